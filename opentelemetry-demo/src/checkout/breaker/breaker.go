@@ -0,0 +1,227 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package breaker stops calling a dependency that keeps failing. After a run
+// of consecutive failures the breaker opens and rejects calls right away, so
+// callers fail fast instead of waiting on a dependency that is down. Once
+// the open timeout has passed it lets a single trial call through, and
+// closes again if that call succeeds.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrOpen is returned by Allow while the breaker rejects calls.
+var ErrOpen = errors.New("breaker: circuit is open")
+
+// State is the state of a breaker.
+type State int
+
+const (
+	// Closed lets every call through.
+	Closed State = iota
+	// HalfOpen lets a single trial call through.
+	HalfOpen
+	// Open rejects every call.
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case HalfOpen:
+		return "half-open"
+	case Open:
+		return "open"
+	}
+	return "unknown"
+}
+
+// Outcome is how a call ended, as far as the breaker is concerned.
+type Outcome int
+
+const (
+	// Success is a call the dependency handled.
+	Success Outcome = iota
+	// Failure is a call that suggests the dependency is unhealthy.
+	Failure
+	// Ignored is a call that says nothing about the dependency, such as one
+	// the caller cancelled. It frees the trial of a half-open breaker
+	// without changing its state.
+	Ignored
+)
+
+// Config controls when a breaker opens and for how long.
+type Config struct {
+	// FailureThreshold is the number of consecutive failures that opens the
+	// breaker. Zero disables the breaker.
+	FailureThreshold int
+	// OpenTimeout is how long the breaker stays open before it lets a trial
+	// call through.
+	OpenTimeout time.Duration
+}
+
+// DefaultConfig returns the settings used by checkout.
+func DefaultConfig() Config {
+	return Config{
+		FailureThreshold: 5,
+		OpenTimeout:      10 * time.Second,
+	}
+}
+
+// Breaker is a circuit breaker for a single dependency. It is safe for
+// concurrent use.
+type Breaker struct {
+	name        string
+	cfg         Config
+	now         func() time.Time
+	attrs       attribute.Set
+	transitions metric.Int64Counter
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	trial    bool
+	// generation changes with every state change, so the outcome of a call
+	// allowed in an earlier state is ignored.
+	generation uint64
+}
+
+// New creates a closed breaker. Its state is exported through meter as the
+// app.breaker.state gauge (0 closed, 1 half-open, 2 open), and every state
+// change is counted by app.breaker.transitions.
+func New(name string, cfg Config, meter metric.Meter) (*Breaker, error) {
+	b := &Breaker{
+		name:  name,
+		cfg:   cfg,
+		now:   time.Now,
+		attrs: attribute.NewSet(attribute.String("app.breaker.name", name)),
+	}
+
+	var err error
+	b.transitions, err = meter.Int64Counter("app.breaker.transitions",
+		metric.WithDescription("Number of circuit breaker state changes"))
+	if err != nil {
+		return nil, err
+	}
+	gauge, err := meter.Int64ObservableGauge("app.breaker.state",
+		metric.WithDescription("Circuit breaker state: 0 closed, 1 half-open, 2 open"))
+	if err != nil {
+		return nil, err
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveInt64(gauge, int64(b.State()), metric.WithAttributeSet(b.attrs))
+		return nil
+	}, gauge)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Name returns the name the breaker was created with.
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State returns the current state. An open breaker whose timeout has passed
+// is reported as open until a call is attempted.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Allow reports whether a call may go ahead. It returns ErrOpen while the
+// breaker rejects calls; otherwise the caller must report the outcome of the
+// call to done. ctx is used to record state changes as events on its span.
+func (b *Breaker) Allow(ctx context.Context) (done func(ctx context.Context, outcome Outcome), err error) {
+	if b.cfg.FailureThreshold <= 0 {
+		return func(context.Context, Outcome) {}, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open {
+		if b.now().Sub(b.openedAt) < b.cfg.OpenTimeout {
+			return nil, b.reject(ctx)
+		}
+		b.setState(ctx, HalfOpen)
+	}
+	if b.state == HalfOpen {
+		if b.trial {
+			return nil, b.reject(ctx)
+		}
+		b.trial = true
+	}
+
+	generation := b.generation
+	return func(ctx context.Context, outcome Outcome) {
+		b.done(ctx, generation, outcome)
+	}, nil
+}
+
+func (b *Breaker) done(ctx context.Context, generation uint64, outcome Outcome) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+	failed := outcome == Failure
+	switch {
+	case outcome == Ignored:
+		// The next call gets to be the trial instead.
+		b.trial = false
+	case b.state == HalfOpen && failed:
+		b.setState(ctx, Open)
+	case b.state == HalfOpen:
+		b.setState(ctx, Closed)
+	case failed:
+		b.failures++
+		if b.failures >= b.cfg.FailureThreshold {
+			b.setState(ctx, Open)
+		}
+	default:
+		b.failures = 0
+	}
+}
+
+func (b *Breaker) reject(ctx context.Context) error {
+	trace.SpanFromContext(ctx).AddEvent("circuit breaker rejected call", trace.WithAttributes(
+		attribute.String("app.breaker.name", b.name),
+		attribute.String("app.breaker.state", b.state.String()),
+	))
+	return ErrOpen
+}
+
+// setState moves the breaker to state. b.mu must be held.
+func (b *Breaker) setState(ctx context.Context, state State) {
+	from := b.state
+	b.state = state
+	b.generation++
+	b.failures = 0
+	b.trial = false
+	if state == Open {
+		b.openedAt = b.now()
+	}
+
+	attrs := []attribute.KeyValue{
+		attribute.String("app.breaker.name", b.name),
+		attribute.String("app.breaker.from", from.String()),
+		attribute.String("app.breaker.to", state.String()),
+	}
+	b.transitions.Add(ctx, 1, metric.WithAttributes(attrs...))
+	trace.SpanFromContext(ctx).AddEvent("circuit breaker state changed", trace.WithAttributes(attrs...))
+}
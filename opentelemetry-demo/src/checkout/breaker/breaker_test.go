@@ -0,0 +1,249 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package breaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func newTestBreaker(t *testing.T, cfg Config) (*Breaker, *fakeClock, *sdkmetric.ManualReader) {
+	t.Helper()
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+	b, err := New("currency", cfg, meter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	b.now = clock.now
+	return b, clock, reader
+}
+
+// call runs a call through b that ends with outcome, and returns the error
+// of Allow.
+func call(b *Breaker, outcome Outcome) error {
+	done, err := b.Allow(context.Background())
+	if err != nil {
+		return err
+	}
+	done(context.Background(), outcome)
+	return nil
+}
+
+func TestBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	b, _, _ := newTestBreaker(t, Config{FailureThreshold: 3, OpenTimeout: time.Second})
+
+	call(b, Failure)
+	call(b, Failure)
+	call(b, Success) // a success resets the count
+	call(b, Failure)
+	call(b, Failure)
+	if got := b.State(); got != Closed {
+		t.Fatalf("State() = %v after 2 consecutive failures, want %v", got, Closed)
+	}
+	call(b, Failure)
+	if got := b.State(); got != Open {
+		t.Fatalf("State() = %v after 3 consecutive failures, want %v", got, Open)
+	}
+	if err := call(b, Success); !errors.Is(err, ErrOpen) {
+		t.Errorf("Allow() = %v while open, want %v", err, ErrOpen)
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	b, clock, _ := newTestBreaker(t, Config{FailureThreshold: 1, OpenTimeout: time.Second})
+	call(b, Failure)
+
+	clock.t = clock.t.Add(time.Second)
+	trial, err := b.Allow(context.Background())
+	if err != nil {
+		t.Fatalf("Allow() = %v after the open timeout, want nil", err)
+	}
+	if got := b.State(); got != HalfOpen {
+		t.Fatalf("State() = %v, want %v", got, HalfOpen)
+	}
+	if err := call(b, Success); !errors.Is(err, ErrOpen) {
+		t.Errorf("Allow() = %v during the trial call, want %v", err, ErrOpen)
+	}
+
+	trial(context.Background(), Failure)
+	if got := b.State(); got != Open {
+		t.Fatalf("State() = %v after a failed trial, want %v", got, Open)
+	}
+
+	clock.t = clock.t.Add(time.Second)
+	if err := call(b, Success); err != nil {
+		t.Fatalf("Allow() = %v after the open timeout, want nil", err)
+	}
+	if got := b.State(); got != Closed {
+		t.Fatalf("State() = %v after a successful trial, want %v", got, Closed)
+	}
+}
+
+func TestBreakerIgnoredTrial(t *testing.T) {
+	b, clock, _ := newTestBreaker(t, Config{FailureThreshold: 1, OpenTimeout: time.Second})
+	call(b, Failure)
+
+	clock.t = clock.t.Add(time.Second)
+	if err := call(b, Ignored); err != nil {
+		t.Fatalf("Allow() = %v after the open timeout, want nil", err)
+	}
+	if got := b.State(); got != HalfOpen {
+		t.Fatalf("State() = %v after a cancelled trial, want %v", got, HalfOpen)
+	}
+	if err := call(b, Success); err != nil {
+		t.Fatalf("Allow() = %v after a cancelled trial, want another trial", err)
+	}
+	if got := b.State(); got != Closed {
+		t.Errorf("State() = %v after a successful trial, want %v", got, Closed)
+	}
+}
+
+func TestBreakerIgnoresOutcomesFromEarlierStates(t *testing.T) {
+	b, _, _ := newTestBreaker(t, Config{FailureThreshold: 1, OpenTimeout: time.Second})
+
+	slow, err := b.Allow(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	call(b, Failure)
+	slow(context.Background(), Success)
+	if got := b.State(); got != Open {
+		t.Errorf("State() = %v, want a success allowed while closed not to close the open breaker", got)
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	b, _, _ := newTestBreaker(t, Config{})
+	for i := 0; i < 10; i++ {
+		if err := call(b, Failure); err != nil {
+			t.Fatalf("Allow() = %v, want a disabled breaker to allow every call", err)
+		}
+	}
+}
+
+func TestBreakerTelemetry(t *testing.T) {
+	b, _, reader := newTestBreaker(t, Config{FailureThreshold: 1, OpenTimeout: time.Minute})
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	ctx, span := tp.Tracer("test").Start(context.Background(), "call")
+	done, err := b.Allow(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done(ctx, Failure)
+	if _, err := b.Allow(ctx); err == nil {
+		t.Fatal("Allow() = nil, want the open breaker to reject the call")
+	}
+	span.End()
+
+	var events []string
+	for _, e := range recorder.Ended()[0].Events() {
+		events = append(events, e.Name)
+	}
+	if len(events) != 2 || events[0] != "circuit breaker state changed" || events[1] != "circuit breaker rejected call" {
+		t.Errorf("span events = %q", events)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	found := map[string]bool{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		switch data := m.Data.(type) {
+		case metricdata.Gauge[int64]:
+			found[m.Name] = true
+			if v := data.DataPoints[0].Value; v != int64(Open) {
+				t.Errorf("%s = %d, want %d", m.Name, v, Open)
+			}
+		case metricdata.Sum[int64]:
+			found[m.Name] = true
+			dp := data.DataPoints[0]
+			to, _ := dp.Attributes.Value(attribute.Key("app.breaker.to"))
+			if dp.Value != 1 || to.AsString() != "open" {
+				t.Errorf("%s = %d with to=%q, want 1 with to=\"open\"", m.Name, dp.Value, to.AsString())
+			}
+		}
+	}
+	if !found["app.breaker.state"] || !found["app.breaker.transitions"] {
+		t.Errorf("collected metrics %v, want app.breaker.state and app.breaker.transitions", found)
+	}
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	b, _, _ := newTestBreaker(t, Config{FailureThreshold: 2, OpenTimeout: time.Minute})
+	intercept := UnaryClientInterceptor(b)
+
+	calls := 0
+	invoke := func(err error) error {
+		return intercept(context.Background(), "/oteldemo.CurrencyService/Convert", nil, nil, nil,
+			func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error {
+				calls++
+				return err
+			})
+	}
+
+	// Errors about the request do not open the breaker, including the
+	// Unknown and Internal errors of a rejected request.
+	for _, code := range []codes.Code{codes.InvalidArgument, codes.Unknown, codes.Internal} {
+		for i := 0; i < 3; i++ {
+			invoke(status.Error(code, "rejected"))
+		}
+		if got := b.State(); got != Closed {
+			t.Fatalf("State() = %v after %v errors, want %v", got, code, Closed)
+		}
+	}
+
+	invoke(status.Error(codes.Unavailable, "down"))
+	invoke(status.Error(codes.DeadlineExceeded, "slow"))
+	calls = 0
+	err := invoke(nil)
+	if status.Code(err) != codes.Unavailable || calls != 0 {
+		t.Errorf("call through an open breaker = %v after %d invocations, want Unavailable without invoking", err, calls)
+	}
+}
+
+func TestUnaryClientInterceptorCancelledTrial(t *testing.T) {
+	b, clock, _ := newTestBreaker(t, Config{FailureThreshold: 1, OpenTimeout: time.Second})
+	intercept := UnaryClientInterceptor(b)
+	invoke := func(ctx context.Context, err error) error {
+		return intercept(ctx, "/oteldemo.CurrencyService/Convert", nil, nil, nil,
+			func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error {
+				return err
+			})
+	}
+
+	invoke(context.Background(), status.Error(codes.Unavailable, "down"))
+	clock.t = clock.t.Add(time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	invoke(ctx, status.FromContextError(ctx.Err()).Err())
+	if got := b.State(); got != HalfOpen {
+		t.Fatalf("State() = %v after a cancelled trial, want %v", got, HalfOpen)
+	}
+	if err := invoke(context.Background(), nil); err != nil {
+		t.Fatalf("call after a cancelled trial = %v, want it to be the next trial", err)
+	}
+	if got := b.State(); got != Closed {
+		t.Errorf("State() = %v after a successful trial, want %v", got, Closed)
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package breaker
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryClientInterceptor guards every call made through a client
+// connection with b. Calls the breaker rejects fail with codes.Unavailable
+// without reaching the server. Only errors that suggest the server is
+// unhealthy count as failures; see IsFailure.
+func UnaryClientInterceptor(b *Breaker) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		done, err := b.Allow(ctx)
+		if err != nil {
+			return status.Errorf(codes.Unavailable, "%s: %v", b.Name(), err)
+		}
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		outcome := Success
+		switch {
+		case err != nil && ctx.Err() == context.Canceled:
+			// A call the caller gave up on says nothing about the server.
+			outcome = Ignored
+		case IsFailure(err):
+			outcome = Failure
+		}
+		done(ctx, outcome)
+		return err
+	}
+}
+
+// IsFailure reports whether err is an error the breaker counts: the server
+// could not be reached, did not answer in time or was overloaded. Errors
+// about the request itself, such as codes.NotFound or codes.InvalidArgument,
+// do not count. Neither do codes.Unknown and codes.Internal, which services
+// such as payment return for requests they reject, like a declined card.
+func IsFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
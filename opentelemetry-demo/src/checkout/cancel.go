@@ -0,0 +1,195 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/cloudevents"
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/db/postgres"
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/outbox"
+)
+
+// defaultCancelLockTimeout is how long a cancellation holds its claim on an
+// order by default. It outlasts the calls made to cancel the order, so only
+// the claims of cancellations that died are taken over.
+const defaultCancelLockTimeout = time.Minute
+
+// CancelOrder cancels a placed order. The order is claimed first, so
+// concurrent calls cannot refund it twice, and the claim is released when
+// the shipment or the refund fails so the call can be retried. A claim
+// older than cancelLockTimeout is taken over, so a cancellation that failed
+// after the refund is finished by a later call. Calls for an order that is
+// already cancelled return the result of the cancellation.
+func (cs *checkout) CancelOrder(ctx context.Context, req *pb.CancelOrderRequest) (*pb.CancelOrderResponse, error) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.String("app.order.id", req.OrderId))
+
+	if cs.orders == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "order storage is not configured")
+	}
+	if req.OrderId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "order_id is required")
+	}
+	log.Infof("[CancelOrder] order_id=%q reason=%q", req.OrderId, req.Reason)
+
+	order, err := cs.orders.GetOrder(ctx, req.OrderId)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get order: %+v", err)
+	}
+	if order == nil || (req.UserId != "" && order.UserID != req.UserId) {
+		return nil, status.Errorf(codes.NotFound, "order %q not found", req.OrderId)
+	}
+
+	if order.Status == postgres.OrderStatusPlaced || order.Status == postgres.OrderStatusCancelling {
+		claim, err := cs.orders.BeginCancel(ctx, order.ID, cs.cancelLockTimeout)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to claim order: %+v", err)
+		}
+		if claim != nil {
+			span.SetAttributes(
+				attribute.Bool("app.order.cancel.replay", false),
+				attribute.Bool("app.order.cancel.takeover", order.Status == postgres.OrderStatusCancelling),
+			)
+			return cs.cancelOrder(ctx, order, claim, req)
+		}
+		// Another call got to the order first; report what it did.
+		if order, err = cs.orders.GetOrder(ctx, req.OrderId); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to get order: %+v", err)
+		}
+		if order == nil {
+			return nil, status.Errorf(codes.NotFound, "order %q not found", req.OrderId)
+		}
+	}
+
+	switch order.Status {
+	case postgres.OrderStatusCancelled:
+		span.SetAttributes(attribute.Bool("app.order.cancel.replay", true))
+		log.Infof("[CancelOrder] order %q is already cancelled", order.ID)
+		return cancelOrderResponse(order), nil
+	case postgres.OrderStatusCancelling:
+		return nil, status.Errorf(codes.Aborted, "order %q is already being cancelled", order.ID)
+	default:
+		return nil, status.Errorf(codes.FailedPrecondition, "order %q cannot be cancelled in status %q", order.ID, order.Status)
+	}
+}
+
+// cancelOrder cancels an order claimed with BeginCancel. The shipment is
+// cancelled before the charge is refunded, so an order whose shipment
+// cannot be stopped is not refunded. Both are skipped when the claim was
+// taken over from a call that already refunded the order.
+func (cs *checkout) cancelOrder(ctx context.Context, order *postgres.Order, claim *postgres.CancelClaim, req *pb.CancelOrderRequest) (*pb.CancelOrderResponse, error) {
+	span := trace.SpanFromContext(ctx)
+
+	// The order is released or recorded even if the caller has gone away,
+	// so it is not left claimed.
+	storeCtx := context.WithoutCancel(ctx)
+	abandon := func() {
+		if err := cs.orders.AbandonCancel(storeCtx, order.ID, claim); err != nil {
+			log.Errorf("failed to release order %q after a failed cancellation: %+v", order.ID, err)
+		}
+	}
+
+	refunded := fromMoneyRow(order.Total)
+	if claim.Refunded {
+		span.AddEvent("already refunded")
+	} else {
+		if order.ShippingTrackingID != "" {
+			if err := cs.cancelShipment(ctx, order.ShippingTrackingID); err != nil {
+				abandon()
+				return nil, status.Errorf(codes.Unavailable, "shipping error: %+v", err)
+			}
+			span.AddEvent("shipment cancelled",
+				trace.WithAttributes(attribute.String("app.shipping.tracking.id", order.ShippingTrackingID)))
+		}
+
+		refundID, err := cs.refundCharge(ctx, order.TransactionID, refunded)
+		if err != nil {
+			abandon()
+			return nil, status.Errorf(codes.Unavailable, "payment error: %+v", err)
+		}
+		span.AddEvent("refunded", trace.WithAttributes(
+			attribute.String("app.payment.transaction.id", order.TransactionID),
+			attribute.String("app.payment.refund.id", refundID),
+		))
+		// From here on the claim is kept when something fails: the call that
+		// takes it over completes the cancellation without refunding again.
+		if err := cs.orders.RecordRefund(storeCtx, order.ID, claim, refundID); err != nil {
+			log.Errorf("order %q was refunded but the refund could not be recorded: %+v", order.ID, err)
+			return nil, status.Errorf(codes.Internal, "failed to record refund: %+v", err)
+		}
+	}
+	if cs.inventorySvcClient != nil {
+		// Releasing is a no-op for a reservation that is already released,
+		// so a call that took the claim over releases it as well.
+		if err := cs.releaseStock(ctx, order.ID); err != nil {
+			log.Warnf("failed to return the stock of cancelled order %q: %+v", order.ID, err)
+		}
+	}
+
+	cancelledAt := time.Now().UTC()
+	message, headers, err := cs.events.Encode(cloudevents.TypeOrderCancelled, order.ID, &pb.OrderCancelled{
+		OrderId:            order.ID,
+		UserId:             order.UserID,
+		Reason:             req.Reason,
+		Refunded:           refunded,
+		ShippingTrackingId: order.ShippingTrackingID,
+		CancelledAt:        timestamppb.New(cancelledAt),
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to marshal cancellation event: %+v", err)
+	}
+	var events []*postgres.OutboxEvent
+	if cs.useOutbox {
+		events = append(events, outbox.NewEvent(ctx, cs.kafkaCancelledTopic, order.ID, message, headers))
+	}
+	if err := cs.orders.CompleteCancel(storeCtx, order.ID, claim, req.Reason, events...); err != nil {
+		log.Errorf("order %q was refunded but could not be marked cancelled: %+v", order.ID, err)
+		return nil, status.Errorf(codes.Internal, "failed to store cancellation: %+v", err)
+	}
+	span.AddEvent("cancelled")
+
+	if req.RestoreCart {
+		items := make([]*pb.CartItem, len(order.Items))
+		for i, it := range order.Items {
+			items[i] = &pb.CartItem{ProductId: it.ProductID, Quantity: it.Quantity}
+		}
+		if err := cs.restoreUserCart(ctx, order.UserID, items); err != nil {
+			log.Warnf("failed to restore the cart of cancelled order %q: %+v", order.ID, err)
+		}
+	}
+
+	if cs.kafkaBrokerSvcAddr != "" {
+		if cs.useOutbox {
+			log.Infof("cancellation event queued in outbox")
+		} else {
+			cs.publish(ctx, &sarama.ProducerMessage{
+				Topic:   cs.kafkaCancelledTopic,
+				Key:     sarama.StringEncoder(order.ID),
+				Value:   sarama.ByteEncoder(message),
+				Headers: kafkaHeaders(headers),
+			})
+		}
+	}
+
+	order.Status = postgres.OrderStatusCancelled
+	order.CancelReason = req.Reason
+	order.CancelledAt = &cancelledAt
+	return cancelOrderResponse(order), nil
+}
+
+func cancelOrderResponse(order *postgres.Order) *pb.CancelOrderResponse {
+	return &pb.CancelOrderResponse{
+		Order:    toOrderRecord(order),
+		Refunded: fromMoneyRow(order.Total),
+	}
+}
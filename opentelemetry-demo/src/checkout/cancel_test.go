@@ -0,0 +1,317 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/cloudevents"
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/db/postgres"
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/kafka"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/money"
+)
+
+// placeTestOrder places the test order with stored orders and returns its ID.
+func placeTestOrder(t *testing.T, f *fakes, svc *checkout) string {
+	t.Helper()
+	f.cart.items[testUserID] = testCart()
+	if svc.orders == nil {
+		svc.orders = &fakeOrders{}
+	}
+	resp, err := svc.PlaceOrder(context.Background(), testOrderRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.GetOrder().GetOrderId()
+}
+
+func cancelledFromEvent(t *testing.T, headers map[string]string, payload []byte) *pb.OrderCancelled {
+	t.Helper()
+	cancelled := new(pb.OrderCancelled)
+	if event := decodeEvent(t, headers, payload, cancelled); event.Type != cloudevents.TypeOrderCancelled {
+		t.Errorf("event type = %q, want %q", event.Type, cloudevents.TypeOrderCancelled)
+	}
+	return cancelled
+}
+
+func TestCancelOrder(t *testing.T) {
+	f := newFakes()
+	svc := startFakes(t, f)
+	orders := &fakeOrders{}
+	svc.orders = orders
+	svc.useOutbox = true
+	svc.kafkaBrokerSvcAddr = "kafka:9092"
+	svc.kafkaTopic = "orders"
+	svc.kafkaCancelledTopic = "order_cancelled"
+	orderID := placeTestOrder(t, f, svc)
+
+	req := &pb.CancelOrderRequest{OrderId: orderID, UserId: testUserID, Reason: "changed my mind"}
+	resp, err := svc.CancelOrder(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !money.AreEquals(resp.GetRefunded(), wantTotal) {
+		t.Errorf("refunded %v, want %v", resp.GetRefunded(), wantTotal)
+	}
+	if record := resp.GetOrder(); record.GetStatus() != postgres.OrderStatusCancelled || record.GetCancelReason() != "changed my mind" || record.GetCancelledAt() == nil {
+		t.Errorf("unexpected order record: %v", record)
+	}
+	if len(f.shipping.cancelled) != 1 || f.shipping.cancelled[0] != "TRACK-1" {
+		t.Errorf("cancelled shipments = %v, want TRACK-1", f.shipping.cancelled)
+	}
+	if len(f.payment.refunds) != 1 || f.payment.refunds[0].GetTransactionId() != "TX-1" || !money.AreEquals(f.payment.refunds[0].GetAmount(), wantTotal) {
+		t.Errorf("unexpected refunds: %v", f.payment.refunds)
+	}
+
+	// The order event and the cancellation event.
+	if len(orders.events) != 2 {
+		t.Fatalf("got %d outbox events, want 2", len(orders.events))
+	}
+	event := orders.events[1]
+	if event.Topic != "order_cancelled" || event.Key != orderID {
+		t.Errorf("cancellation event on %q with key %q, want order_cancelled and the order ID", event.Topic, event.Key)
+	}
+	if got := cancelledFromEvent(t, event.Headers, event.Payload); got.GetOrderId() != orderID || got.GetReason() != "changed my mind" || !money.AreEquals(got.GetRefunded(), wantTotal) {
+		t.Errorf("unexpected cancellation event: %v", got)
+	}
+
+	// A repeated call reports the cancellation without undoing anything again.
+	again, err := svc.CancelOrder(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !money.AreEquals(again.GetRefunded(), wantTotal) || again.GetOrder().GetStatus() != postgres.OrderStatusCancelled {
+		t.Errorf("repeated CancelOrder() = %v, want the first cancellation", again)
+	}
+	if len(f.payment.refunds) != 1 || len(f.shipping.cancelled) != 1 || len(orders.events) != 2 {
+		t.Errorf("repeated CancelOrder() refunded, cancelled or published again")
+	}
+}
+
+func TestCancelOrderRestoresCart(t *testing.T) {
+	f := newFakes()
+	svc := startFakes(t, f)
+	orderID := placeTestOrder(t, f, svc)
+
+	if _, err := svc.CancelOrder(context.Background(), &pb.CancelOrderRequest{OrderId: orderID, RestoreCart: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.cart.cartOf(testUserID); len(got) != len(testCart()) || got[0].GetProductId() != "OLJCESPC7Z" || got[0].GetQuantity() != 2 {
+		t.Errorf("cart after cancelling = %v, want the items of the order", got)
+	}
+}
+
+func TestCancelOrderReleasesStock(t *testing.T) {
+	f := newFakes()
+	f.inventory = newFakeInventory(map[string]int64{"OLJCESPC7Z": 5})
+	svc := startFakes(t, f)
+	orderID := placeTestOrder(t, f, svc)
+	if got := f.inventory.available("OLJCESPC7Z"); got != 3 {
+		t.Fatalf("available telescopes after the order = %d, want 3", got)
+	}
+
+	if _, err := svc.CancelOrder(context.Background(), &pb.CancelOrderRequest{OrderId: orderID}); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.inventory.available("OLJCESPC7Z"); got != 5 {
+		t.Errorf("available telescopes after cancelling = %d, want 5", got)
+	}
+	if len(f.inventory.released) != 1 || f.inventory.released[0] != orderID {
+		t.Errorf("released reservations = %v, want [%s]", f.inventory.released, orderID)
+	}
+}
+
+func TestCancelOrderErrors(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "service unavailable")
+
+	tests := []struct {
+		name       string
+		setup      func(f *fakes, svc *checkout, orderID string)
+		req        func(orderID string) *pb.CancelOrderRequest
+		wantCode   codes.Code
+		wantStatus string
+	}{
+		{
+			name:       "UnknownOrder",
+			req:        func(string) *pb.CancelOrderRequest { return &pb.CancelOrderRequest{OrderId: "missing"} },
+			wantCode:   codes.NotFound,
+			wantStatus: postgres.OrderStatusPlaced,
+		},
+		{
+			name: "OtherUser",
+			req: func(orderID string) *pb.CancelOrderRequest {
+				return &pb.CancelOrderRequest{OrderId: orderID, UserId: "someone-else"}
+			},
+			wantCode:   codes.NotFound,
+			wantStatus: postgres.OrderStatusPlaced,
+		},
+		{
+			name: "ShipmentNotCancelled",
+			setup: func(f *fakes, svc *checkout, orderID string) {
+				f.shipping.cancelError = status.Error(codes.FailedPrecondition, "already delivered")
+			},
+			wantCode:   codes.Unavailable,
+			wantStatus: postgres.OrderStatusPlaced,
+		},
+		{
+			name: "RefundFails",
+			setup: func(f *fakes, svc *checkout, orderID string) {
+				f.payment.refundErr = unavailable
+			},
+			wantCode:   codes.Unavailable,
+			wantStatus: postgres.OrderStatusPlaced,
+		},
+		{
+			name: "AlreadyBeingCancelled",
+			setup: func(f *fakes, svc *checkout, orderID string) {
+				svc.orders.BeginCancel(context.Background(), orderID, time.Minute)
+			},
+			wantCode:   codes.Aborted,
+			wantStatus: postgres.OrderStatusCancelling,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakes()
+			svc := startFakes(t, f)
+			orderID := placeTestOrder(t, f, svc)
+			if tt.setup != nil {
+				tt.setup(f, svc, orderID)
+			}
+			req := &pb.CancelOrderRequest{OrderId: orderID}
+			if tt.req != nil {
+				req = tt.req(orderID)
+			}
+
+			_, err := svc.CancelOrder(context.Background(), req)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("CancelOrder() error = %v, want code %v", err, tt.wantCode)
+			}
+			order, _ := svc.orders.GetOrder(context.Background(), orderID)
+			if order.Status != tt.wantStatus {
+				t.Errorf("order status = %q, want %q", order.Status, tt.wantStatus)
+			}
+			if len(f.payment.refunds) != 0 {
+				t.Errorf("failed CancelOrder() refunded %v", f.payment.refunds)
+			}
+		})
+	}
+}
+
+func TestCancelOrderTakesOverExpiredClaim(t *testing.T) {
+	t.Run("NotRefunded", func(t *testing.T) {
+		// The call holding the claim died before it refunded the order.
+		f := newFakes()
+		svc := startFakes(t, f)
+		orderID := placeTestOrder(t, f, svc)
+		if _, err := svc.orders.BeginCancel(context.Background(), orderID, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+
+		svc.cancelLockTimeout = 0
+		resp, err := svc.CancelOrder(context.Background(), &pb.CancelOrderRequest{OrderId: orderID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.GetOrder().GetStatus() != postgres.OrderStatusCancelled {
+			t.Errorf("order status = %q, want %q", resp.GetOrder().GetStatus(), postgres.OrderStatusCancelled)
+		}
+		if len(f.payment.refunds) != 1 || len(f.shipping.cancelled) != 1 {
+			t.Errorf("got %d refunds and %d cancelled shipments, want 1 of each", len(f.payment.refunds), len(f.shipping.cancelled))
+		}
+	})
+
+	t.Run("Refunded", func(t *testing.T) {
+		// The call holding the claim refunded the order but could not mark
+		// it cancelled.
+		f := newFakes()
+		svc := startFakes(t, f)
+		orders := &fakeOrders{completeErr: errors.New("connection reset")}
+		svc.orders = orders
+		orderID := placeTestOrder(t, f, svc)
+		req := &pb.CancelOrderRequest{OrderId: orderID, Reason: "changed my mind"}
+
+		if _, err := svc.CancelOrder(context.Background(), req); status.Code(err) != codes.Internal {
+			t.Fatalf("CancelOrder() error = %v, want Internal", err)
+		}
+		orders.completeErr = nil
+		if _, err := svc.CancelOrder(context.Background(), req); status.Code(err) != codes.Aborted {
+			t.Fatalf("CancelOrder() before the claim expired error = %v, want Aborted", err)
+		}
+
+		svc.cancelLockTimeout = 0
+		resp, err := svc.CancelOrder(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record := resp.GetOrder(); record.GetStatus() != postgres.OrderStatusCancelled || record.GetCancelReason() != "changed my mind" {
+			t.Errorf("unexpected order record: %v", record)
+		}
+		if !money.AreEquals(resp.GetRefunded(), wantTotal) {
+			t.Errorf("refunded %v, want %v", resp.GetRefunded(), wantTotal)
+		}
+		if len(f.payment.refunds) != 1 || len(f.shipping.cancelled) != 1 {
+			t.Errorf("got %d refunds and %d cancelled shipments, want 1 of each", len(f.payment.refunds), len(f.shipping.cancelled))
+		}
+		if orders.refunds[orderID] != "REFUND-1" {
+			t.Errorf("recorded refund = %q, want REFUND-1", orders.refunds[orderID])
+		}
+	})
+}
+
+func TestCancelOrderWithoutStorage(t *testing.T) {
+	svc := startFakes(t, newFakes())
+	_, err := svc.CancelOrder(context.Background(), &pb.CancelOrderRequest{OrderId: "order-1"})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("CancelOrder() error = %v, want FailedPrecondition", err)
+	}
+}
+
+func TestCancelOrderKafka(t *testing.T) {
+	f := newFakes()
+	svc := startFakes(t, f)
+	orderID := placeTestOrder(t, f, svc)
+
+	config := mocks.NewTestConfig()
+	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
+	mock := mocks.NewAsyncProducer(t, config)
+	published := make(chan *sarama.ProducerMessage, 1)
+	mock.ExpectInputWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		published <- msg
+		return nil
+	})
+	producer := kafka.NewProducer(mock, log)
+	defer producer.Close()
+	svc.kafkaBrokerSvcAddr = "kafka:9092"
+	svc.kafkaCancelledTopic = "order_cancelled"
+	svc.KafkaProducerClient = producer
+
+	if _, err := svc.CancelOrder(context.Background(), &pb.CancelOrderRequest{OrderId: orderID, Reason: "duplicate"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-published:
+		if msg.Topic != "order_cancelled" {
+			t.Errorf("published to %q, want order_cancelled", msg.Topic)
+		}
+		payload, err := msg.Value.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cancelledFromEvent(t, recordHeaders(msg.Headers), payload); got.GetOrderId() != orderID || got.GetReason() != "duplicate" {
+			t.Errorf("unexpected cancellation event: %v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no cancellation event was published")
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"google.golang.org/grpc"
+
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/breaker"
+)
+
+// clientConfig controls how checkout calls one of the services it depends
+// on.
+type clientConfig struct {
+	// Timeout bounds each call, retries included. A sooner deadline of the
+	// PlaceOrder call still applies. Zero leaves calls without a timeout of
+	// their own.
+	Timeout time.Duration
+	// RetryMaxAttempts is the number of attempts a call that fails with
+	// codes.Unavailable gets, the first one included; gRPC allows at most 5.
+	// One disables retries.
+	RetryMaxAttempts    int
+	RetryInitialBackoff time.Duration
+	RetryMaxBackoff     time.Duration
+	Breaker             breaker.Config
+}
+
+// clientConfigs holds the settings of every gRPC client of checkout.
+type clientConfigs struct {
+	ProductCatalog clientConfig
+	Cart           clientConfig
+	Currency       clientConfig
+	Shipping       clientConfig
+	Payment        clientConfig
+	Inventory      clientConfig
+}
+
+// defaultClientConfigs returns the settings used when the environment does
+// not override them. Only the read-only catalog and currency calls, and the
+// inventory calls, which are keyed by order, are retried by default:
+// retrying a charge, a shipment or a cart update that reached the server
+// could apply it twice.
+func defaultClientConfigs() clientConfigs {
+	base := clientConfig{
+		Timeout:             2 * time.Second,
+		RetryMaxAttempts:    1,
+		RetryInitialBackoff: 100 * time.Millisecond,
+		RetryMaxBackoff:     time.Second,
+		Breaker:             breaker.DefaultConfig(),
+	}
+	cfgs := clientConfigs{
+		ProductCatalog: base,
+		Cart:           base,
+		Currency:       base,
+		Shipping:       base,
+		Payment:        base,
+		Inventory:      base,
+	}
+	cfgs.ProductCatalog.RetryMaxAttempts = 3
+	cfgs.Currency.RetryMaxAttempts = 3
+	cfgs.Inventory.RetryMaxAttempts = 3
+	cfgs.Shipping.Timeout = 3 * time.Second
+	cfgs.Payment.Timeout = 5 * time.Second
+	return cfgs
+}
+
+// clientConfigsFromEnv reads the settings of each client from environment
+// variables named after the client's *_ADDR variable, for example
+// CURRENCY_TIMEOUT or PAYMENT_BREAKER_FAILURES, on top of
+// defaultClientConfigs, and validates them.
+func clientConfigsFromEnv() (clientConfigs, error) {
+	return clientConfigsFromLookup(os.LookupEnv)
+}
+
+func clientConfigsFromLookup(lookup func(string) (string, bool)) (clientConfigs, error) {
+	cfgs := defaultClientConfigs()
+	var errs []error
+	for _, c := range []struct {
+		prefix string
+		cfg    *clientConfig
+	}{
+		{"PRODUCT_CATALOG", &cfgs.ProductCatalog},
+		{"CART", &cfgs.Cart},
+		{"CURRENCY", &cfgs.Currency},
+		{"SHIPPING", &cfgs.Shipping},
+		{"PAYMENT", &cfgs.Payment},
+		{"INVENTORY", &cfgs.Inventory},
+	} {
+		if err := c.cfg.load(c.prefix, lookup); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return cfgs, fmt.Errorf("invalid client configuration: %w", err)
+	}
+	return cfgs, nil
+}
+
+func (c *clientConfig) load(prefix string, lookup func(string) (string, bool)) error {
+	var errs []error
+	parse := func(key string, fn func(string) error) {
+		key = prefix + "_" + key
+		if value, ok := lookup(key); ok && strings.TrimSpace(value) != "" {
+			if err := fn(strings.TrimSpace(value)); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			}
+		}
+	}
+	parseDuration := func(key string, target *time.Duration) {
+		parse(key, func(value string) (err error) {
+			*target, err = time.ParseDuration(value)
+			return err
+		})
+	}
+	parseInt := func(key string, target *int) {
+		parse(key, func(value string) (err error) {
+			*target, err = strconv.Atoi(value)
+			return err
+		})
+	}
+
+	parseDuration("TIMEOUT", &c.Timeout)
+	parseInt("RETRY_MAX_ATTEMPTS", &c.RetryMaxAttempts)
+	parseDuration("RETRY_INITIAL_BACKOFF", &c.RetryInitialBackoff)
+	parseDuration("RETRY_MAX_BACKOFF", &c.RetryMaxBackoff)
+	parseInt("BREAKER_FAILURES", &c.Breaker.FailureThreshold)
+	parseDuration("BREAKER_OPEN_TIMEOUT", &c.Breaker.OpenTimeout)
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	if c.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("%s_TIMEOUT: must not be negative", prefix))
+	}
+	if c.RetryMaxAttempts < 1 || c.RetryMaxAttempts > 5 {
+		errs = append(errs, fmt.Errorf("%s_RETRY_MAX_ATTEMPTS: must be between 1 and 5, got %d", prefix, c.RetryMaxAttempts))
+	}
+	if c.RetryMaxAttempts > 1 {
+		if c.RetryInitialBackoff <= 0 {
+			errs = append(errs, fmt.Errorf("%s_RETRY_INITIAL_BACKOFF: must be positive", prefix))
+		}
+		if c.RetryMaxBackoff < c.RetryInitialBackoff {
+			errs = append(errs, fmt.Errorf("%s_RETRY_MAX_BACKOFF: must not be less than %s_RETRY_INITIAL_BACKOFF", prefix, prefix))
+		}
+	}
+	if c.Breaker.FailureThreshold < 0 {
+		errs = append(errs, fmt.Errorf("%s_BREAKER_FAILURES: must not be negative", prefix))
+	}
+	if c.Breaker.FailureThreshold > 0 && c.Breaker.OpenTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("%s_BREAKER_OPEN_TIMEOUT: must be positive", prefix))
+	}
+	return errors.Join(errs...)
+}
+
+// serviceConfig returns the gRPC service config that applies the timeout
+// and retry policy to every method of service.
+func (c clientConfig) serviceConfig(service string) string {
+	type retryPolicy struct {
+		MaxAttempts          int      `json:"maxAttempts"`
+		InitialBackoff       string   `json:"initialBackoff"`
+		MaxBackoff           string   `json:"maxBackoff"`
+		BackoffMultiplier    float64  `json:"backoffMultiplier"`
+		RetryableStatusCodes []string `json:"retryableStatusCodes"`
+	}
+	type methodConfig struct {
+		Name        []map[string]string `json:"name"`
+		Timeout     string              `json:"timeout,omitempty"`
+		RetryPolicy *retryPolicy        `json:"retryPolicy,omitempty"`
+	}
+
+	mc := methodConfig{Name: []map[string]string{{"service": service}}}
+	if c.Timeout > 0 {
+		mc.Timeout = durationJSON(c.Timeout)
+	}
+	if c.RetryMaxAttempts > 1 {
+		mc.RetryPolicy = &retryPolicy{
+			MaxAttempts:          c.RetryMaxAttempts,
+			InitialBackoff:       durationJSON(c.RetryInitialBackoff),
+			MaxBackoff:           durationJSON(c.RetryMaxBackoff),
+			BackoffMultiplier:    2,
+			RetryableStatusCodes: []string{"UNAVAILABLE"},
+		}
+	}
+	config, _ := json.Marshal(map[string][]methodConfig{"methodConfig": {mc}})
+	return string(config)
+}
+
+// dialOptions returns the options that apply c to a client of service.
+func (c clientConfig) dialOptions(service string) ([]grpc.DialOption, error) {
+	b, err := breaker.New(service, c.Breaker, otel.Meter("checkout"))
+	if err != nil {
+		return nil, err
+	}
+	return []grpc.DialOption{
+		grpc.WithDefaultServiceConfig(c.serviceConfig(service)),
+		grpc.WithChainUnaryInterceptor(breaker.UnaryClientInterceptor(b)),
+	}, nil
+}
+
+// durationJSON formats d the way the service config expects durations, as
+// seconds with an "s" suffix.
+func durationJSON(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
@@ -0,0 +1,194 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+)
+
+func mapLookup(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+}
+
+func TestClientConfigsFromLookup(t *testing.T) {
+	cfgs, err := clientConfigsFromLookup(mapLookup(map[string]string{
+		"CURRENCY_TIMEOUT":               "500ms",
+		"CURRENCY_RETRY_MAX_ATTEMPTS":    "5",
+		"CURRENCY_RETRY_INITIAL_BACKOFF": "10ms",
+		"CURRENCY_RETRY_MAX_BACKOFF":     "100ms",
+		"PAYMENT_BREAKER_FAILURES":       "0",
+		"SHIPPING_BREAKER_OPEN_TIMEOUT":  "1m",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := defaultClientConfigs()
+	want.Currency.Timeout = 500 * time.Millisecond
+	want.Currency.RetryMaxAttempts = 5
+	want.Currency.RetryInitialBackoff = 10 * time.Millisecond
+	want.Currency.RetryMaxBackoff = 100 * time.Millisecond
+	want.Payment.Breaker.FailureThreshold = 0
+	want.Shipping.Breaker.OpenTimeout = time.Minute
+	if cfgs != want {
+		t.Errorf("clientConfigsFromLookup() = %+v, want %+v", cfgs, want)
+	}
+}
+
+func TestClientConfigsFromLookupErrors(t *testing.T) {
+	_, err := clientConfigsFromLookup(mapLookup(map[string]string{
+		"CART_TIMEOUT":                 "soon",
+		"CURRENCY_RETRY_MAX_ATTEMPTS":  "6",
+		"PAYMENT_BREAKER_OPEN_TIMEOUT": "0s",
+		"SHIPPING_RETRY_MAX_ATTEMPTS":  "2",
+		"SHIPPING_RETRY_MAX_BACKOFF":   "1ms",
+	}))
+	if err == nil {
+		t.Fatal("clientConfigsFromLookup() = nil, want an error")
+	}
+	for _, key := range []string{"CART_TIMEOUT", "CURRENCY_RETRY_MAX_ATTEMPTS", "PAYMENT_BREAKER_OPEN_TIMEOUT", "SHIPPING_RETRY_MAX_BACKOFF"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("error %q does not mention %s", err, key)
+		}
+	}
+}
+
+func TestServiceConfig(t *testing.T) {
+	cfg := clientConfig{
+		Timeout:             1500 * time.Millisecond,
+		RetryMaxAttempts:    3,
+		RetryInitialBackoff: 100 * time.Millisecond,
+		RetryMaxBackoff:     time.Second,
+	}
+	var got struct {
+		MethodConfig []struct {
+			Name        []map[string]string
+			Timeout     string
+			RetryPolicy *struct {
+				MaxAttempts          int
+				InitialBackoff       string
+				MaxBackoff           string
+				RetryableStatusCodes []string
+			}
+		}
+	}
+	if err := json.Unmarshal([]byte(cfg.serviceConfig("oteldemo.CurrencyService")), &got); err != nil {
+		t.Fatal(err)
+	}
+	mc := got.MethodConfig[0]
+	if mc.Name[0]["service"] != "oteldemo.CurrencyService" || mc.Timeout != "1.5s" {
+		t.Errorf("method config = %+v", mc)
+	}
+	if p := mc.RetryPolicy; p == nil || p.MaxAttempts != 3 || p.InitialBackoff != "0.1s" || p.MaxBackoff != "1s" || p.RetryableStatusCodes[0] != "UNAVAILABLE" {
+		t.Errorf("retry policy = %+v", p)
+	}
+
+	cfg.RetryMaxAttempts = 1
+	if strings.Contains(cfg.serviceConfig("oteldemo.PaymentService"), "retryPolicy") {
+		t.Error("service config has a retry policy with retries disabled")
+	}
+}
+
+func TestPlaceOrderRetriesUnavailableDependency(t *testing.T) {
+	f := newFakes()
+	f.cart.items[testUserID] = testCart()
+	f.currency.unavailable = 2
+	svc := startFakes(t, f)
+
+	if _, err := svc.PlaceOrder(context.Background(), testOrderRequest()); err != nil {
+		t.Fatalf("PlaceOrder() error = %v, want the currency calls to be retried", err)
+	}
+}
+
+func TestPlaceOrderTimesOutSlowDependency(t *testing.T) {
+	f := newFakes()
+	f.cart.items[testUserID] = testCart()
+	f.payment.charging = make(chan struct{}, 1)
+	f.payment.release = make(chan struct{})
+	clients := defaultClientConfigs()
+	clients.Payment.Timeout = 50 * time.Millisecond
+	svc := startFakesWithClients(t, f, clients)
+
+	start := time.Now()
+	_, err := svc.PlaceOrder(context.Background(), testOrderRequest())
+	if err == nil {
+		t.Fatal("PlaceOrder() error = nil, want the charge to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("PlaceOrder() took %v, want it to give up after the payment timeout", elapsed)
+	}
+}
+
+func TestPlaceOrderDeadlineBoundsCalls(t *testing.T) {
+	f := newFakes()
+	f.cart.items[testUserID] = testCart()
+	f.payment.charging = make(chan struct{}, 1)
+	f.payment.release = make(chan struct{})
+	svc := startFakes(t, f)
+	svc.placeOrderTimeout = 50 * time.Millisecond
+
+	_, err := svc.PlaceOrder(context.Background(), testOrderRequest())
+	if err == nil || !strings.Contains(err.Error(), codes.DeadlineExceeded.String()) {
+		t.Errorf("PlaceOrder() error = %v, want the charge to hit the PlaceOrder deadline", err)
+	}
+}
+
+func TestPlaceOrderDeclinesKeepBreakerClosed(t *testing.T) {
+	f := newFakes()
+	f.cart.items[testUserID] = testCart()
+	// The payment service reports a declined card as UNKNOWN.
+	f.payment.chargeErr = status.Error(codes.Unknown, "Credit card info is invalid.")
+	clients := defaultClientConfigs()
+	clients.Payment.Breaker.FailureThreshold = 2
+	svc := startFakesWithClients(t, f, clients)
+
+	for i := 0; i < 4; i++ {
+		if _, err := svc.PlaceOrder(context.Background(), testOrderRequest()); err == nil {
+			t.Fatal("PlaceOrder() error = nil, want the charge to be declined")
+		}
+	}
+	f.payment.mu.Lock()
+	calls := f.payment.calls
+	f.payment.mu.Unlock()
+	if calls != 4 {
+		t.Errorf("payment service got %d calls, want every decline to reach it", calls)
+	}
+}
+
+func TestPlaceOrderBreakerFailsFast(t *testing.T) {
+	f := newFakes()
+	f.cart.items[testUserID] = testCart()
+	f.payment.chargeErr = status.Error(codes.Unavailable, "payment service unavailable")
+	clients := defaultClientConfigs()
+	clients.Payment.Breaker.FailureThreshold = 2
+	svc := startFakesWithClients(t, f, clients)
+
+	for i := 0; i < 3; i++ {
+		if _, err := svc.PlaceOrder(context.Background(), testOrderRequest()); err == nil {
+			t.Fatal("PlaceOrder() error = nil, want the charge to fail")
+		}
+	}
+	f.payment.mu.Lock()
+	calls := f.payment.calls
+	f.payment.mu.Unlock()
+	if calls != 2 {
+		t.Errorf("payment service got %d calls, want the open breaker to stop the third", calls)
+	}
+
+	_, err := svc.PlaceOrder(context.Background(), testOrderRequest())
+	if !strings.Contains(err.Error(), pb.PaymentService_ServiceDesc.ServiceName) {
+		t.Errorf("PlaceOrder() error = %v, want it to name the open breaker", err)
+	}
+}
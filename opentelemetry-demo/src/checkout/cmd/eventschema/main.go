@@ -0,0 +1,105 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+// Command eventschema checks that the payloads of the order events checkout
+// publishes are still compatible with the baseline checked in next to
+// demo.proto. Run it from src/checkout after changing demo.proto:
+//
+//	go run ./cmd/eventschema           # report changes, exit 1 if any break consumers
+//	go run ./cmd/eventschema -update   # accept the current payloads as the baseline
+//
+// A breaking change needs a new version of the event type, in the
+// cloudevents package, before the baseline is updated.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/cloudevents"
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+)
+
+const defaultBaseline = "../../pb/order-events.baseline.json"
+
+// payloads are the messages carried by each event type.
+var payloads = []struct {
+	eventType string
+	message   protoreflect.MessageDescriptor
+}{
+	{cloudevents.TypeOrderPlaced, (&pb.OrderResult{}).ProtoReflect().Descriptor()},
+	{cloudevents.TypeOrderCancelled, (&pb.OrderCancelled{}).ProtoReflect().Descriptor()},
+}
+
+func main() {
+	baseline := flag.String("baseline", defaultBaseline, "path of the baseline")
+	update := flag.Bool("update", false, "write the current payloads to the baseline instead of checking them")
+	flag.Parse()
+
+	if *update {
+		if err := writeBaseline(*baseline); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		fmt.Printf("wrote %s\n", *baseline)
+		return
+	}
+	compatible, err := check(os.Stdout, *baseline)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if !compatible {
+		os.Exit(1)
+	}
+}
+
+func writeBaseline(path string) error {
+	messages := make([]protoreflect.MessageDescriptor, len(payloads))
+	for i, p := range payloads {
+		messages[i] = p.message
+	}
+	data, err := cloudevents.MarshalBaseline(messages...)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// check writes the changes of each payload since the baseline to w and
+// reports whether none of them is breaking. A payload missing from the
+// baseline, because it is new or was renamed, counts as breaking until the
+// baseline is updated.
+func check(w io.Writer, path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	files, err := cloudevents.UnmarshalBaseline(data)
+	if err != nil {
+		return false, err
+	}
+
+	compatible := true
+	for _, p := range payloads {
+		desc, err := files.FindDescriptorByName(p.message.FullName())
+		old, ok := desc.(protoreflect.MessageDescriptor)
+		if err != nil || !ok {
+			fmt.Fprintf(w, "BREAKING %s: %s is not in the baseline\n", p.eventType, p.message.FullName())
+			compatible = false
+			continue
+		}
+		changes := cloudevents.Compare(old, p.message)
+		for _, change := range changes {
+			fmt.Fprintf(w, "%s: %s\n", p.eventType, change)
+		}
+		if len(cloudevents.Breaking(changes)) > 0 {
+			compatible = false
+		}
+	}
+	return compatible, nil
+}
@@ -0,0 +1,38 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestBaseline fails when demo.proto changes an event payload in a way that
+// breaks consumers of the checked-in baseline.
+func TestBaseline(t *testing.T) {
+	var out strings.Builder
+	compatible, err := check(&out, filepath.Join("..", "..", defaultBaseline))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !compatible {
+		t.Errorf("order event payloads are not compatible with the baseline:\n%s", out.String())
+	}
+}
+
+func TestCheckReportsMissingPayloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	if err := os.WriteFile(path, []byte(`{"file": []}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	compatible, err := check(&out, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compatible || !strings.Contains(out.String(), "oteldemo.OrderResult is not in the baseline") {
+		t.Errorf("check() = %v, %q, want the missing payloads reported as breaking", compatible, out.String())
+	}
+}
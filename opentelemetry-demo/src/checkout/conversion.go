@@ -0,0 +1,134 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/currency"
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/money"
+)
+
+// defaultRatesTTL is how long a rate learned from the currency service is
+// used when the service cannot be reached.
+const defaultRatesTTL = time.Hour
+
+// conversionMode decides which conversions are made by the currency service
+// and which with the local rates.
+type conversionMode string
+
+const (
+	// conversionRemote makes every conversion with the currency service.
+	conversionRemote conversionMode = "remote"
+	// conversionFallback makes conversions with the currency service, and
+	// with the rates it recently returned or the local rates while it fails.
+	conversionFallback conversionMode = "fallback"
+	// conversionLocal makes every conversion with the local rates.
+	conversionLocal conversionMode = "local"
+)
+
+func parseConversionMode(s string) (conversionMode, error) {
+	switch mode := conversionMode(s); mode {
+	case "":
+		return conversionRemote, nil
+	case conversionRemote, conversionFallback, conversionLocal:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown currency conversion mode %q, want remote, fallback or local", s)
+}
+
+// Sources of a conversion, recorded on its span.
+const (
+	sourceRemote = "remote"
+	sourceCache  = "cache"
+	sourceLocal  = "local"
+)
+
+// currencyConverter converts amounts with the currency service, the rates it
+// returned, or the local rates, as its mode allows.
+type currencyConverter struct {
+	client pb.CurrencyServiceClient
+	mode   conversionMode
+	// local holds the rates of the rates file; nil when none is configured.
+	local *currency.Rates
+	cache *rateCache
+}
+
+// convert converts from into the currency to and returns which source made
+// the conversion.
+func (c *currencyConverter) convert(ctx context.Context, from *pb.Money, to string) (*pb.Money, string, error) {
+	if c.mode == conversionLocal {
+		result, err := c.local.Convert(from, to)
+		return result, sourceLocal, err
+	}
+
+	result, err := c.client.Convert(ctx, &pb.CurrencyConversionRequest{
+		From:   from,
+		ToCode: to})
+	if c.mode == conversionRemote {
+		return result, sourceRemote, err
+	}
+	if err == nil {
+		if rate, err := money.Ratio(result, from); err == nil {
+			c.cache.put(from.GetCurrencyCode(), to, rate)
+		}
+		return result, sourceRemote, nil
+	}
+	if ctx.Err() != nil {
+		return nil, sourceRemote, err
+	}
+
+	if rate, ok := c.cache.get(from.GetCurrencyCode(), to); ok {
+		result, cacheErr := money.Convert(from, rate, to, money.RoundHalfEven)
+		if cacheErr == nil {
+			return result, sourceCache, nil
+		}
+	}
+	if c.local != nil {
+		result, localErr := c.local.Convert(from, to)
+		if localErr == nil {
+			return result, sourceLocal, nil
+		}
+	}
+	return nil, sourceRemote, err
+}
+
+// rateCache holds the exchange rates implied by the conversions of the
+// currency service, for a TTL after each was last seen.
+type rateCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu    sync.Mutex
+	rates map[[2]string]cachedRate
+}
+
+type cachedRate struct {
+	rate    *big.Rat
+	fetched time.Time
+}
+
+func newRateCache(ttl time.Duration) *rateCache {
+	return &rateCache{ttl: ttl, now: time.Now, rates: make(map[[2]string]cachedRate)}
+}
+
+func (c *rateCache) put(from, to string, rate *big.Rat) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rates[[2]string{from, to}] = cachedRate{rate: rate, fetched: c.now()}
+}
+
+func (c *rateCache) get(from, to string) (*big.Rat, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.rates[[2]string{from, to}]
+	if !ok || c.now().Sub(cached.fetched) >= c.ttl {
+		return nil, false
+	}
+	return cached.rate, true
+}
@@ -0,0 +1,160 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/currency"
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/money"
+)
+
+// testRates converts from USD to EUR at a rate of 2, like fakeCurrency.
+func testRates(t *testing.T) *currency.Rates {
+	t.Helper()
+	rates, err := currency.Parse([]byte(`{"EUR": "2", "USD": "1"}`), currency.JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rates
+}
+
+// recordSpans makes the spans started by checkout recorded until the test
+// ends.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	sr := tracetest.NewSpanRecorder()
+	old := tracer
+	tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)).Tracer("checkout")
+	t.Cleanup(func() { tracer = old })
+	return sr
+}
+
+func TestConvertCurrency(t *testing.T) {
+	// Unavailable errors would be retried by the client, which is not what
+	// is tested here.
+	failed := status.Error(codes.Internal, "currency service failed")
+	tests := []struct {
+		name string
+		mode conversionMode
+		// local makes the test rates available.
+		local bool
+		// warm converts once before the currency service fails, and expire
+		// lets the rate learned from it expire.
+		warm, expire bool
+		convertErr   error
+		wantSource   string
+		wantErr      bool
+		wantCalls    int
+	}{
+		{name: "Remote", mode: conversionRemote, local: true, wantSource: sourceRemote, wantCalls: 1},
+		{name: "RemoteFails", mode: conversionRemote, local: true, convertErr: failed, wantSource: sourceRemote, wantErr: true, wantCalls: 1},
+		{name: "Fallback", mode: conversionFallback, local: true, wantSource: sourceRemote, wantCalls: 1},
+		{name: "FallbackToCache", mode: conversionFallback, local: true, warm: true, convertErr: failed, wantSource: sourceCache, wantCalls: 2},
+		{name: "FallbackToCacheWithoutRates", mode: conversionFallback, warm: true, convertErr: failed, wantSource: sourceCache, wantCalls: 2},
+		{name: "FallbackToLocal", mode: conversionFallback, local: true, convertErr: failed, wantSource: sourceLocal, wantCalls: 1},
+		{name: "FallbackCacheExpired", mode: conversionFallback, local: true, warm: true, expire: true, convertErr: failed, wantSource: sourceLocal, wantCalls: 2},
+		{name: "NothingToFallBackOn", mode: conversionFallback, warm: true, expire: true, convertErr: failed, wantSource: sourceRemote, wantErr: true, wantCalls: 2},
+		{name: "Local", mode: conversionLocal, local: true, convertErr: failed, wantSource: sourceLocal, wantCalls: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakes()
+			svc := startFakes(t, f)
+			svc.converter.mode = tt.mode
+			if tt.local {
+				svc.converter.local = testRates(t)
+			}
+			now := time.Now()
+			svc.converter.cache.now = func() time.Time { return now }
+			from := &pb.Money{CurrencyCode: "USD", Units: 10, Nanos: 500000000}
+
+			if tt.warm {
+				if _, err := svc.convertCurrency(context.Background(), from, "EUR"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.expire {
+				now = now.Add(defaultRatesTTL)
+			}
+			f.currency.convertErr = tt.convertErr
+
+			sr := recordSpans(t)
+			got, err := svc.convertCurrency(context.Background(), from, "EUR")
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("convertCurrency() = %v, want an error", got)
+				}
+			} else if want := (&pb.Money{CurrencyCode: "EUR", Units: 21}); err != nil || !money.AreEquals(got, want) {
+				t.Errorf("convertCurrency() = %v, %v, want %v", got, err, want)
+			}
+			if f.currency.calls != tt.wantCalls {
+				t.Errorf("Convert called %d times, want %d", f.currency.calls, tt.wantCalls)
+			}
+
+			spans := sr.Ended()
+			if len(spans) != 1 || spans[0].Name() != "convertCurrency" {
+				t.Fatalf("got %d spans, want one convertCurrency span", len(spans))
+			}
+			var source attribute.Value
+			for _, attr := range spans[0].Attributes() {
+				if attr.Key == "app.currency.conversion.source" {
+					source = attr.Value
+				}
+			}
+			if source.AsString() != tt.wantSource {
+				t.Errorf("app.currency.conversion.source = %q, want %q", source.AsString(), tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestPlaceOrderWithLocalRates(t *testing.T) {
+	f := newFakes()
+	f.cart.items[testUserID] = testCart()
+	f.currency.convertErr = status.Error(codes.Unavailable, "currency service unavailable")
+	f.currency.supportedErr = f.currency.convertErr
+	svc := startFakes(t, f)
+	svc.converter.mode = conversionLocal
+	svc.converter.local = testRates(t)
+
+	if _, err := svc.PlaceOrder(context.Background(), testOrderRequest()); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.payment.charges) != 1 || !money.AreEquals(f.payment.charges[0].GetAmount(), wantTotal) {
+		t.Errorf("expected one charge of %v, got %v", wantTotal, f.payment.charges)
+	}
+	if f.currency.calls != 0 || f.currency.supportedCalls != 0 {
+		t.Errorf("currency service called %d times, want none in local mode", f.currency.calls+f.currency.supportedCalls)
+	}
+
+	req := testOrderRequest()
+	req.UserCurrency = "JPY"
+	if _, err := svc.PlaceOrder(context.Background(), req); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("PlaceOrder in a currency without a local rate: err = %v, want InvalidArgument", err)
+	}
+}
+
+func TestParseConversionMode(t *testing.T) {
+	for in, want := range map[string]conversionMode{
+		"":         conversionRemote,
+		"remote":   conversionRemote,
+		"fallback": conversionFallback,
+		"local":    conversionLocal,
+	} {
+		if got, err := parseConversionMode(in); err != nil || got != want {
+			t.Errorf("parseConversionMode(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	if _, err := parseConversionMode("Local"); err == nil {
+		t.Error("parseConversionMode(\"Local\") succeeded, want an error")
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package currency converts amounts with exchange rates read from a file, so
+// checkout can price orders without the currency service.
+package currency
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/money"
+)
+
+// ErrUnsupported is returned for conversions from or to a currency that has
+// no rate.
+var ErrUnsupported = errors.New("unsupported currency")
+
+// Format is the format of a rates file.
+type Format int
+
+const (
+	// JSON maps currency codes to rates, in the format of the currency
+	// service's currency_conversion.json:
+	//
+	//	{"EUR": "1.0", "USD": "1.1305", "JPY": "126.40"}
+	JSON Format = iota
+	// XML is the euro foreign exchange reference rates file published by the
+	// European Central Bank. The rates of its most recent day are used.
+	XML
+)
+
+// FormatOf returns the format of a rates file from its extension.
+func FormatOf(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return JSON, nil
+	case ".xml":
+		return XML, nil
+	}
+	return 0, fmt.Errorf("currency: %s: unknown rates file extension, want .json or .xml", path)
+}
+
+// Rates are exchange rates against a common base currency: one unit of the
+// base is worth Rate(code) units of each currency. Rates are kept as exact
+// fractions of their decimal values. A Rates is immutable and safe for
+// concurrent use.
+type Rates struct {
+	rates map[string]*big.Rat
+	date  time.Time
+}
+
+// Load reads a rates file in the format given by its extension.
+func Load(path string) (*Rates, error) {
+	format, err := FormatOf(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("currency: %w", err)
+	}
+	r, err := Parse(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("currency: %s: %w", path, err)
+	}
+	return r, nil
+}
+
+// Parse reads rates in the given format.
+func Parse(data []byte, format Format) (*Rates, error) {
+	switch format {
+	case JSON:
+		return parseJSON(data)
+	case XML:
+		return parseXML(data)
+	}
+	return nil, fmt.Errorf("unknown rates format %d", format)
+}
+
+func parseJSON(data []byte) (*Rates, error) {
+	var file map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&file); err != nil {
+		return nil, err
+	}
+	r := &Rates{rates: make(map[string]*big.Rat, len(file))}
+	for code, v := range file {
+		// Rates are strings in the currency service's file, but plain
+		// numbers are accepted too.
+		var s string
+		switch v := v.(type) {
+		case string:
+			s = v
+		case json.Number:
+			s = v.String()
+		default:
+			return nil, fmt.Errorf("rate of %s is not a number: %v", code, v)
+		}
+		if err := r.add(code, s); err != nil {
+			return nil, err
+		}
+	}
+	return r, r.check()
+}
+
+// ecbEnvelope is the layout of the European Central Bank's reference rates:
+// a Cube of daily Cubes, each holding a Cube per currency. The rates are
+// against the euro, which is not listed.
+type ecbEnvelope struct {
+	Days []struct {
+		Time  string `xml:"time,attr"`
+		Rates []struct {
+			Currency string `xml:"currency,attr"`
+			Rate     string `xml:"rate,attr"`
+		} `xml:"Cube"`
+	} `xml:"Cube>Cube"`
+}
+
+func parseXML(data []byte) (*Rates, error) {
+	var file ecbEnvelope
+	if err := xml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	if len(file.Days) == 0 {
+		return nil, errors.New("no rates")
+	}
+	// Files with the history of the rates list the most recent day first.
+	day := file.Days[0]
+	r := &Rates{rates: make(map[string]*big.Rat, len(day.Rates)+1)}
+	if day.Time != "" {
+		date, err := time.Parse(time.DateOnly, day.Time)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q", day.Time)
+		}
+		r.date = date
+	}
+	for _, rate := range day.Rates {
+		if err := r.add(rate.Currency, rate.Rate); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := r.rates["EUR"]; !ok {
+		r.rates["EUR"] = big.NewRat(1, 1)
+	}
+	return r, r.check()
+}
+
+func (r *Rates) add(code, value string) error {
+	if len(code) != 3 || strings.ToUpper(code) != code {
+		return fmt.Errorf("%q is not an ISO 4217 currency code", code)
+	}
+	if _, ok := r.rates[code]; ok {
+		return fmt.Errorf("duplicate rate for %s", code)
+	}
+	rate, ok := new(big.Rat).SetString(value)
+	if !ok || rate.Sign() <= 0 {
+		return fmt.Errorf("rate of %s is not a positive decimal: %q", code, value)
+	}
+	r.rates[code] = rate
+	return nil
+}
+
+func (r *Rates) check() error {
+	if len(r.rates) == 0 {
+		return errors.New("no rates")
+	}
+	return nil
+}
+
+// Date returns the day the rates were published, or the zero time when the
+// file does not say.
+func (r *Rates) Date() time.Time { return r.date }
+
+// Codes returns the currencies with a rate, sorted.
+func (r *Rates) Codes() []string {
+	codes := make([]string, 0, len(r.rates))
+	for code := range r.rates {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// Supports reports whether there is a rate for the currency.
+func (r *Rates) Supports(code string) bool {
+	_, ok := r.rates[code]
+	return ok
+}
+
+// Rate returns the number of units of to that one unit of from is worth.
+func (r *Rates) Rate(from, to string) (*big.Rat, error) {
+	fromRate, ok := r.rates[from]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, from)
+	}
+	toRate, ok := r.rates[to]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, to)
+	}
+	return new(big.Rat).Quo(toRate, fromRate), nil
+}
+
+// Convert converts from into the currency to. The result is exact up to the
+// nano, which is rounded half to even.
+func (r *Rates) Convert(from *pb.Money, to string) (*pb.Money, error) {
+	rate, err := r.Rate(from.GetCurrencyCode(), to)
+	if err != nil {
+		return nil, err
+	}
+	return money.Convert(from, rate, to, money.RoundHalfEven)
+}
@@ -0,0 +1,152 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package currency
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/money"
+)
+
+const testJSON = `{
+  "EUR": "1.0",
+  "USD": "1.1305",
+  "JPY": 126.40,
+  "GBP": "0.85970"
+}`
+
+const testXML = `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<gesmes:Sender>
+		<gesmes:name>European Central Bank</gesmes:name>
+	</gesmes:Sender>
+	<Cube>
+		<Cube time="2019-05-10">
+			<Cube currency="USD" rate="1.1305"/>
+			<Cube currency="JPY" rate="126.40"/>
+			<Cube currency="GBP" rate="0.85970"/>
+		</Cube>
+		<Cube time="2019-05-09">
+			<Cube currency="USD" rate="1.1214"/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`
+
+func TestParse(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		data     string
+		format   Format
+		wantDate time.Time
+	}{
+		{"JSON", testJSON, JSON, time.Time{}},
+		{"XML", testXML, XML, time.Date(2019, 5, 10, 0, 0, 0, 0, time.UTC)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Parse([]byte(tt.data), tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []string{"EUR", "GBP", "JPY", "USD"}; !reflect.DeepEqual(r.Codes(), want) {
+				t.Errorf("Codes() = %v, want %v", r.Codes(), want)
+			}
+			if !r.Date().Equal(tt.wantDate) {
+				t.Errorf("Date() = %v, want %v", r.Date(), tt.wantDate)
+			}
+			got, err := r.Convert(&pb.Money{CurrencyCode: "EUR", Units: 100}, "USD")
+			if want := (&pb.Money{CurrencyCode: "USD", Units: 113, Nanos: 50000000}); err != nil || !money.AreEquals(got, want) {
+				t.Errorf("Convert(100 EUR) = %v, %v, want %v", got, err, want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		data   string
+		format Format
+		want   string
+	}{
+		{"Empty", `{}`, JSON, "no rates"},
+		{"Negative", `{"USD": "-1"}`, JSON, "not a positive decimal"},
+		{"Zero", `{"USD": 0}`, JSON, "not a positive decimal"},
+		{"NotANumber", `{"USD": "abc"}`, JSON, "not a positive decimal"},
+		{"NotAString", `{"USD": true}`, JSON, "not a number"},
+		{"LowerCase", `{"usd": "1"}`, JSON, "not an ISO 4217 currency code"},
+		{"Malformed", `{"USD": `, JSON, "unexpected EOF"},
+		{"NoDays", `<Envelope><Cube></Cube></Envelope>`, XML, "no rates"},
+		{"BadDate", `<Envelope><Cube><Cube time="10/05/2019"><Cube currency="USD" rate="1.1"/></Cube></Cube></Envelope>`, XML, "invalid date"},
+		{"Duplicate", `<Envelope><Cube><Cube><Cube currency="USD" rate="1.1"/><Cube currency="USD" rate="1.2"/></Cube></Cube></Envelope>`, XML, "duplicate rate for USD"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.data), tt.format)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "eurofxref-daily.XML")
+	if err := os.WriteFile(path, []byte(testXML), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Supports("EUR") || !r.Supports("JPY") || r.Supports("CHF") {
+		t.Errorf("Codes() = %v, want EUR, GBP, JPY and USD", r.Codes())
+	}
+
+	if _, err := Load(filepath.Join(dir, "rates.yaml")); err == nil || !strings.Contains(err.Error(), "unknown rates file extension") {
+		t.Errorf("Load(rates.yaml) error = %v, want an unknown extension", err)
+	}
+	if _, err := Load(filepath.Join(dir, "missing.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Load(missing.json) error = %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	r, err := Parse([]byte(testJSON), JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		from *pb.Money
+		to   string
+		want *pb.Money
+	}{
+		// 10.99 * 126.40 / 1.1305
+		{&pb.Money{CurrencyCode: "USD", Units: 10, Nanos: 990000000}, "JPY", &pb.Money{CurrencyCode: "JPY", Units: 1228, Nanos: 780185759}},
+		{&pb.Money{CurrencyCode: "JPY", Units: 12640}, "EUR", &pb.Money{CurrencyCode: "EUR", Units: 100}},
+		{&pb.Money{CurrencyCode: "GBP", Units: -5}, "GBP", &pb.Money{CurrencyCode: "GBP", Units: -5}},
+		{&pb.Money{CurrencyCode: "USD"}, "EUR", &pb.Money{CurrencyCode: "EUR"}},
+	} {
+		got, err := r.Convert(tt.from, tt.to)
+		if err != nil || !money.AreEquals(got, tt.want) {
+			t.Errorf("Convert(%v, %s) = %v, %v, want %v", tt.from, tt.to, got, err, tt.want)
+		}
+	}
+
+	if _, err := r.Convert(&pb.Money{CurrencyCode: "USD", Units: 1}, "CHF"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Convert(USD, CHF) error = %v, want %v", err, ErrUnsupported)
+	}
+	if _, err := r.Convert(&pb.Money{CurrencyCode: "CHF", Units: 1}, "USD"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Convert(CHF, USD) error = %v, want %v", err, ErrUnsupported)
+	}
+	if _, err := r.Convert(&pb.Money{CurrencyCode: "USD", Units: 1, Nanos: -1}, "EUR"); !errors.Is(err, money.ErrInvalidValue) {
+		t.Errorf("Convert(invalid) error = %v, want %v", err, money.ErrInvalidValue)
+	}
+}
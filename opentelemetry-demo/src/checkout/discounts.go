@@ -0,0 +1,81 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/money"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/promotions"
+)
+
+// applyPromotions adds the discounts the promotions in effect give the
+// order to prep, and records which promotions fired on the span.
+func (cs *checkout) applyPromotions(ctx context.Context, prep *orderPrep, currency string, codes []string) error {
+	rules := cs.promotions.Rules()
+	if rules.Len() == 0 {
+		return nil
+	}
+
+	order := promotions.Order{
+		Currency: currency,
+		Items:    make([]promotions.Item, len(prep.orderItems)),
+		Shipping: prep.shippingCostLocalized,
+		Codes:    codes,
+	}
+	for i, it := range prep.orderItems {
+		order.Items[i] = promotions.Item{
+			ProductID: it.GetItem().GetProductId(),
+			Quantity:  it.GetItem().GetQuantity(),
+			Price:     it.GetCost(),
+		}
+	}
+	adjustments, err := rules.Apply(ctx, order, time.Now(), func(ctx context.Context, from *pb.Money, to string) (*pb.Money, error) {
+		return cs.convertCurrency(ctx, from, to)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply promotions: %+v", err)
+	}
+	prep.adjustments = adjustments
+
+	fired := make([]string, len(adjustments))
+	discount := &pb.Money{CurrencyCode: currency}
+	prep.shippingDiscount = &pb.Money{CurrencyCode: currency}
+	for i, adj := range adjustments {
+		fired[i] = adj.GetPromotionId()
+		if discount, err = money.Sum(discount, adj.GetAmount()); err != nil {
+			return fmt.Errorf("failed to apply promotions: %+v", err)
+		}
+		if rules.DiscountsShipping(adj.GetPromotionId()) {
+			if prep.shippingDiscount, err = money.Sum(prep.shippingDiscount, money.Negate(adj.GetAmount())); err != nil {
+				return fmt.Errorf("failed to apply promotions: %+v", err)
+			}
+		}
+	}
+	discountFloat, _ := strconv.ParseFloat(money.Format(money.Negate(discount)), 64)
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.StringSlice("app.order.promotions", fired),
+		attribute.Float64("app.order.discount.amount", discountFloat),
+	)
+	return nil
+}
+
+// normalizePromoCodes returns codes upper-cased, sorted and without
+// duplicates, so two lists of codes can be compared.
+func normalizePromoCodes(codes []string) []string {
+	out := make([]string, 0, len(codes))
+	for _, code := range codes {
+		out = append(out, strings.ToUpper(strings.TrimSpace(code)))
+	}
+	slices.Sort(out)
+	return slices.Compact(out)
+}
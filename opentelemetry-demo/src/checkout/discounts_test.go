@@ -0,0 +1,154 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/money"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/promotions"
+)
+
+const testPromotions = `
+promotions:
+  - id: telescopes-10
+    description: 10% off telescopes
+    type: percentage
+    percent: 10
+    product_ids: [OLJCESPC7Z]
+  - id: ship-free
+    description: Free shipping
+    type: free_shipping
+    code: SHIPFREE
+`
+
+func loadTestPromotions(t *testing.T, svc *checkout) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "promotions.yaml")
+	if err := os.WriteFile(path, []byte(testPromotions), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	engine, err := promotions.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.promotions = engine
+}
+
+func TestPlaceOrderAppliesPromotions(t *testing.T) {
+	f := newFakes()
+	f.cart.items[testUserID] = testCart()
+	svc := startFakes(t, f)
+	svc.orders = &fakeOrders{}
+	loadTestPromotions(t, svc)
+
+	req := testOrderRequest()
+	req.PromoCodes = []string{"shipfree"}
+	resp, err := svc.PlaceOrder(context.Background(), req)
+	if err != nil {
+		t.Fatalf("PlaceOrder() error = %v", err)
+	}
+
+	var ids []string
+	for _, adj := range resp.GetOrder().GetAdjustments() {
+		ids = append(ids, adj.GetPromotionId())
+	}
+	if !slices.Equal(ids, []string{"telescopes-10", "ship-free"}) {
+		t.Fatalf("adjustments = %v, want the automatic promotion and the one of the code", resp.GetOrder().GetAdjustments())
+	}
+	adjustments := resp.GetOrder().GetAdjustments()
+	if !money.AreEquals(adjustments[0].GetAmount(), &pb.Money{CurrencyCode: "EUR", Units: -40, Nanos: -200000000}) {
+		t.Errorf("telescope discount = %v, want -40.20", adjustments[0].GetAmount())
+	}
+	if adjustments[1].GetPromoCode() != "SHIPFREE" {
+		t.Errorf("shipping adjustment has promo code %q, want SHIPFREE", adjustments[1].GetPromoCode())
+	}
+
+	// 459.98 - 40.20 - 17.98
+	want := &pb.Money{CurrencyCode: "EUR", Units: 401, Nanos: 800000000}
+	if len(f.payment.charges) != 1 || !money.AreEquals(f.payment.charges[0].GetAmount(), want) {
+		t.Errorf("charges = %v, want one of %v", f.payment.charges, want)
+	}
+
+	stored, err := svc.GetOrder(context.Background(), &pb.GetOrderRequest{OrderId: resp.GetOrder().GetOrderId()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := stored.GetOrder().GetOrder().GetAdjustments()
+	if len(got) != len(adjustments) {
+		t.Fatalf("stored adjustments = %v, want %v", got, adjustments)
+	}
+	for i := range got {
+		if !proto.Equal(got[i], adjustments[i]) {
+			t.Errorf("stored adjustment %d = %v, want %v", i, got[i], adjustments[i])
+		}
+	}
+}
+
+func TestPlaceOrderRejectsUnknownPromoCode(t *testing.T) {
+	f := newFakes()
+	f.cart.items[testUserID] = testCart()
+	svc := startFakes(t, f)
+	loadTestPromotions(t, svc)
+
+	req := testOrderRequest()
+	req.PromoCodes = []string{"SHIPFREE", "BOGUS", ""}
+	_, err := svc.PlaceOrder(context.Background(), req)
+	if got := violatedFields(t, err); !slices.Equal(got, []string{"promo_codes[1]", "promo_codes[2]"}) {
+		t.Errorf("violated fields = %q", got)
+	}
+	if len(f.payment.charges) != 0 {
+		t.Error("PlaceOrder() charged an order with an invalid promo code")
+	}
+}
+
+func TestPromoCodesWithoutPromotions(t *testing.T) {
+	svc := startFakes(t, newFakes())
+	req := testOrderRequest()
+	req.PromoCodes = []string{"SHIPFREE"}
+	_, err := svc.PlaceOrder(context.Background(), req)
+	if got := violatedFields(t, err); !slices.Equal(got, []string{"promo_codes[0]"}) {
+		t.Errorf("violated fields = %q, want the code rejected when no promotions are configured", got)
+	}
+}
+
+func TestPreviewOrderAppliesPromotions(t *testing.T) {
+	f := newFakes()
+	f.cart.items[testUserID] = testCart()
+	svc := startFakes(t, f)
+	loadTestPromotions(t, svc)
+
+	preview := testPreviewRequest()
+	preview.PromoCodes = []string{"SHIPFREE"}
+	resp, err := svc.PreviewOrder(context.Background(), preview)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quote := resp.GetQuote()
+	want := &pb.Money{CurrencyCode: "EUR", Units: 401, Nanos: 800000000}
+	if len(quote.GetAdjustments()) != 2 || !money.AreEquals(quote.GetTotal(), want) {
+		t.Fatalf("quote = %v, want 2 adjustments and a total of %v", quote, want)
+	}
+
+	req := testOrderRequest()
+	req.QuoteId = quote.GetQuoteId()
+	if _, err := svc.PlaceOrder(context.Background(), req); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("PlaceOrder() without the quoted promo codes error = %v, want FailedPrecondition", err)
+	}
+	req.PromoCodes = []string{"shipfree"}
+	if _, err := svc.PlaceOrder(context.Background(), req); err != nil {
+		t.Fatalf("PlaceOrder() error = %v", err)
+	}
+	if !money.AreEquals(f.payment.charges[0].GetAmount(), want) {
+		t.Errorf("charged %v, want the quoted %v", f.payment.charges[0].GetAmount(), want)
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package emailqueue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/db/postgres"
+)
+
+// FileStore is a queue kept on disk, for when checkout runs without a
+// database. Each job is a JSON file in the pending directory, moved to the
+// dead directory when it is dead-lettered and removed once sent. Files are
+// replaced atomically, so a crash loses at most the outcome of the attempt
+// in flight, which is then retried. Leases are kept in memory: a FileStore
+// directory must be used by a single process.
+type FileStore struct {
+	pending string
+	dead    string
+	now     func() time.Time
+
+	mu     sync.Mutex
+	nextID int64
+	leases map[int64]time.Time
+}
+
+// fileJob is the content of a job file.
+type fileJob struct {
+	Job         *postgres.EmailJob `json:"job"`
+	NextAttempt time.Time          `json:"next_attempt"`
+}
+
+// NewFileStore opens the queue in dir, creating it if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	s := &FileStore{
+		pending: filepath.Join(dir, "pending"),
+		dead:    filepath.Join(dir, "dead"),
+		now:     time.Now,
+		leases:  make(map[int64]time.Time),
+	}
+	for _, d := range []string{s.pending, s.dead} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create email queue directory: %w", err)
+		}
+		ids, err := jobIDs(d)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			s.nextID = max(s.nextID, id)
+		}
+	}
+	return s, nil
+}
+
+// Enqueue stores a pending job that is due right away and sets its ID.
+func (s *FileStore) Enqueue(_ context.Context, job *postgres.EmailJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	job.ID = s.nextID
+	job.Status = postgres.EmailPending
+	job.CreatedAt = s.now()
+	if err := s.write(&fileJob{Job: job, NextAttempt: job.CreatedAt}); err != nil {
+		return fmt.Errorf("failed to queue email for order %s: %w", job.OrderID, err)
+	}
+	return nil
+}
+
+// ClaimDue claims up to limit pending jobs that are due, oldest first. A
+// claimed job is not claimed again before its lease expires. Job files that
+// cannot be read are moved to the dead directory.
+func (s *FileStore) ClaimDue(_ context.Context, limit int, lease time.Duration) ([]*postgres.EmailJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids, err := jobIDs(s.pending)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	var jobs []*postgres.EmailJob
+	for _, id := range ids {
+		if len(jobs) == limit {
+			break
+		}
+		if until, ok := s.leases[id]; ok && now.Before(until) {
+			continue
+		}
+		fj, err := s.read(id)
+		if err != nil {
+			if renameErr := os.Rename(s.path(s.pending, id), s.path(s.dead, id)+".corrupt"); renameErr != nil {
+				return nil, errors.Join(err, renameErr)
+			}
+			continue
+		}
+		if fj.NextAttempt.After(now) {
+			continue
+		}
+		s.leases[id] = now.Add(lease)
+		jobs = append(jobs, fj.Job)
+	}
+	return jobs, nil
+}
+
+// MarkSent removes a job that was sent.
+func (s *FileStore) MarkSent(_ context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.leases, id)
+	if err := os.Remove(s.path(s.pending, id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// MarkFailed records a failed attempt and when to try again.
+func (s *FileStore) MarkFailed(_ context.Context, id int64, nextAttempt time.Time, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fj, err := s.read(id)
+	if err != nil {
+		return err
+	}
+	fj.Job.Attempts++
+	fj.Job.LastError = reason
+	fj.NextAttempt = nextAttempt
+	delete(s.leases, id)
+	return s.write(fj)
+}
+
+// MarkDead records the last failed attempt and moves the job to the dead
+// directory.
+func (s *FileStore) MarkDead(_ context.Context, id int64, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fj, err := s.read(id)
+	if err != nil {
+		return err
+	}
+	fj.Job.Attempts++
+	fj.Job.LastError = reason
+	fj.Job.Status = postgres.EmailDead
+	if err := s.write(fj); err != nil {
+		return err
+	}
+	delete(s.leases, id)
+	return os.Rename(s.path(s.pending, id), s.path(s.dead, id))
+}
+
+func (s *FileStore) path(dir string, id int64) string {
+	return filepath.Join(dir, strconv.FormatInt(id, 10)+".json")
+}
+
+func (s *FileStore) read(id int64) (*fileJob, error) {
+	data, err := os.ReadFile(s.path(s.pending, id))
+	if err != nil {
+		return nil, err
+	}
+	var fj fileJob
+	if err := json.Unmarshal(data, &fj); err != nil {
+		return nil, fmt.Errorf("failed to read email job %d: %w", id, err)
+	}
+	if fj.Job == nil {
+		return nil, fmt.Errorf("failed to read email job %d: no job", id)
+	}
+	return &fj, nil
+}
+
+// write replaces the pending file of a job atomically.
+func (s *FileStore) write(fj *fileJob) error {
+	data, err := json.Marshal(fj)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.pending, ".job-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(s.pending, fj.Job.ID))
+}
+
+// jobIDs returns the IDs of the job files in dir, in ascending order.
+func jobIDs(dir string) ([]int64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || e.IsDir() {
+			continue
+		}
+		if id, err := strconv.ParseInt(name, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
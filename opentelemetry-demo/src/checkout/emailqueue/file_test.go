@@ -0,0 +1,113 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package emailqueue
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/db/postgres"
+)
+
+func TestFileStoreSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, order := range []string{"order-1", "order-2"} {
+		if err := store.Enqueue(ctx, &postgres.EmailJob{OrderID: order, Email: "someone@example.com", Payload: []byte("{}")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	next := time.Now().Add(time.Hour)
+	if err := store.MarkFailed(ctx, 1, next, "timeout"); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := reopened.ClaimDue(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != 2 || jobs[0].OrderID != "order-2" {
+		t.Fatalf("ClaimDue() = %+v, want only job 2, job 1 is not due", jobs)
+	}
+
+	if err := reopened.MarkSent(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	reopened.now = func() time.Time { return next }
+	jobs, err = reopened.ClaimDue(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != 1 || jobs[0].Attempts != 1 || jobs[0].LastError != "timeout" {
+		t.Fatalf("ClaimDue() = %+v, want job 1 with its failed attempt", jobs)
+	}
+
+	job := &postgres.EmailJob{OrderID: "order-3"}
+	if err := reopened.Enqueue(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	if job.ID != 3 {
+		t.Errorf("new job ID = %d, want 3 after the existing jobs", job.ID)
+	}
+}
+
+func TestFileStoreLeases(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1000, 0)
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+	if err := store.Enqueue(ctx, &postgres.EmailJob{OrderID: "order-1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if jobs, _ := store.ClaimDue(ctx, 10, time.Minute); len(jobs) != 1 {
+		t.Fatalf("first ClaimDue() = %d jobs, want 1", len(jobs))
+	}
+	if jobs, _ := store.ClaimDue(ctx, 10, time.Minute); len(jobs) != 0 {
+		t.Errorf("ClaimDue() during the lease = %d jobs, want none", len(jobs))
+	}
+	now = now.Add(time.Minute)
+	if jobs, _ := store.ClaimDue(ctx, 10, time.Minute); len(jobs) != 1 {
+		t.Errorf("ClaimDue() after the lease = %d jobs, want 1", len(jobs))
+	}
+
+	if err := store.MarkSent(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if ids, _ := jobIDs(store.pending); len(ids) != 0 {
+		t.Errorf("pending jobs after MarkSent = %v, want none", ids)
+	}
+}
+
+func TestFileStoreMovesCorruptJobsAside(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "pending", "7.json"), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := store.ClaimDue(context.Background(), 10, time.Minute)
+	if err != nil || len(jobs) != 0 {
+		t.Fatalf("ClaimDue() = %v, %v, want no jobs and no error", jobs, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "dead", "7.json.corrupt")); err != nil {
+		t.Errorf("corrupt job was not moved to the dead letters: %v", err)
+	}
+}
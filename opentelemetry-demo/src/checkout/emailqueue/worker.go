@@ -0,0 +1,189 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package emailqueue retries order confirmation emails that failed to send.
+// Failed confirmations are stored in a queue, in Postgres or on disk, and a
+// worker sends them again with exponential backoff. A confirmation that
+// keeps failing is moved to the dead letters, where it stays for
+// inspection but is never retried.
+package emailqueue
+
+import (
+	"context"
+	"time"
+
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/db/postgres"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Store is the queue as seen by the worker. It is implemented by
+// postgres.EmailQueueRepository and FileStore.
+type Store interface {
+	Enqueue(ctx context.Context, job *postgres.EmailJob) error
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*postgres.EmailJob, error)
+	MarkSent(ctx context.Context, id int64) error
+	MarkFailed(ctx context.Context, id int64, nextAttempt time.Time, reason string) error
+	MarkDead(ctx context.Context, id int64, reason string) error
+}
+
+// SendFunc sends the email of a job.
+type SendFunc func(ctx context.Context, job *postgres.EmailJob) error
+
+// Config controls how often the worker polls and how it retries.
+type Config struct {
+	// PollInterval is how long the worker sleeps when nothing is due.
+	PollInterval time.Duration
+	// BatchSize is the maximum number of jobs claimed at once.
+	BatchSize int
+	// Lease is how long a claimed job is hidden from other workers.
+	Lease time.Duration
+	// SendTimeout bounds each attempt to send an email.
+	SendTimeout time.Duration
+	// MinBackoff and MaxBackoff bound the exponential delay between
+	// attempts to send an email.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// MaxAttempts is the number of retries after which a job is moved to
+	// the dead letters.
+	MaxAttempts int
+}
+
+// DefaultConfig returns the settings used by checkout. With them, a job is
+// retried for about a day before it is dead-lettered.
+func DefaultConfig() Config {
+	return Config{
+		PollInterval: time.Second,
+		BatchSize:    20,
+		Lease:        time.Minute,
+		SendTimeout:  10 * time.Second,
+		MinBackoff:   5 * time.Second,
+		MaxBackoff:   time.Hour,
+		MaxAttempts:  30,
+	}
+}
+
+// Worker sends the jobs of a queue.
+type Worker struct {
+	store  Store
+	send   SendFunc
+	tracer trace.Tracer
+	log    *logrus.Logger
+	cfg    Config
+	now    func() time.Time
+}
+
+// NewWorker creates a worker that sends the jobs of store with send.
+func NewWorker(store Store, send SendFunc, tracer trace.Tracer, log *logrus.Logger, cfg Config) *Worker {
+	return &Worker{
+		store:  store,
+		send:   send,
+		tracer: tracer,
+		log:    log,
+		cfg:    cfg,
+		now:    time.Now,
+	}
+}
+
+// NewJob creates a job that carries the trace context of ctx, so the
+// retries continue the trace of the request that placed the order.
+func NewJob(ctx context.Context, orderID, email string, payload []byte) *postgres.EmailJob {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	return &postgres.EmailJob{
+		OrderID: orderID,
+		Email:   email,
+		Payload: payload,
+		Headers: carrier,
+	}
+}
+
+// Run sends due jobs until ctx is cancelled.
+func (w *Worker) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		n, err := w.sendBatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			w.log.Errorf("email worker failed to claim jobs: %+v", err)
+		}
+		if n > 0 && err == nil {
+			// There may be more jobs due.
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.cfg.PollInterval):
+		}
+	}
+}
+
+// sendBatch claims and sends one batch of jobs and returns how many were
+// claimed.
+func (w *Worker) sendBatch(ctx context.Context) (int, error) {
+	jobs, err := w.store.ClaimDue(ctx, w.cfg.BatchSize, w.cfg.Lease)
+	if err != nil {
+		return 0, err
+	}
+	for _, job := range jobs {
+		w.process(ctx, job)
+	}
+	return len(jobs), nil
+}
+
+func (w *Worker) process(ctx context.Context, job *postgres.EmailJob) {
+	// Continue the trace of the request that placed the order.
+	parent := otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(job.Headers))
+	spanCtx, span := w.tracer.Start(parent, "email retry",
+		trace.WithAttributes(
+			attribute.String("app.order.id", job.OrderID),
+			attribute.Int64("app.email.job.id", job.ID),
+			attribute.Int("app.email.job.attempts", job.Attempts),
+		),
+	)
+	defer span.End()
+
+	sendCtx, cancel := context.WithTimeout(spanCtx, w.cfg.SendTimeout)
+	err := w.send(sendCtx, job)
+	cancel()
+	if err == nil {
+		if err := w.store.MarkSent(ctx, job.ID); err != nil {
+			// The email is sent again once its lease expires.
+			w.log.Errorf("Failed to mark email job %d as sent: %+v", job.ID, err)
+			return
+		}
+		w.log.Infof("Sent order confirmation for order %s after %d failed retries", job.OrderID, job.Attempts)
+		return
+	}
+
+	span.SetStatus(otelcodes.Error, err.Error())
+	if job.Attempts+1 >= w.cfg.MaxAttempts {
+		span.AddEvent("email job dead-lettered")
+		w.log.Errorf("Giving up on order confirmation for order %s after %d retries: %v", job.OrderID, job.Attempts+1, err)
+		if markErr := w.store.MarkDead(ctx, job.ID, err.Error()); markErr != nil {
+			w.log.Errorf("Failed to dead-letter email job %d: %+v", job.ID, markErr)
+		}
+		return
+	}
+	next := w.now().Add(w.backoff(job.Attempts))
+	w.log.Warnf("Failed to send order confirmation for order %s, retrying at %s: %v", job.OrderID, next.Format(time.RFC3339), err)
+	if markErr := w.store.MarkFailed(ctx, job.ID, next, err.Error()); markErr != nil {
+		w.log.Errorf("Failed to record failed email job %d: %+v", job.ID, markErr)
+	}
+}
+
+// backoff returns the delay before the next attempt of a job that has
+// already failed attempts times.
+func (w *Worker) backoff(attempts int) time.Duration {
+	d := w.cfg.MinBackoff
+	for i := 0; i < attempts && d < w.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > w.cfg.MaxBackoff {
+		d = w.cfg.MaxBackoff
+	}
+	return d
+}
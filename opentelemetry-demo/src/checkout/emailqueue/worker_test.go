@@ -0,0 +1,132 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package emailqueue
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/db/postgres"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// newTestWorker returns a worker over a FileStore in a temporary directory
+// whose clock, shared with the store, is advanced by the returned function.
+func newTestWorker(t *testing.T, send SendFunc) (*Worker, *FileStore, *tracetest.SpanRecorder, func(time.Duration)) {
+	t.Helper()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1000, 0)
+	clock := func() time.Time { return now }
+	store.now = clock
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	log := logrus.New()
+	log.Out = io.Discard
+	cfg := DefaultConfig()
+	cfg.MaxAttempts = 3
+	w := NewWorker(store, send, tp.Tracer("emailqueue"), log, cfg)
+	w.now = clock
+	return w, store, sr, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestWorkerSendsQueuedEmail(t *testing.T) {
+	var sent []*postgres.EmailJob
+	w, store, sr, _ := newTestWorker(t, func(_ context.Context, job *postgres.EmailJob) error {
+		sent = append(sent, job)
+		return nil
+	})
+
+	tp := sdktrace.NewTracerProvider()
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "PlaceOrder")
+	if err := store.Enqueue(ctx, NewJob(ctx, "order-1", "someone@example.com", []byte("{}"))); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	if n, err := w.sendBatch(context.Background()); err != nil || n != 1 {
+		t.Fatalf("sendBatch() = %d, %v; want 1, nil", n, err)
+	}
+	if len(sent) != 1 || sent[0].OrderID != "order-1" || sent[0].Email != "someone@example.com" {
+		t.Errorf("sent = %+v, want the confirmation of order-1", sent)
+	}
+	if n, _ := w.sendBatch(context.Background()); n != 0 {
+		t.Errorf("sendBatch() after sending claimed %d jobs, want none", n)
+	}
+
+	spans := sr.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	if spans[0].Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("retry span parent = %v, want %v", spans[0].Parent().SpanID(), parent.SpanContext().SpanID())
+	}
+}
+
+func TestWorkerBacksOffAndDeadLetters(t *testing.T) {
+	attempts := 0
+	w, store, _, advance := newTestWorker(t, func(context.Context, *postgres.EmailJob) error {
+		attempts++
+		return errors.New("email service unavailable")
+	})
+	if err := store.Enqueue(context.Background(), &postgres.EmailJob{OrderID: "order-1"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	w.sendBatch(ctx)
+	if n, _ := w.sendBatch(ctx); n != 0 {
+		t.Errorf("sendBatch() claimed %d jobs before the backoff passed, want none", n)
+	}
+	advance(5 * time.Second)
+	w.sendBatch(ctx)
+	// The second failure doubles the backoff.
+	advance(5 * time.Second)
+	if n, _ := w.sendBatch(ctx); n != 0 {
+		t.Errorf("sendBatch() claimed %d jobs before the doubled backoff passed, want none", n)
+	}
+	advance(5 * time.Second)
+	w.sendBatch(ctx)
+	if attempts != 3 {
+		t.Fatalf("%d attempts, want 3", attempts)
+	}
+
+	// The third failure reaches MaxAttempts: the job is never retried.
+	advance(time.Hour)
+	if n, _ := w.sendBatch(ctx); n != 0 {
+		t.Errorf("sendBatch() claimed %d dead-lettered jobs, want none", n)
+	}
+	ids, err := jobIDs(store.dead)
+	if err != nil || len(ids) != 1 {
+		t.Errorf("dead letters = %v, %v, want one job", ids, err)
+	}
+}
+
+func TestBackoffIsCapped(t *testing.T) {
+	w := &Worker{cfg: Config{MinBackoff: time.Second, MaxBackoff: time.Minute}}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{5, 32 * time.Second},
+		{6, time.Minute},
+		{100, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := w.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/db/postgres"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/emailqueue"
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+)
+
+// emailEnqueueTimeout bounds queueing a confirmation that failed to send.
+const emailEnqueueTimeout = 5 * time.Second
+
+// retryOrderConfirmation queues a confirmation that failed to send with
+// sendErr, so the email worker retries it. Without a queue, or when it
+// cannot be queued, the confirmation is lost; the order stands either way.
+func (cs *checkout) retryOrderConfirmation(ctx context.Context, email string, order *pb.OrderResult, sendErr error) {
+	if cs.emailQueue == nil {
+		log.Warnf("failed to send order confirmation to %q: %+v", email, sendErr)
+		return
+	}
+	payload, err := protojson.Marshal(order)
+	if err == nil {
+		// The confirmation is queued even if the caller has gone away or
+		// PlaceOrder ran out of time, which may be why it failed. The job
+		// still carries the trace context of ctx.
+		enqueueCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), emailEnqueueTimeout)
+		err = cs.emailQueue.Enqueue(enqueueCtx, emailqueue.NewJob(ctx, order.GetOrderId(), email, payload))
+		cancel()
+	}
+	if err != nil {
+		log.Errorf("failed to send order confirmation to %q: %+v; failed to queue it for retry: %+v", email, sendErr, err)
+		return
+	}
+	log.Warnf("failed to send order confirmation to %q, queued for retry: %+v", email, sendErr)
+}
+
+// sendQueuedConfirmation sends the confirmation of a queued job; it is the
+// send function of the email worker.
+func (cs *checkout) sendQueuedConfirmation(ctx context.Context, job *postgres.EmailJob) error {
+	order := new(pb.OrderResult)
+	if err := protojson.Unmarshal(job.Payload, order); err != nil {
+		return fmt.Errorf("failed to unmarshal order %s: %w", job.OrderID, err)
+	}
+	return cs.sendOrderConfirmation(ctx, job.Email, order)
+}
@@ -0,0 +1,115 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/db/postgres"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/emailqueue"
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+)
+
+// ctxQueue is a FileStore that, like a database, fails calls whose context
+// is done.
+type ctxQueue struct {
+	*emailqueue.FileStore
+}
+
+func (q ctxQueue) Enqueue(ctx context.Context, job *postgres.EmailJob) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return q.FileStore.Enqueue(ctx, job)
+}
+
+func TestFailedConfirmationIsQueued(t *testing.T) {
+	f := newFakes()
+	f.cart.items[testUserID] = testCart()
+	f.email.statusCode = http.StatusServiceUnavailable
+	svc := startFakes(t, f)
+	queue, err := emailqueue.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.emailQueue = queue
+
+	resp, err := svc.PlaceOrder(context.Background(), testOrderRequest())
+	if err != nil {
+		t.Fatalf("PlaceOrder() error = %v, want the order to stand", err)
+	}
+	jobs, err := queue.ClaimDue(context.Background(), 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].OrderID != resp.GetOrder().GetOrderId() || jobs[0].Email != "someone@example.com" {
+		t.Fatalf("queued jobs = %+v, want the confirmation of the order", jobs)
+	}
+
+	// The email service recovers and the worker sends the queued job.
+	f.email.mu.Lock()
+	f.email.statusCode = http.StatusOK
+	f.email.mu.Unlock()
+	if err := svc.sendQueuedConfirmation(context.Background(), jobs[0]); err != nil {
+		t.Fatalf("sendQueuedConfirmation() error = %v", err)
+	}
+	sent := f.email.confirmations()
+	if len(sent) != 1 || sent[0].GetOrder().GetOrderId() != resp.GetOrder().GetOrderId() || len(sent[0].GetOrder().GetItems()) != 2 {
+		t.Errorf("sent confirmations = %v, want the queued order", sent)
+	}
+}
+
+func TestConfirmationOverGRPC(t *testing.T) {
+	f := newFakes()
+	f.cart.items[testUserID] = testCart()
+	f.emailOverGRPC = true
+	// The HTTP API would fail the confirmation.
+	f.email.statusCode = http.StatusInternalServerError
+	svc := startFakes(t, f)
+
+	resp, err := svc.PlaceOrder(context.Background(), testOrderRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := f.email.confirmations()
+	if len(sent) != 1 || sent[0].GetOrder().GetOrderId() != resp.GetOrder().GetOrderId() {
+		t.Errorf("sent confirmations = %v, want the order sent over gRPC", sent)
+	}
+}
+
+func TestConfirmationQueuedAfterCancel(t *testing.T) {
+	old := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(old) })
+	recordSpans(t)
+	queue, err := emailqueue.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := &checkout{emailQueue: ctxQueue{queue}}
+
+	ctx, span := tracer.Start(context.Background(), "PlaceOrder")
+	defer span.End()
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	svc.retryOrderConfirmation(ctx, "someone@example.com", &pb.OrderResult{OrderId: "order-1"}, errors.New("email unavailable"))
+
+	jobs, err := queue.ClaimDue(context.Background(), 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].OrderID != "order-1" {
+		t.Fatalf("queued jobs = %+v, want the confirmation queued despite the cancelled call", jobs)
+	}
+	if traceID := span.SpanContext().TraceID().String(); !strings.Contains(jobs[0].Headers["traceparent"], traceID) {
+		t.Errorf("job headers = %v, want the trace %s", jobs[0].Headers, traceID)
+	}
+}
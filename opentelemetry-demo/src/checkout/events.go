@@ -0,0 +1,28 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"sort"
+
+	"github.com/IBM/sarama"
+
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/cloudevents"
+)
+
+// eventSource is the CloudEvents source of the events checkout publishes.
+const eventSource = "/oteldemo/checkout"
+
+// kafkaHeaders converts event headers to record headers, in a stable order.
+func kafkaHeaders(headers cloudevents.Headers) []sarama.RecordHeader {
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	records := make([]sarama.RecordHeader, len(keys))
+	for i, key := range keys {
+		records[i] = sarama.RecordHeader{Key: []byte(key), Value: []byte(headers[key])}
+	}
+	return records
+}
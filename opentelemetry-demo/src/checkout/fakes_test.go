@@ -0,0 +1,614 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/cloudevents"
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/db/postgres"
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+)
+
+// fakes are in-process stand-ins for every service checkout calls. Each one
+// records the requests it gets and fails a call when its error for that call
+// is set.
+type fakes struct {
+	cart     *fakeCart
+	catalog  *fakeProductCatalog
+	currency *fakeCurrency
+	shipping *fakeShipping
+	payment  *fakePayment
+	email    *fakeEmail
+	// inventory, when set, is the inventory checkout reserves stock from.
+	inventory *fakeInventory
+
+	// emailOverGRPC connects checkout to the gRPC API of the email fake
+	// instead of its HTTP API.
+	emailOverGRPC bool
+}
+
+func newFakes() *fakes {
+	return &fakes{
+		cart: &fakeCart{items: map[string][]*pb.CartItem{}},
+		catalog: &fakeProductCatalog{products: map[string]*pb.Product{
+			"OLJCESPC7Z": {Id: "OLJCESPC7Z", Name: "Telescope", PriceUsd: &pb.Money{CurrencyCode: "USD", Units: 100, Nanos: 500000000}, Categories: []string{"telescopes"}},
+			"66VCHSJNUP": {Id: "66VCHSJNUP", Name: "Lens", PriceUsd: &pb.Money{CurrencyCode: "USD", Units: 20}, Categories: []string{"accessories"}},
+		}},
+		currency: &fakeCurrency{},
+		shipping: &fakeShipping{quote: &pb.Money{CurrencyCode: "USD", Units: 8, Nanos: 990000000}},
+		payment:  &fakePayment{},
+		email:    &fakeEmail{},
+	}
+}
+
+// startFakes serves the fakes over bufconn and the email fake over HTTP, and
+// returns a checkout service connected to them.
+func startFakes(t *testing.T, f *fakes) *checkout {
+	t.Helper()
+	return startFakesWithClients(t, f, defaultClientConfigs())
+}
+
+// startFakesWithClients is startFakes with the given client settings.
+func startFakesWithClients(t *testing.T, f *fakes, clients clientConfigs) *checkout {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	pb.RegisterCartServiceServer(srv, f.cart)
+	pb.RegisterProductCatalogServiceServer(srv, f.catalog)
+	pb.RegisterCurrencyServiceServer(srv, f.currency)
+	pb.RegisterShippingServiceServer(srv, f.shipping)
+	pb.RegisterPaymentServiceServer(srv, f.payment)
+	pb.RegisterEmailServiceServer(srv, f.email)
+	if f.inventory != nil {
+		pb.RegisterInventoryServiceServer(srv, f.inventory)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	emailSrv := httptest.NewServer(f.email)
+	t.Cleanup(emailSrv.Close)
+
+	const bufnet = "passthrough:///bufnet"
+	addrs := serviceAddrs{
+		ProductCatalog: bufnet,
+		Cart:           bufnet,
+		Currency:       bufnet,
+		Shipping:       bufnet,
+		Email:          emailSrv.URL,
+		Payment:        bufnet,
+	}
+	if f.emailOverGRPC {
+		addrs.EmailGRPC = bufnet
+	}
+	if f.inventory != nil {
+		addrs.Inventory = bufnet
+	}
+	svc, closeClients, err := newCheckout(addrs, clients, grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(closeClients)
+	return svc
+}
+
+type fakeCart struct {
+	pb.UnimplementedCartServiceServer
+
+	mu            sync.Mutex
+	items         map[string][]*pb.CartItem
+	getErr        error
+	emptyErr      error
+	addItemErr    error
+	restoredItems []*pb.CartItem
+}
+
+func (f *fakeCart) GetCart(_ context.Context, req *pb.GetCartRequest) (*pb.Cart, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.getErr != nil {
+		return nil, f.getErr
+	}
+	return &pb.Cart{UserId: req.GetUserId(), Items: f.items[req.GetUserId()]}, nil
+}
+
+func (f *fakeCart) EmptyCart(_ context.Context, req *pb.EmptyCartRequest) (*pb.Empty, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.emptyErr != nil {
+		return nil, f.emptyErr
+	}
+	delete(f.items, req.GetUserId())
+	return &pb.Empty{}, nil
+}
+
+func (f *fakeCart) AddItem(_ context.Context, req *pb.AddItemRequest) (*pb.Empty, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.addItemErr != nil {
+		return nil, f.addItemErr
+	}
+	f.items[req.GetUserId()] = append(f.items[req.GetUserId()], req.GetItem())
+	f.restoredItems = append(f.restoredItems, req.GetItem())
+	return &pb.Empty{}, nil
+}
+
+func (f *fakeCart) cartOf(userID string) []*pb.CartItem {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.items[userID]
+}
+
+type fakeProductCatalog struct {
+	pb.UnimplementedProductCatalogServiceServer
+
+	products map[string]*pb.Product
+	// delay is how long each lookup takes, and lookups of the products in
+	// block wait until they are cancelled.
+	delay time.Duration
+	block map[string]bool
+
+	mu          sync.Mutex
+	lookups     map[string]int
+	inFlight    int
+	maxInFlight int
+	cancelled   int
+}
+
+func (f *fakeProductCatalog) GetProduct(ctx context.Context, req *pb.GetProductRequest) (*pb.Product, error) {
+	f.mu.Lock()
+	if f.lookups == nil {
+		f.lookups = map[string]int{}
+	}
+	f.lookups[req.GetId()]++
+	f.inFlight++
+	f.maxInFlight = max(f.maxInFlight, f.inFlight)
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.inFlight--
+		f.mu.Unlock()
+	}()
+
+	if f.block[req.GetId()] {
+		<-ctx.Done()
+		f.mu.Lock()
+		f.cancelled++
+		f.mu.Unlock()
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	time.Sleep(f.delay)
+
+	product, ok := f.products[req.GetId()]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no product with ID %s", req.GetId())
+	}
+	return product, nil
+}
+
+// fakeCurrency converts from USD to EUR at a rate of 2, and leaves amounts
+// that are already in the target currency unchanged.
+type fakeCurrency struct {
+	pb.UnimplementedCurrencyServiceServer
+
+	mu         sync.Mutex
+	convertErr error
+	// unavailable is the number of calls still to fail with
+	// codes.Unavailable before Convert succeeds.
+	unavailable    int
+	calls          int
+	supportedErr   error
+	supportedCalls int
+}
+
+func (f *fakeCurrency) GetSupportedCurrencies(context.Context, *pb.Empty) (*pb.GetSupportedCurrenciesResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.supportedCalls++
+	if f.supportedErr != nil {
+		return nil, f.supportedErr
+	}
+	return &pb.GetSupportedCurrenciesResponse{CurrencyCodes: []string{"USD", "EUR"}}, nil
+}
+
+func (f *fakeCurrency) Convert(_ context.Context, req *pb.CurrencyConversionRequest) (*pb.Money, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.convertErr != nil {
+		return nil, f.convertErr
+	}
+	if f.unavailable > 0 {
+		f.unavailable--
+		return nil, status.Error(codes.Unavailable, "currency service unavailable")
+	}
+	from := req.GetFrom()
+	switch {
+	case from.GetCurrencyCode() == req.GetToCode():
+		return from, nil
+	case from.GetCurrencyCode() == "USD" && req.GetToCode() == "EUR":
+		nanos := int64(from.GetNanos()) * 2
+		return &pb.Money{
+			CurrencyCode: "EUR",
+			Units:        from.GetUnits()*2 + nanos/1e9,
+			Nanos:        int32(nanos % 1e9),
+		}, nil
+	}
+	return nil, status.Errorf(codes.InvalidArgument, "unsupported conversion %s to %s", from.GetCurrencyCode(), req.GetToCode())
+}
+
+type fakeShipping struct {
+	pb.UnimplementedShippingServiceServer
+
+	mu          sync.Mutex
+	quote       *pb.Money
+	quoteErr    error
+	shipErr     error
+	shipped     int
+	cancelled   []string
+	cancelError error
+}
+
+func (f *fakeShipping) GetQuote(context.Context, *pb.GetQuoteRequest) (*pb.GetQuoteResponse, error) {
+	if f.quoteErr != nil {
+		return nil, f.quoteErr
+	}
+	return &pb.GetQuoteResponse{CostUsd: f.quote}, nil
+}
+
+func (f *fakeShipping) ShipOrder(context.Context, *pb.ShipOrderRequest) (*pb.ShipOrderResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.shipErr != nil {
+		return nil, f.shipErr
+	}
+	f.shipped++
+	return &pb.ShipOrderResponse{TrackingId: "TRACK-1"}, nil
+}
+
+func (f *fakeShipping) CancelShipment(_ context.Context, req *pb.CancelShipmentRequest) (*pb.Empty, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.cancelError != nil {
+		return nil, f.cancelError
+	}
+	f.cancelled = append(f.cancelled, req.GetTrackingId())
+	return &pb.Empty{}, nil
+}
+
+type fakePayment struct {
+	pb.UnimplementedPaymentServiceServer
+
+	mu        sync.Mutex
+	chargeErr error
+	refundErr error
+	calls     int
+	charges   []*pb.ChargeRequest
+	refunds   []*pb.RefundRequest
+
+	// When set, Charge reports on charging and then waits for release.
+	charging chan struct{}
+	release  chan struct{}
+}
+
+func (f *fakePayment) Charge(ctx context.Context, req *pb.ChargeRequest) (*pb.ChargeResponse, error) {
+	if f.charging != nil {
+		f.charging <- struct{}{}
+		select {
+		case <-f.release:
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.chargeErr != nil {
+		return nil, f.chargeErr
+	}
+	f.charges = append(f.charges, req)
+	return &pb.ChargeResponse{TransactionId: "TX-1"}, nil
+}
+
+func (f *fakePayment) Refund(_ context.Context, req *pb.RefundRequest) (*pb.RefundResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.refundErr != nil {
+		return nil, f.refundErr
+	}
+	f.refunds = append(f.refunds, req)
+	return &pb.RefundResponse{RefundId: "REFUND-1"}, nil
+}
+
+// fakeInventory holds the stock of the products it was given for orders.
+// Other products are not tracked and never run out.
+type fakeInventory struct {
+	pb.UnimplementedInventoryServiceServer
+
+	mu           sync.Mutex
+	stock        map[string]int64
+	reservations map[string]*fakeReservation
+	commitErr    error
+	committed    []string
+	released     []string
+}
+
+type fakeReservation struct {
+	items     []*pb.CartItem
+	ttl       time.Duration
+	committed bool
+}
+
+func newFakeInventory(stock map[string]int64) *fakeInventory {
+	return &fakeInventory{stock: stock, reservations: map[string]*fakeReservation{}}
+}
+
+func (f *fakeInventory) ReserveStock(_ context.Context, req *pb.ReserveStockRequest) (*pb.ReserveStockResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	wanted := map[string]int64{}
+	for _, it := range req.GetItems() {
+		wanted[it.GetProductId()] += int64(it.GetQuantity())
+	}
+	for id, quantity := range wanted {
+		if available, tracked := f.stock[id]; tracked && available < quantity {
+			return nil, status.Errorf(codes.FailedPrecondition, "insufficient stock: %s: %d requested, %d available", id, quantity, available)
+		}
+	}
+	for id, quantity := range wanted {
+		if _, tracked := f.stock[id]; tracked {
+			f.stock[id] -= quantity
+		}
+	}
+	ttl := req.GetTtl().AsDuration()
+	f.reservations[req.GetReservationId()] = &fakeReservation{items: req.GetItems(), ttl: ttl}
+	return &pb.ReserveStockResponse{ExpiresAt: timestamppb.New(time.Now().Add(ttl))}, nil
+}
+
+func (f *fakeInventory) CommitReservation(_ context.Context, req *pb.CommitReservationRequest) (*pb.Empty, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.commitErr != nil {
+		return nil, f.commitErr
+	}
+	r, ok := f.reservations[req.GetReservationId()]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "reservation not found: %q", req.GetReservationId())
+	}
+	r.committed = true
+	f.committed = append(f.committed, req.GetReservationId())
+	return &pb.Empty{}, nil
+}
+
+func (f *fakeInventory) ReleaseReservation(_ context.Context, req *pb.ReleaseReservationRequest) (*pb.Empty, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.released = append(f.released, req.GetReservationId())
+	r, ok := f.reservations[req.GetReservationId()]
+	if !ok {
+		return &pb.Empty{}, nil
+	}
+	for _, it := range r.items {
+		if _, tracked := f.stock[it.GetProductId()]; tracked {
+			f.stock[it.GetProductId()] += int64(it.GetQuantity())
+		}
+	}
+	delete(f.reservations, req.GetReservationId())
+	return &pb.Empty{}, nil
+}
+
+func (f *fakeInventory) available(productID string) int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.stock[productID]
+}
+
+// fakeEmail accepts order confirmations both over gRPC and over the HTTP API
+// of the email service.
+type fakeEmail struct {
+	pb.UnimplementedEmailServiceServer
+
+	mu         sync.Mutex
+	statusCode int
+	sent       []*pb.SendOrderConfirmationRequest
+}
+
+func (f *fakeEmail) SendOrderConfirmation(_ context.Context, req *pb.SendOrderConfirmationRequest) (*pb.Empty, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, req)
+	return &pb.Empty{}, nil
+}
+
+func (f *fakeEmail) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/send_order_confirmation" {
+		http.NotFound(w, r)
+		return
+	}
+	var body struct {
+		Email string          `json:"email"`
+		Order json.RawMessage `json:"order"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	order := new(pb.OrderResult)
+	if err := protojson.Unmarshal(body.Order, order); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.statusCode != 0 && f.statusCode != http.StatusOK {
+		w.WriteHeader(f.statusCode)
+		return
+	}
+	f.sent = append(f.sent, &pb.SendOrderConfirmationRequest{Email: body.Email, Order: order})
+}
+
+func (f *fakeEmail) confirmations() []*pb.SendOrderConfirmationRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*pb.SendOrderConfirmationRequest(nil), f.sent...)
+}
+
+// fakeOrders is an in-memory orderRepository.
+type fakeOrders struct {
+	mu        sync.Mutex
+	createErr error
+	// completeErr fails CompleteCancel, leaving the order claimed.
+	completeErr error
+	orders      []*postgres.Order
+	events      []*postgres.OutboxEvent
+	// claims holds the cancellation claim of each order being cancelled,
+	// and refunds the refunds recorded for them.
+	claims  map[string]*postgres.CancelClaim
+	refunds map[string]string
+}
+
+func (f *fakeOrders) CreateOrder(_ context.Context, order *postgres.Order, events ...*postgres.OutboxEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.createErr != nil {
+		return f.createErr
+	}
+	f.orders = append(f.orders, order)
+	f.events = append(f.events, events...)
+	return nil
+}
+
+func (f *fakeOrders) GetOrder(_ context.Context, id string) (*postgres.Order, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.find(id), nil
+}
+
+func (f *fakeOrders) ListOrdersForUser(context.Context, string, int, *postgres.OrderCursor) ([]*postgres.Order, *postgres.OrderCursor, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.orders, nil, nil
+}
+
+func (f *fakeOrders) BeginCancel(_ context.Context, id string, lease time.Duration) (*postgres.CancelClaim, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	order := f.find(id)
+	if order == nil {
+		return nil, nil
+	}
+	if held := f.claims[id]; order.Status != postgres.OrderStatusPlaced &&
+		(order.Status != postgres.OrderStatusCancelling || held == nil || time.Since(held.ClaimedAt) < lease) {
+		return nil, nil
+	}
+	_, refunded := f.refunds[id]
+	claim := &postgres.CancelClaim{ClaimedAt: time.Now(), Refunded: refunded}
+	if f.claims == nil {
+		f.claims = make(map[string]*postgres.CancelClaim)
+	}
+	f.claims[id] = claim
+	order.Status = postgres.OrderStatusCancelling
+	return claim, nil
+}
+
+func (f *fakeOrders) RecordRefund(_ context.Context, id string, claim *postgres.CancelClaim, refundID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.claimed(id, claim) == nil {
+		return fmt.Errorf("order %s is not claimed by this call", id)
+	}
+	if f.refunds == nil {
+		f.refunds = make(map[string]string)
+	}
+	f.refunds[id] = refundID
+	return nil
+}
+
+func (f *fakeOrders) CompleteCancel(_ context.Context, id string, claim *postgres.CancelClaim, reason string, events ...*postgres.OutboxEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.completeErr != nil {
+		return f.completeErr
+	}
+	order := f.claimed(id, claim)
+	if order == nil {
+		return fmt.Errorf("order %s is not claimed by this call", id)
+	}
+	now := time.Now()
+	order.Status = postgres.OrderStatusCancelled
+	order.CancelReason, order.CancelledAt = reason, &now
+	f.events = append(f.events, events...)
+	return nil
+}
+
+func (f *fakeOrders) AbandonCancel(_ context.Context, id string, claim *postgres.CancelClaim) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if order := f.claimed(id, claim); order != nil {
+		order.Status = postgres.OrderStatusPlaced
+		delete(f.claims, id)
+	}
+	return nil
+}
+
+func (f *fakeOrders) find(id string) *postgres.Order {
+	for _, order := range f.orders {
+		if order.ID == id {
+			return order
+		}
+	}
+	return nil
+}
+
+// claimed returns the order if it is being cancelled under claim.
+func (f *fakeOrders) claimed(id string, claim *postgres.CancelClaim) *postgres.Order {
+	order := f.find(id)
+	if order == nil || order.Status != postgres.OrderStatusCancelling || f.claims[id] != claim {
+		return nil
+	}
+	return order
+}
+
+// decodeEvent decodes an event published to Kafka or the outbox into msg
+// and returns its attributes.
+func decodeEvent(t *testing.T, headers map[string]string, payload []byte, msg proto.Message) cloudevents.Event {
+	t.Helper()
+	event, err := cloudevents.Decode(cloudevents.Headers(headers), payload, msg)
+	if err != nil {
+		t.Fatalf("failed to decode event: %v", err)
+	}
+	if event.SpecVersion != cloudevents.SpecVersion {
+		t.Errorf("event has spec version %q, want %q", event.SpecVersion, cloudevents.SpecVersion)
+	}
+	return event
+}
+
+// recordHeaders returns the headers of a Kafka message as a map.
+func recordHeaders(headers []sarama.RecordHeader) map[string]string {
+	m := make(map[string]string, len(headers))
+	for _, h := range headers {
+		m[string(h.Key)] = string(h.Value)
+	}
+	return m
+}
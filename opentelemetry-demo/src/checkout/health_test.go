@@ -0,0 +1,71 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/health"
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+)
+
+func checkHealth(t *testing.T, svc *checkout, name string) healthpb.HealthCheckResponse_ServingStatus {
+	t.Helper()
+	resp, err := svc.health.Check(context.Background(), &healthpb.HealthCheckRequest{Service: name})
+	if err != nil {
+		t.Fatalf("Check(%q) error = %v", name, err)
+	}
+	return resp.GetStatus()
+}
+
+func TestHealthProbesDependencies(t *testing.T) {
+	svc := startFakes(t, newFakes())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	svc.health.Update(ctx)
+
+	for _, name := range []string{"", health.Readiness, pb.CheckoutService_ServiceDesc.ServiceName, "cart", "payment", health.Liveness} {
+		if got := checkHealth(t, svc, name); got != healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("%q = %v, want SERVING", name, got)
+		}
+	}
+}
+
+func TestHealthReportsUnreachableDependencies(t *testing.T) {
+	const down = "passthrough:///down"
+	svc, closeClients, err := newCheckout(serviceAddrs{
+		ProductCatalog: down,
+		Cart:           down,
+		Currency:       down,
+		Shipping:       down,
+		Email:          "http://localhost",
+		Payment:        down,
+	}, defaultClientConfigs(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return nil, errors.New("connection refused")
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeClients()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	svc.health.Update(ctx)
+
+	for _, name := range []string{"", pb.CheckoutService_ServiceDesc.ServiceName, "cart"} {
+		if got := checkHealth(t, svc, name); got != healthpb.HealthCheckResponse_NOT_SERVING {
+			t.Errorf("%q = %v, want NOT_SERVING", name, got)
+		}
+	}
+	if got := checkHealth(t, svc, health.Liveness); got != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("liveness = %v, want SERVING", got)
+	}
+}
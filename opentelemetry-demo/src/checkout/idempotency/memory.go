@@ -0,0 +1,112 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package idempotency
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	key         string
+	fingerprint string
+	completed   bool
+	response    []byte
+	lockedAt    time.Time
+}
+
+// MemoryStore is an in-memory Store that keeps the most recently used keys
+// up to a fixed capacity. It is meant for tests and single-replica setups;
+// keys are lost on restart.
+type MemoryStore struct {
+	capacity    int
+	lockTimeout time.Duration
+	now         func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// NewMemoryStore creates a MemoryStore holding at most capacity keys. An
+// in-progress key older than lockTimeout is assumed to belong to a request
+// that died and can be claimed again.
+func NewMemoryStore(capacity int, lockTimeout time.Duration) *MemoryStore {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &MemoryStore{
+		capacity:    capacity,
+		lockTimeout: lockTimeout,
+		now:         time.Now,
+		order:       list.New(),
+		entries:     make(map[string]*list.Element),
+	}
+}
+
+// Begin implements Store.
+func (s *MemoryStore) Begin(_ context.Context, key, fingerprint string) (*Claim, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if el, ok := s.entries[key]; ok {
+		e := el.Value.(*memoryEntry)
+		s.order.MoveToFront(el)
+		if e.fingerprint != fingerprint {
+			return nil, nil, ErrMismatch
+		}
+		if e.completed {
+			return nil, e.response, nil
+		}
+		if now.Sub(e.lockedAt) < s.lockTimeout {
+			return nil, nil, ErrInProgress
+		}
+		e.lockedAt = now
+		return &Claim{key: key, fingerprint: fingerprint, lockedAt: now}, nil, nil
+	}
+
+	s.entries[key] = s.order.PushFront(&memoryEntry{key: key, fingerprint: fingerprint, lockedAt: now})
+	for s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryEntry).key)
+	}
+	return &Claim{key: key, fingerprint: fingerprint, lockedAt: now}, nil, nil
+}
+
+// Complete implements Store. A key evicted while it was claimed is added
+// back.
+func (s *MemoryStore) Complete(_ context.Context, claim *Claim, response []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[claim.key]
+	if !ok {
+		el = s.order.PushFront(&memoryEntry{key: claim.key, fingerprint: claim.fingerprint, lockedAt: claim.lockedAt})
+		s.entries[claim.key] = el
+	}
+	e := el.Value.(*memoryEntry)
+	if e.completed || !e.lockedAt.Equal(claim.lockedAt) {
+		return ErrNotClaimed
+	}
+	e.completed = true
+	e.response = response
+	return nil
+}
+
+// Abandon implements Store.
+func (s *MemoryStore) Abandon(_ context.Context, claim *Claim) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[claim.key]; ok {
+		if e := el.Value.(*memoryEntry); !e.completed && e.lockedAt.Equal(claim.lockedAt) {
+			s.order.Remove(el)
+			delete(s.entries, claim.key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreLifecycle(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(10, time.Minute)
+
+	claim, resp, err := s.Begin(ctx, "k", "req")
+	if err != nil || claim == nil || resp != nil {
+		t.Fatalf("first Begin() = %v, %q, %v; want a claim", claim, resp, err)
+	}
+	if _, _, err := s.Begin(ctx, "k", "req"); !errors.Is(err, ErrInProgress) {
+		t.Fatalf("concurrent Begin() error = %v, want %v", err, ErrInProgress)
+	}
+	if err := s.Complete(ctx, claim, []byte("order")); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	claim, resp, err = s.Begin(ctx, "k", "req")
+	if err != nil || claim != nil || string(resp) != "order" {
+		t.Fatalf("repeated Begin() = %v, %q, %v; want %q", claim, resp, err, "order")
+	}
+}
+
+func TestMemoryStoreMismatch(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(10, time.Minute)
+
+	claim, _, _ := s.Begin(ctx, "k", "req")
+	if _, _, err := s.Begin(ctx, "k", "other"); !errors.Is(err, ErrMismatch) {
+		t.Errorf("Begin() of an in-progress key with another request error = %v, want %v", err, ErrMismatch)
+	}
+	_ = s.Complete(ctx, claim, []byte("order"))
+	if _, resp, err := s.Begin(ctx, "k", "other"); !errors.Is(err, ErrMismatch) || resp != nil {
+		t.Errorf("Begin() of a completed key with another request = %q, %v; want %v", resp, err, ErrMismatch)
+	}
+}
+
+func TestMemoryStoreAbandon(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(10, time.Minute)
+
+	claim, _, _ := s.Begin(ctx, "k", "req")
+	if err := s.Abandon(ctx, claim); err != nil {
+		t.Fatalf("Abandon() error = %v", err)
+	}
+	claim, resp, err := s.Begin(ctx, "k", "req")
+	if err != nil || claim == nil || resp != nil {
+		t.Fatalf("Begin() after Abandon = %v, %q, %v; want a claim", claim, resp, err)
+	}
+
+	_ = s.Complete(ctx, claim, []byte("order"))
+	_ = s.Abandon(ctx, claim)
+	if _, resp, _ := s.Begin(ctx, "k", "req"); string(resp) != "order" {
+		t.Errorf("Abandon() dropped a completed key")
+	}
+}
+
+func TestMemoryStoreLockTimeout(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	s := NewMemoryStore(10, time.Minute)
+	s.now = func() time.Time { return now }
+
+	stale, _, _ := s.Begin(ctx, "k", "req")
+	now = now.Add(2 * time.Minute)
+	claim, resp, err := s.Begin(ctx, "k", "req")
+	if err != nil || claim == nil || resp != nil {
+		t.Fatalf("Begin() of a stale key = %v, %q, %v; want a claim", claim, resp, err)
+	}
+
+	// The request that lost the key can neither complete nor release it.
+	if err := s.Complete(ctx, stale, []byte("stale")); !errors.Is(err, ErrNotClaimed) {
+		t.Errorf("Complete() of a taken over claim error = %v, want %v", err, ErrNotClaimed)
+	}
+	_ = s.Abandon(ctx, stale)
+	if _, _, err := s.Begin(ctx, "k", "req"); !errors.Is(err, ErrInProgress) {
+		t.Errorf("Begin() after Abandon() of a taken over claim error = %v, want %v", err, ErrInProgress)
+	}
+	if err := s.Complete(ctx, claim, []byte("order")); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if _, resp, _ := s.Begin(ctx, "k", "req"); string(resp) != "order" {
+		t.Errorf("Begin() = %q, want the response of the current claim", resp)
+	}
+}
+
+func TestMemoryStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(2, time.Minute)
+
+	for _, k := range []string{"a", "b"} {
+		claim, _, _ := s.Begin(ctx, k, "req")
+		_ = s.Complete(ctx, claim, []byte(k))
+	}
+	_, _, _ = s.Begin(ctx, "a", "req") // a is now the most recently used key
+	_, _, _ = s.Begin(ctx, "c", "req")
+
+	if _, resp, _ := s.Begin(ctx, "a", "req"); string(resp) != "a" {
+		t.Errorf("key %q was evicted, want it kept", "a")
+	}
+	if claim, resp, err := s.Begin(ctx, "b", "req"); err != nil || claim == nil || resp != nil {
+		t.Errorf("key %q was kept, want it evicted", "b")
+	}
+}
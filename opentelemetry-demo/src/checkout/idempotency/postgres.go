@@ -0,0 +1,102 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	stateInProgress = "in_progress"
+	stateCompleted  = "completed"
+)
+
+// PostgresStore is a Store backed by the checkout_idempotency_keys table
+// created by the db/migrations V4 migration. It is shared by all checkout
+// replicas.
+type PostgresStore struct {
+	db          *sql.DB
+	lockTimeout time.Duration
+}
+
+// NewPostgresStore creates a PostgresStore. An in-progress key older than
+// lockTimeout is assumed to belong to a request that died and can be claimed
+// again.
+func NewPostgresStore(db *sql.DB, lockTimeout time.Duration) *PostgresStore {
+	return &PostgresStore{db: db, lockTimeout: lockTimeout}
+}
+
+// Begin implements Store.
+func (s *PostgresStore) Begin(ctx context.Context, key, fingerprint string) (*Claim, []byte, error) {
+	// Claim the key if it is new, or take it over if the request holding it
+	// has not been heard of for longer than the lock timeout.
+	claim := &Claim{key: key, fingerprint: fingerprint}
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO checkout_idempotency_keys (idempotency_key, request_fingerprint, state, locked_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (idempotency_key) DO UPDATE SET locked_at = NOW()
+		WHERE checkout_idempotency_keys.state = $3
+		  AND checkout_idempotency_keys.request_fingerprint = $2
+		  AND checkout_idempotency_keys.locked_at < NOW() - make_interval(secs => $4)
+		RETURNING locked_at
+	`, key, fingerprint, stateInProgress, s.lockTimeout.Seconds()).Scan(&claim.lockedAt)
+	if err == nil {
+		return claim, nil, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+
+	var stored, state string
+	var response []byte
+	err = s.db.QueryRowContext(ctx,
+		"SELECT request_fingerprint, state, response FROM checkout_idempotency_keys WHERE idempotency_key = $1",
+		key,
+	).Scan(&stored, &state, &response)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The holder abandoned the key between the two statements.
+		return nil, nil, ErrInProgress
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("failed to read idempotency key: %w", err)
+	}
+	if stored != fingerprint {
+		return nil, nil, ErrMismatch
+	}
+	if state == stateCompleted {
+		return nil, response, nil
+	}
+	return nil, nil, ErrInProgress
+}
+
+// Complete implements Store.
+func (s *PostgresStore) Complete(ctx context.Context, claim *Claim, response []byte) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE checkout_idempotency_keys
+		SET state = $3, response = $4, completed_at = NOW()
+		WHERE idempotency_key = $1 AND state = $5 AND locked_at = $2
+	`, claim.key, claim.lockedAt, stateCompleted, response, stateInProgress)
+	if err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	} else if n != 1 {
+		return ErrNotClaimed
+	}
+	return nil
+}
+
+// Abandon implements Store.
+func (s *PostgresStore) Abandon(ctx context.Context, claim *Claim) error {
+	_, err := s.db.ExecContext(ctx,
+		"DELETE FROM checkout_idempotency_keys WHERE idempotency_key = $1 AND state = $3 AND locked_at = $2",
+		claim.key, claim.lockedAt, stateInProgress,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to abandon idempotency key: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPostgresStoreBegin(t *testing.T) {
+	lockedAt := time.Unix(0, 0)
+	tests := []struct {
+		name      string
+		claimed   bool
+		rows      *sqlmock.Rows
+		wantClaim bool
+		wantResp  string
+		wantErr   error
+	}{
+		{"claimed", true, nil, true, "", nil},
+		{"completed", false, sqlmock.NewRows([]string{"request_fingerprint", "state", "response"}).AddRow("req", "completed", []byte("order")), false, "order", nil},
+		{"in progress", false, sqlmock.NewRows([]string{"request_fingerprint", "state", "response"}).AddRow("req", "in_progress", nil), false, "", ErrInProgress},
+		{"other request", false, sqlmock.NewRows([]string{"request_fingerprint", "state", "response"}).AddRow("other", "completed", []byte("order")), false, "", ErrMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Error creating mock DB: %v", err)
+			}
+			defer db.Close()
+
+			claimRows := sqlmock.NewRows([]string{"locked_at"})
+			if tt.claimed {
+				claimRows.AddRow(lockedAt)
+			}
+			mock.ExpectQuery("INSERT INTO checkout_idempotency_keys").
+				WithArgs("k", "req", "in_progress", float64(60)).
+				WillReturnRows(claimRows)
+			if tt.rows != nil {
+				mock.ExpectQuery("SELECT request_fingerprint, state, response FROM checkout_idempotency_keys").
+					WithArgs("k").
+					WillReturnRows(tt.rows)
+			}
+
+			s := NewPostgresStore(db, time.Minute)
+			claim, resp, err := s.Begin(context.Background(), "k", "req")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Begin() error = %v, want %v", err, tt.wantErr)
+			}
+			if (claim != nil) != tt.wantClaim {
+				t.Errorf("Begin() claim = %v, want claimed %v", claim, tt.wantClaim)
+			}
+			if string(resp) != tt.wantResp {
+				t.Errorf("Begin() response = %q, want %q", resp, tt.wantResp)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestPostgresStoreCompleteAndAbandon(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	claim := &Claim{key: "k", fingerprint: "req", lockedAt: time.Unix(0, 0)}
+	mock.ExpectExec("UPDATE checkout_idempotency_keys").
+		WithArgs("k", claim.lockedAt, "completed", []byte("order"), "in_progress").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM checkout_idempotency_keys").
+		WithArgs("k", claim.lockedAt, "in_progress").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	s := NewPostgresStore(db, time.Minute)
+	if err := s.Complete(context.Background(), claim, []byte("order")); err != nil {
+		t.Errorf("Complete() error = %v", err)
+	}
+	if err := s.Abandon(context.Background(), claim); err != nil {
+		t.Errorf("Abandon() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPostgresStoreCompleteAfterTakeover(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	// Another request took the key over, so its locked_at no longer matches.
+	mock.ExpectExec("UPDATE checkout_idempotency_keys").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	s := NewPostgresStore(db, time.Minute)
+	claim := &Claim{key: "k", fingerprint: "req", lockedAt: time.Unix(0, 0)}
+	if err := s.Complete(context.Background(), claim, []byte("order")); !errors.Is(err, ErrNotClaimed) {
+		t.Errorf("Complete() error = %v, want %v", err, ErrNotClaimed)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package idempotency remembers the outcome of requests by a client-supplied
+// key so that a retried request returns the original response instead of
+// being executed a second time.
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrInProgress is returned by Store.Begin when another request holds
+	// the key and has not finished yet.
+	ErrInProgress = errors.New("idempotency: a request with this key is still in progress")
+
+	// ErrMismatch is returned by Store.Begin when the key was used for a
+	// request with another fingerprint.
+	ErrMismatch = errors.New("idempotency: the key was used for a different request")
+
+	// ErrNotClaimed is returned by Store.Complete when the claim has been
+	// taken over by another request after the lock timeout.
+	ErrNotClaimed = errors.New("idempotency: the key is no longer claimed by this request")
+)
+
+// Claim is a key claimed by Store.Begin. It is passed back to Complete and
+// Abandon, which only act on the key while the claim is still held.
+type Claim struct {
+	key         string
+	fingerprint string
+	lockedAt    time.Time
+}
+
+// Store keeps idempotency keys, the fingerprint of the request each key was
+// used for and the responses recorded for them.
+type Store interface {
+	// Begin claims key for a new request identified by fingerprint. It
+	// returns a claim when the request should run, the stored response when
+	// a previous request with the same key has completed, ErrInProgress when
+	// another request currently holds the key, or ErrMismatch when the key
+	// was used for a request with another fingerprint.
+	Begin(ctx context.Context, key, fingerprint string) (*Claim, []byte, error)
+
+	// Complete records the response of a claimed key. Later calls to Begin
+	// with the same key return it.
+	Complete(ctx context.Context, claim *Claim, response []byte) error
+
+	// Abandon releases a claimed key without recording a response, so that
+	// the request can be retried with the same key after a failure.
+	Abandon(ctx context.Context, claim *Claim) error
+}
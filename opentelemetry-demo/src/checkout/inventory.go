@@ -0,0 +1,62 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+)
+
+// defaultReservationTTL is how long the stock of an order is held by
+// default. It outlasts the default PLACE_ORDER_TIMEOUT, so a reservation
+// only expires for orders that were abandoned.
+const defaultReservationTTL = time.Minute
+
+// reserveStock holds the stock of items under the id of the order. It fails
+// with codes.FailedPrecondition when some of the items are out of stock. A
+// reservation that reached the inventory before the call failed expires on
+// its own.
+func (cs *checkout) reserveStock(ctx context.Context, orderID string, items []*pb.CartItem) error {
+	resp, err := cs.inventorySvcClient.ReserveStock(ctx, &pb.ReserveStockRequest{
+		ReservationId: orderID,
+		Items:         items,
+		Ttl:           durationpb.New(cs.reservationTTL),
+	})
+	if err != nil {
+		if status.Code(err) == codes.FailedPrecondition {
+			return status.Errorf(codes.FailedPrecondition, "out of stock: %s", status.Convert(err).Message())
+		}
+		return status.Errorf(codes.Unavailable, "failed to reserve stock: %+v", err)
+	}
+	trace.SpanFromContext(ctx).AddEvent("reserved", trace.WithAttributes(
+		attribute.String("app.inventory.reservation.expires_at", resp.GetExpiresAt().AsTime().Format(time.RFC3339)),
+	))
+	return nil
+}
+
+// commitStock takes the stock reserved for the order off hand, once it has
+// been paid for.
+func (cs *checkout) commitStock(ctx context.Context, orderID string) error {
+	if _, err := cs.inventorySvcClient.CommitReservation(ctx, &pb.CommitReservationRequest{ReservationId: orderID}); err != nil {
+		return fmt.Errorf("failed to commit stock reservation %q: %+v", orderID, err)
+	}
+	return nil
+}
+
+// releaseStock returns the stock of the order, whether it is still reserved
+// or was already committed.
+func (cs *checkout) releaseStock(ctx context.Context, orderID string) error {
+	if _, err := cs.inventorySvcClient.ReleaseReservation(ctx, &pb.ReleaseReservationRequest{ReservationId: orderID}); err != nil {
+		return fmt.Errorf("failed to release stock reservation %q: %+v", orderID, err)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestPlaceOrderReservesStock(t *testing.T) {
+	f := newFakes()
+	f.cart.items[testUserID] = testCart()
+	f.inventory = newFakeInventory(map[string]int64{"OLJCESPC7Z": 5})
+	svc := startFakes(t, f)
+	svc.reservationTTL = 30 * time.Second
+
+	resp, err := svc.PlaceOrder(context.Background(), testOrderRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	orderID := resp.GetOrder().GetOrderId()
+	if len(f.inventory.committed) != 1 || f.inventory.committed[0] != orderID {
+		t.Errorf("committed reservations = %v, want [%s]", f.inventory.committed, orderID)
+	}
+	if ttl := f.inventory.reservations[orderID].ttl; ttl != 30*time.Second {
+		t.Errorf("reservation ttl = %v, want 30s", ttl)
+	}
+	if got := f.inventory.available("OLJCESPC7Z"); got != 3 {
+		t.Errorf("available telescopes = %d, want 3", got)
+	}
+	if len(f.inventory.released) != 0 {
+		t.Errorf("released reservations = %v, want none", f.inventory.released)
+	}
+}
+
+func TestPlaceOrderOutOfStock(t *testing.T) {
+	f := newFakes()
+	f.cart.items[testUserID] = testCart()
+	f.inventory = newFakeInventory(map[string]int64{"OLJCESPC7Z": 1})
+	svc := startFakes(t, f)
+
+	_, err := svc.PlaceOrder(context.Background(), testOrderRequest())
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("PlaceOrder() error = %v, want FailedPrecondition", err)
+	}
+	if f.payment.calls != 0 {
+		t.Errorf("expected no charge, got %d", f.payment.calls)
+	}
+	if len(f.cart.cartOf(testUserID)) == 0 {
+		t.Error("expected the cart to be kept")
+	}
+	if got := f.inventory.available("OLJCESPC7Z"); got != 1 {
+		t.Errorf("available telescopes = %d, want 1", got)
+	}
+}
+
+func TestPlaceOrderReleasesStock(t *testing.T) {
+	tests := []struct {
+		name       string
+		setup      func(f *fakes)
+		wantCode   codes.Code
+		wantRefund bool
+	}{
+		{
+			name:     "ChargeFails",
+			setup:    func(f *fakes) { f.payment.chargeErr = status.Error(codes.InvalidArgument, "card declined") },
+			wantCode: codes.Internal,
+		},
+		{
+			name:       "CommitFails",
+			setup:      func(f *fakes) { f.inventory.commitErr = status.Error(codes.NotFound, "reservation not found") },
+			wantCode:   codes.Aborted,
+			wantRefund: true,
+		},
+		{
+			name:       "ShippingFails",
+			setup:      func(f *fakes) { f.shipping.shipErr = status.Error(codes.Internal, "no carrier") },
+			wantCode:   codes.Unavailable,
+			wantRefund: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakes()
+			f.cart.items[testUserID] = testCart()
+			f.inventory = newFakeInventory(map[string]int64{"OLJCESPC7Z": 5})
+			tt.setup(f)
+			svc := startFakes(t, f)
+
+			_, err := svc.PlaceOrder(context.Background(), testOrderRequest())
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("PlaceOrder() error = %v, want %v", err, tt.wantCode)
+			}
+			if len(f.inventory.released) != 1 {
+				t.Errorf("released reservations = %v, want one", f.inventory.released)
+			}
+			if got := f.inventory.available("OLJCESPC7Z"); got != 5 {
+				t.Errorf("available telescopes = %d, want 5", got)
+			}
+			if refunded := len(f.payment.refunds) == 1; refunded != tt.wantRefund {
+				t.Errorf("refunds = %v, want refunded %v", f.payment.refunds, tt.wantRefund)
+			}
+		})
+	}
+}
+
+func TestPlaceOrderConcurrentNeverOversells(t *testing.T) {
+	f := newFakes()
+	f.inventory = newFakeInventory(map[string]int64{"OLJCESPC7Z": 7})
+	svc := startFakes(t, f)
+
+	// Every order takes two telescopes, so only three of them can be placed.
+	const users = 10
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		placed int
+	)
+	for i := 0; i < users; i++ {
+		f.cart.items[fmt.Sprintf("user-%d", i)] = testCart()
+	}
+	for i := 0; i < users; i++ {
+		userID := fmt.Sprintf("user-%d", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := testOrderRequest()
+			req.UserId = userID
+			_, err := svc.PlaceOrder(context.Background(), req)
+			switch status.Code(err) {
+			case codes.OK:
+				mu.Lock()
+				placed++
+				mu.Unlock()
+			case codes.FailedPrecondition:
+			default:
+				t.Errorf("PlaceOrder(%s) error = %v", userID, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if placed != 3 {
+		t.Errorf("placed %d orders, want 3", placed)
+	}
+	if len(f.payment.charges) != placed {
+		t.Errorf("charged %d orders, want %d", len(f.payment.charges), placed)
+	}
+	if got := f.inventory.available("OLJCESPC7Z"); got != 1 {
+		t.Errorf("available telescopes = %d, want 1", got)
+	}
+}
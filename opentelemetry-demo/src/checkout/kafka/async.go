@@ -0,0 +1,231 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/IBM/sarama"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrProducerClosed is returned by Send after Close, and is the result of any
+// message that was still unacknowledged when the producer shut down.
+var ErrProducerClosed = errors.New("kafka: producer is closed")
+
+// Result is the outcome of producing a single message.
+type Result struct {
+	Partition int32
+	Offset    int64
+	Err       error
+}
+
+// Future resolves to the Result of the message it was returned for.
+type Future struct {
+	done   chan struct{}
+	result Result
+}
+
+func newFuture() *Future {
+	return &Future{done: make(chan struct{})}
+}
+
+func (f *Future) resolve(result Result) {
+	f.result = result
+	close(f.done)
+}
+
+// Done is closed once the result is available.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the message is acknowledged or failed, and returns its
+// Result. The error is only set when ctx is done first; a failed send is
+// reported through Result.Err.
+func (f *Future) Wait(ctx context.Context) (Result, error) {
+	select {
+	case <-f.done:
+		return f.result, nil
+	case <-ctx.Done():
+		return Result{}, ctx.Err()
+	}
+}
+
+// correlation replaces the Metadata of messages in flight so acks can be
+// matched with the Future of the message they belong to.
+type correlation struct {
+	id       uint64
+	metadata interface{}
+}
+
+// Producer wraps a sarama.AsyncProducer so that callers sharing it each get
+// the acknowledgement of their own message. A single goroutine reads the
+// Successes and Errors channels, so no one else may read from them. The
+// wrapped producer must have Producer.Return.Successes and
+// Producer.Return.Errors enabled.
+type Producer struct {
+	producer sarama.AsyncProducer
+	log      *logrus.Logger
+
+	// client and topic are set when the producer owns its client, which is
+	// then used by Ping and closed with the producer.
+	client sarama.Client
+	topic  string
+
+	// closeMu is held for reading while a message is handed to the input
+	// channel, so Close never closes it under a sender.
+	closeMu sync.RWMutex
+	closed  bool
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]*Future
+
+	dispatched chan struct{}
+}
+
+// NewProducer wraps producer and starts dispatching its acknowledgements.
+func NewProducer(producer sarama.AsyncProducer, log *logrus.Logger) *Producer {
+	p := &Producer{
+		producer:   producer,
+		log:        log,
+		pending:    make(map[uint64]*Future),
+		dispatched: make(chan struct{}),
+	}
+	go p.dispatch()
+	return p
+}
+
+// Send queues msg and returns the Future of its result. It blocks until the
+// producer accepts the message or ctx is done. The message must not be
+// reused until the Future resolves.
+func (p *Producer) Send(ctx context.Context, msg *sarama.ProducerMessage) (*Future, error) {
+	p.closeMu.RLock()
+	defer p.closeMu.RUnlock()
+	if p.closed {
+		return nil, ErrProducerClosed
+	}
+
+	future := newFuture()
+	p.mu.Lock()
+	p.nextID++
+	id := p.nextID
+	p.pending[id] = future
+	p.mu.Unlock()
+
+	metadata := msg.Metadata
+	msg.Metadata = correlation{id: id, metadata: metadata}
+
+	select {
+	case p.producer.Input() <- msg:
+		return future, nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		delete(p.pending, id)
+		p.mu.Unlock()
+		msg.Metadata = metadata
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops accepting messages, waits for the ones in flight to be
+// acknowledged or failed, and shuts down the wrapped producer.
+func (p *Producer) Close() error {
+	p.closeMu.Lock()
+	if p.closed {
+		p.closeMu.Unlock()
+		<-p.dispatched
+		return nil
+	}
+	p.closed = true
+	p.producer.AsyncClose()
+	p.closeMu.Unlock()
+
+	<-p.dispatched
+
+	p.mu.Lock()
+	for id, future := range p.pending {
+		future.resolve(Result{Partition: -1, Offset: -1, Err: ErrProducerClosed})
+		delete(p.pending, id)
+	}
+	p.mu.Unlock()
+
+	if p.client != nil {
+		return p.client.Close()
+	}
+	return nil
+}
+
+// Ping checks that the brokers can be reached by refreshing the metadata of
+// the producer's topic. It always succeeds for producers created with
+// NewProducer, which have no client of their own to ask.
+func (p *Producer) Ping(ctx context.Context) error {
+	p.closeMu.RLock()
+	closed := p.closed
+	p.closeMu.RUnlock()
+	if closed {
+		return ErrProducerClosed
+	}
+	if p.client == nil {
+		return nil
+	}
+
+	// Sarama does not take a context, so a refresh that outlives ctx is
+	// left to finish on its own within the client's timeouts.
+	refreshed := make(chan error, 1)
+	go func() {
+		refreshed <- p.client.RefreshMetadata(p.topic)
+	}()
+	select {
+	case err := <-refreshed:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Producer) dispatch() {
+	defer close(p.dispatched)
+
+	successes, errs := p.producer.Successes(), p.producer.Errors()
+	for successes != nil || errs != nil {
+		select {
+		case msg, ok := <-successes:
+			if !ok {
+				successes = nil
+				continue
+			}
+			p.complete(msg, Result{Partition: msg.Partition, Offset: msg.Offset})
+		case perr, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			// We will log to STDOUT if we're not able to produce messages.
+			p.log.Errorf("Failed to write message: %+v", perr)
+			if perr.Msg != nil {
+				p.complete(perr.Msg, Result{Partition: perr.Msg.Partition, Offset: perr.Msg.Offset, Err: perr.Err})
+			}
+		}
+	}
+}
+
+func (p *Producer) complete(msg *sarama.ProducerMessage, result Result) {
+	c, ok := msg.Metadata.(correlation)
+	if !ok {
+		return
+	}
+	msg.Metadata = c.metadata
+
+	p.mu.Lock()
+	future := p.pending[c.id]
+	delete(p.pending, c.id)
+	p.mu.Unlock()
+
+	if future != nil {
+		future.resolve(result)
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package kafka
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/sirupsen/logrus"
+)
+
+func newTestLogger() *logrus.Logger {
+	log := logrus.New()
+	log.Out = io.Discard
+	return log
+}
+
+func newMockProducer(t *testing.T) *mocks.AsyncProducer {
+	config := mocks.NewTestConfig()
+	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
+	return mocks.NewAsyncProducer(t, config)
+}
+
+func TestProducerResolvesEachMessage(t *testing.T) {
+	const messages = 50
+
+	mock := newMockProducer(t)
+	for i := 0; i < messages; i++ {
+		mock.ExpectInputAndSucceed()
+	}
+	producer := NewProducer(mock, newTestLogger())
+
+	var wg sync.WaitGroup
+	offsets := make(chan int64, messages)
+	for i := 0; i < messages; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			msg := &sarama.ProducerMessage{Topic: Topic, Value: sarama.StringEncoder("order")}
+			future, err := producer.Send(context.Background(), msg)
+			if err != nil {
+				t.Errorf("Send: %v", err)
+				return
+			}
+			result, err := future.Wait(context.Background())
+			if err != nil || result.Err != nil {
+				t.Errorf("Wait: %v, %v", err, result.Err)
+				return
+			}
+			// The mock stamps the offset it assigned on the message itself.
+			if result.Offset != msg.Offset {
+				t.Errorf("got offset %d for a message written at offset %d", result.Offset, msg.Offset)
+			}
+			offsets <- result.Offset
+		}()
+	}
+	wg.Wait()
+	close(offsets)
+
+	seen := make(map[int64]bool)
+	for offset := range offsets {
+		if seen[offset] {
+			t.Errorf("offset %d was reported to more than one caller", offset)
+		}
+		seen[offset] = true
+	}
+	if len(seen) != messages {
+		t.Errorf("got %d distinct offsets, want %d", len(seen), messages)
+	}
+
+	if err := producer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProducerReportsFailures(t *testing.T) {
+	mock := newMockProducer(t)
+	writeErr := errors.New("broker unavailable")
+	mock.ExpectInputAndFail(writeErr)
+	mock.ExpectInputAndSucceed()
+	producer := NewProducer(mock, newTestLogger())
+	defer producer.Close()
+
+	failed, err := producer.Send(context.Background(), &sarama.ProducerMessage{Topic: Topic, Value: sarama.StringEncoder("a")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	succeeded, err := producer.Send(context.Background(), &sarama.ProducerMessage{Topic: Topic, Value: sarama.StringEncoder("b")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := failed.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(result.Err, writeErr) {
+		t.Errorf("got %v, want %v", result.Err, writeErr)
+	}
+
+	result, err = succeeded.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Err != nil {
+		t.Errorf("unexpected error: %v", result.Err)
+	}
+}
+
+func TestProducerRestoresMetadata(t *testing.T) {
+	mock := newMockProducer(t)
+	mock.ExpectInputAndSucceed()
+	producer := NewProducer(mock, newTestLogger())
+	defer producer.Close()
+
+	msg := &sarama.ProducerMessage{Topic: Topic, Value: sarama.StringEncoder("a"), Metadata: "order-1"}
+	future, err := producer.Send(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := future.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Metadata != "order-1" {
+		t.Errorf("got metadata %v, want order-1", msg.Metadata)
+	}
+}
+
+// stalledProducer accepts messages but never acknowledges them until it is
+// closed.
+type stalledProducer struct {
+	sarama.AsyncProducer
+	input     chan *sarama.ProducerMessage
+	successes chan *sarama.ProducerMessage
+	errors    chan *sarama.ProducerError
+}
+
+func newStalledProducer(buffer int) *stalledProducer {
+	return &stalledProducer{
+		input:     make(chan *sarama.ProducerMessage, buffer),
+		successes: make(chan *sarama.ProducerMessage),
+		errors:    make(chan *sarama.ProducerError),
+	}
+}
+
+func (p *stalledProducer) Input() chan<- *sarama.ProducerMessage     { return p.input }
+func (p *stalledProducer) Successes() <-chan *sarama.ProducerMessage { return p.successes }
+func (p *stalledProducer) Errors() <-chan *sarama.ProducerError      { return p.errors }
+func (p *stalledProducer) AsyncClose() {
+	close(p.successes)
+	close(p.errors)
+}
+
+func TestProducerWaitHonorsContext(t *testing.T) {
+	producer := NewProducer(newStalledProducer(1), newTestLogger())
+
+	future, err := producer.Send(context.Background(), &sarama.ProducerMessage{Topic: Topic})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := future.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Messages still in flight fail once the producer is closed.
+	if err := producer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	result, err := future.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(result.Err, ErrProducerClosed) {
+		t.Errorf("got %v, want %v", result.Err, ErrProducerClosed)
+	}
+
+	if _, err := producer.Send(context.Background(), &sarama.ProducerMessage{Topic: Topic}); !errors.Is(err, ErrProducerClosed) {
+		t.Errorf("got %v, want %v", err, ErrProducerClosed)
+	}
+}
+
+func TestProducerSendHonorsContext(t *testing.T) {
+	producer := NewProducer(newStalledProducer(0), newTestLogger())
+	defer producer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	msg := &sarama.ProducerMessage{Topic: Topic, Metadata: "order-1"}
+	if _, err := producer.Send(ctx, msg); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+	if msg.Metadata != "order-1" {
+		t.Errorf("got metadata %v, want order-1", msg.Metadata)
+	}
+}
+
+func TestProducerPing(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"ApiVersionsRequest": sarama.NewMockApiVersionsResponse(t),
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader(Topic, 0, broker.BrokerID()),
+	})
+
+	cfg := DefaultConfig()
+	cfg.Brokers = []string{broker.Addr()}
+	producer, err := CreateKafkaProducer(cfg, newTestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := producer.Ping(ctx); err != nil {
+		t.Errorf("Ping() = %v, want nil", err)
+	}
+
+	if err := producer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := producer.Ping(ctx); !errors.Is(err, ErrProducerClosed) {
+		t.Errorf("Ping() after Close = %v, want %v", err, ErrProducerClosed)
+	}
+}
@@ -0,0 +1,331 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/cloudevents"
+)
+
+// Config describes how to connect and produce to Kafka.
+type Config struct {
+	Brokers []string
+	Topic   string
+	// CancelledTopic is the topic of the events of cancelled orders.
+	CancelledTopic string
+	// EventEncoding is how the payloads of order events are encoded.
+	EventEncoding cloudevents.Encoding
+	ClientID      string
+	Version       sarama.KafkaVersion
+
+	RequiredAcks sarama.RequiredAcks
+	// Idempotent makes the brokers discard duplicates of retried messages.
+	// It requires RequiredAcks to be sarama.WaitForAll.
+	Idempotent  bool
+	Compression sarama.CompressionCodec
+
+	// Linger is how long to wait for more messages before a batch is sent.
+	// A batch is also sent once it holds BatchBytes or BatchMessages. Zero
+	// values leave sarama's defaults in place.
+	Linger        time.Duration
+	BatchBytes    int
+	BatchMessages int
+
+	TLS  TLSConfig
+	SASL SASLConfig
+}
+
+// TLSConfig enables TLS to the brokers. CAFile replaces the system roots,
+// and CertFile and KeyFile set a client certificate for mutual TLS.
+type TLSConfig struct {
+	Enabled            bool
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+}
+
+// SASLConfig enables SASL authentication. Mechanism is one of
+// sarama.SASLTypePlaintext, sarama.SASLTypeSCRAMSHA256 or
+// sarama.SASLTypeSCRAMSHA512, or empty to disable it.
+type SASLConfig struct {
+	Mechanism string
+	Username  string
+	Password  string
+}
+
+// DefaultConfig returns the settings used when the environment does not
+// override them.
+func DefaultConfig() Config {
+	return Config{
+		Topic:          Topic,
+		CancelledTopic: CancelledTopic,
+		EventEncoding:  cloudevents.Protobuf,
+		ClientID:       "checkout",
+		Version:        ProtocolVersion,
+
+		// Sarama has an issue in a single broker kafka if the kafka broker is restarted.
+		// This setting is to prevent that issue from manifesting itself, but may swallow failed messages.
+		RequiredAcks: sarama.NoResponse,
+		Compression:  sarama.CompressionNone,
+	}
+}
+
+// ConfigFromEnv reads the configuration from KAFKA_* environment variables
+// on top of DefaultConfig and validates it.
+func ConfigFromEnv() (Config, error) {
+	return configFromLookup(os.LookupEnv)
+}
+
+func configFromLookup(lookup func(string) (string, bool)) (Config, error) {
+	cfg := DefaultConfig()
+	var errs []error
+	get := func(key string) (string, bool) {
+		value, ok := lookup(key)
+		value = strings.TrimSpace(value)
+		return value, ok && value != ""
+	}
+	parse := func(key string, fn func(string) error) {
+		if value, ok := get(key); ok {
+			if err := fn(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			}
+		}
+	}
+	parseBool := func(key string, target *bool) {
+		parse(key, func(value string) (err error) {
+			*target, err = strconv.ParseBool(value)
+			return err
+		})
+	}
+	parseInt := func(key string, target *int) {
+		parse(key, func(value string) (err error) {
+			*target, err = strconv.Atoi(value)
+			return err
+		})
+	}
+
+	if value, ok := get("KAFKA_ADDR"); ok {
+		cfg.Brokers = splitList(value)
+	}
+	if value, ok := get("KAFKA_TOPIC"); ok {
+		cfg.Topic = value
+	}
+	if value, ok := get("KAFKA_CANCELLED_TOPIC"); ok {
+		cfg.CancelledTopic = value
+	}
+	parse("KAFKA_EVENT_ENCODING", func(value string) (err error) {
+		cfg.EventEncoding, err = cloudevents.ParseEncoding(value)
+		return err
+	})
+	if value, ok := get("KAFKA_CLIENT_ID"); ok {
+		cfg.ClientID = value
+	}
+	parse("KAFKA_VERSION", func(value string) (err error) {
+		cfg.Version, err = sarama.ParseKafkaVersion(value)
+		return err
+	})
+	parse("KAFKA_ACKS", func(value string) (err error) {
+		cfg.RequiredAcks, err = parseAcks(value)
+		return err
+	})
+	parseBool("KAFKA_IDEMPOTENT", &cfg.Idempotent)
+	parse("KAFKA_COMPRESSION", func(value string) error {
+		return cfg.Compression.UnmarshalText([]byte(strings.ToLower(value)))
+	})
+	parse("KAFKA_LINGER", func(value string) (err error) {
+		cfg.Linger, err = time.ParseDuration(value)
+		return err
+	})
+	parseInt("KAFKA_BATCH_BYTES", &cfg.BatchBytes)
+	parseInt("KAFKA_BATCH_MESSAGES", &cfg.BatchMessages)
+
+	parseBool("KAFKA_TLS_ENABLED", &cfg.TLS.Enabled)
+	cfg.TLS.CAFile, _ = get("KAFKA_TLS_CA_FILE")
+	cfg.TLS.CertFile, _ = get("KAFKA_TLS_CERT_FILE")
+	cfg.TLS.KeyFile, _ = get("KAFKA_TLS_KEY_FILE")
+	parseBool("KAFKA_TLS_INSECURE_SKIP_VERIFY", &cfg.TLS.InsecureSkipVerify)
+	// Pointing at certificates is enough to ask for TLS.
+	if cfg.TLS.CAFile != "" || cfg.TLS.CertFile != "" {
+		cfg.TLS.Enabled = true
+	}
+
+	if value, ok := get("KAFKA_SASL_MECHANISM"); ok {
+		cfg.SASL.Mechanism = strings.ToUpper(value)
+	}
+	cfg.SASL.Username, _ = get("KAFKA_SASL_USERNAME")
+	// Passwords are taken verbatim.
+	cfg.SASL.Password, _ = lookup("KAFKA_SASL_PASSWORD")
+
+	if err := errors.Join(errs...); err != nil {
+		return cfg, fmt.Errorf("invalid Kafka configuration: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// Validate reports every problem with the configuration at once.
+func (c Config) Validate() error {
+	var errs []error
+	if len(c.Brokers) == 0 {
+		errs = append(errs, errors.New("KAFKA_ADDR: at least one broker is required"))
+	}
+	if c.Topic == "" {
+		errs = append(errs, errors.New("KAFKA_TOPIC: must not be empty"))
+	}
+	if c.CancelledTopic == "" {
+		errs = append(errs, errors.New("KAFKA_CANCELLED_TOPIC: must not be empty"))
+	}
+	if c.Idempotent {
+		if c.RequiredAcks != sarama.WaitForAll {
+			errs = append(errs, errors.New("KAFKA_IDEMPOTENT: requires KAFKA_ACKS=all"))
+		}
+		if !c.Version.IsAtLeast(sarama.V0_11_0_0) {
+			errs = append(errs, fmt.Errorf("KAFKA_IDEMPOTENT: requires KAFKA_VERSION 0.11.0.0 or later, got %s", c.Version))
+		}
+	}
+	if c.Linger < 0 {
+		errs = append(errs, errors.New("KAFKA_LINGER: must not be negative"))
+	}
+	if c.BatchBytes < 0 {
+		errs = append(errs, errors.New("KAFKA_BATCH_BYTES: must not be negative"))
+	}
+	if c.BatchMessages < 0 {
+		errs = append(errs, errors.New("KAFKA_BATCH_MESSAGES: must not be negative"))
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errs = append(errs, errors.New("KAFKA_TLS_CERT_FILE and KAFKA_TLS_KEY_FILE must be set together"))
+	}
+	if c.TLS.Enabled {
+		if _, err := c.TLS.load(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	switch c.SASL.Mechanism {
+	case "":
+	case sarama.SASLTypePlaintext, sarama.SASLTypeSCRAMSHA256, sarama.SASLTypeSCRAMSHA512:
+		if c.SASL.Username == "" || c.SASL.Password == "" {
+			errs = append(errs, fmt.Errorf("KAFKA_SASL_USERNAME and KAFKA_SASL_PASSWORD are required for %s", c.SASL.Mechanism))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("KAFKA_SASL_MECHANISM: unsupported mechanism %q, use %s, %s or %s",
+			c.SASL.Mechanism, sarama.SASLTypePlaintext, sarama.SASLTypeSCRAMSHA256, sarama.SASLTypeSCRAMSHA512))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid Kafka configuration: %w", err)
+	}
+	return nil
+}
+
+// saramaConfig translates c into the sarama settings shared by all
+// producers.
+func (c Config) saramaConfig() (*sarama.Config, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	saramaConfig := sarama.NewConfig()
+	saramaConfig.ClientID = c.ClientID
+	saramaConfig.Version = c.Version
+
+	saramaConfig.Producer.RequiredAcks = c.RequiredAcks
+	saramaConfig.Producer.Compression = c.Compression
+	if c.Idempotent {
+		saramaConfig.Producer.Idempotent = true
+		saramaConfig.Net.MaxOpenRequests = 1
+	}
+	if c.Linger > 0 {
+		saramaConfig.Producer.Flush.Frequency = c.Linger
+	}
+	if c.BatchBytes > 0 {
+		saramaConfig.Producer.Flush.Bytes = c.BatchBytes
+	}
+	if c.BatchMessages > 0 {
+		saramaConfig.Producer.Flush.Messages = c.BatchMessages
+	}
+
+	if c.TLS.Enabled {
+		tlsConfig, err := c.TLS.load()
+		if err != nil {
+			return nil, err
+		}
+		saramaConfig.Net.TLS.Enable = true
+		saramaConfig.Net.TLS.Config = tlsConfig
+	}
+
+	if c.SASL.Mechanism != "" {
+		saramaConfig.Net.SASL.Enable = true
+		saramaConfig.Net.SASL.Mechanism = sarama.SASLMechanism(c.SASL.Mechanism)
+		saramaConfig.Net.SASL.User = c.SASL.Username
+		saramaConfig.Net.SASL.Password = c.SASL.Password
+		switch c.SASL.Mechanism {
+		case sarama.SASLTypeSCRAMSHA256:
+			saramaConfig.Net.SASL.SCRAMClientGeneratorFunc = scramClientGenerator(sha256Generator)
+		case sarama.SASLTypeSCRAMSHA512:
+			saramaConfig.Net.SASL.SCRAMClientGeneratorFunc = scramClientGenerator(sha512Generator)
+		}
+	}
+
+	return saramaConfig, nil
+}
+
+func (t TLSConfig) load() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("KAFKA_TLS_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("KAFKA_TLS_CA_FILE: no PEM certificates found in %s", t.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if t.CertFile != "" && t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("KAFKA_TLS_CERT_FILE/KAFKA_TLS_KEY_FILE: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+func parseAcks(value string) (sarama.RequiredAcks, error) {
+	switch strings.ToLower(value) {
+	case "none", "0":
+		return sarama.NoResponse, nil
+	case "leader", "1":
+		return sarama.WaitForLocal, nil
+	case "all", "-1":
+		return sarama.WaitForAll, nil
+	}
+	return 0, fmt.Errorf("unknown acks level %q, use none, leader or all", value)
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,227 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package kafka
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/cloudevents"
+)
+
+func lookupFrom(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+}
+
+func TestConfigFromEnvDefaults(t *testing.T) {
+	cfg, err := configFromLookup(lookupFrom(map[string]string{"KAFKA_ADDR": "kafka:9092"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DefaultConfig()
+	want.Brokers = []string{"kafka:9092"}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("got %+v, want %+v", cfg, want)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	cfg, err := configFromLookup(lookupFrom(map[string]string{
+		"KAFKA_ADDR":            " kafka-1:9092, kafka-2:9092,,kafka-3:9092 ",
+		"KAFKA_TOPIC":           "orders-v2",
+		"KAFKA_CANCELLED_TOPIC": "order_cancelled-v2",
+		"KAFKA_EVENT_ENCODING":  "JSON",
+		"KAFKA_CLIENT_ID":       "checkout-1",
+		"KAFKA_VERSION":         "2.8.0",
+		"KAFKA_ACKS":            "all",
+		"KAFKA_IDEMPOTENT":      "true",
+		"KAFKA_COMPRESSION":     "ZSTD",
+		"KAFKA_LINGER":          "20ms",
+		"KAFKA_BATCH_BYTES":     "65536",
+		"KAFKA_BATCH_MESSAGES":  "100",
+		"KAFKA_SASL_MECHANISM":  "scram-sha-512",
+		"KAFKA_SASL_USERNAME":   "checkout",
+		"KAFKA_SASL_PASSWORD":   "secret",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Config{
+		Brokers:        []string{"kafka-1:9092", "kafka-2:9092", "kafka-3:9092"},
+		Topic:          "orders-v2",
+		CancelledTopic: "order_cancelled-v2",
+		EventEncoding:  cloudevents.JSON,
+		ClientID:       "checkout-1",
+		Version:        sarama.V2_8_0_0,
+		RequiredAcks:   sarama.WaitForAll,
+		Idempotent:     true,
+		Compression:    sarama.CompressionZSTD,
+		Linger:         20 * time.Millisecond,
+		BatchBytes:     65536,
+		BatchMessages:  100,
+		SASL: SASLConfig{
+			Mechanism: sarama.SASLTypeSCRAMSHA512,
+			Username:  "checkout",
+			Password:  "secret",
+		},
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("got %+v, want %+v", cfg, want)
+	}
+
+	saramaConfig, err := cfg.saramaConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := saramaConfig.Validate(); err != nil {
+		t.Errorf("sarama rejected the configuration: %v", err)
+	}
+	if !saramaConfig.Producer.Idempotent || saramaConfig.Net.MaxOpenRequests != 1 {
+		t.Errorf("idempotent producer not configured: %+v", saramaConfig.Producer)
+	}
+	if !saramaConfig.Net.SASL.Enable || saramaConfig.Net.SASL.SCRAMClientGeneratorFunc == nil {
+		t.Errorf("SCRAM not configured: %+v", saramaConfig.Net.SASL)
+	}
+}
+
+func TestConfigFromEnvErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want []string
+	}{
+		{
+			name: "MissingBrokers",
+			env:  map[string]string{"KAFKA_ADDR": " , "},
+			want: []string{"KAFKA_ADDR"},
+		},
+		{
+			name: "Unparsable",
+			env: map[string]string{
+				"KAFKA_ADDR":           "kafka:9092",
+				"KAFKA_ACKS":           "some",
+				"KAFKA_COMPRESSION":    "brotli",
+				"KAFKA_LINGER":         "soon",
+				"KAFKA_IDEMPOTENT":     "maybe",
+				"KAFKA_EVENT_ENCODING": "avro",
+			},
+			want: []string{"KAFKA_ACKS", "KAFKA_COMPRESSION", "KAFKA_LINGER", "KAFKA_IDEMPOTENT", "KAFKA_EVENT_ENCODING"},
+		},
+		{
+			name: "IdempotentWithoutAcks",
+			env:  map[string]string{"KAFKA_ADDR": "kafka:9092", "KAFKA_IDEMPOTENT": "true"},
+			want: []string{"requires KAFKA_ACKS=all"},
+		},
+		{
+			name: "HalfClientCertificate",
+			env:  map[string]string{"KAFKA_ADDR": "kafka:9092", "KAFKA_TLS_CERT_FILE": "client.pem"},
+			want: []string{"must be set together"},
+		},
+		{
+			name: "MissingCA",
+			env:  map[string]string{"KAFKA_ADDR": "kafka:9092", "KAFKA_TLS_CA_FILE": "/does/not/exist.pem"},
+			want: []string{"KAFKA_TLS_CA_FILE"},
+		},
+		{
+			name: "UnknownSASLMechanism",
+			env:  map[string]string{"KAFKA_ADDR": "kafka:9092", "KAFKA_SASL_MECHANISM": "GSSAPI"},
+			want: []string{"unsupported mechanism"},
+		},
+		{
+			name: "SASLWithoutCredentials",
+			env:  map[string]string{"KAFKA_ADDR": "kafka:9092", "KAFKA_SASL_MECHANISM": "PLAIN"},
+			want: []string{"KAFKA_SASL_USERNAME and KAFKA_SASL_PASSWORD"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := configFromLookup(lookupFrom(tt.env))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeSelfSignedCert(t, dir)
+
+	cfg, err := configFromLookup(lookupFrom(map[string]string{
+		"KAFKA_ADDR":          "kafka:9093",
+		"KAFKA_TLS_CA_FILE":   certFile,
+		"KAFKA_TLS_CERT_FILE": certFile,
+		"KAFKA_TLS_KEY_FILE":  keyFile,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.TLS.Enabled {
+		t.Error("setting certificate files should enable TLS")
+	}
+
+	saramaConfig, err := cfg.saramaConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !saramaConfig.Net.TLS.Enable || saramaConfig.Net.TLS.Config.RootCAs == nil || len(saramaConfig.Net.TLS.Config.Certificates) != 1 {
+		t.Errorf("TLS not configured: %+v", saramaConfig.Net.TLS)
+	}
+}
+
+func writeSelfSignedCert(t *testing.T, dir string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kafka"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
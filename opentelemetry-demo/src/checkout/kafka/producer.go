@@ -3,41 +3,68 @@
 package kafka
 
 import (
+	"time"
+
 	"github.com/IBM/sarama"
 	"github.com/sirupsen/logrus"
 )
 
 var (
+	// Topic, CancelledTopic and ProtocolVersion are the defaults for
+	// Config.Topic, Config.CancelledTopic and Config.Version.
 	Topic           = "orders"
+	CancelledTopic  = "order_cancelled"
 	ProtocolVersion = sarama.V3_0_0_0
 )
 
-func CreateKafkaProducer(brokers []string, log *logrus.Logger) (sarama.AsyncProducer, error) {
+// SetLogger makes sarama log to log. sarama.Logger is a global read by every
+// client and broker connection, so it is set once at startup rather than by
+// each producer.
+func SetLogger(log *logrus.Logger) {
 	sarama.Logger = log
+}
 
-	saramaConfig := sarama.NewConfig()
-	saramaConfig.Producer.Return.Successes = true
-	saramaConfig.Producer.Return.Errors = true
-
-	// Sarama has an issue in a single broker kafka if the kafka broker is restarted.
-	// This setting is to prevent that issue from manifesting itself, but may swallow failed messages.
-	saramaConfig.Producer.RequiredAcks = sarama.NoResponse
-
-	saramaConfig.Version = ProtocolVersion
+// CreateKafkaProducer creates the producer for order events described by cfg.
+func CreateKafkaProducer(cfg Config, log *logrus.Logger) (*Producer, error) {
+	saramaConfig, err := cfg.saramaConfig()
+	if err != nil {
+		return nil, err
+	}
 
 	// So we can know the partition and offset of messages.
 	saramaConfig.Producer.Return.Successes = true
+	saramaConfig.Producer.Return.Errors = true
 
-	producer, err := sarama.NewAsyncProducer(brokers, saramaConfig)
+	client, err := sarama.NewClient(cfg.Brokers, saramaConfig)
 	if err != nil {
 		return nil, err
 	}
+	producer, err := sarama.NewAsyncProducerFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	p := NewProducer(producer, log)
+	p.client, p.topic = client, cfg.Topic
+	return p, nil
+}
+
+// CreateKafkaSyncProducer creates a producer that waits until all in-sync
+// replicas have acknowledged a message and retries sends that fail,
+// whatever acks level cfg asks for. It is meant for publishers that must not
+// lose messages, such as the outbox relay.
+func CreateKafkaSyncProducer(cfg Config) (sarama.SyncProducer, error) {
+	saramaConfig, err := cfg.saramaConfig()
+	if err != nil {
+		return nil, err
+	}
+	saramaConfig.Producer.RequiredAcks = sarama.WaitForAll
+	saramaConfig.Producer.Retry.Max = 5
+	saramaConfig.Producer.Retry.Backoff = 250 * time.Millisecond
+
+	// Required by the sync producer.
+	saramaConfig.Producer.Return.Successes = true
+	saramaConfig.Producer.Return.Errors = true
 
-	// We will log to STDOUT if we're not able to produce messages.
-	go func() {
-		for err := range producer.Errors() {
-			log.Errorf("Failed to write message: %+v", err)
-		}
-	}()
-	return producer, nil
+	return sarama.NewSyncProducer(cfg.Brokers, saramaConfig)
 }
@@ -5,13 +5,18 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"sync"
+	"syscall"
 	"time"
 
 	"go.opentelemetry.io/otel/attribute"
@@ -35,16 +40,28 @@ import (
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	sdkresource "go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/credentials/insecure"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/cloudevents"
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/db/postgres"
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/faultinject"
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/redact"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/currency"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/emailqueue"
 	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/idempotency"
 	"github.com/open-telemetry/opentelemetry-demo/src/checkout/kafka"
 	"github.com/open-telemetry/opentelemetry-demo/src/checkout/money"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/outbox"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/promotions"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/saga"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/tax"
 )
 
 //go:generate go install google.golang.org/protobuf/cmd/protoc-gen-go
@@ -52,6 +69,7 @@ import (
 //go:generate protoc --go_out=./ --go-grpc_out=./ --proto_path=../../pb ../../pb/demo.proto
 
 var log *logrus.Logger
+var redactor *redact.Redactor
 var tracer trace.Tracer
 var resource *sdkresource.Resource
 var initResourcesOnce sync.Once
@@ -68,6 +86,13 @@ func init() {
 		TimestampFormat: time.RFC3339Nano,
 	}
 	log.Out = os.Stdout
+
+	var err error
+	if redactor, err = redact.FromEnv(); err != nil {
+		log.Fatalf("redaction rules: %v", err)
+	}
+	redact.InstallLogrus(log, redactor)
+	kafka.SetLogger(log)
 }
 
 func initResource() *sdkresource.Resource {
@@ -95,7 +120,7 @@ func initTracerProvider() *sdktrace.TracerProvider {
 		log.Fatalf("new otlp trace grpc exporter failed: %v", err)
 	}
 	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSpanProcessor(redact.NewSpanProcessor(redactor, sdktrace.NewBatchSpanProcessor(exporter))),
 		sdktrace.WithResource(initResource()),
 	)
 	otel.SetTracerProvider(tp)
@@ -119,27 +144,23 @@ func initMeterProvider() *sdkmetric.MeterProvider {
 	return mp
 }
 
-type checkout struct {
-	productCatalogSvcAddr string
-	cartSvcAddr           string
-	currencySvcAddr       string
-	shippingSvcAddr       string
-	emailSvcAddr          string
-	paymentSvcAddr        string
-	kafkaBrokerSvcAddr    string
-	pb.UnimplementedCheckoutServiceServer
-	KafkaProducerClient     sarama.AsyncProducer
-	shippingSvcClient       pb.ShippingServiceClient
-	productCatalogSvcClient pb.ProductCatalogServiceClient
-	cartSvcClient           pb.CartServiceClient
-	currencySvcClient       pb.CurrencyServiceClient
-	emailSvcClient          pb.EmailServiceClient
-	paymentSvcClient        pb.PaymentServiceClient
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
 }
 
-func main() {
+// run starts the service and blocks until it has shut down. Deferred calls
+// release resources in reverse order of creation, so the server stops first,
+// then the producers and connections, and the telemetry providers last.
+func run() error {
 	var port string
 	mustMapEnv(&port, "CHECKOUT_PORT")
+	drainDelay := mustParseDurationEnv("SHUTDOWN_DRAIN_DELAY", 5*time.Second)
+	stopTimeout := mustParseDurationEnv("SHUTDOWN_TIMEOUT", 20*time.Second)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	tp := initTracerProvider()
 	defer func() {
@@ -157,7 +178,7 @@ func main() {
 
 	err := runtime.Start(runtime.WithMinimumReadMemStatsInterval(time.Second))
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	openfeature.SetProvider(flagd.NewProvider())
@@ -165,62 +186,189 @@ func main() {
 
 	tracer = tp.Tracer("checkout")
 
-	svc := new(checkout)
-
-	mustMapEnv(&svc.shippingSvcAddr, "SHIPPING_ADDR")
-	c := mustCreateClient(svc.shippingSvcAddr)
-	svc.shippingSvcClient = pb.NewShippingServiceClient(c)
-	defer c.Close()
+	// Chaos scenarios, such as paymentUnreachable, are fault lists in these
+	// flags, injected into the calls checkout makes and serves.
+	faults := faultinject.NewOpenFeature("checkout", "paymentUnreachable", "checkoutFaults")
+	faults.Logf = log.Warnf
 
-	mustMapEnv(&svc.productCatalogSvcAddr, "PRODUCT_CATALOG_ADDR")
-	c = mustCreateClient(svc.productCatalogSvcAddr)
-	svc.productCatalogSvcClient = pb.NewProductCatalogServiceClient(c)
-	defer c.Close()
-
-	mustMapEnv(&svc.cartSvcAddr, "CART_ADDR")
-	c = mustCreateClient(svc.cartSvcAddr)
-	svc.cartSvcClient = pb.NewCartServiceClient(c)
-	defer c.Close()
-
-	mustMapEnv(&svc.currencySvcAddr, "CURRENCY_ADDR")
-	c = mustCreateClient(svc.currencySvcAddr)
-	svc.currencySvcClient = pb.NewCurrencyServiceClient(c)
-	defer c.Close()
+	clients, err := clientConfigsFromEnv()
+	if err != nil {
+		return err
+	}
+	addrs := serviceAddrsFromEnv()
+	svc, closeClients, err := newCheckout(addrs, clients,
+		grpc.WithChainUnaryInterceptor(faults.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(faults.StreamClientInterceptor()),
+	)
+	if err != nil {
+		return err
+	}
+	defer closeClients()
+	svc.placeOrderTimeout = mustParseDurationEnv("PLACE_ORDER_TIMEOUT", 30*time.Second)
+	svc.prepConcurrency = mustParseIntEnv("ORDER_ITEMS_CONCURRENCY", defaultPrepConcurrency)
+	svc.currencies.ttl = mustParseDurationEnv("SUPPORTED_CURRENCIES_TTL", defaultCurrenciesTTL)
+	svc.quotes.ttl = mustParseDurationEnv("QUOTE_TTL", defaultQuoteTTL)
+	svc.reservationTTL = mustParseDurationEnv("INVENTORY_RESERVATION_TTL", defaultReservationTTL)
+	svc.cancelLockTimeout = mustParseDurationEnv("CANCEL_LOCK_TIMEOUT", defaultCancelLockTimeout)
+
+	if svc.converter.mode, err = parseConversionMode(os.Getenv("CURRENCY_CONVERSION_MODE")); err != nil {
+		return err
+	}
+	svc.converter.cache.ttl = mustParseDurationEnv("CURRENCY_RATES_TTL", defaultRatesTTL)
+	if path := os.Getenv("CURRENCY_RATES_FILE"); path != "" {
+		if svc.converter.local, err = currency.Load(path); err != nil {
+			return err
+		}
+		log.Infof("loaded exchange rates of %d currencies from %s", len(svc.converter.local.Codes()), path)
+	} else if svc.converter.mode == conversionLocal {
+		return errors.New("CURRENCY_RATES_FILE is required with CURRENCY_CONVERSION_MODE=local")
+	}
 
-	mustMapEnv(&svc.emailSvcAddr, "EMAIL_ADDR")
-	c = mustCreateClient(svc.emailSvcAddr)
-	svc.emailSvcClient = pb.NewEmailServiceClient(c)
-	defer c.Close()
+	if path := os.Getenv("PROMOTIONS_FILE"); path != "" {
+		svc.promotions, err = promotions.Load(path)
+		if err != nil {
+			return err
+		}
+		svc.promotions.Logf = log.Warnf
+		log.Infof("loaded %d promotions from %s", svc.promotions.Rules().Len(), path)
+		watchCtx, stopWatching := context.WithCancel(context.Background())
+		defer stopWatching()
+		go func() {
+			if err := svc.promotions.Watch(watchCtx); err != nil {
+				log.Errorf("failed to watch promotions, changes will not be picked up: %+v", err)
+			}
+		}()
+	}
 
-	mustMapEnv(&svc.paymentSvcAddr, "PAYMENT_ADDR")
-	c = mustCreateClient(svc.paymentSvcAddr)
-	svc.paymentSvcClient = pb.NewPaymentServiceClient(c)
-	defer c.Close()
+	if path := os.Getenv("TAX_TABLE_FILE"); path != "" {
+		table, err := tax.Load(path)
+		if err != nil {
+			return err
+		}
+		svc.taxes = table
+		log.Infof("loaded %d tax rates from %s", table.Len(), path)
+	}
 
 	svc.kafkaBrokerSvcAddr = os.Getenv("KAFKA_ADDR")
 
+	var kafkaConfig kafka.Config
 	if svc.kafkaBrokerSvcAddr != "" {
-		svc.KafkaProducerClient, err = kafka.CreateKafkaProducer([]string{svc.kafkaBrokerSvcAddr}, log)
+		kafkaConfig, err = kafka.ConfigFromEnv()
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
+		svc.kafkaTopic = kafkaConfig.Topic
+		svc.kafkaCancelledTopic = kafkaConfig.CancelledTopic
+		svc.events.Encoding = kafkaConfig.EventEncoding
+		svc.KafkaProducerClient, err = kafka.CreateKafkaProducer(kafkaConfig, log)
+		if err != nil {
+			return err
+		}
+		svc.health.Register("kafka", svc.KafkaProducerClient.Ping)
+		defer func() {
+			// Waits for the messages still in flight to be acknowledged.
+			log.Infof("flushing Kafka producer")
+			if err := svc.KafkaProducerClient.Close(); err != nil {
+				log.Errorf("failed to close Kafka producer: %+v", err)
+			}
+		}()
 	}
 
-	log.Infof("service config: %+v", svc)
+	svc.idempotencyWait = mustParseDurationEnv("IDEMPOTENCY_WAIT_TIMEOUT", 10*time.Second)
+	lockTimeout := mustParseDurationEnv("IDEMPOTENCY_LOCK_TIMEOUT", time.Minute)
+	if os.Getenv("DB_CONN") != "" {
+		dbConn, err := postgres.GetConnectionFromEnv("DB_CONN")
+		if err != nil {
+			return err
+		}
+		defer dbConn.Close()
+		svc.idempotencyStore = idempotency.NewPostgresStore(dbConn.DB, lockTimeout)
+		svc.orders = postgres.NewOrderRepository(dbConn)
+		svc.emailQueue = postgres.NewEmailQueueRepository(dbConn)
+
+		// With both a database and a broker, order events go through the
+		// transactional outbox instead of being sent directly.
+		if svc.kafkaBrokerSvcAddr != "" {
+			syncProducer, err := kafka.CreateKafkaSyncProducer(kafkaConfig)
+			if err != nil {
+				return err
+			}
+			defer syncProducer.Close()
+			relay := outbox.NewRelay(postgres.NewOutboxRepository(dbConn), syncProducer, tracer, log, outbox.DefaultConfig())
+			relayCtx, stopRelay := context.WithCancel(context.Background())
+			relayDone := make(chan struct{})
+			go func() {
+				defer close(relayDone)
+				relay.Run(relayCtx)
+			}()
+			defer func() {
+				stopRelay()
+				<-relayDone
+			}()
+			svc.useOutbox = true
+		}
+	} else {
+		svc.idempotencyStore = idempotency.NewMemoryStore(10000, lockTimeout)
+	}
+
+	// Without a database, failed confirmations are queued on disk when a
+	// directory is configured.
+	if dir := os.Getenv("EMAIL_QUEUE_DIR"); svc.emailQueue == nil && dir != "" {
+		if svc.emailQueue, err = emailqueue.NewFileStore(dir); err != nil {
+			return err
+		}
+	}
+	if svc.emailQueue != nil {
+		emailCfg := emailqueue.DefaultConfig()
+		emailCfg.MaxAttempts = mustParseIntEnv("EMAIL_RETRY_MAX_ATTEMPTS", emailCfg.MaxAttempts)
+		emailCfg.MinBackoff = mustParseDurationEnv("EMAIL_RETRY_MIN_BACKOFF", emailCfg.MinBackoff)
+		emailCfg.MaxBackoff = mustParseDurationEnv("EMAIL_RETRY_MAX_BACKOFF", emailCfg.MaxBackoff)
+		worker := emailqueue.NewWorker(svc.emailQueue, svc.sendQueuedConfirmation, tracer, log, emailCfg)
+		workerCtx, stopWorker := context.WithCancel(context.Background())
+		workerDone := make(chan struct{})
+		go func() {
+			defer close(workerDone)
+			worker.Run(workerCtx)
+		}()
+		defer func() {
+			stopWorker()
+			<-workerDone
+		}()
+	}
+
+	// Only the addresses are logged; the redaction hook masks credentials in
+	// them.
+	log.WithFields(logrus.Fields{
+		"product_catalog_addr": addrs.ProductCatalog,
+		"cart_addr":            addrs.Cart,
+		"currency_addr":        addrs.Currency,
+		"shipping_addr":        addrs.Shipping,
+		"email_addr":           addrs.Email,
+		"email_grpc_addr":      addrs.EmailGRPC,
+		"payment_addr":         addrs.Payment,
+		"inventory_addr":       addrs.Inventory,
+		"kafka_addr":           svc.kafkaBrokerSvcAddr,
+	}).Info("service config")
 
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	var srv = grpc.NewServer(
 		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(faults.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(faults.StreamServerInterceptor()),
 	)
 	pb.RegisterCheckoutServiceServer(srv, svc)
-	healthpb.RegisterHealthServer(srv, svc)
+	healthpb.RegisterHealthServer(srv, svc.health)
+
+	healthCtx, stopHealth := context.WithCancel(context.Background())
+	defer stopHealth()
+	go svc.health.Run(healthCtx)
+
 	log.Infof("starting to listen on tcp: %q", lis.Addr().String())
-	err = srv.Serve(lis)
-	log.Fatal(err)
+	return serve(ctx, stop, srv, lis, svc, drainDelay, stopTimeout)
 }
 
 func mustMapEnv(target *string, envKey string) {
@@ -231,15 +379,154 @@ func mustMapEnv(target *string, envKey string) {
 	*target = v
 }
 
-func (cs *checkout) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
-	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+func mustParseIntEnv(envKey string, fallback int) int {
+	v := os.Getenv(envKey)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		panic(fmt.Sprintf("environment variable %q is not a positive integer: %q", envKey, v))
+	}
+	return n
 }
 
-func (cs *checkout) Watch(req *healthpb.HealthCheckRequest, ws healthpb.Health_WatchServer) error {
-	return status.Errorf(codes.Unimplemented, "health check via Watch not implemented")
+func mustParseDurationEnv(envKey string, fallback time.Duration) time.Duration {
+	v := os.Getenv(envKey)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		panic(fmt.Sprintf("environment variable %q is not a valid duration: %v", envKey, err))
+	}
+	return d
 }
 
+// idempotencyKeyHeader is the gRPC metadata entry clients can use instead of
+// PlaceOrderRequest.idempotency_key.
+const idempotencyKeyHeader = "idempotency-key"
+
 func (cs *checkout) PlaceOrder(ctx context.Context, req *pb.PlaceOrderRequest) (*pb.PlaceOrderResponse, error) {
+	if err := cs.validatePlaceOrderRequest(ctx, req); err != nil {
+		return nil, err
+	}
+
+	key := idempotencyKey(ctx, req)
+	if key == "" || cs.idempotencyStore == nil {
+		return cs.placeOrder(ctx, req)
+	}
+
+	span := trace.SpanFromContext(ctx)
+	// Keys are scoped by user so one user can never replay another's order.
+	storeKey := req.UserId + "/" + key
+
+	fingerprint, err := requestFingerprint(req)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to fingerprint request: %+v", err)
+	}
+	claim, resp, err := cs.beginIdempotentOrder(ctx, storeKey, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	if resp != nil {
+		span.SetAttributes(attribute.Bool("app.order.idempotent_replay", true))
+		log.Infof("[PlaceOrder] returning stored result for idempotency key %q", key)
+		return resp, nil
+	}
+	span.SetAttributes(attribute.Bool("app.order.idempotent_replay", false))
+
+	resp, err = cs.placeOrder(ctx, req)
+	// The outcome is recorded even if the caller has already gone away, since
+	// that is exactly when it will retry.
+	storeCtx := context.WithoutCancel(ctx)
+	if err != nil {
+		if abandonErr := cs.idempotencyStore.Abandon(storeCtx, claim); abandonErr != nil {
+			log.Errorf("failed to release idempotency key %q: %+v", key, abandonErr)
+		}
+		return nil, err
+	}
+
+	stored, err := proto.Marshal(resp)
+	if err != nil {
+		log.Errorf("failed to marshal PlaceOrder response for idempotency key %q: %+v", key, err)
+	} else if err := cs.idempotencyStore.Complete(storeCtx, claim, stored); err != nil {
+		log.Errorf("failed to store PlaceOrder response for idempotency key %q: %+v", key, err)
+	}
+	return resp, nil
+}
+
+// beginIdempotentOrder claims an idempotency key for the request with
+// fingerprint. It returns the stored response of a completed order with the
+// same key, or the claim when the caller should place the order. A key used
+// for another request fails with codes.InvalidArgument. While another call
+// holds the key it waits for that call to finish, and gives up with
+// codes.Aborted after idempotencyWait.
+func (cs *checkout) beginIdempotentOrder(ctx context.Context, key, fingerprint string) (*idempotency.Claim, *pb.PlaceOrderResponse, error) {
+	const pollInterval = 100 * time.Millisecond
+	deadline := time.Now().Add(cs.idempotencyWait)
+
+	for {
+		claim, stored, err := cs.idempotencyStore.Begin(ctx, key, fingerprint)
+		switch {
+		case err == nil && claim != nil:
+			return claim, nil, nil
+		case err == nil:
+			resp := new(pb.PlaceOrderResponse)
+			if err := proto.Unmarshal(stored, resp); err != nil {
+				return nil, nil, status.Errorf(codes.Internal, "failed to decode stored order: %+v", err)
+			}
+			return nil, resp, nil
+		case errors.Is(err, idempotency.ErrMismatch):
+			return nil, nil, status.Errorf(codes.InvalidArgument, "idempotency key was already used for a different order")
+		case !errors.Is(err, idempotency.ErrInProgress):
+			return nil, nil, status.Errorf(codes.Internal, "idempotency store failure: %+v", err)
+		}
+
+		if time.Now().After(deadline) {
+			return nil, nil, status.Errorf(codes.Aborted, "an order with the same idempotency key is still in progress")
+		}
+		select {
+		case <-ctx.Done():
+			return nil, nil, status.Errorf(codes.Aborted, "an order with the same idempotency key is still in progress: %v", ctx.Err())
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// requestFingerprint identifies the contents of an order request, so a key
+// replayed with another request can be told apart. The idempotency key is
+// left out, as it may be sent in the request or in the metadata.
+func requestFingerprint(req *pb.PlaceOrderRequest) (string, error) {
+	req = proto.Clone(req).(*pb.PlaceOrderRequest)
+	req.IdempotencyKey = ""
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func idempotencyKey(ctx context.Context, req *pb.PlaceOrderRequest) string {
+	if req.IdempotencyKey != "" {
+		return req.IdempotencyKey
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(idempotencyKeyHeader); len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+func (cs *checkout) placeOrder(ctx context.Context, req *pb.PlaceOrderRequest) (*pb.PlaceOrderResponse, error) {
+	if cs.placeOrderTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cs.placeOrderTimeout)
+		defer cancel()
+	}
+
 	span := trace.SpanFromContext(ctx)
 	span.SetAttributes(
 		attribute.String("app.user.id", req.UserId),
@@ -259,37 +546,99 @@ func (cs *checkout) PlaceOrder(ctx context.Context, req *pb.PlaceOrderRequest) (
 		return nil, status.Errorf(codes.Internal, "failed to generate order uuid")
 	}
 
-	prep, err := cs.prepareOrderItemsAndShippingQuoteFromCart(ctx, req.UserId, req.UserCurrency, req.Address)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, err.Error())
+	var (
+		prep   orderPrep
+		total  *pb.Money
+		placed bool
+	)
+	if req.QuoteId != "" {
+		// The order is placed at the prices the user was shown.
+		var q *orderQuote
+		if q, err = cs.takeQuote(ctx, req); err != nil {
+			return nil, err
+		}
+		defer func() {
+			if !placed {
+				cs.quotes.restore(q)
+			}
+		}()
+		prep, total = q.prep, q.total
+		span.SetAttributes(attribute.String("app.order.quote.id", q.id))
+		span.AddEvent("quoted")
+	} else {
+		if prep, err = cs.prepareOrderItemsAndShippingQuoteFromCart(ctx, req.UserId, req.UserCurrency, req.Address); err != nil {
+			return nil, status.Errorf(codes.Internal, err.Error())
+		}
+		span.AddEvent("prepared")
+
+		if err = cs.applyPromotions(ctx, &prep, req.UserCurrency, req.PromoCodes); err != nil {
+			return nil, status.Errorf(codes.Internal, err.Error())
+		}
+		if err = cs.applyTaxes(ctx, &prep, req.UserCurrency, req.Address); err != nil {
+			return nil, status.Errorf(codes.Internal, err.Error())
+		}
+		if total, err = orderTotal(req.UserCurrency, prep); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to calculate order total: %+v", err)
+		}
 	}
-	span.AddEvent("prepared")
 
-	total := &pb.Money{CurrencyCode: req.UserCurrency,
-		Units: 0,
-		Nanos: 0}
-	total = money.Must(money.Sum(total, prep.shippingCostLocalized))
-	for _, it := range prep.orderItems {
-		multPrice := money.MultiplySlow(it.Cost, uint32(it.GetItem().GetQuantity()))
-		total = money.Must(money.Sum(total, multPrice))
+	// Every step below that has a side effect records how to undo it, so a
+	// failure in a later step can roll back the earlier ones.
+	sg := saga.New("PlaceOrder", tracer)
+
+	// The stock is held before the card is charged, so an order is never
+	// paid for items that are sold out.
+	if cs.inventorySvcClient != nil {
+		if err = cs.reserveStock(ctx, orderID.String(), prep.cartItems); err != nil {
+			return nil, err
+		}
+		sg.AddCompensation("reservation", func(ctx context.Context) error {
+			return cs.releaseStock(ctx, orderID.String())
+		})
 	}
 
 	txID, err := cs.chargeCard(ctx, total, req.CreditCard)
 	if err != nil {
+		cs.compensate(ctx, sg)
 		return nil, status.Errorf(codes.Internal, "failed to charge card: %+v", err)
 	}
 	log.Infof("payment went through (transaction_id: %s)", txID)
 	span.AddEvent("charged",
 		trace.WithAttributes(attribute.String("app.payment.transaction.id", txID)))
+	sg.AddCompensation("charge", func(ctx context.Context) error {
+		_, err := cs.refundCharge(ctx, txID, total)
+		return err
+	})
+
+	if cs.inventorySvcClient != nil {
+		// The reservation may have expired while the card was charged, and
+		// its stock gone to another order.
+		if err = cs.commitStock(ctx, orderID.String()); err != nil {
+			cs.compensate(ctx, sg)
+			return nil, status.Error(codes.Aborted, err.Error())
+		}
+		span.AddEvent("stock committed")
+	}
 
 	shippingTrackingID, err := cs.shipOrder(ctx, req.Address, prep.cartItems)
 	if err != nil {
+		cs.compensate(ctx, sg)
 		return nil, status.Errorf(codes.Unavailable, "shipping error: %+v", err)
 	}
 	shippingTrackingAttribute := attribute.String("app.shipping.tracking.id", shippingTrackingID)
 	span.AddEvent("shipped", trace.WithAttributes(shippingTrackingAttribute))
+	sg.AddCompensation("shipment", func(ctx context.Context) error {
+		return cs.cancelShipment(ctx, shippingTrackingID)
+	})
 
-	_ = cs.emptyUserCart(ctx, req.UserId)
+	// The cart is emptied before the order is stored, so an order that
+	// cannot be stored puts the items back. Failing to empty it does not
+	// fail the order.
+	if err := cs.emptyUserCart(ctx, req.UserId); err == nil {
+		sg.AddCompensation("cart", func(ctx context.Context) error {
+			return cs.restoreUserCart(ctx, req.UserId, prep.cartItems)
+		})
+	}
 
 	orderResult := &pb.OrderResult{
 		OrderId:            orderID.String(),
@@ -297,10 +646,29 @@ func (cs *checkout) PlaceOrder(ctx context.Context, req *pb.PlaceOrderRequest) (
 		ShippingCost:       prep.shippingCostLocalized,
 		ShippingAddress:    req.Address,
 		Items:              prep.orderItems,
+		Adjustments:        prep.adjustments,
+		Taxes:              prep.taxes,
 	}
 
-	shippingCostFloat, _ := strconv.ParseFloat(fmt.Sprintf("%d.%02d", prep.shippingCostLocalized.GetUnits(), prep.shippingCostLocalized.GetNanos()/1000000000), 64)
-	totalPriceFloat, _ := strconv.ParseFloat(fmt.Sprintf("%d.%02d", total.GetUnits(), total.GetNanos()/1000000000), 64)
+	if cs.orders != nil {
+		var events []*postgres.OutboxEvent
+		if cs.useOutbox {
+			message, headers, err := cs.events.Encode(cloudevents.TypeOrderPlaced, orderResult.OrderId, orderResult)
+			if err != nil {
+				cs.compensate(ctx, sg)
+				return nil, status.Errorf(codes.Internal, "failed to marshal order event: %+v", err)
+			}
+			events = append(events, outbox.NewEvent(ctx, cs.kafkaTopic, orderResult.OrderId, message, headers))
+		}
+		if err := cs.orders.CreateOrder(ctx, newOrderRow(req, orderResult, total, txID), events...); err != nil {
+			cs.compensate(ctx, sg)
+			return nil, status.Errorf(codes.Internal, "failed to store order: %+v", err)
+		}
+		span.AddEvent("stored")
+	}
+
+	shippingCostFloat, _ := strconv.ParseFloat(money.Format(prep.shippingCostLocalized), 64)
+	totalPriceFloat, _ := strconv.ParseFloat(money.Format(total), 64)
 
 	span.SetAttributes(
 		attribute.String("app.order.id", orderID.String()),
@@ -311,17 +679,24 @@ func (cs *checkout) PlaceOrder(ctx context.Context, req *pb.PlaceOrderRequest) (
 	)
 
 	if err := cs.sendOrderConfirmation(ctx, req.Email, orderResult); err != nil {
-		log.Warnf("failed to send order confirmation to %q: %+v", req.Email, err)
+		cs.retryOrderConfirmation(ctx, req.Email, orderResult, err)
 	} else {
 		log.Infof("order confirmation email sent to %q", req.Email)
 	}
 
 	// send to kafka only if kafka broker address is set
 	if cs.kafkaBrokerSvcAddr != "" {
-		log.Infof("sending to postProcessor")
-		cs.sendToPostProcessor(ctx, orderResult)
+		if cs.useOutbox {
+			// The outbox relay publishes the event stored with the order.
+			log.Infof("order event queued in outbox")
+			cs.simulateKafkaQueueProblems(ctx, orderResult)
+		} else {
+			log.Infof("sending to postProcessor")
+			cs.sendToPostProcessor(ctx, orderResult)
+		}
 	}
 
+	placed = true
 	resp := &pb.PlaceOrderResponse{Order: orderResult}
 	return resp, nil
 }
@@ -330,6 +705,15 @@ type orderPrep struct {
 	orderItems            []*pb.OrderItem
 	cartItems             []*pb.CartItem
 	shippingCostLocalized *pb.Money
+	// adjustments are the discounts of the promotions applied to the order.
+	adjustments []*pb.OrderAdjustment
+	// shippingDiscount is the part of the adjustments taken off the
+	// shipping cost, as a positive amount. The rest is taken off the items.
+	shippingDiscount *pb.Money
+	// categories are the categories of each product, by product ID.
+	categories map[string][]string
+	// taxes are the taxes charged on the order, after its discounts.
+	taxes []*pb.TaxLine
 }
 
 func (cs *checkout) prepareOrderItemsAndShippingQuoteFromCart(ctx context.Context, userID, userCurrency string, address *pb.Address) (orderPrep, error) {
@@ -342,7 +726,7 @@ func (cs *checkout) prepareOrderItemsAndShippingQuoteFromCart(ctx context.Contex
 	if err != nil {
 		return out, fmt.Errorf("cart failure: %+v", err)
 	}
-	orderItems, err := cs.prepOrderItems(ctx, cartItems, userCurrency)
+	orderItems, categories, err := cs.prepOrderItems(ctx, cartItems, userCurrency)
 	if err != nil {
 		return out, fmt.Errorf("failed to prepare order: %+v", err)
 	}
@@ -358,12 +742,13 @@ func (cs *checkout) prepareOrderItemsAndShippingQuoteFromCart(ctx context.Contex
 	out.shippingCostLocalized = shippingPrice
 	out.cartItems = cartItems
 	out.orderItems = orderItems
+	out.categories = categories
 
 	var totalCart int32
 	for _, ci := range cartItems {
 		totalCart += ci.Quantity
 	}
-	shippingCostFloat, _ := strconv.ParseFloat(fmt.Sprintf("%d.%02d", shippingPrice.GetUnits(), shippingPrice.GetNanos()/1000000000), 64)
+	shippingCostFloat, _ := strconv.ParseFloat(money.Format(shippingPrice), 64)
 
 	span.SetAttributes(
 		attribute.Float64("app.shipping.amount", shippingCostFloat),
@@ -373,18 +758,6 @@ func (cs *checkout) prepareOrderItemsAndShippingQuoteFromCart(ctx context.Contex
 	return out, nil
 }
 
-func mustCreateClient(svcAddr string) *grpc.ClientConn {
-	c, err := grpc.NewClient(svcAddr,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
-	)
-	if err != nil {
-		log.Fatalf("could not connect to %s service, err: %+v", svcAddr, err)
-	}
-
-	return c
-}
-
 func (cs *checkout) quoteShipping(ctx context.Context, address *pb.Address, items []*pb.CartItem) (*pb.Money, error) {
 	shippingQuote, err := cs.shippingSvcClient.
 		GetQuote(ctx, &pb.GetQuoteRequest{
@@ -411,44 +784,131 @@ func (cs *checkout) emptyUserCart(ctx context.Context, userID string) error {
 	return nil
 }
 
-func (cs *checkout) prepOrderItems(ctx context.Context, items []*pb.CartItem, userCurrency string) ([]*pb.OrderItem, error) {
-	out := make([]*pb.OrderItem, len(items))
-
-	for i, item := range items {
-		product, err := cs.productCatalogSvcClient.GetProduct(ctx, &pb.GetProductRequest{Id: item.GetProductId()})
-		if err != nil {
-			return nil, fmt.Errorf("failed to get product #%q", item.GetProductId())
+func (cs *checkout) restoreUserCart(ctx context.Context, userID string, items []*pb.CartItem) error {
+	for _, item := range items {
+		if _, err := cs.cartSvcClient.AddItem(ctx, &pb.AddItemRequest{UserId: userID, Item: item}); err != nil {
+			return fmt.Errorf("failed to restore item %q to user cart: %+v", item.GetProductId(), err)
 		}
-		price, err := cs.convertCurrency(ctx, product.GetPriceUsd(), userCurrency)
-		if err != nil {
-			return nil, fmt.Errorf("failed to convert price of %q to %s", item.GetProductId(), userCurrency)
+	}
+	return nil
+}
+
+// prepOrderItems prices the cart items in userCurrency and returns the
+// categories of their products by product ID. Products are looked up once
+// per product ID and prices converted once per amount, with at most
+// cs.prepConcurrency calls in flight. The first error cancels the calls that
+// are still running.
+func (cs *checkout) prepOrderItems(ctx context.Context, items []*pb.CartItem, userCurrency string) ([]*pb.OrderItem, map[string][]string, error) {
+	var ids []string
+	prices := make(map[string]*pb.Money)
+	for _, item := range items {
+		if _, ok := prices[item.GetProductId()]; !ok {
+			prices[item.GetProductId()] = nil
+			ids = append(ids, item.GetProductId())
 		}
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(cs.prepConcurrency, 1))
+	conv := newConversions(cs, userCurrency)
+	converted := make([]*pb.Money, len(ids))
+	productCategories := make([][]string, len(ids))
+	for i, id := range ids {
+		g.Go(func() error {
+			product, err := cs.productCatalogSvcClient.GetProduct(ctx, &pb.GetProductRequest{Id: id})
+			if err != nil {
+				return fmt.Errorf("failed to get product #%q", id)
+			}
+			price, err := conv.convert(ctx, product.GetPriceUsd())
+			if err != nil {
+				return fmt.Errorf("failed to convert price of %q to %s", id, userCurrency)
+			}
+			converted[i] = price
+			productCategories[i] = product.GetCategories()
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, nil, err
+	}
+	categories := make(map[string][]string, len(ids))
+	for i, id := range ids {
+		prices[id] = converted[i]
+		categories[id] = productCategories[i]
+	}
+
+	out := make([]*pb.OrderItem, len(items))
+	for i, item := range items {
 		out[i] = &pb.OrderItem{
 			Item: item,
-			Cost: price}
+			Cost: prices[item.GetProductId()]}
 	}
-	return out, nil
+	return out, categories, nil
+}
+
+// conversions memoizes the currency conversions of a single request, so
+// equal amounts are converted once even when they are asked for
+// concurrently.
+type conversions struct {
+	cs *checkout
+	to string
+
+	mu    sync.Mutex
+	calls map[string]*conversion
+}
+
+type conversion struct {
+	done   chan struct{}
+	result *pb.Money
+	err    error
+}
+
+func newConversions(cs *checkout, to string) *conversions {
+	return &conversions{cs: cs, to: to, calls: make(map[string]*conversion)}
+}
+
+func (c *conversions) convert(ctx context.Context, from *pb.Money) (*pb.Money, error) {
+	key := fmt.Sprintf("%s %d %d", from.GetCurrencyCode(), from.GetUnits(), from.GetNanos())
+
+	c.mu.Lock()
+	call, ok := c.calls[key]
+	if !ok {
+		call = &conversion{done: make(chan struct{})}
+		c.calls[key] = call
+	}
+	c.mu.Unlock()
+
+	if ok {
+		select {
+		case <-call.done:
+			return call.result, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	call.result, call.err = c.cs.convertCurrency(ctx, from, c.to)
+	close(call.done)
+	return call.result, call.err
 }
 
 func (cs *checkout) convertCurrency(ctx context.Context, from *pb.Money, toCurrency string) (*pb.Money, error) {
-	result, err := cs.currencySvcClient.Convert(ctx, &pb.CurrencyConversionRequest{
-		From:   from,
-		ToCode: toCurrency})
+	ctx, span := tracer.Start(ctx, "convertCurrency", trace.WithAttributes(
+		attribute.String("app.currency.conversion.from", from.GetCurrencyCode()),
+		attribute.String("app.currency.conversion.to", toCurrency),
+	))
+	defer span.End()
+
+	result, source, err := cs.converter.convert(ctx, from, toCurrency)
+	span.SetAttributes(attribute.String("app.currency.conversion.source", source))
 	if err != nil {
+		span.SetStatus(otelcodes.Error, err.Error())
 		return nil, fmt.Errorf("failed to convert currency: %+v", err)
 	}
 	return result, err
 }
 
 func (cs *checkout) chargeCard(ctx context.Context, amount *pb.Money, paymentInfo *pb.CreditCardInfo) (string, error) {
-	paymentService := cs.paymentSvcClient
-	if cs.isFeatureFlagEnabled(ctx, "paymentUnreachable") {
-		badAddress := "badAddress:50051"
-		c := mustCreateClient(badAddress)
-		paymentService = pb.NewPaymentServiceClient(c)
-	}
-
-	paymentResp, err := paymentService.Charge(ctx, &pb.ChargeRequest{
+	paymentResp, err := cs.paymentSvcClient.Charge(ctx, &pb.ChargeRequest{
 		Amount:     amount,
 		CreditCard: paymentInfo})
 	if err != nil {
@@ -457,7 +917,30 @@ func (cs *checkout) chargeCard(ctx context.Context, amount *pb.Money, paymentInf
 	return paymentResp.GetTransactionId(), nil
 }
 
+func (cs *checkout) refundCharge(ctx context.Context, transactionID string, amount *pb.Money) (string, error) {
+	resp, err := cs.paymentSvcClient.Refund(ctx, &pb.RefundRequest{
+		TransactionId: transactionID,
+		Amount:        amount})
+	if err != nil {
+		return "", fmt.Errorf("could not refund transaction %q: %+v", transactionID, err)
+	}
+	log.Infof("payment refunded (transaction_id: %s, refund_id: %s)", transactionID, resp.GetRefundId())
+	return resp.GetRefundId(), nil
+}
+
+// sendOrderConfirmation sends the confirmation with the gRPC client of the
+// email service when checkout has one, and over its HTTP API otherwise.
 func (cs *checkout) sendOrderConfirmation(ctx context.Context, email string, order *pb.OrderResult) error {
+	if cs.emailSvcClient != nil {
+		_, err := cs.emailSvcClient.SendOrderConfirmation(ctx, &pb.SendOrderConfirmationRequest{
+			Email: email,
+			Order: order})
+		if err != nil {
+			return fmt.Errorf("failed to send order confirmation: %+v", err)
+		}
+		return nil
+	}
+
 	emailPayload, err := json.Marshal(map[string]interface{}{
 		"email": email,
 		"order": order,
@@ -489,67 +972,117 @@ func (cs *checkout) shipOrder(ctx context.Context, address *pb.Address, items []
 	return resp.GetTrackingId(), nil
 }
 
+func (cs *checkout) cancelShipment(ctx context.Context, trackingID string) error {
+	if _, err := cs.shippingSvcClient.CancelShipment(ctx, &pb.CancelShipmentRequest{TrackingId: trackingID}); err != nil {
+		return fmt.Errorf("failed to cancel shipment %q: %+v", trackingID, err)
+	}
+	return nil
+}
+
+// compensate undoes the completed steps of a failed order. Compensation
+// failures are logged rather than returned, since the caller is already
+// reporting the error that caused the rollback.
+func (cs *checkout) compensate(ctx context.Context, sg *saga.Saga) {
+	if err := sg.Compensate(ctx); err != nil {
+		log.Errorf("failed to roll back order: %+v", err)
+	}
+}
+
 func (cs *checkout) sendToPostProcessor(ctx context.Context, result *pb.OrderResult) {
-	message, err := proto.Marshal(result)
+	message, headers, err := cs.events.Encode(cloudevents.TypeOrderPlaced, result.OrderId, result)
 	if err != nil {
-		log.Errorf("Failed to marshal message to protobuf: %+v", err)
+		log.Errorf("Failed to encode order event: %+v", err)
 		return
 	}
 
 	msg := sarama.ProducerMessage{
-		Topic: kafka.Topic,
-		Value: sarama.ByteEncoder(message),
+		Topic:   cs.kafkaTopic,
+		Value:   sarama.ByteEncoder(message),
+		Headers: kafkaHeaders(headers),
 	}
+	cs.publish(ctx, &msg)
+	cs.overloadKafkaQueue(ctx, &msg)
+}
 
+// publish sends msg to Kafka and waits for the broker to acknowledge it.
+// Failures are traced and logged, since events are sent after the order
+// they describe has been committed.
+func (cs *checkout) publish(ctx context.Context, msg *sarama.ProducerMessage) {
 	// Inject tracing info into message
-	span := createProducerSpan(ctx, &msg)
+	span := createProducerSpan(ctx, msg)
 	defer span.End()
 
 	// Send message and handle response
 	startTime := time.Now()
-	select {
-	case cs.KafkaProducerClient.Input() <- &msg:
-		log.Infof("Message sent to Kafka: %v", msg)
-		select {
-		case successMsg := <-cs.KafkaProducerClient.Successes():
-			span.SetAttributes(
-				attribute.Bool("messaging.kafka.producer.success", true),
-				attribute.Int("messaging.kafka.producer.duration_ms", int(time.Since(startTime).Milliseconds())),
-				attribute.KeyValue(semconv.MessagingKafkaMessageOffset(int(successMsg.Offset))),
-			)
-			log.Infof("Successful to write message. offset: %v, duration: %v", successMsg.Offset, time.Since(startTime))
-		case errMsg := <-cs.KafkaProducerClient.Errors():
-			span.SetAttributes(
-				attribute.Bool("messaging.kafka.producer.success", false),
-				attribute.Int("messaging.kafka.producer.duration_ms", int(time.Since(startTime).Milliseconds())),
-			)
-			span.SetStatus(otelcodes.Error, errMsg.Err.Error())
-			log.Errorf("Failed to write message: %v", errMsg.Err)
-		case <-ctx.Done():
-			span.SetAttributes(
-				attribute.Bool("messaging.kafka.producer.success", false),
-				attribute.Int("messaging.kafka.producer.duration_ms", int(time.Since(startTime).Milliseconds())),
-			)
-			span.SetStatus(otelcodes.Error, "Context cancelled: "+ctx.Err().Error())
-			log.Warnf("Context canceled before success message received: %v", ctx.Err())
-		}
-	case <-ctx.Done():
+	future, err := cs.KafkaProducerClient.Send(ctx, msg)
+	if err != nil {
 		span.SetAttributes(
 			attribute.Bool("messaging.kafka.producer.success", false),
 			attribute.Int("messaging.kafka.producer.duration_ms", int(time.Since(startTime).Milliseconds())),
 		)
-		span.SetStatus(otelcodes.Error, "Failed to send: "+ctx.Err().Error())
-		log.Errorf("Failed to send message to Kafka within context deadline: %v", ctx.Err())
+		span.SetStatus(otelcodes.Error, "Failed to send: "+err.Error())
+		log.Errorf("Failed to send message to Kafka within context deadline: %v", err)
 		return
 	}
+	log.Infof("Message sent to Kafka topic %s", msg.Topic)
 
+	ack, err := future.Wait(ctx)
+	switch {
+	case err != nil:
+		span.SetAttributes(
+			attribute.Bool("messaging.kafka.producer.success", false),
+			attribute.Int("messaging.kafka.producer.duration_ms", int(time.Since(startTime).Milliseconds())),
+		)
+		span.SetStatus(otelcodes.Error, "Context cancelled: "+err.Error())
+		log.Warnf("Context canceled before success message received: %v", err)
+	case ack.Err != nil:
+		span.SetAttributes(
+			attribute.Bool("messaging.kafka.producer.success", false),
+			attribute.Int("messaging.kafka.producer.duration_ms", int(time.Since(startTime).Milliseconds())),
+		)
+		span.SetStatus(otelcodes.Error, ack.Err.Error())
+		log.Errorf("Failed to write message: %v", ack.Err)
+	default:
+		span.SetAttributes(
+			attribute.Bool("messaging.kafka.producer.success", true),
+			attribute.Int("messaging.kafka.producer.duration_ms", int(time.Since(startTime).Milliseconds())),
+			attribute.KeyValue(semconv.MessagingKafkaDestinationPartition(int(ack.Partition))),
+			attribute.KeyValue(semconv.MessagingKafkaMessageOffset(int(ack.Offset))),
+		)
+		log.Infof("Successful to write message. offset: %v, duration: %v", ack.Offset, time.Since(startTime))
+	}
+}
+
+// simulateKafkaQueueProblems overloads the queue for orders whose event is
+// published through the outbox, so the kafkaQueueProblems flag behaves the
+// same either way.
+func (cs *checkout) simulateKafkaQueueProblems(ctx context.Context, result *pb.OrderResult) {
+	message, headers, err := cs.events.Encode(cloudevents.TypeOrderPlaced, result.OrderId, result)
+	if err != nil {
+		log.Errorf("Failed to encode order event: %+v", err)
+		return
+	}
+	cs.overloadKafkaQueue(ctx, &sarama.ProducerMessage{
+		Topic:   cs.kafkaTopic,
+		Value:   sarama.ByteEncoder(message),
+		Headers: kafkaHeaders(headers),
+	})
+}
+
+// overloadKafkaQueue floods the producer with copies of msg when the
+// kafkaQueueProblems flag is set. Each copy is a message of its own, since the
+// producer tracks the result of every message it is handed.
+func (cs *checkout) overloadKafkaQueue(ctx context.Context, msg *sarama.ProducerMessage) {
 	ffValue := cs.getIntFeatureFlag(ctx, "kafkaQueueProblems")
 	if ffValue > 0 {
 		log.Infof("Warning: FeatureFlag 'kafkaQueueProblems' is activated, overloading queue now.")
 		for i := 0; i < ffValue; i++ {
 			go func(i int) {
-				cs.KafkaProducerClient.Input() <- &msg
-				_ = <-cs.KafkaProducerClient.Successes()
+				_, _ = cs.KafkaProducerClient.Send(context.Background(), &sarama.ProducerMessage{
+					Topic:   msg.Topic,
+					Value:   msg.Value,
+					Headers: msg.Headers,
+				})
 			}(i)
 		}
 		log.Infof("Done with #%d messages for overload simulation.", ffValue)
@@ -582,20 +1115,6 @@ func createProducerSpan(ctx context.Context, msg *sarama.ProducerMessage) trace.
 	return span
 }
 
-func (cs *checkout) isFeatureFlagEnabled(ctx context.Context, featureFlagName string) bool {
-	client := openfeature.NewClient("checkout")
-
-	// Default value is set to false, but you could also make this a parameter.
-	featureEnabled, _ := client.BooleanValue(
-		ctx,
-		featureFlagName,
-		false,
-		openfeature.EvaluationContext{},
-	)
-
-	return featureEnabled
-}
-
 func (cs *checkout) getIntFeatureFlag(ctx context.Context, featureFlagName string) int {
 	client := openfeature.NewClient("checkout")
 
@@ -0,0 +1,234 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package money
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+)
+
+// defaultMinorUnits is used by Format for currencies missing from the ISO
+// 4217 table.
+const defaultMinorUnits = 2
+
+var (
+	ErrInvalidDecimal  = errors.New("invalid decimal amount")
+	ErrUnknownCurrency = errors.New("unknown currency code")
+)
+
+// RoundingMode decides what happens to the digits beyond the minor unit of a
+// currency.
+type RoundingMode int
+
+const (
+	// RoundHalfEven rounds to the nearest value, and ties to the even one.
+	RoundHalfEven RoundingMode = iota
+	// RoundHalfUp rounds to the nearest value, and ties away from zero.
+	RoundHalfUp
+	// RoundDown drops the extra digits, rounding towards zero.
+	RoundDown
+)
+
+// Parse reads a decimal amount such as "12.34" or "-0.5" in the given
+// currency. Up to nine fractional digits are accepted, regardless of the
+// currency's minor unit.
+func Parse(s, currencyCode string) (*pb.Money, error) {
+	negative := strings.HasPrefix(s, "-")
+	if negative || strings.HasPrefix(s, "+") {
+		s = s[1:]
+	}
+	whole, frac, hasPoint := strings.Cut(s, ".")
+	if !isDigits(whole) || (hasPoint && !isDigits(frac)) || len(frac) > 9 {
+		return &pb.Money{}, ErrInvalidDecimal
+	}
+
+	units, err := strconv.ParseUint(whole, 10, 64)
+	limit := uint64(math.MaxInt64)
+	if negative {
+		limit++
+	}
+	if err != nil || units > limit {
+		return &pb.Money{}, ErrOverflow
+	}
+	nanos := uint64(0)
+	if frac != "" {
+		nanos, _ = strconv.ParseUint(frac+strings.Repeat("0", 9-len(frac)), 10, 32)
+	}
+
+	m := &pb.Money{
+		Units:        int64(units),
+		Nanos:        int32(nanos),
+		CurrencyCode: currencyCode}
+	if negative {
+		m = Negate(m)
+	}
+	return m, nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Format returns the amount as a decimal string with as many fractional
+// digits as the currency's minor unit, rounding half to even. Currencies
+// missing from the ISO 4217 table are shown with two digits. The result can
+// be read back with Parse.
+func Format(m *pb.Money) string {
+	digits, ok := MinorUnits(m.GetCurrencyCode())
+	if !ok {
+		digits = defaultMinorUnits
+	}
+	minor := roundToMinorUnits(toNanos(m), digits, RoundHalfEven)
+
+	negative := minor.Sign() < 0
+	s := minor.Abs(minor).String()
+	if digits > 0 {
+		if len(s) <= digits {
+			s = strings.Repeat("0", digits-len(s)+1) + s
+		}
+		s = s[:len(s)-digits] + "." + s[len(s)-digits:]
+	}
+	if negative {
+		s = "-" + s
+	}
+	return s
+}
+
+// Round rounds m to the minor unit of its currency.
+func Round(m *pb.Money, mode RoundingMode) (*pb.Money, error) {
+	if !IsValid(m) {
+		return &pb.Money{}, ErrInvalidValue
+	}
+	digits, ok := MinorUnits(m.GetCurrencyCode())
+	if !ok {
+		return &pb.Money{}, ErrUnknownCurrency
+	}
+	minor := roundToMinorUnits(toNanos(m), digits, mode)
+	nanos := minor.Mul(minor, pow10(9-digits))
+	if !fitsMoney(nanos) {
+		return &pb.Money{}, ErrOverflow
+	}
+	return fromNanos(nanos, m.GetCurrencyCode()), nil
+}
+
+// Scale multiplies m by the fraction num/den, such as 15/100 for 15%, and
+// rounds the result to the minor unit of its currency with mode. Currencies
+// missing from the ISO 4217 table are rounded to two digits.
+func Scale(m *pb.Money, num, den int64, mode RoundingMode) (*pb.Money, error) {
+	if !IsValid(m) {
+		return &pb.Money{}, ErrInvalidValue
+	}
+	if num < 0 || den <= 0 {
+		return &pb.Money{}, ErrInvalidRatios
+	}
+	digits, ok := MinorUnits(m.GetCurrencyCode())
+	if !ok {
+		digits = defaultMinorUnits
+	}
+	scaled := new(big.Int).Mul(toNanos(m), big.NewInt(num))
+	divisor := new(big.Int).Mul(big.NewInt(den), pow10(9-digits))
+	minor := roundQuo(scaled, divisor, mode)
+	nanos := minor.Mul(minor, pow10(9-digits))
+	if !fitsMoney(nanos) {
+		return &pb.Money{}, ErrOverflow
+	}
+	return fromNanos(nanos, m.GetCurrencyCode()), nil
+}
+
+// Convert multiplies m by rate and returns the result in currencyCode. The
+// result is rounded to the nano with mode rather than to the currency's minor
+// unit, like the amounts the currency service returns.
+func Convert(m *pb.Money, rate *big.Rat, currencyCode string, mode RoundingMode) (*pb.Money, error) {
+	if !IsValid(m) {
+		return &pb.Money{}, ErrInvalidValue
+	}
+	if rate.Sign() < 0 {
+		return &pb.Money{}, ErrInvalidRatios
+	}
+	scaled := new(big.Int).Mul(toNanos(m), rate.Num())
+	nanos := roundQuo(scaled, rate.Denom(), mode)
+	if !fitsMoney(nanos) {
+		return &pb.Money{}, ErrOverflow
+	}
+	return fromNanos(nanos, currencyCode), nil
+}
+
+// Ratio returns l divided by r, regardless of their currencies, such as the
+// exchange rate between an amount and its conversion.
+func Ratio(l, r *pb.Money) (*big.Rat, error) {
+	if !IsValid(l) || !IsValid(r) || IsZero(r) {
+		return nil, ErrInvalidValue
+	}
+	return new(big.Rat).SetFrac(toNanos(l), toNanos(r)), nil
+}
+
+// ToMinorUnits returns m as an integer number of the currency's minor unit,
+// such as cents for USD or yen for JPY, rounding the extra digits with mode.
+func ToMinorUnits(m *pb.Money, mode RoundingMode) (int64, error) {
+	if !IsValid(m) {
+		return 0, ErrInvalidValue
+	}
+	digits, ok := MinorUnits(m.GetCurrencyCode())
+	if !ok {
+		return 0, ErrUnknownCurrency
+	}
+	minor := roundToMinorUnits(toNanos(m), digits, mode)
+	if !minor.IsInt64() {
+		return 0, ErrOverflow
+	}
+	return minor.Int64(), nil
+}
+
+// FromMinorUnits is the inverse of ToMinorUnits.
+func FromMinorUnits(amount int64, currencyCode string) (*pb.Money, error) {
+	digits, ok := MinorUnits(currencyCode)
+	if !ok {
+		return &pb.Money{}, ErrUnknownCurrency
+	}
+	nanos := new(big.Int).Mul(big.NewInt(amount), pow10(9-digits))
+	return fromNanos(nanos, currencyCode), nil
+}
+
+// roundToMinorUnits converts an amount in nanos into an amount with the given
+// number of decimal digits.
+func roundToMinorUnits(nanos *big.Int, digits int, mode RoundingMode) *big.Int {
+	return roundQuo(nanos, pow10(9-digits), mode)
+}
+
+// roundQuo divides n by the positive divisor, rounding with mode.
+func roundQuo(n, divisor *big.Int, mode RoundingMode) *big.Int {
+	quo, rem := new(big.Int).QuoRem(n, divisor, new(big.Int))
+	if rem.Sign() == 0 || mode == RoundDown {
+		return quo
+	}
+
+	// Compare the dropped digits with half of the divisor.
+	half := new(big.Int).Lsh(new(big.Int).Abs(rem), 1).Cmp(divisor)
+	if half > 0 || (half == 0 && (mode == RoundHalfUp || quo.Bit(0) == 1)) {
+		quo.Add(quo, big.NewInt(int64(n.Sign())))
+	}
+	return quo
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// fitsMoney reports whether an amount in nanos can be represented as Money.
+func fitsMoney(nanos *big.Int) bool {
+	units := new(big.Int).Quo(nanos, big.NewInt(nanosMod))
+	return units.IsInt64()
+}
@@ -0,0 +1,240 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package money
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    *pb.Money
+		wantErr error
+	}{
+		{"12.34", mmc(12, 340000000, "USD"), nil},
+		{"12", mmc(12, 0, "USD"), nil},
+		{"+0.5", mmc(0, 500000000, "USD"), nil},
+		{"-0.5", mmc(0, -500000000, "USD"), nil},
+		{"-1.000000001", mmc(-1, -1, "USD"), nil},
+		{"9223372036854775807.999999999", mmc(math.MaxInt64, 999999999, "USD"), nil},
+		{"-9223372036854775808", mmc(math.MinInt64, 0, "USD"), nil},
+		{"9223372036854775808", mm(0, 0), ErrOverflow},
+		{"", mm(0, 0), ErrInvalidDecimal},
+		{"-", mm(0, 0), ErrInvalidDecimal},
+		{".5", mm(0, 0), ErrInvalidDecimal},
+		{"5.", mm(0, 0), ErrInvalidDecimal},
+		{"1,5", mm(0, 0), ErrInvalidDecimal},
+		{"1.2.3", mm(0, 0), ErrInvalidDecimal},
+		{"1e3", mm(0, 0), ErrInvalidDecimal},
+		{" 1", mm(0, 0), ErrInvalidDecimal},
+		{"0.0000000001", mm(0, 0), ErrInvalidDecimal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := Parse(tt.in, "USD")
+			if err != tt.wantErr {
+				t.Errorf("Parse(%q): expected err=\"%v\" got=\"%v\"", tt.in, tt.wantErr, err)
+			}
+			if !AreEquals(got, tt.want) {
+				t.Errorf("Parse(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		in   *pb.Money
+		want string
+	}{
+		{"cents", mmc(12, 340000000, "USD"), "12.34"},
+		{"whole", mmc(12, 0, "USD"), "12.00"},
+		{"small", mmc(0, 6000000, "USD"), "0.01"},
+		{"half even down", mmc(0, 125000000, "USD"), "0.12"},
+		{"half even up", mmc(0, 135000000, "USD"), "0.14"},
+		{"above half", mmc(0, 125000001, "USD"), "0.13"},
+		{"carry", mmc(1, 999000000, "USD"), "2.00"},
+		{"negative", mmc(-3, -50000000, "EUR"), "-3.05"},
+		{"negative below a cent", mmc(0, -4000000, "EUR"), "0.00"},
+		{"no minor unit", mmc(1500, 500000000, "JPY"), "1500"},
+		{"three digits", mmc(1, 234500000, "BHD"), "1.234"},
+		{"four digits", mmc(1, 123450000, "CLF"), "1.1234"},
+		{"unknown currency", mmc(1, 500000000, "XXX"), "1.50"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Format(tt.in); got != tt.want {
+				t.Errorf("Format(%v) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormat_roundTrip(t *testing.T) {
+	checkProperty(t, func(m validMoney) bool {
+		rounded, err := Round(m.Money, RoundHalfEven)
+		if err == ErrOverflow {
+			return true
+		}
+		parsed, err := Parse(Format(m.Money), m.GetCurrencyCode())
+		return err == nil && AreEquals(parsed, rounded)
+	})
+}
+
+func TestToMinorUnits(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      *pb.Money
+		mode    RoundingMode
+		want    int64
+		wantErr error
+	}{
+		{"exact", mmc(12, 340000000, "USD"), RoundHalfEven, 1234, nil},
+		{"half even down", mmc(0, 125000000, "USD"), RoundHalfEven, 12, nil},
+		{"half even up", mmc(0, 135000000, "USD"), RoundHalfEven, 14, nil},
+		{"half up", mmc(0, 125000000, "USD"), RoundHalfUp, 13, nil},
+		{"half up negative", mmc(0, -125000000, "USD"), RoundHalfUp, -13, nil},
+		{"half even negative", mmc(0, -125000000, "USD"), RoundHalfEven, -12, nil},
+		{"below half", mmc(0, 124999999, "USD"), RoundHalfUp, 12, nil},
+		{"down", mmc(0, 129999999, "USD"), RoundDown, 12, nil},
+		{"down negative", mmc(0, -129999999, "USD"), RoundDown, -12, nil},
+		{"yen", mmc(1500, 500000000, "JPY"), RoundHalfEven, 1500, nil},
+		{"dinar", mmc(1, 234000000, "BHD"), RoundHalfEven, 1234, nil},
+		{"Error: unknown currency", mmc(1, 0, "XXX"), RoundHalfEven, 0, ErrUnknownCurrency},
+		{"Error: invalid", mmc(1, -1, "USD"), RoundHalfEven, 0, ErrInvalidValue},
+		{"Error: overflow", mmc(math.MaxInt64, 0, "USD"), RoundHalfEven, 0, ErrOverflow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ToMinorUnits(tt.in, tt.mode)
+			if err != tt.wantErr {
+				t.Errorf("ToMinorUnits(%v): expected err=\"%v\" got=\"%v\"", tt.in, tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("ToMinorUnits(%v) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromMinorUnits(t *testing.T) {
+	tests := []struct {
+		amount  int64
+		code    string
+		want    *pb.Money
+		wantErr error
+	}{
+		{1234, "USD", mmc(12, 340000000, "USD"), nil},
+		{-5, "USD", mmc(0, -50000000, "USD"), nil},
+		{1500, "JPY", mmc(1500, 0, "JPY"), nil},
+		{1234, "BHD", mmc(1, 234000000, "BHD"), nil},
+		{1, "XXX", mm(0, 0), ErrUnknownCurrency},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			got, err := FromMinorUnits(tt.amount, tt.code)
+			if err != tt.wantErr {
+				t.Errorf("FromMinorUnits(%d, %q): expected err=\"%v\" got=\"%v\"", tt.amount, tt.code, tt.wantErr, err)
+			}
+			if !AreEquals(got, tt.want) {
+				t.Errorf("FromMinorUnits(%d, %q) = %v, want %v", tt.amount, tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMinorUnits_roundTrip(t *testing.T) {
+	checkProperty(t, func(amount int64, pick uint8) bool {
+		codes := []string{"USD", "JPY", "BHD", "CLF"}
+		code := codes[int(pick)%len(codes)]
+		m, err := FromMinorUnits(amount, code)
+		if err != nil || !IsValid(m) {
+			return false
+		}
+		for _, mode := range []RoundingMode{RoundHalfEven, RoundHalfUp, RoundDown} {
+			if got, err := ToMinorUnits(m, mode); err != nil || got != amount {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func TestRound(t *testing.T) {
+	got, err := Round(mmc(2, 675000000, "USD"), RoundHalfEven)
+	if err != nil || !AreEquals(got, mmc(2, 680000000, "USD")) {
+		t.Errorf("Round = %v, %v, want 2.68", got, err)
+	}
+	if _, err := Round(mmc(math.MaxInt64, 999999999, "USD"), RoundHalfUp); err != ErrOverflow {
+		t.Errorf("Round: expected err=\"%v\" got=\"%v\"", ErrOverflow, err)
+	}
+}
+
+func TestScale(t *testing.T) {
+	tests := []struct {
+		m        *pb.Money
+		num, den int64
+		mode     RoundingMode
+		want     *pb.Money
+	}{
+		{mmc(200, 0, "USD"), 15, 100, RoundDown, mmc(30, 0, "USD")},
+		{mmc(19, 990000000, "USD"), 125, 1000, RoundDown, mmc(2, 490000000, "USD")},
+		{mmc(19, 990000000, "USD"), 125, 1000, RoundHalfUp, mmc(2, 500000000, "USD")},
+		{mmc(999, 0, "JPY"), 1, 3, RoundHalfEven, mmc(333, 0, "JPY")},
+		{mmc(-10, 0, "EUR"), 1, 3, RoundDown, mmc(-3, -330000000, "EUR")},
+	}
+	for _, tt := range tests {
+		got, err := Scale(tt.m, tt.num, tt.den, tt.mode)
+		if err != nil || !AreEquals(got, tt.want) {
+			t.Errorf("Scale(%v, %d/%d) = %v, %v, want %v", tt.m, tt.num, tt.den, got, err, tt.want)
+		}
+	}
+	if _, err := Scale(mmc(1, 0, "USD"), 1, 0, RoundDown); err != ErrInvalidRatios {
+		t.Errorf("Scale: expected err=\"%v\" got=\"%v\"", ErrInvalidRatios, err)
+	}
+	if _, err := Scale(mmc(math.MaxInt64, 0, "USD"), 2, 1, RoundDown); err != ErrOverflow {
+		t.Errorf("Scale: expected err=\"%v\" got=\"%v\"", ErrOverflow, err)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		m    *pb.Money
+		rate string
+		to   string
+		mode RoundingMode
+		want *pb.Money
+	}{
+		{mmc(100, 0, "EUR"), "1.1305", "USD", RoundHalfEven, mmc(113, 50000000, "USD")},
+		{mmc(1, 0, "USD"), "1/3", "EUR", RoundHalfEven, mmc(0, 333333333, "EUR")},
+		{mmc(2, 0, "USD"), "1/3", "EUR", RoundDown, mmc(0, 666666666, "EUR")},
+		{mmc(-2, 0, "USD"), "1/3", "EUR", RoundHalfUp, mmc(0, -666666667, "EUR")},
+		{mmc(0, 1, "USD"), "1/2", "EUR", RoundHalfEven, mmc(0, 0, "EUR")},
+	}
+	for _, tt := range tests {
+		rate, _ := new(big.Rat).SetString(tt.rate)
+		got, err := Convert(tt.m, rate, tt.to, tt.mode)
+		if err != nil || !AreEquals(got, tt.want) || got.GetCurrencyCode() != tt.to {
+			t.Errorf("Convert(%v, %s) = %v, %v, want %v", tt.m, tt.rate, got, err, tt.want)
+		}
+	}
+	if _, err := Convert(mmc(math.MaxInt64, 0, "USD"), big.NewRat(2, 1), "EUR", RoundDown); err != ErrOverflow {
+		t.Errorf("Convert: expected err=\"%v\" got=\"%v\"", ErrOverflow, err)
+	}
+}
+
+func TestRatio(t *testing.T) {
+	got, err := Ratio(mmc(113, 50000000, "USD"), mmc(100, 0, "EUR"))
+	if want := big.NewRat(11305, 10000); err != nil || got.Cmp(want) != 0 {
+		t.Errorf("Ratio = %v, %v, want %v", got, err, want)
+	}
+	if _, err := Ratio(mmc(1, 0, "USD"), mmc(0, 0, "EUR")); err != ErrInvalidValue {
+		t.Errorf("Ratio: expected err=\"%v\" got=\"%v\"", ErrInvalidValue, err)
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package money
+
+import "strings"
+
+// minorUnits maps ISO 4217 currency codes to the number of digits after the
+// decimal separator. Codes without a minor unit, such as XAU, are left out.
+var minorUnits = func() map[string]int {
+	table := make(map[string]int)
+	add := func(digits int, codes string) {
+		for _, code := range strings.Fields(codes) {
+			table[code] = digits
+		}
+	}
+	add(0, `BIF CLP DJF GNF ISK JPY KMF KRW PYG RWF UGX UYI VND VUV XAF XOF XPF`)
+	add(2, `AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BMD BND BOB
+		BOV BRL BSD BTN BWP BYN BZD CAD CDF CHE CHF CHW CNY COP COU CRC CUC CUP
+		CVE CZK DKK DOP DZD EGP ERN ETB EUR FJD FKP GBP GEL GHS GIP GMD GTQ GYD
+		HKD HNL HTG HUF IDR ILS INR IRR JMD KES KGS KHR KPW KYD KZT LAK LBP LKR
+		LRD LSL MAD MDL MGA MKD MMK MNT MOP MRU MUR MVR MWK MXN MXV MYR MZN NAD
+		NGN NIO NOK NPR NZD PAB PEN PGK PHP PKR PLN QAR RON RSD RUB SAR SBD SCR
+		SDG SEK SGD SHP SLE SLL SOS SRD SSP STN SVC SYP SZL THB TJS TMT TOP TRY
+		TTD TWD TZS UAH USD USN UYU UZS VED VES WST XCD XCG YER ZAR ZMW ZWG ZWL`)
+	add(3, `BHD IQD JOD KWD LYD OMR TND`)
+	add(4, `CLF UYW`)
+	return table
+}()
+
+// MinorUnits returns the number of decimal digits used by the currency, for
+// example 2 for USD, 0 for JPY and 3 for BHD. It returns false for codes that
+// are unknown or have no minor unit.
+func MinorUnits(currencyCode string) (int, bool) {
+	digits, ok := minorUnits[currencyCode]
+	return digits, ok
+}
@@ -4,6 +4,10 @@ package money
 
 import (
 	"errors"
+	"math"
+	"math/big"
+	"math/bits"
+	"sort"
 
 	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
 )
@@ -17,6 +21,8 @@ const (
 var (
 	ErrInvalidValue        = errors.New("one of the specified money values is invalid")
 	ErrMismatchingCurrency = errors.New("mismatching currency codes")
+	ErrOverflow            = errors.New("money value overflows the units range")
+	ErrInvalidRatios       = errors.New("ratios must be non-negative and not all zero")
 )
 
 // IsValid checks if specified value has a valid units/nanos signs and ranges.
@@ -84,12 +90,17 @@ func Sum(l, r *pb.Money) (*pb.Money, error) {
 	} else if l.GetCurrencyCode() != r.GetCurrencyCode() {
 		return &pb.Money{}, ErrMismatchingCurrency
 	}
-	units := l.GetUnits() + r.GetUnits()
+	units, overflow := addUnits(l.GetUnits(), r.GetUnits())
+	if overflow {
+		return &pb.Money{}, ErrOverflow
+	}
 	nanos := l.GetNanos() + r.GetNanos()
 
-	if (units == 0 && nanos == 0) || (units > 0 && nanos >= 0) || (units < 0 && nanos <= 0) {
+	if units == 0 || nanos == 0 || (units > 0) == (nanos > 0) {
 		// same sign <units, nanos>
-		units += int64(nanos / nanosMod)
+		if units, overflow = addUnits(units, int64(nanos/nanosMod)); overflow {
+			return &pb.Money{}, ErrOverflow
+		}
 		nanos = nanos % nanosMod
 	} else {
 		// different sign. nanos guaranteed to not to go over the limit
@@ -108,8 +119,178 @@ func Sum(l, r *pb.Money) (*pb.Money, error) {
 		CurrencyCode: l.GetCurrencyCode()}, nil
 }
 
+// addUnits adds l and r, reporting whether the result overflowed int64.
+func addUnits(l, r int64) (int64, bool) {
+	sum := l + r
+	return sum, (l > 0 && r > 0 && sum < 0) || (l < 0 && r < 0 && sum >= 0)
+}
+
+// Multiply returns m multiplied by n. Returns an error if m is invalid or the
+// result does not fit in the units range.
+func Multiply(m *pb.Money, n int64) (*pb.Money, error) {
+	if !IsValid(m) {
+		return &pb.Money{}, ErrInvalidValue
+	}
+
+	negative := (m.GetUnits() < 0 || m.GetNanos() < 0) != (n < 0)
+	units, nanos, k := abs(m.GetUnits()), abs(int64(m.GetNanos())), abs(n)
+
+	// nanos*k can exceed 64 bits, but its high word is below nanos, so the
+	// quotient by nanosMod always fits.
+	hi, lo := bits.Mul64(nanos, k)
+	carry, nanos := bits.Div64(hi, lo, nanosMod)
+
+	hi, lo = bits.Mul64(units, k)
+	lo, c := bits.Add64(lo, carry, 0)
+	limit := uint64(math.MaxInt64)
+	if negative {
+		limit++
+	}
+	if hi != 0 || c != 0 || lo > limit {
+		return &pb.Money{}, ErrOverflow
+	}
+
+	// For math.MinInt64 units the conversion wraps to the negative value
+	// already, and negating it leaves it unchanged.
+	out := &pb.Money{
+		Units:        int64(lo),
+		Nanos:        int32(nanos),
+		CurrencyCode: m.GetCurrencyCode()}
+	if negative {
+		out = Negate(out)
+	}
+	return out, nil
+}
+
+// abs returns the magnitude of v. It is correct for math.MinInt64 as well.
+func abs(v int64) uint64 {
+	if v < 0 {
+		return uint64(-(v + 1)) + 1
+	}
+	return uint64(v)
+}
+
+// Allocate splits m into len(ratios) parts proportional to ratios. The parts
+// always add up to exactly m: the nanos left over after rounding every part
+// down are handed out one at a time, to the parts that lost the most to
+// rounding first. A part with a zero ratio is always zero.
+func Allocate(m *pb.Money, ratios []int) ([]*pb.Money, error) {
+	if !IsValid(m) {
+		return nil, ErrInvalidValue
+	}
+	total := new(big.Int)
+	for _, r := range ratios {
+		if r < 0 {
+			return nil, ErrInvalidRatios
+		}
+		total.Add(total, big.NewInt(int64(r)))
+	}
+	if total.Sign() == 0 {
+		return nil, ErrInvalidRatios
+	}
+
+	amount := toNanos(m)
+	negative := amount.Sign() < 0
+	amount.Abs(amount)
+
+	parts := make([]*big.Int, len(ratios))
+	remainders := make([]*big.Int, len(ratios))
+	allocated := new(big.Int)
+	for i, r := range ratios {
+		parts[i], remainders[i] = new(big.Int).QuoRem(
+			new(big.Int).Mul(amount, big.NewInt(int64(r))), total, new(big.Int))
+		allocated.Add(allocated, parts[i])
+	}
+
+	order := make([]int, len(ratios))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]].Cmp(remainders[order[b]]) > 0
+	})
+	left := new(big.Int).Sub(amount, allocated).Int64() // less than len(ratios)
+	for _, i := range order[:left] {
+		parts[i].Add(parts[i], big.NewInt(1))
+	}
+
+	out := make([]*pb.Money, len(ratios))
+	for i, part := range parts {
+		if negative {
+			part.Neg(part)
+		}
+		out[i] = fromNanos(part, m.GetCurrencyCode())
+	}
+	return out, nil
+}
+
+func toNanos(m *pb.Money) *big.Int {
+	n := new(big.Int).Mul(big.NewInt(m.GetUnits()), big.NewInt(nanosMod))
+	return n.Add(n, big.NewInt(int64(m.GetNanos())))
+}
+
+// fromNanos converts an amount in nanos that is known to be in range back
+// into a Money value.
+func fromNanos(n *big.Int, currencyCode string) *pb.Money {
+	units, nanos := new(big.Int).QuoRem(n, big.NewInt(nanosMod), new(big.Int))
+	return &pb.Money{
+		Units:        units.Int64(),
+		Nanos:        int32(nanos.Int64()),
+		CurrencyCode: currencyCode}
+}
+
+// Compare returns -1, 0 or +1 depending on whether l is less than, equal to
+// or greater than r. Returns an error if one of the values is invalid or the
+// currency codes are not matching.
+func Compare(l, r *pb.Money) (int, error) {
+	if !IsValid(l) || !IsValid(r) {
+		return 0, ErrInvalidValue
+	} else if l.GetCurrencyCode() != r.GetCurrencyCode() {
+		return 0, ErrMismatchingCurrency
+	}
+	// Units and nanos of a valid value never have opposite signs, so the
+	// values order like the <units, nanos> pairs.
+	switch {
+	case l.GetUnits() < r.GetUnits():
+		return -1, nil
+	case l.GetUnits() > r.GetUnits():
+		return 1, nil
+	case l.GetNanos() < r.GetNanos():
+		return -1, nil
+	case l.GetNanos() > r.GetNanos():
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Min returns the smaller of l and r, or l if they are equal.
+func Min(l, r *pb.Money) (*pb.Money, error) {
+	c, err := Compare(l, r)
+	if err != nil {
+		return &pb.Money{}, err
+	}
+	if c > 0 {
+		return r, nil
+	}
+	return l, nil
+}
+
+// Max returns the larger of l and r, or l if they are equal.
+func Max(l, r *pb.Money) (*pb.Money, error) {
+	c, err := Compare(l, r)
+	if err != nil {
+		return &pb.Money{}, err
+	}
+	if c < 0 {
+		return r, nil
+	}
+	return l, nil
+}
+
 // MultiplySlow is a slow multiplication operation done through adding the value
 // to itself n-1 times.
+//
+// Deprecated: use Multiply, which runs in constant time and reports overflow.
 func MultiplySlow(m *pb.Money, n uint32) *pb.Money {
 	out := m
 	for n > 1 {
@@ -3,9 +3,14 @@
 package money
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"math/big"
+	"math/rand"
 	"reflect"
 	"testing"
+	"testing/quick"
 
 	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
 )
@@ -218,6 +223,9 @@ func TestSum(t *testing.T) {
 		{"mixed (larger negative, with borrow)", args{mm(-11, -100000000), mm(2, 9000000 /*.09*/)}, mm(-9, -91000000 /*.091*/), nil},
 		{"0+negative", args{mm(0, 0), mm(-2, -100000000)}, mm(-2, -100000000), nil},
 		{"negative+0", args{mm(-2, -100000000), mm(0, 0)}, mm(-2, -100000000), nil},
+		{"just nanos", args{mm(0, 982811510), mm(0, 0)}, mm(0, 982811510), nil},
+		{"just nanos (carry)", args{mm(0, 600000000), mm(0, 600000000)}, mm(1, 200000000), nil},
+		{"just negative nanos (carry)", args{mm(0, -600000000), mm(0, -600000000)}, mm(-1, -200000000), nil},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -231,3 +239,273 @@ func TestSum(t *testing.T) {
 		})
 	}
 }
+
+// validMoney is a quick.Generator for valid money values. Units are drawn
+// from a few magnitudes so both small amounts and values close to the int64
+// limits show up.
+type validMoney struct{ *pb.Money }
+
+func (validMoney) Generate(r *rand.Rand, _ int) reflect.Value {
+	var units int64
+	switch r.Intn(4) {
+	case 0:
+		units = 0
+	case 1:
+		units = r.Int63n(1000)
+	case 2:
+		units = r.Int63n(1 << 40)
+	default:
+		units = r.Int63()
+	}
+	nanos := r.Int31n(nanosMod)
+	if units == 0 && r.Intn(2) == 0 {
+		nanos = 0
+	}
+	if r.Intn(2) == 0 {
+		units, nanos = -units, -nanos
+	}
+	return reflect.ValueOf(validMoney{mmc(units, nanos, "USD")})
+}
+
+// inRange reports whether an amount in nanos can be represented as Money.
+func inRange(n *big.Int) bool {
+	hi := new(big.Int).Mul(big.NewInt(math.MaxInt64), big.NewInt(nanosMod))
+	hi.Add(hi, big.NewInt(nanosMax))
+	lo := new(big.Int).Mul(big.NewInt(math.MinInt64), big.NewInt(nanosMod))
+	lo.Add(lo, big.NewInt(nanosMin))
+	return n.Cmp(lo) >= 0 && n.Cmp(hi) <= 0
+}
+
+func checkProperty(t *testing.T, f interface{}) {
+	t.Helper()
+	if err := quick.Check(f, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSum_overflow(t *testing.T) {
+	tests := []struct {
+		name string
+		l, r *pb.Money
+	}{
+		{"units", mm(math.MaxInt64, 0), mm(1, 0)},
+		{"carry", mm(math.MaxInt64, 600000000), mm(0, 600000000)},
+		{"negative units", mm(math.MinInt64+1, 0), mm(-2, 0)},
+		{"negative carry", mm(math.MinInt64, -600000000), mm(0, -600000000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Sum(tt.l, tt.r); err != ErrOverflow {
+				t.Errorf("Sum([%v],[%v]): expected err=\"%v\" got=\"%v\"", tt.l, tt.r, ErrOverflow, err)
+			}
+		})
+	}
+}
+
+func TestSum_property(t *testing.T) {
+	checkProperty(t, func(l, r validMoney) bool {
+		want := new(big.Int).Add(toNanos(l.Money), toNanos(r.Money))
+		got, err := Sum(l.Money, r.Money)
+		if !inRange(want) {
+			return err == ErrOverflow
+		}
+		return err == nil && IsValid(got) && toNanos(got).Cmp(want) == 0
+	})
+}
+
+func TestMultiply(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       *pb.Money
+		n       int64
+		want    *pb.Money
+		wantErr error
+	}{
+		{"zero", mmc(3, 500000000, "USD"), 0, mmc(0, 0, "USD"), nil},
+		{"one", mmc(3, 500000000, "USD"), 1, mmc(3, 500000000, "USD"), nil},
+		{"carry", mmc(3, 500000000, "USD"), 3, mmc(10, 500000000, "USD"), nil},
+		{"negative value", mm(-3, -500000000), 3, mm(-10, -500000000), nil},
+		{"negative factor", mm(3, 500000000), -3, mm(-10, -500000000), nil},
+		{"both negative", mm(-3, -500000000), -3, mm(10, 500000000), nil},
+		{"large quantity", mm(0, 999999999), math.MaxInt32, mm(2147483644, 852516353), nil},
+		{"Error: invalid", mm(1, -1), 2, mm(0, 0), ErrInvalidValue},
+		{"Error: overflow", mm(math.MaxInt64/2+1, 0), 2, mm(0, 0), ErrOverflow},
+		{"Error: overflow from nanos", mm(math.MaxInt64, 500000000), 2, mm(0, 0), ErrOverflow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Multiply(tt.m, tt.n)
+			if err != tt.wantErr {
+				t.Errorf("Multiply([%v],%d): expected err=\"%v\" got=\"%v\"", tt.m, tt.n, tt.wantErr, err)
+			}
+			if !AreEquals(got, tt.want) {
+				t.Errorf("Multiply([%v],%d) = %v, want %v", tt.m, tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMultiply_property(t *testing.T) {
+	checkProperty(t, func(m validMoney, n int64) bool {
+		if rand.Intn(2) == 0 {
+			n %= 1000
+		}
+		want := new(big.Int).Mul(toNanos(m.Money), big.NewInt(n))
+		got, err := Multiply(m.Money, n)
+		if !inRange(want) {
+			return err == ErrOverflow
+		}
+		return err == nil && IsValid(got) && toNanos(got).Cmp(want) == 0 &&
+			got.GetCurrencyCode() == m.GetCurrencyCode()
+	})
+}
+
+func TestMultiply_matchesMultiplySlow(t *testing.T) {
+	checkProperty(t, func(units uint16, nanos uint32, n uint8) bool {
+		m := mm(int64(units), int32(nanos%nanosMod))
+		got, err := Multiply(m, int64(n))
+		if n == 0 {
+			// MultiplySlow never returns less than m.
+			return err == nil && IsZero(got)
+		}
+		return err == nil && AreEquals(got, MultiplySlow(m, uint32(n)))
+	})
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       *pb.Money
+		ratios  []int
+		want    []*pb.Money
+		wantErr error
+	}{
+		{"even", mm(10, 0), []int{1, 1}, []*pb.Money{mm(5, 0), mm(5, 0)}, nil},
+		{"thirds", mm(1, 0), []int{1, 1, 1}, []*pb.Money{mm(0, 333333334), mm(0, 333333333), mm(0, 333333333)}, nil},
+		{"largest remainder first", mm(0, 5), []int{1, 3}, []*pb.Money{mm(0, 1), mm(0, 4)}, nil},
+		{"zero ratio", mm(7, 0), []int{0, 2, 5}, []*pb.Money{mm(0, 0), mm(2, 0), mm(5, 0)}, nil},
+		{"negative", mm(-1, 0), []int{1, 1, 1}, []*pb.Money{mm(0, -333333334), mm(0, -333333333), mm(0, -333333333)}, nil},
+		{"keeps currency", mmc(3, 0, "EUR"), []int{2, 1}, []*pb.Money{mmc(2, 0, "EUR"), mmc(1, 0, "EUR")}, nil},
+		{"Error: invalid value", mm(1, -1), []int{1}, nil, ErrInvalidValue},
+		{"Error: no ratios", mm(1, 0), nil, nil, ErrInvalidRatios},
+		{"Error: zero ratios", mm(1, 0), []int{0, 0}, nil, ErrInvalidRatios},
+		{"Error: negative ratio", mm(1, 0), []int{2, -1}, nil, ErrInvalidRatios},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Allocate(tt.m, tt.ratios)
+			if err != tt.wantErr {
+				t.Errorf("Allocate([%v],%v): expected err=\"%v\" got=\"%v\"", tt.m, tt.ratios, tt.wantErr, err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Allocate([%v],%v) = %v, want %v", tt.m, tt.ratios, got, tt.want)
+			}
+			for i := range got {
+				if !AreEquals(got[i], tt.want[i]) {
+					t.Errorf("Allocate([%v],%v) = %v, want %v", tt.m, tt.ratios, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAllocate_property(t *testing.T) {
+	checkProperty(t, func(m validMoney, ratios []uint16) bool {
+		rs := make([]int, len(ratios))
+		total := int64(0)
+		for i, r := range ratios {
+			rs[i] = int(r)
+			total += int64(r)
+		}
+		parts, err := Allocate(m.Money, rs)
+		if total == 0 {
+			return errors.Is(err, ErrInvalidRatios)
+		}
+		if err != nil || len(parts) != len(rs) {
+			return false
+		}
+
+		amount := toNanos(m.Money)
+		sum := new(big.Int)
+		for i, part := range parts {
+			if !IsValid(part) || part.GetCurrencyCode() != m.GetCurrencyCode() {
+				return false
+			}
+			got := toNanos(part)
+			sum.Add(sum, got)
+
+			// Every part is within one nano of its exact share.
+			exact := new(big.Rat).SetFrac(new(big.Int).Mul(amount, big.NewInt(int64(rs[i]))), big.NewInt(total))
+			diff := new(big.Rat).Sub(new(big.Rat).SetInt(got), exact)
+			if diff.Abs(diff).Cmp(big.NewRat(1, 1)) >= 0 {
+				return false
+			}
+		}
+		return sum.Cmp(amount) == 0
+	})
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name    string
+		l, r    *pb.Money
+		want    int
+		wantErr error
+	}{
+		{"equal", mm(1, 5), mm(1, 5), 0, nil},
+		{"units", mm(1, 900000000), mm(2, 0), -1, nil},
+		{"nanos", mm(1, 6), mm(1, 5), 1, nil},
+		{"negative", mm(-1, -5), mm(-1, -4), -1, nil},
+		{"negative nanos only", mm(0, -1), mm(0, 0), -1, nil},
+		{"Error: currency code mismatch", mmc(1, 0, "AAA"), mmc(1, 0, "BBB"), 0, ErrMismatchingCurrency},
+		{"Error: invalid", mm(1, -1), mm(1, 0), 0, ErrInvalidValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Compare(tt.l, tt.r)
+			if err != tt.wantErr {
+				t.Errorf("Compare([%v],[%v]): expected err=\"%v\" got=\"%v\"", tt.l, tt.r, tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("Compare([%v],[%v]) = %d, want %d", tt.l, tt.r, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompare_property(t *testing.T) {
+	checkProperty(t, func(l, r validMoney) bool {
+		got, err := Compare(l.Money, r.Money)
+		if err != nil {
+			return false
+		}
+		reverse, _ := Compare(r.Money, l.Money)
+		return got == toNanos(l.Money).Cmp(toNanos(r.Money)) && reverse == -got
+	})
+}
+
+func TestMinMax_property(t *testing.T) {
+	checkProperty(t, func(l, r validMoney) bool {
+		lo, err := Min(l.Money, r.Money)
+		if err != nil {
+			return false
+		}
+		hi, err := Max(l.Money, r.Money)
+		if err != nil {
+			return false
+		}
+		c, _ := Compare(lo, hi)
+		return c <= 0 &&
+			(lo == l.Money || lo == r.Money) && (hi == l.Money || hi == r.Money) &&
+			(lo != hi || AreEquals(l.Money, r.Money))
+	})
+}
+
+func TestMinMax_mismatchingCurrency(t *testing.T) {
+	if _, err := Min(mmc(1, 0, "AAA"), mmc(2, 0, "BBB")); err != ErrMismatchingCurrency {
+		t.Errorf("Min: expected err=\"%v\" got=\"%v\"", ErrMismatchingCurrency, err)
+	}
+	if _, err := Max(mmc(1, 0, "AAA"), mmc(2, 0, "BBB")); err != ErrMismatchingCurrency {
+		t.Errorf("Max: expected err=\"%v\" got=\"%v\"", ErrMismatchingCurrency, err)
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/db/postgres"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+)
+
+const (
+	defaultOrdersPageSize = 20
+	maxOrdersPageSize     = 100
+)
+
+// orderRepository stores placed orders. It is implemented by
+// postgres.OrderRepository.
+type orderRepository interface {
+	CreateOrder(ctx context.Context, order *postgres.Order, events ...*postgres.OutboxEvent) error
+	GetOrder(ctx context.Context, id string) (*postgres.Order, error)
+	ListOrdersForUser(ctx context.Context, userID string, limit int, after *postgres.OrderCursor) ([]*postgres.Order, *postgres.OrderCursor, error)
+	BeginCancel(ctx context.Context, id string, lease time.Duration) (*postgres.CancelClaim, error)
+	RecordRefund(ctx context.Context, id string, claim *postgres.CancelClaim, refundID string) error
+	CompleteCancel(ctx context.Context, id string, claim *postgres.CancelClaim, reason string, events ...*postgres.OutboxEvent) error
+	AbandonCancel(ctx context.Context, id string, claim *postgres.CancelClaim) error
+}
+
+func (cs *checkout) GetOrder(ctx context.Context, req *pb.GetOrderRequest) (*pb.GetOrderResponse, error) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.String("app.order.id", req.OrderId))
+
+	if cs.orders == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "order storage is not configured")
+	}
+	if req.OrderId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "order_id is required")
+	}
+
+	order, err := cs.orders.GetOrder(ctx, req.OrderId)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get order: %+v", err)
+	}
+	if order == nil || (req.UserId != "" && order.UserID != req.UserId) {
+		return nil, status.Errorf(codes.NotFound, "order %q not found", req.OrderId)
+	}
+	return &pb.GetOrderResponse{Order: toOrderRecord(order)}, nil
+}
+
+func (cs *checkout) ListOrdersForUser(ctx context.Context, req *pb.ListOrdersForUserRequest) (*pb.ListOrdersForUserResponse, error) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.String("app.user.id", req.UserId))
+
+	if cs.orders == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "order storage is not configured")
+	}
+	if req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id is required")
+	}
+
+	pageSize := int(req.PageSize)
+	switch {
+	case pageSize < 0:
+		return nil, status.Errorf(codes.InvalidArgument, "page_size must not be negative")
+	case pageSize == 0:
+		pageSize = defaultOrdersPageSize
+	case pageSize > maxOrdersPageSize:
+		pageSize = maxOrdersPageSize
+	}
+
+	var after *postgres.OrderCursor
+	if req.PageToken != "" {
+		var err error
+		if after, err = decodePageToken(req.PageToken); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid page_token: %v", err)
+		}
+	}
+
+	orders, next, err := cs.orders.ListOrdersForUser(ctx, req.UserId, pageSize, after)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list orders: %+v", err)
+	}
+
+	resp := &pb.ListOrdersForUserResponse{Orders: make([]*pb.OrderRecord, len(orders))}
+	for i, o := range orders {
+		resp.Orders[i] = toOrderRecord(o)
+	}
+	if next != nil {
+		resp.NextPageToken = encodePageToken(next)
+	}
+	span.SetAttributes(attribute.Int("app.orders.count", len(orders)))
+	return resp, nil
+}
+
+// encodePageToken turns a cursor into an opaque token. Clients must not rely
+// on its format.
+func encodePageToken(c *postgres.OrderCursor) string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + ":" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodePageToken(token string) (*postgres.OrderCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok || id == "" {
+		return nil, fmt.Errorf("malformed token")
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed token: %v", err)
+	}
+	return &postgres.OrderCursor{CreatedAt: time.Unix(0, n).UTC(), ID: id}, nil
+}
+
+func newOrderRow(req *pb.PlaceOrderRequest, result *pb.OrderResult, total *pb.Money, transactionID string) *postgres.Order {
+	order := &postgres.Order{
+		ID:                 result.GetOrderId(),
+		UserID:             req.GetUserId(),
+		Email:              req.GetEmail(),
+		Status:             postgres.OrderStatusPlaced,
+		Total:              toMoneyRow(total),
+		ShippingCost:       toMoneyRow(result.GetShippingCost()),
+		ShippingTrackingID: result.GetShippingTrackingId(),
+		TransactionID:      transactionID,
+		ShippingAddress: postgres.Address{
+			StreetAddress: result.GetShippingAddress().GetStreetAddress(),
+			City:          result.GetShippingAddress().GetCity(),
+			State:         result.GetShippingAddress().GetState(),
+			Country:       result.GetShippingAddress().GetCountry(),
+			ZipCode:       result.GetShippingAddress().GetZipCode(),
+		},
+		Items:       make([]postgres.OrderItem, len(result.GetItems())),
+		Adjustments: make([]postgres.OrderAdjustment, len(result.GetAdjustments())),
+		Taxes:       make([]postgres.OrderTax, len(result.GetTaxes())),
+	}
+	for i, it := range result.GetItems() {
+		order.Items[i] = postgres.OrderItem{
+			ProductID: it.GetItem().GetProductId(),
+			Quantity:  it.GetItem().GetQuantity(),
+			Cost:      toMoneyRow(it.GetCost()),
+		}
+	}
+	for i, adj := range result.GetAdjustments() {
+		order.Adjustments[i] = postgres.OrderAdjustment{
+			PromotionID: adj.GetPromotionId(),
+			Description: adj.GetDescription(),
+			PromoCode:   adj.GetPromoCode(),
+			Amount:      toMoneyRow(adj.GetAmount()),
+		}
+	}
+	for i, line := range result.GetTaxes() {
+		order.Taxes[i] = postgres.OrderTax{
+			TaxID:         line.GetTaxId(),
+			Description:   line.GetDescription(),
+			Rate:          line.GetRate(),
+			TaxableAmount: toMoneyRow(line.GetTaxableAmount()),
+			Amount:        toMoneyRow(line.GetAmount()),
+		}
+	}
+	return order
+}
+
+func toOrderRecord(o *postgres.Order) *pb.OrderRecord {
+	result := &pb.OrderResult{
+		OrderId:            o.ID,
+		ShippingTrackingId: o.ShippingTrackingID,
+		ShippingCost:       fromMoneyRow(o.ShippingCost),
+		ShippingAddress: &pb.Address{
+			StreetAddress: o.ShippingAddress.StreetAddress,
+			City:          o.ShippingAddress.City,
+			State:         o.ShippingAddress.State,
+			Country:       o.ShippingAddress.Country,
+			ZipCode:       o.ShippingAddress.ZipCode,
+		},
+		Items:       make([]*pb.OrderItem, len(o.Items)),
+		Adjustments: make([]*pb.OrderAdjustment, len(o.Adjustments)),
+		Taxes:       make([]*pb.TaxLine, len(o.Taxes)),
+	}
+	for i, it := range o.Items {
+		result.Items[i] = &pb.OrderItem{
+			Item: &pb.CartItem{ProductId: it.ProductID, Quantity: it.Quantity},
+			Cost: fromMoneyRow(it.Cost),
+		}
+	}
+	for i, adj := range o.Adjustments {
+		result.Adjustments[i] = &pb.OrderAdjustment{
+			PromotionId: adj.PromotionID,
+			Description: adj.Description,
+			PromoCode:   adj.PromoCode,
+			Amount:      fromMoneyRow(adj.Amount),
+		}
+	}
+	for i, line := range o.Taxes {
+		result.Taxes[i] = &pb.TaxLine{
+			TaxId:         line.TaxID,
+			Description:   line.Description,
+			Rate:          line.Rate,
+			TaxableAmount: fromMoneyRow(line.TaxableAmount),
+			Amount:        fromMoneyRow(line.Amount),
+		}
+	}
+	record := &pb.OrderRecord{
+		Order:        result,
+		UserId:       o.UserID,
+		Status:       o.Status,
+		Total:        fromMoneyRow(o.Total),
+		CreatedAt:    timestamppb.New(o.CreatedAt),
+		CancelReason: o.CancelReason,
+	}
+	if o.CancelledAt != nil {
+		record.CancelledAt = timestamppb.New(*o.CancelledAt)
+	}
+	return record
+}
+
+func toMoneyRow(m *pb.Money) postgres.Money {
+	return postgres.Money{CurrencyCode: m.GetCurrencyCode(), Units: m.GetUnits(), Nanos: m.GetNanos()}
+}
+
+func fromMoneyRow(m postgres.Money) *pb.Money {
+	return &pb.Money{CurrencyCode: m.CurrencyCode, Units: m.Units, Nanos: m.Nanos}
+}
@@ -0,0 +1,32 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/db/postgres"
+)
+
+func TestPageTokenRoundTrip(t *testing.T) {
+	in := &postgres.OrderCursor{
+		CreatedAt: time.Date(2025, 3, 14, 9, 26, 53, 589793000, time.UTC),
+		ID:        "3f1c1a2e-0000-11f0-9f6a-0242ac120002",
+	}
+	out, err := decodePageToken(encodePageToken(in))
+	if err != nil {
+		t.Fatalf("decodePageToken() error = %v", err)
+	}
+	if !out.CreatedAt.Equal(in.CreatedAt) || out.ID != in.ID {
+		t.Errorf("decodePageToken(encodePageToken(%v)) = %v", in, out)
+	}
+}
+
+func TestDecodePageTokenRejectsGarbage(t *testing.T) {
+	for _, token := range []string{"not base64!", "bm9jb2xvbg", "YWJjOmlk", "MTIzOg"} {
+		if _, err := decodePageToken(token); err == nil {
+			t.Errorf("decodePageToken(%q) succeeded, want error", token)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package outbox publishes events that were written to the transactional
+// outbox table together with the data they describe. Events are delivered at
+// least once: an event is only marked as delivered after the broker has
+// acknowledged it, so a relay that restarts publishes it again.
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/db/postgres"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Store is the outbox table as seen by the relay. It is implemented by
+// postgres.OutboxRepository.
+type Store interface {
+	ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]*postgres.OutboxEvent, error)
+	MarkDelivered(ctx context.Context, id int64) error
+	MarkFailed(ctx context.Context, id int64, nextAttempt time.Time, reason string) error
+}
+
+// Config controls how often the relay polls and how it retries.
+type Config struct {
+	// PollInterval is how long the relay sleeps when there is nothing to
+	// publish.
+	PollInterval time.Duration
+	// BatchSize is the maximum number of events claimed at once.
+	BatchSize int
+	// Lease is how long a claimed event is hidden from other relays.
+	Lease time.Duration
+	// MinBackoff and MaxBackoff bound the exponential delay between
+	// attempts to publish an event that failed.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultConfig returns the settings used by checkout.
+func DefaultConfig() Config {
+	return Config{
+		PollInterval: time.Second,
+		BatchSize:    50,
+		Lease:        30 * time.Second,
+		MinBackoff:   time.Second,
+		MaxBackoff:   5 * time.Minute,
+	}
+}
+
+// Relay moves events from the outbox to Kafka.
+type Relay struct {
+	store    Store
+	producer sarama.SyncProducer
+	tracer   trace.Tracer
+	log      *logrus.Logger
+	cfg      Config
+	now      func() time.Time
+}
+
+// NewRelay creates a relay that publishes with the given producer, which
+// should be configured to wait for all replicas to acknowledge.
+func NewRelay(store Store, producer sarama.SyncProducer, tracer trace.Tracer, log *logrus.Logger, cfg Config) *Relay {
+	return &Relay{
+		store:    store,
+		producer: producer,
+		tracer:   tracer,
+		log:      log,
+		cfg:      cfg,
+		now:      time.Now,
+	}
+}
+
+// NewEvent creates an outbox event that is published with headers and the
+// trace context of ctx, so the message published later continues the trace
+// of the request.
+func NewEvent(ctx context.Context, topic, key string, payload []byte, headers map[string]string) *postgres.OutboxEvent {
+	carrier := make(propagation.MapCarrier, len(headers))
+	for k, v := range headers {
+		carrier[k] = v
+	}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	return &postgres.OutboxEvent{
+		AggregateID: key,
+		Topic:       topic,
+		Key:         key,
+		Payload:     payload,
+		Headers:     carrier,
+	}
+}
+
+// Run publishes pending events until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		n, err := r.relayBatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.log.Errorf("outbox relay failed to claim events: %+v", err)
+		}
+		if n > 0 && err == nil {
+			// There may be more events waiting.
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.cfg.PollInterval):
+		}
+	}
+}
+
+// relayBatch claims and publishes one batch of events and returns how many
+// were claimed.
+func (r *Relay) relayBatch(ctx context.Context) (int, error) {
+	events, err := r.store.ClaimPending(ctx, r.cfg.BatchSize, r.cfg.Lease)
+	if err != nil {
+		return 0, err
+	}
+	for _, event := range events {
+		r.publish(ctx, event)
+	}
+	return len(events), nil
+}
+
+func (r *Relay) publish(ctx context.Context, event *postgres.OutboxEvent) {
+	msg := &sarama.ProducerMessage{
+		Topic: event.Topic,
+		Value: sarama.ByteEncoder(event.Payload),
+	}
+	if event.Key != "" {
+		msg.Key = sarama.StringEncoder(event.Key)
+	}
+
+	// Continue the trace of the request that wrote the event.
+	parent := otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(event.Headers))
+	spanCtx, span := r.tracer.Start(parent,
+		fmt.Sprintf("%s publish", event.Topic),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.PeerService("kafka"),
+			semconv.NetworkTransportTCP,
+			semconv.MessagingSystemKafka,
+			semconv.MessagingDestinationName(event.Topic),
+			semconv.MessagingOperationPublish,
+			attribute.Int64("app.outbox.event.id", event.ID),
+			attribute.Int("app.outbox.event.attempts", event.Attempts),
+		),
+	)
+	defer span.End()
+
+	// The stored trace context is replaced by that of the publish span.
+	carrier := make(propagation.MapCarrier, len(event.Headers))
+	for key, value := range event.Headers {
+		carrier[key] = value
+	}
+	for _, field := range otel.GetTextMapPropagator().Fields() {
+		delete(carrier, field)
+	}
+	otel.GetTextMapPropagator().Inject(spanCtx, carrier)
+	for key, value := range carrier {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+	}
+
+	startTime := r.now()
+	partition, offset, err := r.producer.SendMessage(msg)
+	span.SetAttributes(attribute.Int("messaging.kafka.producer.duration_ms", int(r.now().Sub(startTime).Milliseconds())))
+	if err != nil {
+		next := r.now().Add(r.backoff(event.Attempts))
+		span.SetAttributes(attribute.Bool("messaging.kafka.producer.success", false))
+		span.SetStatus(otelcodes.Error, err.Error())
+		r.log.Warnf("Failed to publish outbox event %d, retrying at %s: %v", event.ID, next.Format(time.RFC3339), err)
+		if markErr := r.store.MarkFailed(ctx, event.ID, next, err.Error()); markErr != nil {
+			r.log.Errorf("Failed to record failed outbox event %d: %+v", event.ID, markErr)
+		}
+		return
+	}
+
+	span.SetAttributes(
+		attribute.Bool("messaging.kafka.producer.success", true),
+		semconv.MessagingKafkaDestinationPartition(int(partition)),
+		semconv.MessagingKafkaMessageOffset(int(offset)),
+	)
+	if err := r.store.MarkDelivered(ctx, event.ID); err != nil {
+		// The event is published again once its lease expires.
+		r.log.Errorf("Failed to mark outbox event %d as delivered: %+v", event.ID, err)
+		return
+	}
+	r.log.Infof("Published outbox event %d. partition: %d, offset: %d", event.ID, partition, offset)
+}
+
+// backoff returns the delay before the next attempt of an event that has
+// already failed attempts times.
+func (r *Relay) backoff(attempts int) time.Duration {
+	d := r.cfg.MinBackoff
+	for i := 0; i < attempts && d < r.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > r.cfg.MaxBackoff {
+		d = r.cfg.MaxBackoff
+	}
+	return d
+}
@@ -0,0 +1,159 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package outbox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/db/postgres"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type fakeStore struct {
+	mu        sync.Mutex
+	pending   []*postgres.OutboxEvent
+	delivered []int64
+	failed    map[int64]time.Time
+}
+
+func (s *fakeStore) ClaimPending(_ context.Context, limit int, _ time.Duration) ([]*postgres.OutboxEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if limit > len(s.pending) {
+		limit = len(s.pending)
+	}
+	claimed := s.pending[:limit]
+	s.pending = s.pending[limit:]
+	return claimed, nil
+}
+
+func (s *fakeStore) MarkDelivered(_ context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delivered = append(s.delivered, id)
+	return nil
+}
+
+func (s *fakeStore) MarkFailed(_ context.Context, id int64, next time.Time, _ string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failed == nil {
+		s.failed = make(map[int64]time.Time)
+	}
+	s.failed[id] = next
+	return nil
+}
+
+func newTestRelay(t *testing.T, store Store) (*Relay, *mocks.SyncProducer, *tracetest.SpanRecorder) {
+	t.Helper()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	producer := mocks.NewSyncProducer(t, nil)
+	log := logrus.New()
+	log.Out = io.Discard
+	return NewRelay(store, producer, tp.Tracer("outbox"), log, DefaultConfig()), producer, sr
+}
+
+func TestRelayPublishesAndMarksDelivered(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	tp := sdktrace.NewTracerProvider()
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "PlaceOrder")
+	event := NewEvent(ctx, "orders", "order-1", []byte("payload"), map[string]string{"ce_type": "oteldemo.order.placed.v1"})
+	event.ID = 1
+	parent.End()
+
+	store := &fakeStore{pending: []*postgres.OutboxEvent{event}}
+	relay, producer, sr := newTestRelay(t, store)
+
+	var headers []sarama.RecordHeader
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		headers = msg.Headers
+		return nil
+	})
+
+	n, err := relay.relayBatch(context.Background())
+	if err != nil || n != 1 {
+		t.Fatalf("relayBatch() = %d, %v; want 1, nil", n, err)
+	}
+	if len(store.delivered) != 1 || store.delivered[0] != 1 {
+		t.Errorf("delivered = %v, want [1]", store.delivered)
+	}
+
+	spans := sr.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.SpanContext().TraceID() != parent.SpanContext().TraceID() {
+		t.Errorf("publish span is in trace %v, want %v", span.SpanContext().TraceID(), parent.SpanContext().TraceID())
+	}
+	if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("publish span parent = %v, want %v", span.Parent().SpanID(), parent.SpanContext().SpanID())
+	}
+
+	var traceparent, eventType string
+	for _, h := range headers {
+		switch string(h.Key) {
+		case "traceparent":
+			traceparent = string(h.Value)
+		case "ce_type":
+			eventType = string(h.Value)
+		}
+	}
+	if len(headers) != 2 || eventType != "oteldemo.order.placed.v1" {
+		t.Errorf("headers = %v, want the event headers and one traceparent", headers)
+	}
+	if want := "00-" + span.SpanContext().TraceID().String() + "-" + span.SpanContext().SpanID().String() + "-01"; traceparent != want {
+		t.Errorf("traceparent header = %q, want %q", traceparent, want)
+	}
+}
+
+func TestRelayBacksOffFailedEvents(t *testing.T) {
+	store := &fakeStore{pending: []*postgres.OutboxEvent{{ID: 1, Topic: "orders", Attempts: 2}}}
+	relay, producer, _ := newTestRelay(t, store)
+	now := time.Unix(1000, 0)
+	relay.now = func() time.Time { return now }
+
+	producer.ExpectSendMessageAndFail(errors.New("broker unavailable"))
+
+	if _, err := relay.relayBatch(context.Background()); err != nil {
+		t.Fatalf("relayBatch() error = %v", err)
+	}
+	if len(store.delivered) != 0 {
+		t.Errorf("delivered = %v, want none", store.delivered)
+	}
+	if got, want := store.failed[1], now.Add(4*time.Second); !got.Equal(want) {
+		t.Errorf("next attempt = %v, want %v", got, want)
+	}
+}
+
+func TestBackoffIsCapped(t *testing.T) {
+	relay := &Relay{cfg: Config{MinBackoff: time.Second, MaxBackoff: time.Minute}}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{5, 32 * time.Second},
+		{6, time.Minute},
+		{100, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := relay.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,415 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/cloudevents"
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/idempotency"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/kafka"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/money"
+)
+
+func TestMain(m *testing.M) {
+	tracer = noop.NewTracerProvider().Tracer("checkout")
+	log.Out = io.Discard
+	os.Exit(m.Run())
+}
+
+const testUserID = "user-1"
+
+func testCart() []*pb.CartItem {
+	return []*pb.CartItem{
+		{ProductId: "OLJCESPC7Z", Quantity: 2},
+		{ProductId: "66VCHSJNUP", Quantity: 1},
+	}
+}
+
+func testOrderRequest() *pb.PlaceOrderRequest {
+	return &pb.PlaceOrderRequest{
+		UserId:       testUserID,
+		UserCurrency: "EUR",
+		Address: &pb.Address{
+			StreetAddress: "1600 Amphitheatre Parkway",
+			City:          "Mountain View",
+			State:         "CA",
+			Country:       "United States",
+			ZipCode:       "94043",
+		},
+		Email: "someone@example.com",
+		CreditCard: &pb.CreditCardInfo{
+			CreditCardNumber:          "4432-8015-6152-0454",
+			CreditCardCvv:             672,
+			CreditCardExpirationYear:  2039,
+			CreditCardExpirationMonth: 1,
+		},
+	}
+}
+
+// wantTotal is the cost of testCart plus shipping, converted to EUR: 2 x
+// 201.00 + 40.00 + 17.98.
+var wantTotal = &pb.Money{CurrencyCode: "EUR", Units: 459, Nanos: 980000000}
+
+func TestPlaceOrder(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "service unavailable")
+
+	tests := []struct {
+		name     string
+		setup    func(f *fakes, svc *checkout)
+		wantCode codes.Code
+		check    func(t *testing.T, f *fakes, svc *checkout, resp *pb.PlaceOrderResponse)
+	}{
+		{
+			name:     "Success",
+			wantCode: codes.OK,
+			check: func(t *testing.T, f *fakes, svc *checkout, resp *pb.PlaceOrderResponse) {
+				order := resp.GetOrder()
+				if order.GetOrderId() == "" || order.GetShippingTrackingId() != "TRACK-1" {
+					t.Errorf("unexpected order: %v", order)
+				}
+				if len(order.GetItems()) != 2 || !money.AreEquals(order.GetItems()[0].GetCost(), &pb.Money{CurrencyCode: "EUR", Units: 201}) {
+					t.Errorf("unexpected order items: %v", order.GetItems())
+				}
+				if len(f.payment.charges) != 1 || !money.AreEquals(f.payment.charges[0].GetAmount(), wantTotal) {
+					t.Errorf("expected one charge of %v, got %v", wantTotal, f.payment.charges)
+				}
+				if len(f.cart.cartOf(testUserID)) != 0 {
+					t.Error("expected the cart to be emptied")
+				}
+				sent := f.email.confirmations()
+				if len(sent) != 1 || sent[0].GetEmail() != "someone@example.com" || sent[0].GetOrder().GetOrderId() != order.GetOrderId() {
+					t.Errorf("unexpected order confirmations: %v", sent)
+				}
+			},
+		},
+		{
+			name: "StoresOrder",
+			setup: func(f *fakes, svc *checkout) {
+				svc.orders = &fakeOrders{}
+			},
+			wantCode: codes.OK,
+			check: func(t *testing.T, f *fakes, svc *checkout, resp *pb.PlaceOrderResponse) {
+				orders := svc.orders.(*fakeOrders)
+				if len(orders.orders) != 1 || orders.orders[0].ID != resp.GetOrder().GetOrderId() {
+					t.Fatalf("expected the order to be stored, got %v", orders.orders)
+				}
+				if got := orders.orders[0]; got.TransactionID != "TX-1" || got.Total.Units != 459 {
+					t.Errorf("unexpected stored order: %+v", got)
+				}
+				if len(orders.events) != 0 {
+					t.Errorf("expected no outbox events without Kafka, got %d", len(orders.events))
+				}
+			},
+		},
+		{
+			name: "QueuesOutboxEvent",
+			setup: func(f *fakes, svc *checkout) {
+				svc.orders = &fakeOrders{}
+				svc.useOutbox = true
+				svc.kafkaBrokerSvcAddr = "kafka:9092"
+				svc.kafkaTopic = "orders"
+			},
+			wantCode: codes.OK,
+			check: func(t *testing.T, f *fakes, svc *checkout, resp *pb.PlaceOrderResponse) {
+				events := svc.orders.(*fakeOrders).events
+				if len(events) != 1 || events[0].Topic != "orders" || events[0].Key != resp.GetOrder().GetOrderId() {
+					t.Fatalf("unexpected outbox events: %v", events)
+				}
+				got := new(pb.OrderResult)
+				event := decodeEvent(t, events[0].Headers, events[0].Payload, got)
+				if !proto.Equal(got, resp.GetOrder()) {
+					t.Errorf("outbox event = %v, want %v", got, resp.GetOrder())
+				}
+				if event.Type != cloudevents.TypeOrderPlaced || event.Source != eventSource {
+					t.Errorf("unexpected event attributes: %+v", event)
+				}
+			},
+		},
+		{
+			name: "CartUnavailable",
+			setup: func(f *fakes, svc *checkout) {
+				f.cart.getErr = unavailable
+			},
+			wantCode: codes.Internal,
+			check: func(t *testing.T, f *fakes, svc *checkout, resp *pb.PlaceOrderResponse) {
+				if len(f.payment.charges) != 0 {
+					t.Error("expected no charge")
+				}
+			},
+		},
+		{
+			name: "UnknownProduct",
+			setup: func(f *fakes, svc *checkout) {
+				f.cart.items[testUserID] = append(f.cart.items[testUserID], &pb.CartItem{ProductId: "MISSING", Quantity: 1})
+			},
+			wantCode: codes.Internal,
+			check: func(t *testing.T, f *fakes, svc *checkout, resp *pb.PlaceOrderResponse) {
+				if len(f.payment.charges) != 0 {
+					t.Error("expected no charge")
+				}
+			},
+		},
+		{
+			name: "CurrencyUnavailable",
+			setup: func(f *fakes, svc *checkout) {
+				f.currency.convertErr = unavailable
+			},
+			wantCode: codes.Internal,
+		},
+		{
+			name: "ShippingQuoteFails",
+			setup: func(f *fakes, svc *checkout) {
+				f.shipping.quoteErr = unavailable
+			},
+			wantCode: codes.Internal,
+			check: func(t *testing.T, f *fakes, svc *checkout, resp *pb.PlaceOrderResponse) {
+				if len(f.payment.charges) != 0 {
+					t.Error("expected no charge")
+				}
+			},
+		},
+		{
+			name: "ChargeDeclined",
+			setup: func(f *fakes, svc *checkout) {
+				f.payment.chargeErr = status.Error(codes.InvalidArgument, "card declined")
+			},
+			wantCode: codes.Internal,
+			check: func(t *testing.T, f *fakes, svc *checkout, resp *pb.PlaceOrderResponse) {
+				if f.shipping.shipped != 0 {
+					t.Error("expected nothing to be shipped")
+				}
+				if len(f.cart.cartOf(testUserID)) == 0 {
+					t.Error("expected the cart to be kept")
+				}
+			},
+		},
+		{
+			name: "ShippingFails",
+			setup: func(f *fakes, svc *checkout) {
+				f.shipping.shipErr = unavailable
+			},
+			wantCode: codes.Unavailable,
+			check: func(t *testing.T, f *fakes, svc *checkout, resp *pb.PlaceOrderResponse) {
+				if len(f.payment.refunds) != 1 || f.payment.refunds[0].GetTransactionId() != "TX-1" ||
+					!money.AreEquals(f.payment.refunds[0].GetAmount(), wantTotal) {
+					t.Errorf("expected TX-1 to be refunded, got %v", f.payment.refunds)
+				}
+				if len(f.cart.cartOf(testUserID)) == 0 {
+					t.Error("expected the cart to be kept")
+				}
+				if len(f.email.confirmations()) != 0 {
+					t.Error("expected no order confirmation")
+				}
+			},
+		},
+		{
+			name: "StoringOrderFails",
+			setup: func(f *fakes, svc *checkout) {
+				svc.orders = &fakeOrders{createErr: errors.New("database is down")}
+			},
+			wantCode: codes.Internal,
+			check: func(t *testing.T, f *fakes, svc *checkout, resp *pb.PlaceOrderResponse) {
+				if len(f.payment.refunds) != 1 {
+					t.Errorf("expected the charge to be refunded, got %v", f.payment.refunds)
+				}
+				if len(f.shipping.cancelled) != 1 || f.shipping.cancelled[0] != "TRACK-1" {
+					t.Errorf("expected TRACK-1 to be cancelled, got %v", f.shipping.cancelled)
+				}
+				if got := f.cart.cartOf(testUserID); len(got) != len(testCart()) || got[0].GetProductId() != "OLJCESPC7Z" || got[0].GetQuantity() != 2 {
+					t.Errorf("cart = %v, want the items of the order restored", got)
+				}
+				if len(f.cart.restoredItems) != len(testCart()) {
+					t.Errorf("restored %d items, want the %d items of the emptied cart", len(f.cart.restoredItems), len(testCart()))
+				}
+			},
+		},
+		{
+			name: "EmptyingCartFails",
+			setup: func(f *fakes, svc *checkout) {
+				f.cart.emptyErr = unavailable
+			},
+			wantCode: codes.OK,
+			check: func(t *testing.T, f *fakes, svc *checkout, resp *pb.PlaceOrderResponse) {
+				if len(f.payment.refunds) != 0 {
+					t.Error("expected the order to stand")
+				}
+			},
+		},
+		{
+			name: "EmailFails",
+			setup: func(f *fakes, svc *checkout) {
+				f.email.statusCode = http.StatusInternalServerError
+			},
+			wantCode: codes.OK,
+			check: func(t *testing.T, f *fakes, svc *checkout, resp *pb.PlaceOrderResponse) {
+				if len(f.email.confirmations()) != 0 {
+					t.Error("expected no order confirmation")
+				}
+				if len(f.payment.refunds) != 0 {
+					t.Error("expected the order to stand")
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakes()
+			f.cart.items[testUserID] = testCart()
+			svc := startFakes(t, f)
+			if tt.setup != nil {
+				tt.setup(f, svc)
+			}
+
+			resp, err := svc.PlaceOrder(context.Background(), testOrderRequest())
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("PlaceOrder() code = %v, want %v (err: %v)", got, tt.wantCode, err)
+			}
+			if tt.check != nil {
+				tt.check(t, f, svc, resp)
+			}
+		})
+	}
+}
+
+func TestPlaceOrderKafka(t *testing.T) {
+	tests := []struct {
+		name     string
+		result   error
+		encoding cloudevents.Encoding
+	}{
+		{"Published", nil, cloudevents.Protobuf},
+		{"PublishedAsJSON", nil, cloudevents.JSON},
+		{"BrokerFails", sarama.ErrNotEnoughReplicas, cloudevents.Protobuf},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakes()
+			f.cart.items[testUserID] = testCart()
+			svc := startFakes(t, f)
+
+			config := mocks.NewTestConfig()
+			config.Producer.Return.Successes = true
+			config.Producer.Return.Errors = true
+			mock := mocks.NewAsyncProducer(t, config)
+
+			published := make(chan *sarama.ProducerMessage, 1)
+			checker := func(msg *sarama.ProducerMessage) error {
+				published <- msg
+				return nil
+			}
+			if tt.result == nil {
+				mock.ExpectInputWithMessageCheckerFunctionAndSucceed(checker)
+			} else {
+				mock.ExpectInputWithMessageCheckerFunctionAndFail(checker, tt.result)
+			}
+
+			producer := kafka.NewProducer(mock, log)
+			defer producer.Close()
+			svc.kafkaBrokerSvcAddr = "kafka:9092"
+			svc.kafkaTopic = "orders"
+			svc.KafkaProducerClient = producer
+			svc.events.Encoding = tt.encoding
+
+			resp, err := svc.PlaceOrder(context.Background(), testOrderRequest())
+			if err != nil {
+				t.Fatalf("PlaceOrder() error = %v, a failed publish must not fail the order", err)
+			}
+
+			select {
+			case msg := <-published:
+				if msg.Topic != "orders" {
+					t.Errorf("published to %q, want orders", msg.Topic)
+				}
+				payload, err := msg.Value.Encode()
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := new(pb.OrderResult)
+				event := decodeEvent(t, recordHeaders(msg.Headers), payload, got)
+				if !proto.Equal(got, resp.GetOrder()) {
+					t.Errorf("published order = %v, want %v", got, resp.GetOrder())
+				}
+				if event.Type != cloudevents.TypeOrderPlaced || event.Subject != resp.GetOrder().GetOrderId() || event.ContentType != tt.encoding.ContentType() {
+					t.Errorf("unexpected event attributes: %+v", event)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("no order event was published")
+			}
+		})
+	}
+}
+
+func TestPlaceOrderIdempotent(t *testing.T) {
+	f := newFakes()
+	f.cart.items[testUserID] = testCart()
+	svc := startFakes(t, f)
+	svc.idempotencyStore = idempotency.NewMemoryStore(10, time.Minute)
+	svc.idempotencyWait = time.Second
+
+	req := testOrderRequest()
+	req.IdempotencyKey = "retry-me"
+	first, err := svc.PlaceOrder(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := svc.PlaceOrder(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !proto.Equal(first, second) {
+		t.Errorf("retry returned %v, want %v", second, first)
+	}
+	if len(f.payment.charges) != 1 {
+		t.Errorf("expected a single charge, got %d", len(f.payment.charges))
+	}
+}
+
+func TestPlaceOrderIdempotencyKeyReusedForAnotherOrder(t *testing.T) {
+	f := newFakes()
+	f.cart.items[testUserID] = testCart()
+	svc := startFakes(t, f)
+	svc.idempotencyStore = idempotency.NewMemoryStore(10, time.Minute)
+	svc.idempotencyWait = time.Second
+
+	req := testOrderRequest()
+	req.IdempotencyKey = "retry-me"
+	if _, err := svc.PlaceOrder(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	other := testOrderRequest()
+	other.IdempotencyKey = "retry-me"
+	other.Email = "someone.else@example.com"
+	f.cart.items[testUserID] = testCart()
+	if _, err := svc.PlaceOrder(context.Background(), other); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("PlaceOrder() with a reused key error = %v, want InvalidArgument", err)
+	}
+
+	// The same request sent with the key in the metadata is a replay.
+	req.IdempotencyKey = ""
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(idempotencyKeyHeader, "retry-me"))
+	if _, err := svc.PlaceOrder(ctx, req); err != nil {
+		t.Errorf("PlaceOrder() with the key in the metadata error = %v, want the stored order", err)
+	}
+	if len(f.payment.charges) != 1 {
+		t.Errorf("expected a single charge, got %d", len(f.payment.charges))
+	}
+}
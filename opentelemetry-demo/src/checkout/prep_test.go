@@ -0,0 +1,123 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+)
+
+// addProducts adds n products priced at 10 USD to the catalog fake and
+// returns a cart with one of each.
+func addProducts(f *fakes, n int) []*pb.CartItem {
+	var items []*pb.CartItem
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("PRODUCT%02d", i)
+		f.catalog.products[id] = &pb.Product{Id: id, PriceUsd: &pb.Money{CurrencyCode: "USD", Units: 10}}
+		items = append(items, &pb.CartItem{ProductId: id, Quantity: int32(i + 1)})
+	}
+	return items
+}
+
+func TestPrepOrderItemsKeepsOrderAndDeduplicates(t *testing.T) {
+	f := newFakes()
+	svc := startFakes(t, f)
+
+	items := []*pb.CartItem{
+		{ProductId: "66VCHSJNUP", Quantity: 1},
+		{ProductId: "OLJCESPC7Z", Quantity: 2},
+		{ProductId: "66VCHSJNUP", Quantity: 3},
+	}
+	got, _, err := svc.prepOrderItems(context.Background(), items, "EUR")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantCosts := []*pb.Money{
+		{CurrencyCode: "EUR", Units: 40},
+		{CurrencyCode: "EUR", Units: 201},
+		{CurrencyCode: "EUR", Units: 40},
+	}
+	if len(got) != len(items) {
+		t.Fatalf("got %d order items, want %d", len(got), len(items))
+	}
+	for i := range items {
+		if !proto.Equal(got[i].GetItem(), items[i]) || !proto.Equal(got[i].GetCost(), wantCosts[i]) {
+			t.Errorf("item %d = %v, want %v at %v", i, got[i], items[i], wantCosts[i])
+		}
+	}
+	if n := f.catalog.lookups["66VCHSJNUP"]; n != 1 {
+		t.Errorf("product looked up %d times, want 1", n)
+	}
+}
+
+func TestPrepOrderItemsMemoizesConversions(t *testing.T) {
+	f := newFakes()
+	items := addProducts(f, 5)
+	svc := startFakes(t, f)
+
+	if _, _, err := svc.prepOrderItems(context.Background(), items, "EUR"); err != nil {
+		t.Fatal(err)
+	}
+	if f.currency.calls != 1 {
+		t.Errorf("Convert called %d times for 5 equal prices, want 1", f.currency.calls)
+	}
+}
+
+func TestPrepOrderItemsBoundsConcurrency(t *testing.T) {
+	f := newFakes()
+	items := addProducts(f, 8)
+	f.catalog.delay = 20 * time.Millisecond
+	svc := startFakes(t, f)
+	svc.prepConcurrency = 3
+
+	if _, _, err := svc.prepOrderItems(context.Background(), items, "EUR"); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.catalog.maxInFlight; got < 2 || got > 3 {
+		t.Errorf("%d lookups were in flight at once, want between 2 and the limit of 3", got)
+	}
+}
+
+func TestPrepOrderItemsCancelsOnFirstError(t *testing.T) {
+	f := newFakes()
+	items := addProducts(f, 3)
+	f.catalog.block = map[string]bool{"PRODUCT00": true, "PRODUCT01": true}
+	items = append(items, &pb.CartItem{ProductId: "MISSING", Quantity: 1})
+	svc := startFakes(t, f)
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := svc.prepOrderItems(context.Background(), items, "EUR")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("prepOrderItems() error = nil, want the missing product to fail it")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("prepOrderItems() did not return after the first error")
+	}
+
+	// The blocked lookups notice the cancellation on the server shortly after.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		f.catalog.mu.Lock()
+		cancelled := f.catalog.cancelled
+		f.catalog.mu.Unlock()
+		if cancelled == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d blocked lookups were cancelled, want 2", cancelled)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/money"
+)
+
+func testPreviewRequest() *pb.PreviewOrderRequest {
+	req := testOrderRequest()
+	return &pb.PreviewOrderRequest{
+		UserId:       req.UserId,
+		UserCurrency: req.UserCurrency,
+		Address:      req.Address,
+	}
+}
+
+// previewQuote previews the order of testPreviewRequest and returns its
+// quote.
+func previewQuote(t *testing.T, svc *checkout) *pb.OrderQuote {
+	t.Helper()
+	resp, err := svc.PreviewOrder(context.Background(), testPreviewRequest())
+	if err != nil {
+		t.Fatalf("PreviewOrder() error = %v", err)
+	}
+	return resp.GetQuote()
+}
+
+func TestPreviewOrder(t *testing.T) {
+	f := newFakes()
+	f.cart.items[testUserID] = testCart()
+	svc := startFakes(t, f)
+
+	before := time.Now()
+	quote := previewQuote(t, svc)
+	if quote.GetQuoteId() == "" {
+		t.Error("quote has no ID")
+	}
+	if len(quote.GetItems()) != 2 || !money.AreEquals(quote.GetItems()[0].GetCost(), &pb.Money{CurrencyCode: "EUR", Units: 201}) {
+		t.Errorf("quote items = %v", quote.GetItems())
+	}
+	if !money.AreEquals(quote.GetShippingCost(), &pb.Money{CurrencyCode: "EUR", Units: 17, Nanos: 980000000}) {
+		t.Errorf("quote shipping cost = %v", quote.GetShippingCost())
+	}
+	if !money.AreEquals(quote.GetTotal(), wantTotal) {
+		t.Errorf("quote total = %v, want %v", quote.GetTotal(), wantTotal)
+	}
+	if expires := quote.GetExpiresAt().AsTime(); expires.Before(before.Add(defaultQuoteTTL)) {
+		t.Errorf("quote expires at %v, want %v after the preview", expires, defaultQuoteTTL)
+	}
+
+	if len(f.payment.charges) != 0 || f.shipping.shipped != 0 || len(f.email.confirmations()) != 0 {
+		t.Errorf("PreviewOrder() charged %d times, shipped %d times and sent %d emails, want none",
+			len(f.payment.charges), f.shipping.shipped, len(f.email.confirmations()))
+	}
+	if len(f.cart.cartOf(testUserID)) != 2 {
+		t.Error("PreviewOrder() changed the cart")
+	}
+}
+
+func TestPreviewOrderValidation(t *testing.T) {
+	svc := startFakes(t, newFakes())
+	req := testPreviewRequest()
+	req.UserCurrency = "XYZ"
+	req.Address = &pb.Address{City: "Mountain View"}
+
+	_, err := svc.PreviewOrder(context.Background(), req)
+	want := []string{"address.country", "address.street_address", "address.zip_code", "user_currency"}
+	if got := violatedFields(t, err); !slices.Equal(got, want) {
+		t.Errorf("violated fields = %q, want %q", got, want)
+	}
+}
+
+func TestPlaceOrderWithQuote(t *testing.T) {
+	f := newFakes()
+	f.cart.items[testUserID] = testCart()
+	svc := startFakes(t, f)
+	quote := previewQuote(t, svc)
+
+	// Prices that change after the preview do not change what the user pays.
+	f.catalog.products["OLJCESPC7Z"] = &pb.Product{Id: "OLJCESPC7Z", PriceUsd: &pb.Money{CurrencyCode: "USD", Units: 500}}
+	lookups := len(f.catalog.lookups)
+
+	req := testOrderRequest()
+	req.QuoteId = quote.GetQuoteId()
+	resp, err := svc.PlaceOrder(context.Background(), req)
+	if err != nil {
+		t.Fatalf("PlaceOrder() error = %v", err)
+	}
+	if len(f.payment.charges) != 1 || !money.AreEquals(f.payment.charges[0].GetAmount(), wantTotal) {
+		t.Errorf("charges = %v, want one of the quoted %v", f.payment.charges, wantTotal)
+	}
+	if items := resp.GetOrder().GetItems(); !money.AreEquals(items[0].GetCost(), quote.GetItems()[0].GetCost()) {
+		t.Errorf("order items = %v, want the quoted items", items)
+	}
+	if len(f.catalog.lookups) != lookups {
+		t.Error("PlaceOrder() looked up products again for a quoted order")
+	}
+
+	// A quote pays for a single order.
+	f.cart.items[testUserID] = testCart()
+	_, err = svc.PlaceOrder(context.Background(), req)
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("PlaceOrder() with a used quote error = %v, want FailedPrecondition", err)
+	}
+}
+
+func TestPlaceOrderRejectsStaleQuote(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(f *fakes, svc *checkout, req *pb.PlaceOrderRequest)
+	}{
+		{
+			name: "UnknownQuote",
+			modify: func(f *fakes, svc *checkout, req *pb.PlaceOrderRequest) {
+				req.QuoteId = "no-such-quote"
+			},
+		},
+		{
+			name: "ExpiredQuote",
+			modify: func(f *fakes, svc *checkout, req *pb.PlaceOrderRequest) {
+				svc.quotes.now = func() time.Time { return time.Now().Add(defaultQuoteTTL) }
+			},
+		},
+		{
+			name: "OtherUser",
+			modify: func(f *fakes, svc *checkout, req *pb.PlaceOrderRequest) {
+				req.UserId = "user-2"
+				f.cart.items["user-2"] = testCart()
+			},
+		},
+		{
+			name: "OtherCurrency",
+			modify: func(f *fakes, svc *checkout, req *pb.PlaceOrderRequest) {
+				req.UserCurrency = "USD"
+			},
+		},
+		{
+			name: "OtherAddress",
+			modify: func(f *fakes, svc *checkout, req *pb.PlaceOrderRequest) {
+				req.Address.ZipCode = "10001"
+			},
+		},
+		{
+			name: "CartChanged",
+			modify: func(f *fakes, svc *checkout, req *pb.PlaceOrderRequest) {
+				f.cart.items[testUserID] = append(testCart(), &pb.CartItem{ProductId: "66VCHSJNUP", Quantity: 1})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakes()
+			f.cart.items[testUserID] = testCart()
+			svc := startFakes(t, f)
+
+			req := testOrderRequest()
+			req.QuoteId = previewQuote(t, svc).GetQuoteId()
+			tt.modify(f, svc, req)
+
+			_, err := svc.PlaceOrder(context.Background(), req)
+			if status.Code(err) != codes.FailedPrecondition {
+				t.Errorf("PlaceOrder() error = %v, want FailedPrecondition", err)
+			}
+			if len(f.payment.charges) != 0 {
+				t.Errorf("PlaceOrder() charged %v for a stale quote", f.payment.charges)
+			}
+		})
+	}
+}
+
+func TestPlaceOrderKeepsQuoteOnFailure(t *testing.T) {
+	f := newFakes()
+	f.cart.items[testUserID] = testCart()
+	svc := startFakes(t, f)
+	req := testOrderRequest()
+	req.QuoteId = previewQuote(t, svc).GetQuoteId()
+
+	f.payment.chargeErr = status.Error(codes.InvalidArgument, "card declined")
+	if _, err := svc.PlaceOrder(context.Background(), req); err == nil {
+		t.Fatal("PlaceOrder() error = nil, want the charge to fail")
+	}
+
+	f.payment.chargeErr = nil
+	if _, err := svc.PlaceOrder(context.Background(), req); err != nil {
+		t.Errorf("PlaceOrder() error = %v, want the quote to be usable after a failed order", err)
+	}
+}
+
+func TestQuoteStore(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := newQuoteStore(time.Minute, 2)
+	s.now = func() time.Time { return now }
+
+	a, b, c := &orderQuote{}, &orderQuote{}, &orderQuote{}
+	s.add(a)
+	now = now.Add(time.Second)
+	s.add(b)
+	s.add(c)
+	if s.take(a.id) != nil {
+		t.Error("take() returned a quote evicted by capacity")
+	}
+
+	got := s.take(b.id)
+	if got != b {
+		t.Fatalf("take() = %v, want the stored quote", got)
+	}
+	if s.take(b.id) != nil {
+		t.Error("take() returned a quote twice")
+	}
+	s.restore(b)
+
+	now = now.Add(time.Minute)
+	if s.take(b.id) != nil || s.take(c.id) != nil {
+		t.Error("take() returned an expired quote")
+	}
+	if s.order.Len() != 0 || len(s.quotes) != 0 {
+		t.Errorf("store holds %d quotes after they expired, want none", s.order.Len())
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package promotions
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/money"
+)
+
+// Item is an order line as the rules see it.
+type Item struct {
+	ProductID string
+	Quantity  int32
+	// Price is the price of a single item in the currency of the order.
+	Price *pb.Money
+}
+
+// Order is what the rules are applied to.
+type Order struct {
+	Currency string
+	Items    []Item
+	Shipping *pb.Money
+	// Codes are the promo codes the user entered.
+	Codes []string
+}
+
+// Converter converts an amount into currency.
+type Converter func(ctx context.Context, from *pb.Money, currency string) (*pb.Money, error)
+
+// Apply returns an adjustment for every rule that gives order a discount at
+// now, in the order of the rules. Amounts are negative and exact: percentages
+// are rounded down to the minor unit of the currency, and the discounts
+// never add up to more than the price of the items and the shipping cost.
+// convert is only called for fixed amounts in another currency.
+func (s *Set) Apply(ctx context.Context, order Order, now time.Time, convert Converter) ([]*pb.OrderAdjustment, error) {
+	if s.Len() == 0 {
+		return nil, nil
+	}
+	codes := make(map[string]bool, len(order.Codes))
+	for _, code := range order.Codes {
+		codes[normalizeCode(code)] = true
+	}
+
+	zero := &pb.Money{CurrencyCode: order.Currency}
+	itemsLeft := zero
+	for _, it := range order.Items {
+		line, err := lineTotal(it, it.Quantity)
+		if err != nil {
+			return nil, err
+		}
+		if itemsLeft, err = money.Sum(itemsLeft, line); err != nil {
+			return nil, err
+		}
+	}
+	shippingLeft := zero
+	if order.Shipping != nil {
+		shippingLeft = order.Shipping
+	}
+
+	var adjustments []*pb.OrderAdjustment
+	for _, r := range s.rules {
+		if !r.active(now) || (r.code != "" && !codes[r.code]) {
+			continue
+		}
+		left := &itemsLeft
+		if r.Type == FreeShipping {
+			left = &shippingLeft
+		}
+		discount, err := r.discount(ctx, order, *left, convert)
+		if err != nil {
+			return nil, fmt.Errorf("promotion %q: %w", r.ID, err)
+		}
+		if discount, err = money.Min(discount, *left); err != nil {
+			return nil, fmt.Errorf("promotion %q: %w", r.ID, err)
+		}
+		if !money.IsPositive(discount) {
+			continue
+		}
+		if *left, err = money.Sum(*left, money.Negate(discount)); err != nil {
+			return nil, fmt.Errorf("promotion %q: %w", r.ID, err)
+		}
+
+		description := r.Description
+		if description == "" {
+			description = r.ID
+		}
+		adjustments = append(adjustments, &pb.OrderAdjustment{
+			PromotionId: r.ID,
+			Description: description,
+			PromoCode:   r.code,
+			Amount:      money.Negate(discount),
+		})
+	}
+	return adjustments, nil
+}
+
+// discount returns the discount r gives order, before it is capped. left is
+// what is left of the price the discount applies to.
+func (r *rule) discount(ctx context.Context, order Order, left *pb.Money, convert Converter) (*pb.Money, error) {
+	zero := &pb.Money{CurrencyCode: order.Currency}
+	switch r.Type {
+	case Percentage:
+		subtotal, err := r.subtotal(order, func(it Item) int32 { return it.Quantity })
+		if err != nil {
+			return nil, err
+		}
+		return money.Scale(subtotal, r.percent, 100*1e9, money.RoundDown)
+
+	case FixedAmount:
+		amount := r.amount
+		if amount.GetCurrencyCode() != order.Currency {
+			converted, err := convert(ctx, amount, order.Currency)
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert %s %s: %w", money.Format(amount), amount.GetCurrencyCode(), err)
+			}
+			if amount, err = money.Scale(converted, 1, 1, money.RoundDown); err != nil {
+				return nil, err
+			}
+		}
+		if r.products == nil {
+			return amount, nil
+		}
+		subtotal, err := r.subtotal(order, func(it Item) int32 { return it.Quantity })
+		if err != nil {
+			return nil, err
+		}
+		return money.Min(amount, subtotal)
+
+	case FreeShipping:
+		return left, nil
+
+	case BuyXGetY:
+		group := int32(r.Buy + r.Get)
+		return r.subtotal(order, func(it Item) int32 { return it.Quantity / group * int32(r.Get) })
+	}
+	return zero, nil
+}
+
+// subtotal adds up the price of quantity(item) of every eligible item.
+func (r *rule) subtotal(order Order, quantity func(Item) int32) (*pb.Money, error) {
+	total := &pb.Money{CurrencyCode: order.Currency}
+	for _, it := range order.Items {
+		if !r.eligible(it.ProductID) {
+			continue
+		}
+		line, err := lineTotal(it, quantity(it))
+		if err != nil {
+			return nil, err
+		}
+		if total, err = money.Sum(total, line); err != nil {
+			return nil, err
+		}
+	}
+	return total, nil
+}
+
+func lineTotal(it Item, quantity int32) (*pb.Money, error) {
+	return money.Multiply(it.Price, int64(quantity))
+}
@@ -0,0 +1,160 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package promotions
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/money"
+)
+
+func eur(units int64, nanos int32) *pb.Money {
+	return &pb.Money{CurrencyCode: "EUR", Units: units, Nanos: nanos}
+}
+
+// testOrder is two telescopes at 201.00 and three lenses at 40.00, shipped
+// for 17.98.
+func testOrder(codes ...string) Order {
+	return Order{
+		Currency: "EUR",
+		Items: []Item{
+			{ProductID: "OLJCESPC7Z", Quantity: 2, Price: eur(201, 0)},
+			{ProductID: "66VCHSJNUP", Quantity: 3, Price: eur(40, 0)},
+		},
+		Shipping: eur(17, 980000000),
+		Codes:    codes,
+	}
+}
+
+// usdToEUR converts at a rate of 2.
+func usdToEUR(_ context.Context, from *pb.Money, currency string) (*pb.Money, error) {
+	if from.GetCurrencyCode() != "USD" || currency != "EUR" {
+		return nil, errors.New("unsupported conversion")
+	}
+	return money.Multiply(&pb.Money{CurrencyCode: "EUR", Units: from.GetUnits(), Nanos: from.GetNanos()}, 2)
+}
+
+func mustParse(t *testing.T, yaml string) *Set {
+	t.Helper()
+	s, err := Parse([]byte(yaml), YAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestApply(t *testing.T) {
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		rules string
+		order Order
+		want  map[string]*pb.Money
+	}{
+		{
+			name:  "PercentageOfEligibleItems",
+			rules: "promotions: [{id: p, type: percentage, percent: 12.5, product_ids: [OLJCESPC7Z]}]",
+			order: testOrder(),
+			// 12.5% of 402.00
+			want: map[string]*pb.Money{"p": eur(-50, -250000000)},
+		},
+		{
+			name:  "PercentageRoundsDown",
+			rules: "promotions: [{id: p, type: percentage, percent: 33.333}]",
+			order: testOrder(),
+			// 33.333% of 522.00 is 173.99826
+			want: map[string]*pb.Money{"p": eur(-173, -990000000)},
+		},
+		{
+			name:  "FixedAmountConverted",
+			rules: "promotions: [{id: f, type: fixed_amount, amount: 5.5, currency: USD}]",
+			order: testOrder(),
+			want:  map[string]*pb.Money{"f": eur(-11, 0)},
+		},
+		{
+			name:  "FixedAmountCappedAtEligibleItems",
+			rules: "promotions: [{id: f, type: fixed_amount, amount: 500, currency: EUR, product_ids: [66VCHSJNUP]}]",
+			order: testOrder(),
+			want:  map[string]*pb.Money{"f": eur(-120, 0)},
+		},
+		{
+			name:  "FreeShipping",
+			rules: "promotions: [{id: s, type: free_shipping, code: SHIP}]",
+			order: testOrder("ship"),
+			want:  map[string]*pb.Money{"s": eur(-17, -980000000)},
+		},
+		{
+			name:  "BuyXGetY",
+			rules: "promotions: [{id: b, type: buy_x_get_y, buy: 2, get: 1}]",
+			order: testOrder(),
+			// Only the lenses come in a group of three.
+			want: map[string]*pb.Money{"b": eur(-40, 0)},
+		},
+		{
+			name:  "CodeNotEntered",
+			rules: "promotions: [{id: s, type: free_shipping, code: SHIP}]",
+			order: testOrder("OTHER"),
+			want:  map[string]*pb.Money{},
+		},
+		{
+			name:  "NotActive",
+			rules: "promotions: [{id: s, type: free_shipping, ends_at: 2026-01-01T00:00:00Z}]",
+			order: testOrder(),
+			want:  map[string]*pb.Money{},
+		},
+		{
+			name: "DiscountsNeverExceedThePrice",
+			rules: `promotions:
+  - {id: half, type: percentage, percent: 50}
+  - {id: most, type: fixed_amount, amount: 400, currency: EUR}
+  - {id: ship, type: free_shipping}
+  - {id: again, type: free_shipping}`,
+			order: testOrder(),
+			want: map[string]*pb.Money{
+				"half": eur(-261, 0),
+				"most": eur(-261, 0),
+				"ship": eur(-17, -980000000),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adjustments, err := mustParse(t, tt.rules).Apply(context.Background(), tt.order, now, usdToEUR)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(adjustments) != len(tt.want) {
+				t.Fatalf("Apply() = %v, want %d adjustments", adjustments, len(tt.want))
+			}
+			for _, adj := range adjustments {
+				want, ok := tt.want[adj.GetPromotionId()]
+				if !ok || !money.AreEquals(adj.GetAmount(), want) {
+					t.Errorf("adjustment %q = %v, want %v", adj.GetPromotionId(), adj.GetAmount(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyRecordsCode(t *testing.T) {
+	s := mustParse(t, "promotions: [{id: s, description: Free shipping, type: free_shipping, code: ship}]")
+	adjustments, err := s.Apply(context.Background(), testOrder(" Ship"), time.Now(), usdToEUR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adj := adjustments[0]; adj.GetPromoCode() != "SHIP" || adj.GetDescription() != "Free shipping" {
+		t.Errorf("adjustment = %v", adj)
+	}
+}
+
+func TestApplyConversionError(t *testing.T) {
+	s := mustParse(t, "promotions: [{id: f, type: fixed_amount, amount: 5, currency: JPY}]")
+	if _, err := s.Apply(context.Background(), testOrder(), time.Now(), usdToEUR); err == nil {
+		t.Error("Apply() = nil, want the failed conversion to be reported")
+	}
+}
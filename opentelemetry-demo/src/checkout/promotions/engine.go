@@ -0,0 +1,113 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package promotions
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Engine holds the rules of a rules file and reloads them when the file
+// changes. It is safe for concurrent use.
+type Engine struct {
+	path   string
+	format Format
+	// Logf reports reloads and rules files that fail to load. It defaults
+	// to doing nothing.
+	Logf func(format string, args ...any)
+
+	rules atomic.Pointer[Set]
+
+	mu   sync.Mutex
+	data []byte
+}
+
+// Load reads the rules file at path, which must have a .json, .yaml or .yml
+// extension.
+func Load(path string) (*Engine, error) {
+	format, err := FormatOf(path)
+	if err != nil {
+		return nil, err
+	}
+	e := &Engine{path: path, format: format, Logf: func(string, ...any) {}}
+	if _, err := e.reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Rules returns the rules currently in effect. A nil Engine has no rules.
+func (e *Engine) Rules() *Set {
+	if e == nil {
+		return nil
+	}
+	return e.rules.Load()
+}
+
+// reload reads the rules file again and swaps in its rules if its content
+// changed. An invalid file leaves the current rules in effect, and so does an
+// empty one, which is usually a file caught in the middle of being written;
+// "promotions: []" removes every rule.
+func (e *Engine) reload() (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	data, err := os.ReadFile(e.path)
+	if err != nil {
+		return false, fmt.Errorf("promotions: %w", err)
+	}
+	if e.data != nil && (len(data) == 0 || bytes.Equal(data, e.data)) {
+		return false, nil
+	}
+	rules, err := Parse(data, e.format)
+	if err != nil {
+		return false, fmt.Errorf("promotions: %s: %w", e.path, err)
+	}
+	e.rules.Store(rules)
+	e.data = data
+	return true, nil
+}
+
+// Watch reloads the rules whenever the rules file changes, until ctx is
+// done. It watches the directory of the file rather than the file itself,
+// so files that are replaced rather than written to, like a mounted
+// Kubernetes ConfigMap, are picked up too.
+func (e *Engine) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("promotions: %w", err)
+	}
+	defer watcher.Close()
+	if err := watcher.Add(filepath.Dir(e.path)); err != nil {
+		return fmt.Errorf("promotions: %w", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-watcher.Errors:
+			e.Logf("promotions: watching %s: %v", e.path, err)
+		case event := <-watcher.Events:
+			if event.Has(fsnotify.Chmod) {
+				continue
+			}
+			// Reading the file again is cheap, and other files in the
+			// directory may be symlinks to it.
+			changed, err := e.reload()
+			switch {
+			case err != nil:
+				e.Logf("failed to reload promotions, keeping the current rules: %v", err)
+			case changed:
+				e.Logf("reloaded %d promotions from %s", e.Rules().Len(), e.path)
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package promotions
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond until it holds or a few seconds have passed.
+func waitFor(t *testing.T, cond func() bool) bool {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if cond() {
+			return true
+		}
+	}
+	return false
+}
+
+func TestEngineReloadsOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "promotions.yaml")
+	if err := os.WriteFile(path, []byte("promotions: [{id: a, type: free_shipping, code: SHIP}]"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	e, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		mu     sync.Mutex
+		logged []string
+	)
+	e.Logf = func(format string, args ...any) {
+		mu.Lock()
+		defer mu.Unlock()
+		logged = append(logged, fmt.Sprintf(format, args...))
+	}
+	failureLogged := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.ContainsFunc(logged, func(s string) bool { return strings.HasPrefix(s, "failed to reload") })
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- e.Watch(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	})
+	// Give the watcher time to start before the file changes.
+	time.Sleep(50 * time.Millisecond)
+
+	// Files are often replaced rather than written to.
+	next := path + ".tmp"
+	if err := os.WriteFile(next, []byte("promotions: [{id: a, type: free_shipping, code: SHIP}, {id: b, type: free_shipping, code: FREE}]"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(next, path); err != nil {
+		t.Fatal(err)
+	}
+	if !waitFor(t, func() bool { return e.Rules().Known("FREE", time.Now()) }) {
+		t.Fatal("the rules were not reloaded after the file changed")
+	}
+
+	if err := os.WriteFile(path, []byte("promotions: [{id: c}]"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if !waitFor(t, failureLogged) {
+		t.Fatal("an invalid rules file was not reported")
+	}
+	if e.Rules().Len() != 2 {
+		t.Errorf("Rules().Len() = %d after an invalid change, want the 2 rules that were in effect", e.Rules().Len())
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := Load(filepath.Join(dir, "promotions.toml")); err == nil {
+		t.Error("Load() accepted an unknown extension")
+	}
+	if _, err := Load(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("Load() accepted a missing file")
+	}
+	invalid := filepath.Join(dir, "invalid.json")
+	os.WriteFile(invalid, []byte(`{"promotions": [{"id": "x", "type": "bogus"}]}`), 0o644)
+	if _, err := Load(invalid); err == nil {
+		t.Error("Load() accepted an invalid file")
+	}
+}
+
+func TestNilEngine(t *testing.T) {
+	var e *Engine
+	if e.Rules().Len() != 0 {
+		t.Error("a nil Engine has rules")
+	}
+}
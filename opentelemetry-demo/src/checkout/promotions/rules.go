@@ -0,0 +1,238 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package promotions applies discounts to orders. Promotions are read from a
+// JSON or YAML rules file and either apply to every order or only to orders
+// that carry their promo code.
+package promotions
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/money"
+)
+
+// Type is the kind of discount a rule gives.
+type Type string
+
+const (
+	// Percentage takes Percent off the price of the eligible items.
+	Percentage Type = "percentage"
+	// FixedAmount takes Amount off the price of the eligible items.
+	FixedAmount Type = "fixed_amount"
+	// FreeShipping takes the shipping cost off the order.
+	FreeShipping Type = "free_shipping"
+	// BuyXGetY gives Get items for free for every Buy items of the same
+	// eligible product.
+	BuyXGetY Type = "buy_x_get_y"
+)
+
+// Rule is a promotion as it is written in the rules file.
+type Rule struct {
+	ID          string `json:"id" yaml:"id"`
+	Description string `json:"description" yaml:"description"`
+	Type        Type   `json:"type" yaml:"type"`
+	// Code is the promo code that applies the rule, matched regardless of
+	// case. A rule without a code applies to every order.
+	Code string `json:"code" yaml:"code"`
+	// ProductIDs limits the rule to these products. Empty means every
+	// product; free shipping ignores it.
+	ProductIDs []string `json:"product_ids" yaml:"product_ids"`
+	// Percent is the discount of a percentage rule, such as 12.5.
+	Percent json.Number `json:"percent" yaml:"percent"`
+	// Amount is the discount of a fixed amount rule in Currency. It is
+	// converted to the currency of the order when they differ.
+	Amount   json.Number `json:"amount" yaml:"amount"`
+	Currency string      `json:"currency" yaml:"currency"`
+	// Buy and Get are the quantities of a buy X get Y rule.
+	Buy int `json:"buy" yaml:"buy"`
+	Get int `json:"get" yaml:"get"`
+	// StartsAt and EndsAt optionally limit when the rule applies.
+	StartsAt *time.Time `json:"starts_at" yaml:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at" yaml:"ends_at"`
+}
+
+// Format is the syntax of a rules file.
+type Format int
+
+const (
+	JSON Format = iota
+	YAML
+)
+
+// FormatOf returns the format of a rules file from its extension.
+func FormatOf(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return JSON, nil
+	case ".yaml", ".yml":
+		return YAML, nil
+	}
+	return 0, fmt.Errorf("promotions: %s: unknown rules file extension, want .json, .yaml or .yml", path)
+}
+
+// Set is a validated list of rules. Rules are applied in the order of the
+// file. A nil Set has no rules.
+type Set struct {
+	rules []*rule
+}
+
+// rule is a Rule with its values parsed.
+type rule struct {
+	Rule
+	code     string
+	products map[string]bool
+	// percent is Percent in billionths of a percent, so it stays exact.
+	percent int64
+	amount  *pb.Money
+}
+
+// Parse reads and validates a rules file of the form
+//
+//	promotions:
+//	  - id: spring-sale
+//	    type: percentage
+//	    percent: 10
+//
+// and reports every invalid rule.
+func Parse(data []byte, format Format) (*Set, error) {
+	var file struct {
+		Promotions []Rule `json:"promotions" yaml:"promotions"`
+	}
+	var err error
+	switch format {
+	case JSON:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&file)
+	case YAML:
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(&file)
+	}
+	// An empty file has no rules.
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("promotions: %w", err)
+	}
+
+	s := &Set{}
+	var errs []error
+	ids := make(map[string]bool)
+	for i, r := range file.Promotions {
+		compiled, err := compile(r)
+		if err == nil && ids[r.ID] {
+			err = errors.New("duplicate id")
+		}
+		ids[r.ID] = true
+		if err != nil {
+			errs = append(errs, fmt.Errorf("promotions[%d] %q: %w", i, r.ID, err))
+			continue
+		}
+		s.rules = append(s.rules, compiled)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("promotions: invalid rules: %w", err)
+	}
+	return s, nil
+}
+
+func compile(r Rule) (*rule, error) {
+	if strings.TrimSpace(r.ID) == "" {
+		return nil, errors.New("id must not be empty")
+	}
+	c := &rule{Rule: r, code: normalizeCode(r.Code)}
+	if len(r.ProductIDs) > 0 {
+		c.products = make(map[string]bool, len(r.ProductIDs))
+		for _, id := range r.ProductIDs {
+			c.products[id] = true
+		}
+	}
+	if r.StartsAt != nil && r.EndsAt != nil && !r.StartsAt.Before(*r.EndsAt) {
+		return nil, errors.New("starts_at must be before ends_at")
+	}
+
+	switch r.Type {
+	case Percentage:
+		percent, err := money.Parse(r.Percent.String(), "")
+		if err != nil || !money.IsPositive(percent) || percent.GetUnits() > 100 || (percent.GetUnits() == 100 && percent.GetNanos() > 0) {
+			return nil, fmt.Errorf("percent must be a number above 0 and at most 100, got %q", r.Percent)
+		}
+		c.percent = percent.GetUnits()*1e9 + int64(percent.GetNanos())
+	case FixedAmount:
+		if len(r.Currency) != 3 || strings.ToUpper(r.Currency) != r.Currency {
+			return nil, fmt.Errorf("currency must be an ISO 4217 currency code, got %q", r.Currency)
+		}
+		amount, err := money.Parse(r.Amount.String(), r.Currency)
+		if err != nil || !money.IsPositive(amount) {
+			return nil, fmt.Errorf("amount must be a positive decimal, got %q", r.Amount)
+		}
+		c.amount = amount
+	case FreeShipping:
+	case BuyXGetY:
+		if r.Buy < 1 || r.Get < 1 {
+			return nil, fmt.Errorf("buy and get must be at least 1, got %d and %d", r.Buy, r.Get)
+		}
+	default:
+		return nil, fmt.Errorf("unknown type %q, want %s, %s, %s or %s", r.Type, Percentage, FixedAmount, FreeShipping, BuyXGetY)
+	}
+	return c, nil
+}
+
+func (r *rule) active(now time.Time) bool {
+	return (r.StartsAt == nil || !now.Before(*r.StartsAt)) && (r.EndsAt == nil || now.Before(*r.EndsAt))
+}
+
+func (r *rule) eligible(productID string) bool {
+	return r.products == nil || r.products[productID]
+}
+
+func normalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Known reports whether code is the promo code of a rule that applies at
+// now.
+func (s *Set) Known(code string, now time.Time) bool {
+	if s == nil {
+		return false
+	}
+	code = normalizeCode(code)
+	for _, r := range s.rules {
+		if r.code != "" && r.code == code && r.active(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// DiscountsShipping reports whether the adjustments of the promotion with
+// the given ID are taken off the shipping cost rather than the items.
+func (s *Set) DiscountsShipping(promotionID string) bool {
+	if s == nil {
+		return false
+	}
+	for _, r := range s.rules {
+		if r.ID == promotionID {
+			return r.Type == FreeShipping
+		}
+	}
+	return false
+}
+
+// Len returns the number of rules.
+func (s *Set) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.rules)
+}
@@ -0,0 +1,158 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package promotions
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testYAML = `
+promotions:
+  - id: spring-sale
+    description: 10% off telescopes
+    type: percentage
+    percent: 12.5
+    product_ids: [OLJCESPC7Z]
+  - id: welcome
+    type: fixed_amount
+    code: Welcome5
+    amount: "5.00"
+    currency: USD
+    starts_at: 2026-01-01T00:00:00Z
+    ends_at: 2027-01-01T00:00:00Z
+  - id: ship-free
+    type: free_shipping
+    code: SHIPFREE
+  - id: lens-3-for-2
+    type: buy_x_get_y
+    buy: 2
+    get: 1
+`
+
+const testJSON = `{
+  "promotions": [
+    {"id": "spring-sale", "description": "10% off telescopes", "type": "percentage", "percent": 12.5, "product_ids": ["OLJCESPC7Z"]},
+    {"id": "welcome", "type": "fixed_amount", "code": "Welcome5", "amount": "5.00", "currency": "USD",
+     "starts_at": "2026-01-01T00:00:00Z", "ends_at": "2027-01-01T00:00:00Z"},
+    {"id": "ship-free", "type": "free_shipping", "code": "SHIPFREE"},
+    {"id": "lens-3-for-2", "type": "buy_x_get_y", "buy": 2, "get": 1}
+  ]
+}`
+
+func TestParse(t *testing.T) {
+	for name, tt := range map[string]struct {
+		data   string
+		format Format
+	}{
+		"YAML": {testYAML, YAML},
+		"JSON": {testJSON, JSON},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, err := Parse([]byte(tt.data), tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.Len() != 4 {
+				t.Fatalf("Len() = %d, want 4", s.Len())
+			}
+			if got := s.rules[0].percent; got != 12_500_000_000 {
+				t.Errorf("percent = %d, want 12.5%% in billionths", got)
+			}
+			if got := s.rules[1]; got.amount.GetUnits() != 5 || got.code != "WELCOME5" {
+				t.Errorf("fixed amount rule = %+v", got)
+			}
+		})
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	for _, format := range []Format{JSON, YAML} {
+		if s, err := Parse(nil, format); err != nil || s.Len() != 0 {
+			t.Errorf("Parse(empty, %d) = %v, %v, want no rules", format, s, err)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := Parse([]byte(`
+promotions:
+  - id: no-type
+  - id: too-much
+    type: percentage
+    percent: 150
+  - id: no-currency
+    type: fixed_amount
+    amount: 5
+  - id: bad-bogo
+    type: buy_x_get_y
+    buy: 1
+  - id: backwards
+    type: free_shipping
+    starts_at: 2027-01-01T00:00:00Z
+    ends_at: 2026-01-01T00:00:00Z
+  - id: bad-bogo
+    type: free_shipping
+`), YAML)
+	if err == nil {
+		t.Fatal("Parse() = nil, want an error")
+	}
+	for _, want := range []string{
+		`promotions[0] "no-type": unknown type`,
+		`promotions[1] "too-much": percent`,
+		`promotions[2] "no-currency": currency`,
+		`promotions[3] "bad-bogo": buy and get`,
+		`promotions[4] "backwards": starts_at`,
+		`promotions[5] "bad-bogo": duplicate id`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+
+	if _, err := Parse([]byte(`{"promotions": [{"id": "x", "typo": 1}]}`), JSON); err == nil {
+		t.Error("Parse() accepted an unknown field")
+	}
+}
+
+func TestKnown(t *testing.T) {
+	s, err := Parse([]byte(testYAML), YAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	during := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	after := time.Date(2027, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tt := range []struct {
+		code string
+		now  time.Time
+		want bool
+	}{
+		{"WELCOME5", during, true},
+		{" welcome5 ", during, true},
+		{"WELCOME5", after, false},
+		{"SHIPFREE", after, true},
+		{"NOPE", during, false},
+		{"", during, false},
+	} {
+		if got := s.Known(tt.code, tt.now); got != tt.want {
+			t.Errorf("Known(%q, %v) = %v, want %v", tt.code, tt.now, got, tt.want)
+		}
+	}
+	if (*Set)(nil).Known("WELCOME5", during) {
+		t.Error("a nil Set knows a code")
+	}
+}
+
+func TestDiscountsShipping(t *testing.T) {
+	s, err := Parse([]byte(testYAML), YAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[string]bool{"ship-free": true, "spring-sale": false, "unknown": false} {
+		if got := s.DiscountsShipping(id); got != want {
+			t.Errorf("DiscountsShipping(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
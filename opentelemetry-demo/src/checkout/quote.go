@@ -0,0 +1,273 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"container/list"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/money"
+)
+
+const (
+	// defaultQuoteTTL is how long PlaceOrder accepts a quote for.
+	defaultQuoteTTL = 15 * time.Minute
+	// quoteCapacity is the number of unexpired quotes kept; the oldest are
+	// dropped first.
+	quoteCapacity = 10000
+)
+
+// orderQuote is an order priced by PreviewOrder.
+type orderQuote struct {
+	id       string
+	userID   string
+	currency string
+	address  *pb.Address
+	// codes are the promo codes of the quote, as normalizePromoCodes
+	// returns them.
+	codes   []string
+	prep    orderPrep
+	total   *pb.Money
+	expires time.Time
+}
+
+// quoteStore keeps the quotes PreviewOrder hands out until they expire. It is
+// held in memory, so a quote can only be used on the replica that issued it
+// and is lost on restart; PlaceOrder reports such a quote as expired.
+type quoteStore struct {
+	ttl      time.Duration
+	capacity int
+	now      func() time.Time
+
+	mu sync.Mutex
+	// order holds the quotes oldest first. Every quote lives for the same
+	// TTL, so this is also the order in which they expire.
+	order  *list.List
+	quotes map[string]*list.Element
+}
+
+func newQuoteStore(ttl time.Duration, capacity int) *quoteStore {
+	return &quoteStore{
+		ttl:      ttl,
+		capacity: max(capacity, 1),
+		now:      time.Now,
+		order:    list.New(),
+		quotes:   make(map[string]*list.Element),
+	}
+}
+
+// add stores q under a new ID and sets its expiry.
+func (s *quoteStore) add(q *orderQuote) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	q.id = uuid.NewString()
+	q.expires = now.Add(s.ttl)
+	s.quotes[q.id] = s.order.PushBack(q)
+	for front := s.order.Front(); front != nil; front = s.order.Front() {
+		if s.order.Len() <= s.capacity && now.Before(front.Value.(*orderQuote).expires) {
+			break
+		}
+		s.remove(front)
+	}
+}
+
+// take removes the quote with the given ID and returns it, or nil if there
+// is no such quote or it has expired. Taking a quote keeps two orders from
+// being placed with it at the same time.
+func (s *quoteStore) take(id string) *orderQuote {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.quotes[id]
+	if !ok {
+		return nil
+	}
+	s.remove(el)
+	if q := el.Value.(*orderQuote); s.now().Before(q.expires) {
+		return q
+	}
+	return nil
+}
+
+// restore puts back a quote taken for an order that failed, unless it has
+// expired in the meantime.
+func (s *quoteStore) restore(q *orderQuote) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.quotes[q.id]; ok || !s.now().Before(q.expires) {
+		return
+	}
+	// Quotes are ordered by expiry, so q goes before the first newer one.
+	for el := s.order.Front(); el != nil; el = el.Next() {
+		if el.Value.(*orderQuote).expires.After(q.expires) {
+			s.quotes[q.id] = s.order.InsertBefore(q, el)
+			return
+		}
+	}
+	s.quotes[q.id] = s.order.PushBack(q)
+}
+
+// remove drops el. s.mu must be held.
+func (s *quoteStore) remove(el *list.Element) {
+	s.order.Remove(el)
+	delete(s.quotes, el.Value.(*orderQuote).id)
+}
+
+// PreviewOrder prices the user's cart the way PlaceOrder would and returns
+// the price as a quote. It only reads from the cart, catalog, currency and
+// shipping quote services: nothing is charged, shipped, sent or published.
+func (cs *checkout) PreviewOrder(ctx context.Context, req *pb.PreviewOrderRequest) (*pb.PreviewOrderResponse, error) {
+	if err := cs.validatePreviewOrderRequest(ctx, req); err != nil {
+		return nil, err
+	}
+	if cs.placeOrderTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cs.placeOrderTimeout)
+		defer cancel()
+	}
+
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.String("app.user.id", req.UserId),
+		attribute.String("app.user.currency", req.UserCurrency),
+	)
+	log.Infof("[PreviewOrder] user_id=%q user_currency=%q", req.UserId, req.UserCurrency)
+
+	prep, err := cs.prepareOrderItemsAndShippingQuoteFromCart(ctx, req.UserId, req.UserCurrency, req.Address)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+	if err := cs.applyPromotions(ctx, &prep, req.UserCurrency, req.PromoCodes); err != nil {
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+	if err := cs.applyTaxes(ctx, &prep, req.UserCurrency, req.Address); err != nil {
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+	total, err := orderTotal(req.UserCurrency, prep)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to calculate order total: %+v", err)
+	}
+
+	q := &orderQuote{
+		userID:   req.UserId,
+		currency: req.UserCurrency,
+		address:  proto.Clone(req.Address).(*pb.Address),
+		codes:    normalizePromoCodes(req.PromoCodes),
+		prep:     prep,
+		total:    total,
+	}
+	cs.quotes.add(q)
+	span.SetAttributes(attribute.String("app.order.quote.id", q.id))
+
+	return &pb.PreviewOrderResponse{Quote: &pb.OrderQuote{
+		QuoteId:      q.id,
+		Items:        prep.orderItems,
+		ShippingCost: prep.shippingCostLocalized,
+		Total:        total,
+		ExpiresAt:    timestamppb.New(q.expires),
+		Adjustments:  prep.adjustments,
+		Taxes:        prep.taxes,
+	}}, nil
+}
+
+// takeQuote claims the quote req refers to for placing the order. It fails
+// with codes.FailedPrecondition when the quote has expired or no longer
+// matches the request or the user's cart, in which case the caller should
+// preview the order again. The caller must restore the quote if the order
+// is not placed.
+func (cs *checkout) takeQuote(ctx context.Context, req *pb.PlaceOrderRequest) (*orderQuote, error) {
+	q := cs.quotes.take(req.QuoteId)
+	// A quote of another user is reported like an unknown one.
+	if q == nil || q.userID != req.UserId {
+		if q != nil {
+			cs.quotes.restore(q)
+		}
+		return nil, status.Errorf(codes.FailedPrecondition, "quote %q has expired or does not exist", req.QuoteId)
+	}
+
+	var mismatch string
+	switch {
+	case q.currency != req.UserCurrency:
+		mismatch = "the quote is in " + q.currency
+	case !proto.Equal(q.address, req.Address):
+		mismatch = "the quote is for another address"
+	case !slices.Equal(q.codes, normalizePromoCodes(req.PromoCodes)):
+		mismatch = "the quote has other promo codes"
+	default:
+		cartItems, err := cs.getUserCart(ctx, req.UserId)
+		if err != nil {
+			cs.quotes.restore(q)
+			return nil, status.Errorf(codes.Internal, "cart failure: %+v", err)
+		}
+		if !sameCartItems(q.prep.cartItems, cartItems) {
+			mismatch = "the cart has changed since the quote"
+		}
+	}
+	if mismatch != "" {
+		cs.quotes.restore(q)
+		return nil, status.Errorf(codes.FailedPrecondition, "quote %q does not match the order: %s", req.QuoteId, mismatch)
+	}
+	return q, nil
+}
+
+// sameCartItems reports whether a and b hold the same quantity of every
+// product, in any order.
+func sameCartItems(a, b []*pb.CartItem) bool {
+	quantities := make(map[string]int32)
+	for _, item := range a {
+		quantities[item.GetProductId()] += item.GetQuantity()
+	}
+	for _, item := range b {
+		quantities[item.GetProductId()] -= item.GetQuantity()
+	}
+	for _, n := range quantities {
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// orderTotal adds up the items, shipping cost, adjustments and taxes of prep
+// in currency.
+func orderTotal(currency string, prep orderPrep) (*pb.Money, error) {
+	total, err := money.Sum(&pb.Money{CurrencyCode: currency}, prep.shippingCostLocalized)
+	if err != nil {
+		return nil, err
+	}
+	for _, it := range prep.orderItems {
+		multPrice, err := money.Multiply(it.Cost, int64(it.GetItem().GetQuantity()))
+		if err != nil {
+			return nil, err
+		}
+		if total, err = money.Sum(total, multPrice); err != nil {
+			return nil, err
+		}
+	}
+	for _, adj := range prep.adjustments {
+		if total, err = money.Sum(total, adj.GetAmount()); err != nil {
+			return nil, err
+		}
+	}
+	for _, line := range prep.taxes {
+		if total, err = money.Sum(total, line.GetAmount()); err != nil {
+			return nil, err
+		}
+	}
+	return total, nil
+}
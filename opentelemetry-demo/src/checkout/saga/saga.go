@@ -0,0 +1,113 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package saga undoes the completed steps of a multi-step operation when a
+// later step fails. Each step records a compensating action, and the actions
+// run in reverse order when the saga is compensated.
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultTimeout bounds how long a single compensating action may run.
+var DefaultTimeout = 10 * time.Second
+
+// Compensation undoes the effect of a step that has already completed.
+type Compensation func(ctx context.Context) error
+
+type step struct {
+	name       string
+	compensate Compensation
+}
+
+// Saga records compensating actions for the steps of a single operation.
+// It is safe for concurrent use.
+type Saga struct {
+	name   string
+	tracer trace.Tracer
+
+	mu    sync.Mutex
+	steps []step
+	done  bool
+}
+
+// New creates a saga. Compensations are traced with the given tracer as
+// children of the span found in the context passed to Compensate.
+func New(name string, tracer trace.Tracer) *Saga {
+	return &Saga{name: name, tracer: tracer}
+}
+
+// AddCompensation records the compensating action of a step that has just
+// completed successfully.
+func (s *Saga) AddCompensation(name string, c Compensation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.steps = append(s.steps, step{name: name, compensate: c})
+}
+
+// Len returns the number of recorded compensations.
+func (s *Saga) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.steps)
+}
+
+// Compensate runs the recorded compensations in reverse order. Every action
+// runs even if an earlier one fails, and the errors are joined together.
+// Compensations are detached from the cancellation of ctx so that a request
+// that has hit its deadline is still undone. Calling Compensate more than once
+// is a no-op.
+func (s *Saga) Compensate(ctx context.Context) error {
+	s.mu.Lock()
+	if s.done {
+		s.mu.Unlock()
+		return nil
+	}
+	s.done = true
+	steps := s.steps
+	s.mu.Unlock()
+
+	parent := trace.SpanFromContext(ctx)
+	parent.AddEvent("compensating", trace.WithAttributes(
+		attribute.String("app.saga.name", s.name),
+		attribute.Int("app.saga.steps", len(steps)),
+	))
+
+	ctx = context.WithoutCancel(ctx)
+	var errs []error
+	for i := len(steps) - 1; i >= 0; i-- {
+		if err := s.run(ctx, steps[i]); err != nil {
+			errs = append(errs, fmt.Errorf("compensate %s: %w", steps[i].name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Saga) run(ctx context.Context, st step) error {
+	ctx, span := s.tracer.Start(ctx, "compensate "+st.name,
+		trace.WithAttributes(
+			attribute.String("app.saga.name", s.name),
+			attribute.String("app.saga.step", st.name),
+		),
+	)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+	defer cancel()
+
+	if err := st.compensate(ctx); err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		return err
+	}
+	return nil
+}
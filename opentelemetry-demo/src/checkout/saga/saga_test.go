@@ -0,0 +1,113 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package saga
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestSaga() (*Saga, *tracetest.SpanRecorder) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	return New("test", tp.Tracer("saga")), sr
+}
+
+func TestCompensateRunsInReverseOrder(t *testing.T) {
+	s, _ := newTestSaga()
+	var got []string
+	for _, name := range []string{"charge", "ship", "cart"} {
+		name := name
+		s.AddCompensation(name, func(context.Context) error {
+			got = append(got, name)
+			return nil
+		})
+	}
+
+	if err := s.Compensate(context.Background()); err != nil {
+		t.Fatalf("Compensate() error = %v", err)
+	}
+	if want := []string{"cart", "ship", "charge"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("compensation order = %v, want %v", got, want)
+	}
+}
+
+func TestCompensateContinuesAfterFailure(t *testing.T) {
+	s, _ := newTestSaga()
+	errRefund := errors.New("refund failed")
+	var ran []string
+	s.AddCompensation("charge", func(context.Context) error {
+		ran = append(ran, "charge")
+		return nil
+	})
+	s.AddCompensation("ship", func(context.Context) error {
+		ran = append(ran, "ship")
+		return errRefund
+	})
+
+	err := s.Compensate(context.Background())
+	if !errors.Is(err, errRefund) {
+		t.Fatalf("Compensate() error = %v, want %v", err, errRefund)
+	}
+	if want := []string{"ship", "charge"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("compensations run = %v, want %v", ran, want)
+	}
+}
+
+func TestCompensateIgnoresCancelledContext(t *testing.T) {
+	s, _ := newTestSaga()
+	s.AddCompensation("charge", func(ctx context.Context) error {
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Compensate(ctx); err != nil {
+		t.Errorf("Compensate() error = %v, want nil", err)
+	}
+}
+
+func TestCompensateOnlyOnce(t *testing.T) {
+	s, _ := newTestSaga()
+	calls := 0
+	s.AddCompensation("charge", func(context.Context) error {
+		calls++
+		return nil
+	})
+
+	_ = s.Compensate(context.Background())
+	_ = s.Compensate(context.Background())
+	if calls != 1 {
+		t.Errorf("compensation ran %d times, want 1", calls)
+	}
+}
+
+func TestCompensateTracesChildSpans(t *testing.T) {
+	s, sr := newTestSaga()
+	s.AddCompensation("charge", func(context.Context) error { return nil })
+	s.AddCompensation("ship", func(context.Context) error { return errors.New("boom") })
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "PlaceOrder")
+	_ = s.Compensate(ctx)
+	parent.End()
+
+	var names []string
+	for _, span := range sr.Ended() {
+		if span.Name() == "PlaceOrder" {
+			continue
+		}
+		names = append(names, span.Name())
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("span %q parent = %v, want %v", span.Name(), span.Parent().SpanID(), parent.SpanContext().SpanID())
+		}
+	}
+	if want := []string{"compensate ship", "compensate charge"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("compensation spans = %v, want %v", names, want)
+	}
+}
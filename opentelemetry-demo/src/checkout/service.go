@@ -0,0 +1,232 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/cloudevents"
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/health"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/emailqueue"
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/idempotency"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/kafka"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/promotions"
+)
+
+// defaultPrepConcurrency is the default limit of calls made at once to
+// prepare the items of an order.
+const defaultPrepConcurrency = 8
+
+type checkout struct {
+	productCatalogSvcAddr string
+	cartSvcAddr           string
+	currencySvcAddr       string
+	shippingSvcAddr       string
+	emailSvcAddr          string
+	paymentSvcAddr        string
+	kafkaBrokerSvcAddr    string
+	kafkaTopic            string
+	kafkaCancelledTopic   string
+	// events wraps the order events published to Kafka in CloudEvents.
+	events cloudevents.Encoder
+	pb.UnimplementedCheckoutServiceServer
+	KafkaProducerClient     *kafka.Producer
+	shippingSvcClient       pb.ShippingServiceClient
+	productCatalogSvcClient pb.ProductCatalogServiceClient
+	cartSvcClient           pb.CartServiceClient
+	currencySvcClient       pb.CurrencyServiceClient
+	currencies              *currencyCache
+	converter               *currencyConverter
+	emailSvcClient          pb.EmailServiceClient
+	paymentSvcClient        pb.PaymentServiceClient
+	idempotencyStore        idempotency.Store
+	orders                  orderRepository
+	useOutbox               bool
+	idempotencyWait         time.Duration
+	// cancelLockTimeout is how long a cancellation holds its claim on an
+	// order before another call can take it over.
+	cancelLockTimeout time.Duration
+	// placeOrderTimeout bounds PlaceOrder, and with it every call it makes.
+	placeOrderTimeout time.Duration
+	// quotes holds the quotes handed out by PreviewOrder.
+	quotes *quoteStore
+	// promotions holds the discount rules; nil when none are configured.
+	promotions *promotions.Engine
+	// taxes computes the taxes of orders; nil when none are charged.
+	taxes TaxCalculator
+	// inventorySvcClient reserves the stock of orders; nil when stock is
+	// not checked.
+	inventorySvcClient pb.InventoryServiceClient
+	// reservationTTL is how long the stock of an order is held for it to be
+	// charged.
+	reservationTTL time.Duration
+	// prepConcurrency limits the product lookups and conversions made at
+	// once for the items of an order.
+	prepConcurrency int
+	// emailQueue holds the confirmations that failed to send until the
+	// email worker retries them; nil when failed confirmations are dropped.
+	emailQueue emailqueue.Store
+
+	// health probes the services checkout calls and serves the result.
+	// Readiness is also reported as pb.CheckoutService_ServiceDesc.ServiceName.
+	health *health.Registry
+}
+
+// serviceAddrs are the addresses of the services checkout calls. Email is
+// the base URL of the email service's HTTP API. EmailGRPC, when set, is the
+// address of its gRPC API, which is then used instead. Inventory is
+// optional: without it, orders are placed without reserving stock.
+type serviceAddrs struct {
+	ProductCatalog string
+	Cart           string
+	Currency       string
+	Shipping       string
+	Email          string
+	EmailGRPC      string
+	Payment        string
+	Inventory      string
+}
+
+func serviceAddrsFromEnv() serviceAddrs {
+	var addrs serviceAddrs
+	mustMapEnv(&addrs.Shipping, "SHIPPING_ADDR")
+	mustMapEnv(&addrs.ProductCatalog, "PRODUCT_CATALOG_ADDR")
+	mustMapEnv(&addrs.Cart, "CART_ADDR")
+	mustMapEnv(&addrs.Currency, "CURRENCY_ADDR")
+	mustMapEnv(&addrs.Email, "EMAIL_ADDR")
+	addrs.EmailGRPC = os.Getenv("EMAIL_GRPC_ADDR")
+	mustMapEnv(&addrs.Payment, "PAYMENT_ADDR")
+	addrs.Inventory = os.Getenv("INVENTORY_ADDR")
+	return addrs
+}
+
+// newCheckout creates the service with clients for the services at addrs,
+// each set up with its timeout, retry policy and circuit breaker from
+// clients. opts are added to the options every client is created with,
+// which lets tests connect to in-process servers. The returned function
+// closes the clients. Every gRPC client except email's is registered as a
+// health check: failed confirmations do not fail orders.
+func newCheckout(addrs serviceAddrs, clients clientConfigs, opts ...grpc.DialOption) (*checkout, func(), error) {
+	svc := &checkout{
+		productCatalogSvcAddr: addrs.ProductCatalog,
+		cartSvcAddr:           addrs.Cart,
+		currencySvcAddr:       addrs.Currency,
+		shippingSvcAddr:       addrs.Shipping,
+		emailSvcAddr:          addrs.Email,
+		paymentSvcAddr:        addrs.Payment,
+		prepConcurrency:       defaultPrepConcurrency,
+		events:                cloudevents.Encoder{Source: eventSource, Encoding: cloudevents.Protobuf},
+		quotes:                newQuoteStore(defaultQuoteTTL, quoteCapacity),
+		reservationTTL:        defaultReservationTTL,
+		cancelLockTimeout:     defaultCancelLockTimeout,
+		health:                health.NewRegistry(pb.CheckoutService_ServiceDesc.ServiceName),
+	}
+	svc.health.Logf = log.Warnf
+
+	var conns []*grpc.ClientConn
+	closeAll := func() {
+		for _, c := range conns {
+			c.Close()
+		}
+	}
+	connect := func(addr string, cfg *clientConfig, service string) (*grpc.ClientConn, error) {
+		connOpts := opts
+		if cfg != nil {
+			clientOpts, err := cfg.dialOptions(service)
+			if err != nil {
+				closeAll()
+				return nil, err
+			}
+			connOpts = append(clientOpts, opts...)
+		}
+		c, err := createClient(addr, connOpts...)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		conns = append(conns, c)
+		return c, nil
+	}
+
+	c, err := connect(addrs.Shipping, &clients.Shipping, pb.ShippingService_ServiceDesc.ServiceName)
+	if err != nil {
+		return nil, nil, err
+	}
+	svc.shippingSvcClient = pb.NewShippingServiceClient(c)
+	svc.health.Register("shipping", health.ConnProbe(c))
+
+	if c, err = connect(addrs.ProductCatalog, &clients.ProductCatalog, pb.ProductCatalogService_ServiceDesc.ServiceName); err != nil {
+		return nil, nil, err
+	}
+	svc.productCatalogSvcClient = pb.NewProductCatalogServiceClient(c)
+	svc.health.Register("product-catalog", health.ConnProbe(c))
+
+	if c, err = connect(addrs.Cart, &clients.Cart, pb.CartService_ServiceDesc.ServiceName); err != nil {
+		return nil, nil, err
+	}
+	svc.cartSvcClient = pb.NewCartServiceClient(c)
+	svc.health.Register("cart", health.ConnProbe(c))
+
+	if c, err = connect(addrs.Currency, &clients.Currency, pb.CurrencyService_ServiceDesc.ServiceName); err != nil {
+		return nil, nil, err
+	}
+	svc.currencySvcClient = pb.NewCurrencyServiceClient(c)
+	svc.currencies = newCurrencyCache(svc.currencySvcClient, defaultCurrenciesTTL)
+	svc.converter = &currencyConverter{
+		client: svc.currencySvcClient,
+		mode:   conversionRemote,
+		cache:  newRateCache(defaultRatesTTL),
+	}
+	// Orders do not need the currency service when there are local rates to
+	// fall back on.
+	currencyProbe := health.ConnProbe(c)
+	svc.health.Register("currency", func(ctx context.Context) error {
+		if svc.converter.mode != conversionRemote && svc.converter.local != nil {
+			return nil
+		}
+		return currencyProbe(ctx)
+	})
+
+	if addrs.EmailGRPC != "" {
+		if c, err = connect(addrs.EmailGRPC, nil, pb.EmailService_ServiceDesc.ServiceName); err != nil {
+			return nil, nil, err
+		}
+		svc.emailSvcClient = pb.NewEmailServiceClient(c)
+	}
+
+	if c, err = connect(addrs.Payment, &clients.Payment, pb.PaymentService_ServiceDesc.ServiceName); err != nil {
+		return nil, nil, err
+	}
+	svc.paymentSvcClient = pb.NewPaymentServiceClient(c)
+	svc.health.Register("payment", health.ConnProbe(c))
+
+	if addrs.Inventory != "" {
+		if c, err = connect(addrs.Inventory, &clients.Inventory, pb.InventoryService_ServiceDesc.ServiceName); err != nil {
+			return nil, nil, err
+		}
+		svc.inventorySvcClient = pb.NewInventoryServiceClient(c)
+		svc.health.Register("inventory", health.ConnProbe(c))
+	}
+
+	return svc, closeAll, nil
+}
+
+func createClient(svcAddr string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	opts = append([]grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+	}, opts...)
+	c, err := grpc.NewClient(svcAddr, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to %s service, err: %+v", svcAddr, err)
+	}
+	return c, nil
+}
@@ -0,0 +1,49 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// serve runs srv on lis until it fails or ctx is done, and then drains it:
+// health checks report NOT_SERVING for drainDelay so clients and load
+// balancers stop sending new calls, and the calls in flight get up to
+// stopTimeout to finish before they are cancelled. release is called once
+// draining starts, so a second signal stops the process right away.
+func serve(ctx context.Context, release func(), srv *grpc.Server, lis net.Listener, svc *checkout, drainDelay, stopTimeout time.Duration) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(lis)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	release()
+
+	log.Infof("shutting down, draining for %v", drainDelay)
+	svc.health.Drain()
+	time.Sleep(drainDelay)
+
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		log.Infof("all in-flight calls finished")
+	case <-time.After(stopTimeout):
+		log.Warnf("in-flight calls did not finish within %v, cancelling them", stopTimeout)
+		srv.Stop()
+		<-stopped
+	}
+	return <-serveErr
+}
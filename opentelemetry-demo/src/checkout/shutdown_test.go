@@ -0,0 +1,111 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+)
+
+// startServing serves svc through serve and returns a client for it, a
+// function that starts the shutdown, and the channel serve's result is sent
+// to.
+func startServing(t *testing.T, svc *checkout, drainDelay, stopTimeout time.Duration) (pb.CheckoutServiceClient, context.CancelFunc, <-chan error) {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	pb.RegisterCheckoutServiceServer(srv, svc)
+	healthpb.RegisterHealthServer(srv, svc.health)
+
+	ctx, shutdown := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, func() {}, srv, lis, svc, drainDelay, stopTimeout)
+	}()
+
+	conn, err := grpc.NewClient("passthrough:///checkout",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewCheckoutServiceClient(conn), shutdown, done
+}
+
+func TestServeDrainsInFlightCalls(t *testing.T) {
+	f := newFakes()
+	f.cart.items[testUserID] = testCart()
+	f.payment.charging = make(chan struct{})
+	f.payment.release = make(chan struct{})
+	svc := startFakes(t, f)
+
+	client, shutdown, done := startServing(t, svc, 50*time.Millisecond, 5*time.Second)
+
+	placed := make(chan error, 1)
+	go func() {
+		_, err := client.PlaceOrder(context.Background(), testOrderRequest())
+		placed <- err
+	}()
+	<-f.payment.charging
+
+	shutdown()
+	// Give serve time to start draining before checking health.
+	time.Sleep(10 * time.Millisecond)
+	resp, err := svc.health.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil || resp.GetStatus() != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("Check() = %v, %v, want NOT_SERVING while draining", resp.GetStatus(), err)
+	}
+
+	close(f.payment.release)
+	if err := <-placed; err != nil {
+		t.Errorf("in-flight PlaceOrder failed: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("serve() error = %v", err)
+	}
+}
+
+func TestServeCancelsCallsAfterTimeout(t *testing.T) {
+	f := newFakes()
+	f.cart.items[testUserID] = testCart()
+	f.payment.charging = make(chan struct{})
+	f.payment.release = make(chan struct{})
+	svc := startFakes(t, f)
+
+	client, shutdown, done := startServing(t, svc, 0, 50*time.Millisecond)
+
+	placed := make(chan error, 1)
+	go func() {
+		_, err := client.PlaceOrder(context.Background(), testOrderRequest())
+		placed <- err
+	}()
+	<-f.payment.charging
+
+	shutdown()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("serve() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve() did not return after the stop timeout")
+	}
+	if err := <-placed; status.Code(err) == codes.OK {
+		t.Error("expected the stuck PlaceOrder to be cancelled")
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package tax
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/money"
+)
+
+// Item is an order line as the tax table sees it.
+type Item struct {
+	ProductID string
+	// Categories are the categories of the product, which exempt it from
+	// the rates that list one of them.
+	Categories []string
+	Quantity   int32
+	// Price is the price of a single item in the currency of the order.
+	Price *pb.Money
+}
+
+// Order is what the taxes are computed for.
+type Order struct {
+	Currency string
+	Address  *pb.Address
+	Items    []Item
+	Shipping *pb.Money
+	// ItemDiscount is what promotions took off the items, as a positive
+	// amount. It lowers the taxable price of every item in the same
+	// proportion.
+	ItemDiscount *pb.Money
+	// ShippingDiscount is what promotions took off the shipping cost, as a
+	// positive amount. It only lowers the taxable amount of rates that
+	// tax shipping.
+	ShippingDiscount *pb.Money
+}
+
+// Calculate returns a tax line for every rate that applies to the address
+// of order, in the order of the table. Rates with nothing to tax, because
+// every item is exempt, are left out. Taxable amounts are rounded half to
+// even and taxes half up, both to the minor unit of the currency.
+func (t *Table) Calculate(_ context.Context, order Order) ([]*pb.TaxLine, error) {
+	if t.Len() == 0 {
+		return nil, nil
+	}
+
+	zero := &pb.Money{CurrencyCode: order.Currency}
+	lines := make([]*pb.Money, len(order.Items))
+	gross := zero
+	for i, it := range order.Items {
+		line, err := money.Multiply(it.Price, int64(it.Quantity))
+		if err != nil {
+			return nil, fmt.Errorf("product %q: %w", it.ProductID, err)
+		}
+		lines[i] = line
+		if gross, err = money.Sum(gross, line); err != nil {
+			return nil, err
+		}
+	}
+	// share is the part of every item price left after the item discount.
+	share, err := discountShare(gross, order.ItemDiscount)
+	if err != nil {
+		return nil, err
+	}
+	shipping, err := discountedShipping(zero, order.Shipping, order.ShippingDiscount)
+	if err != nil {
+		return nil, err
+	}
+
+	var taxes []*pb.TaxLine
+	for _, r := range t.rates {
+		if !r.matches(order.Address) {
+			continue
+		}
+		taxable := zero
+		for i, it := range order.Items {
+			if r.exempts(it.Categories) {
+				continue
+			}
+			if taxable, err = money.Sum(taxable, lines[i]); err != nil {
+				return nil, err
+			}
+		}
+		if share != nil {
+			if taxable, err = money.Convert(taxable, share, order.Currency, money.RoundHalfEven); err != nil {
+				return nil, err
+			}
+		}
+		if r.Shipping {
+			if taxable, err = money.Sum(taxable, shipping); err != nil {
+				return nil, err
+			}
+		}
+		if taxable, err = money.Scale(taxable, 1, 1, money.RoundHalfEven); err != nil {
+			return nil, err
+		}
+		if !money.IsPositive(taxable) {
+			continue
+		}
+
+		amount, err := money.Scale(taxable, r.percent, 100*1e9, money.RoundHalfUp)
+		if err != nil {
+			return nil, fmt.Errorf("tax %q: %w", r.ID, err)
+		}
+		taxes = append(taxes, &pb.TaxLine{
+			TaxId:         r.ID,
+			Description:   r.Description,
+			Rate:          formatPercent(r.percent),
+			TaxableAmount: taxable,
+			Amount:        amount,
+		})
+	}
+	return taxes, nil
+}
+
+// discountShare returns the part of gross left once discount is taken off,
+// or nil when there is no discount.
+func discountShare(gross, discount *pb.Money) (*big.Rat, error) {
+	if discount == nil || !money.IsPositive(discount) || !money.IsPositive(gross) {
+		return nil, nil
+	}
+	net, err := money.Sum(gross, money.Negate(discount))
+	if err != nil {
+		return nil, err
+	}
+	if !money.IsPositive(net) {
+		return new(big.Rat), nil
+	}
+	return money.Ratio(net, gross)
+}
+
+// discountedShipping returns the shipping cost left once discount is taken
+// off, and zero when there is no shipping cost.
+func discountedShipping(zero, shipping, discount *pb.Money) (*pb.Money, error) {
+	if shipping == nil {
+		return zero, nil
+	}
+	if discount == nil || !money.IsPositive(discount) {
+		return shipping, nil
+	}
+	discount, err := money.Min(discount, shipping)
+	if err != nil {
+		return nil, err
+	}
+	return money.Sum(shipping, money.Negate(discount))
+}
+
+func (r *rate) matches(address *pb.Address) bool {
+	if !strings.EqualFold(strings.TrimSpace(address.GetCountry()), strings.TrimSpace(r.Country)) {
+		return false
+	}
+	if r.State != "" && !strings.EqualFold(strings.TrimSpace(address.GetState()), strings.TrimSpace(r.State)) {
+		return false
+	}
+	if len(r.ZipPrefixes) == 0 {
+		return true
+	}
+	zip := strings.ToUpper(strings.TrimSpace(address.GetZipCode()))
+	for _, prefix := range r.ZipPrefixes {
+		if strings.HasPrefix(zip, strings.ToUpper(strings.TrimSpace(prefix))) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rate) exempts(categories []string) bool {
+	for _, category := range categories {
+		if r.exempt[strings.ToLower(category)] {
+			return true
+		}
+	}
+	return false
+}
+
+// formatPercent formats a percentage in billionths of a percent without
+// trailing zeros, such as "7.25".
+func formatPercent(billionths int64) string {
+	s := strconv.FormatInt(billionths/1e9, 10)
+	if frac := billionths % 1e9; frac != 0 {
+		s += "." + strings.TrimRight(fmt.Sprintf("%09d", frac), "0")
+	}
+	return s
+}
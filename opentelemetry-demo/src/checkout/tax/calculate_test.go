@@ -0,0 +1,189 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package tax
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+)
+
+func usd(units int64, nanos int32) *pb.Money {
+	return &pb.Money{CurrencyCode: "USD", Units: units, Nanos: nanos}
+}
+
+func testOrder(country, state, zip string) Order {
+	return Order{
+		Currency: "USD",
+		Address:  &pb.Address{Country: country, State: state, ZipCode: zip},
+		Items: []Item{
+			{ProductID: "OLJCESPC7Z", Categories: []string{"telescopes"}, Quantity: 2, Price: usd(100, 500000000)},
+			{ProductID: "BOOK", Categories: []string{"accessories", "books"}, Quantity: 1, Price: usd(20, 0)},
+		},
+		Shipping: usd(8, 990000000),
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	table, err := Parse([]byte(testYAML), YAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	discounted := Order{
+		Currency: "USD",
+		Address:  &pb.Address{Country: "United States", State: "CA", ZipCode: "90001"},
+		Items: []Item{
+			{ProductID: "OLJCESPC7Z", Quantity: 1, Price: usd(100, 0)},
+			{ProductID: "BOOK", Categories: []string{"books"}, Quantity: 1, Price: usd(100, 0)},
+		},
+		ItemDiscount: usd(50, 0),
+	}
+	// Free shipping on 100.00 of items and 10.00 of shipping.
+	freeShipping := Order{
+		Currency:         "USD",
+		Address:          &pb.Address{Country: "United States", State: "CA", ZipCode: "90001"},
+		Items:            []Item{{ProductID: "OLJCESPC7Z", Quantity: 1, Price: usd(100, 0)}},
+		Shipping:         usd(10, 0),
+		ShippingDiscount: usd(10, 0),
+	}
+	freeShippingDE := freeShipping
+	freeShippingDE.Address = &pb.Address{Country: "Germany", ZipCode: "10115"}
+	// 20.00 off the same items, shipped to Germany.
+	itemDiscountDE := freeShippingDE
+	itemDiscountDE.ShippingDiscount = nil
+	itemDiscountDE.ItemDiscount = usd(20, 0)
+	onlyBooks := testOrder("United States", "CA", "90001")
+	onlyBooks.Items = onlyBooks.Items[1:]
+
+	tests := []struct {
+		name  string
+		order Order
+		want  []*pb.TaxLine
+	}{
+		{
+			// 7.25% of 201.00, the book being exempt, is 14.5725.
+			name:  "State",
+			order: testOrder("United States", "CA", "90001"),
+			want: []*pb.TaxLine{
+				{TaxId: "us-ca", Description: "California sales tax", Rate: "7.25", TaxableAmount: usd(201, 0), Amount: usd(14, 570000000)},
+			},
+		},
+		{
+			// The district tax also applies to the book: 1.375% of 221.00
+			// is 3.03875.
+			name:  "StateAndDistrict",
+			order: testOrder("United States", "CA", "94107"),
+			want: []*pb.TaxLine{
+				{TaxId: "us-ca", Description: "California sales tax", Rate: "7.25", TaxableAmount: usd(201, 0), Amount: usd(14, 570000000)},
+				{TaxId: "us-ca-sf", Description: "San Francisco district tax", Rate: "1.375", TaxableAmount: usd(221, 0), Amount: usd(3, 40000000)},
+			},
+		},
+		{
+			name:  "MatchedRegardlessOfCase",
+			order: testOrder(" united states", "ca", "94107-1234"),
+			want: []*pb.TaxLine{
+				{TaxId: "us-ca", Description: "California sales tax", Rate: "7.25", TaxableAmount: usd(201, 0), Amount: usd(14, 570000000)},
+				{TaxId: "us-ca-sf", Description: "San Francisco district tax", Rate: "1.375", TaxableAmount: usd(221, 0), Amount: usd(3, 40000000)},
+			},
+		},
+		{
+			// 19% of 229.99, shipping included, is 43.6981.
+			name:  "Shipping",
+			order: testOrder("Germany", "", "10115"),
+			want: []*pb.TaxLine{
+				{TaxId: "de", Description: "Umsatzsteuer", Rate: "19", TaxableAmount: usd(229, 990000000), Amount: usd(43, 700000000)},
+			},
+		},
+		{
+			// A quarter of the items is discounted, so a quarter of the
+			// taxable items is too: 7.25% of 75.00 is 5.4375.
+			name:  "Discount",
+			order: discounted,
+			want: []*pb.TaxLine{
+				{TaxId: "us-ca", Description: "California sales tax", Rate: "7.25", TaxableAmount: usd(75, 0), Amount: usd(5, 440000000)},
+			},
+		},
+		{
+			// Free shipping leaves the items of a rate without shipping
+			// untouched: 7.25% of 100.00.
+			name:  "FreeShipping",
+			order: freeShipping,
+			want: []*pb.TaxLine{
+				{TaxId: "us-ca", Description: "California sales tax", Rate: "7.25", TaxableAmount: usd(100, 0), Amount: usd(7, 250000000)},
+			},
+		},
+		{
+			// A rate on shipping taxes none of the free shipping: 19% of
+			// 100.00.
+			name:  "FreeShippingTaxed",
+			order: freeShippingDE,
+			want: []*pb.TaxLine{
+				{TaxId: "de", Description: "Umsatzsteuer", Rate: "19", TaxableAmount: usd(100, 0), Amount: usd(19, 0)},
+			},
+		},
+		{
+			// An item discount leaves shipping untouched: 19% of 80.00 and
+			// 10.00.
+			name:  "ItemDiscountWithShipping",
+			order: itemDiscountDE,
+			want: []*pb.TaxLine{
+				{TaxId: "de", Description: "Umsatzsteuer", Rate: "19", TaxableAmount: usd(90, 0), Amount: usd(17, 100000000)},
+			},
+		},
+		{
+			name:  "Exempt",
+			order: onlyBooks,
+		},
+		{
+			name:  "OtherState",
+			order: testOrder("United States", "NY", "10001"),
+		},
+		{
+			name:  "OtherCountry",
+			order: testOrder("France", "", "75001"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := table.Calculate(context.Background(), tt.order)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Calculate() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !proto.Equal(got[i], tt.want[i]) {
+					t.Errorf("tax %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCalculateWithoutRates(t *testing.T) {
+	var table *Table
+	got, err := table.Calculate(context.Background(), testOrder("Germany", "", "10115"))
+	if err != nil || got != nil {
+		t.Errorf("Calculate() = %v, %v, want no taxes", got, err)
+	}
+}
+
+func TestFormatPercent(t *testing.T) {
+	for billionths, want := range map[int64]string{
+		0:               "0",
+		19_000_000_000:  "19",
+		7_250_000_000:   "7.25",
+		1_375_000_000:   "1.375",
+		100_000_000_000: "100",
+		1:               "0.000000001",
+	} {
+		if got := formatPercent(billionths); got != want {
+			t.Errorf("formatPercent(%d) = %q, want %q", billionths, got, want)
+		}
+	}
+}
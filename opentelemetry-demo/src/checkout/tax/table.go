@@ -0,0 +1,180 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package tax computes the taxes of an order from a table of rates keyed on
+// the shipping address.
+package tax
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/money"
+)
+
+// Rate is a tax as it is written in the tax table.
+type Rate struct {
+	ID          string `json:"id" yaml:"id"`
+	Description string `json:"description" yaml:"description"`
+	// Country is matched against Address.Country regardless of case, so it
+	// is written the way the addresses of orders write it.
+	Country string `json:"country" yaml:"country"`
+	// State optionally limits the rate to a state, matched against
+	// Address.State regardless of case.
+	State string `json:"state" yaml:"state"`
+	// ZipPrefixes optionally limits the rate to zip codes starting with one
+	// of the prefixes.
+	ZipPrefixes []string `json:"zip_prefixes" yaml:"zip_prefixes"`
+	// Percent is the rate, such as 7.25.
+	Percent json.Number `json:"percent" yaml:"percent"`
+	// Shipping makes the shipping cost taxable too.
+	Shipping bool `json:"shipping" yaml:"shipping"`
+	// ExemptCategories are the product categories the rate does not apply
+	// to, matched regardless of case.
+	ExemptCategories []string `json:"exempt_categories" yaml:"exempt_categories"`
+}
+
+// Format is the syntax of a tax table file.
+type Format int
+
+const (
+	JSON Format = iota
+	YAML
+)
+
+// FormatOf returns the format of a tax table file from its extension.
+func FormatOf(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return JSON, nil
+	case ".yaml", ".yml":
+		return YAML, nil
+	}
+	return 0, fmt.Errorf("tax: %s: unknown tax table extension, want .json, .yaml or .yml", path)
+}
+
+// Table is a validated list of rates. Every rate that matches the address of
+// an order applies to it, in the order of the file, so a state rate and a
+// county rate both apply to an address in the county. A nil Table has no
+// rates. It is safe for concurrent use.
+type Table struct {
+	rates []*rate
+}
+
+// rate is a Rate with its values parsed.
+type rate struct {
+	Rate
+	// percent is Percent in billionths of a percent, so it stays exact.
+	percent int64
+	exempt  map[string]bool
+}
+
+// Load reads a tax table file in the format given by its extension.
+func Load(path string) (*Table, error) {
+	format, err := FormatOf(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("tax: %w", err)
+	}
+	t, err := Parse(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("tax: %s: %w", path, err)
+	}
+	return t, nil
+}
+
+// Parse reads and validates a tax table of the form
+//
+//	rates:
+//	  - id: us-ca
+//	    country: United States
+//	    state: CA
+//	    percent: 7.25
+//	    exempt_categories: [food]
+//
+// and reports every invalid rate.
+func Parse(data []byte, format Format) (*Table, error) {
+	var file struct {
+		Rates []Rate `json:"rates" yaml:"rates"`
+	}
+	var err error
+	switch format {
+	case JSON:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&file)
+	case YAML:
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(&file)
+	}
+	// An empty file has no rates.
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	t := &Table{}
+	var errs []error
+	ids := make(map[string]bool)
+	for i, r := range file.Rates {
+		compiled, err := compile(r)
+		if err == nil && ids[r.ID] {
+			err = errors.New("duplicate id")
+		}
+		ids[r.ID] = true
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rates[%d] %q: %w", i, r.ID, err))
+			continue
+		}
+		t.rates = append(t.rates, compiled)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("invalid rates: %w", err)
+	}
+	return t, nil
+}
+
+func compile(r Rate) (*rate, error) {
+	if strings.TrimSpace(r.ID) == "" {
+		return nil, errors.New("id must not be empty")
+	}
+	if strings.TrimSpace(r.Country) == "" {
+		return nil, errors.New("country must not be empty")
+	}
+	percent, err := money.Parse(r.Percent.String(), "")
+	if err != nil || money.IsNegative(percent) || percent.GetUnits() > 100 || (percent.GetUnits() == 100 && percent.GetNanos() > 0) {
+		return nil, fmt.Errorf("percent must be a number from 0 to 100, got %q", r.Percent)
+	}
+	c := &rate{Rate: r, percent: percent.GetUnits()*1e9 + int64(percent.GetNanos())}
+	for _, prefix := range r.ZipPrefixes {
+		if strings.TrimSpace(prefix) == "" {
+			return nil, errors.New("zip_prefixes must not be empty")
+		}
+	}
+	if len(r.ExemptCategories) > 0 {
+		c.exempt = make(map[string]bool, len(r.ExemptCategories))
+		for _, category := range r.ExemptCategories {
+			c.exempt[strings.ToLower(category)] = true
+		}
+	}
+	return c, nil
+}
+
+// Len returns the number of rates.
+func (t *Table) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.rates)
+}
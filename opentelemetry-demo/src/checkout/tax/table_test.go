@@ -0,0 +1,149 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package tax
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testYAML = `
+rates:
+  - id: us-ca
+    description: California sales tax
+    country: United States
+    state: CA
+    percent: 7.25
+    exempt_categories: [Books]
+  - id: us-ca-sf
+    description: San Francisco district tax
+    country: United States
+    state: CA
+    zip_prefixes: ["941"]
+    percent: 1.375
+  - id: de
+    description: Umsatzsteuer
+    country: Germany
+    percent: 19
+    shipping: true
+`
+
+const testJSON = `{
+  "rates": [
+    {"id": "us-ca", "description": "California sales tax", "country": "United States", "state": "CA", "percent": 7.25, "exempt_categories": ["Books"]},
+    {"id": "us-ca-sf", "description": "San Francisco district tax", "country": "United States", "state": "CA", "zip_prefixes": ["941"], "percent": 1.375},
+    {"id": "de", "description": "Umsatzsteuer", "country": "Germany", "percent": 19, "shipping": true}
+  ]
+}`
+
+func TestParse(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		data   string
+		format Format
+	}{
+		{"YAML", testYAML, YAML},
+		{"JSON", testJSON, JSON},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			table, err := Parse([]byte(tt.data), tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if table.Len() != 3 {
+				t.Fatalf("Len() = %d, want 3", table.Len())
+			}
+			ca := table.rates[0]
+			if ca.percent != 7_250_000_000 || !ca.exempt["books"] {
+				t.Errorf("us-ca = %+v, want 7.25%% with books exempt", ca)
+			}
+			if sf := table.rates[1]; sf.percent != 1_375_000_000 {
+				t.Errorf("us-ca-sf percent = %d, want 1.375%%", sf.percent)
+			}
+		})
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	table, err := Parse(nil, YAML)
+	if err != nil || table.Len() != 0 {
+		t.Errorf("Parse(empty) = %d rates, %v, want no rates", table.Len(), err)
+	}
+}
+
+func TestParseReportsEveryInvalidRate(t *testing.T) {
+	data := `
+rates:
+  - id: ""
+    country: Germany
+    percent: 19
+  - id: no-country
+    percent: 5
+  - id: negative
+    country: France
+    percent: -1
+  - id: too-high
+    country: France
+    percent: 100.5
+  - id: empty-zip
+    country: United States
+    zip_prefixes: [""]
+    percent: 5
+  - id: de
+    country: Germany
+    percent: 19
+  - id: de
+    country: Germany
+    percent: 7
+`
+	_, err := Parse([]byte(data), YAML)
+	if err == nil {
+		t.Fatal("Parse() succeeded, want an error")
+	}
+	for _, want := range []string{
+		`rates[0] "": id must not be empty`,
+		`rates[1] "no-country": country must not be empty`,
+		`rates[2] "negative": percent must be`,
+		`rates[3] "too-high": percent must be`,
+		`rates[4] "empty-zip": zip_prefixes must not be empty`,
+		`rates[6] "de": duplicate id`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+}
+
+func TestParseRejectsUnknownFields(t *testing.T) {
+	if _, err := Parse([]byte("rates:\n  - id: de\n    country: Germany\n    rate: 19\n"), YAML); err == nil {
+		t.Error("Parse() accepted an unknown field in YAML")
+	}
+	if _, err := Parse([]byte(`{"rates": [{"id": "de", "country": "Germany", "rate": 19}]}`), JSON); err == nil {
+		t.Error("Parse() accepted an unknown field in JSON")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "taxes.yml")
+	if err := os.WriteFile(path, []byte(testYAML), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	table, err := Load(path)
+	if err != nil || table.Len() != 3 {
+		t.Fatalf("Load() = %d rates, %v, want 3", table.Len(), err)
+	}
+
+	if _, err := Load(filepath.Join(dir, "taxes.csv")); err == nil || !strings.Contains(err.Error(), "unknown tax table extension") {
+		t.Errorf("Load(taxes.csv) error = %v, want an unknown extension", err)
+	}
+	bad := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(bad, []byte(`{"rates": [{"id": "de"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(bad); err == nil || !strings.Contains(err.Error(), bad) {
+		t.Errorf("Load(bad.json) error = %v, want it to name the file", err)
+	}
+}
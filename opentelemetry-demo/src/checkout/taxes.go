@@ -0,0 +1,79 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/money"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/tax"
+)
+
+// TaxCalculator computes the taxes of an order. Amounts are in the currency
+// of the order. *tax.Table is the default implementation.
+type TaxCalculator interface {
+	Calculate(ctx context.Context, order tax.Order) ([]*pb.TaxLine, error)
+}
+
+// applyTaxes adds the taxes of the order to prep, once its discounts are
+// known, and records them on the span.
+func (cs *checkout) applyTaxes(ctx context.Context, prep *orderPrep, currency string, address *pb.Address) error {
+	if cs.taxes == nil {
+		return nil
+	}
+
+	order := tax.Order{
+		Currency:         currency,
+		Address:          address,
+		Items:            make([]tax.Item, len(prep.orderItems)),
+		Shipping:         prep.shippingCostLocalized,
+		ItemDiscount:     &pb.Money{CurrencyCode: currency},
+		ShippingDiscount: prep.shippingDiscount,
+	}
+	for i, it := range prep.orderItems {
+		order.Items[i] = tax.Item{
+			ProductID:  it.GetItem().GetProductId(),
+			Categories: prep.categories[it.GetItem().GetProductId()],
+			Quantity:   it.GetItem().GetQuantity(),
+			Price:      it.GetCost(),
+		}
+	}
+	var err error
+	for _, adj := range prep.adjustments {
+		if order.ItemDiscount, err = money.Sum(order.ItemDiscount, money.Negate(adj.GetAmount())); err != nil {
+			return fmt.Errorf("failed to calculate taxes: %+v", err)
+		}
+	}
+	if prep.shippingDiscount != nil {
+		if order.ItemDiscount, err = money.Sum(order.ItemDiscount, money.Negate(prep.shippingDiscount)); err != nil {
+			return fmt.Errorf("failed to calculate taxes: %+v", err)
+		}
+	}
+
+	taxes, err := cs.taxes.Calculate(ctx, order)
+	if err != nil {
+		return fmt.Errorf("failed to calculate taxes: %+v", err)
+	}
+	prep.taxes = taxes
+
+	ids := make([]string, len(taxes))
+	total := &pb.Money{CurrencyCode: currency}
+	for i, line := range taxes {
+		ids[i] = line.GetTaxId()
+		if total, err = money.Sum(total, line.GetAmount()); err != nil {
+			return fmt.Errorf("failed to calculate taxes: %+v", err)
+		}
+	}
+	totalFloat, _ := strconv.ParseFloat(money.Format(total), 64)
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.StringSlice("app.order.taxes", ids),
+		attribute.Float64("app.order.tax.amount", totalFloat),
+	)
+	return nil
+}
@@ -0,0 +1,200 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/money"
+	"github.com/open-telemetry/opentelemetry-demo/src/checkout/tax"
+)
+
+// testTaxes charges 10% on the items of testCart but the lens, an
+// accessory, and on shipping, for addresses in California.
+func testTaxes(t *testing.T) *tax.Table {
+	t.Helper()
+	table, err := tax.Parse([]byte(`
+rates:
+  - id: us-ca
+    description: California sales tax
+    country: United States
+    state: CA
+    percent: 10
+    shipping: true
+    exempt_categories: [accessories]
+`), tax.YAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return table
+}
+
+// wantTax is 10% of the telescopes and shipping of testCart in EUR:
+// 2 x 201.00 + 17.98 = 419.98.
+var wantTax = &pb.TaxLine{
+	TaxId:         "us-ca",
+	Description:   "California sales tax",
+	Rate:          "10",
+	TaxableAmount: &pb.Money{CurrencyCode: "EUR", Units: 419, Nanos: 980000000},
+	Amount:        &pb.Money{CurrencyCode: "EUR", Units: 42},
+}
+
+func TestPlaceOrderChargesTaxes(t *testing.T) {
+	f := newFakes()
+	f.cart.items[testUserID] = testCart()
+	svc := startFakes(t, f)
+	svc.taxes = testTaxes(t)
+	svc.orders = &fakeOrders{}
+
+	sr := recordSpans(t)
+	ctx, span := tracer.Start(context.Background(), "PlaceOrder")
+	resp, err := svc.PlaceOrder(ctx, testOrderRequest())
+	span.End()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	taxes := resp.GetOrder().GetTaxes()
+	if len(taxes) != 1 || !proto.Equal(taxes[0], wantTax) {
+		t.Errorf("order taxes = %v, want %v", taxes, wantTax)
+	}
+	want := money.Must(money.Sum(wantTotal, wantTax.Amount))
+	if len(f.payment.charges) != 1 || !money.AreEquals(f.payment.charges[0].GetAmount(), want) {
+		t.Errorf("expected one charge of %v, got %v", want, f.payment.charges)
+	}
+
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, s := range sr.Ended() {
+		if s.Name() == "PlaceOrder" {
+			for _, attr := range s.Attributes() {
+				attrs[attr.Key] = attr.Value
+			}
+		}
+	}
+	if ids := attrs["app.order.taxes"].AsStringSlice(); len(ids) != 1 || ids[0] != "us-ca" {
+		t.Errorf("app.order.taxes = %v, want [us-ca]", ids)
+	}
+	if amount := attrs["app.order.tax.amount"].AsFloat64(); amount != 42 {
+		t.Errorf("app.order.tax.amount = %v, want 42", amount)
+	}
+
+	stored, err := svc.GetOrder(context.Background(), &pb.GetOrderRequest{OrderId: resp.GetOrder().GetOrderId()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if taxes := stored.GetOrder().GetOrder().GetTaxes(); len(taxes) != 1 || !proto.Equal(taxes[0], wantTax) {
+		t.Errorf("stored taxes = %v, want %v", taxes, wantTax)
+	}
+}
+
+func TestPreviewOrderQuotesTaxes(t *testing.T) {
+	f := newFakes()
+	f.cart.items[testUserID] = testCart()
+	svc := startFakes(t, f)
+	svc.taxes = testTaxes(t)
+
+	quote := previewQuote(t, svc)
+	if taxes := quote.GetTaxes(); len(taxes) != 1 || !proto.Equal(taxes[0], wantTax) {
+		t.Errorf("quote taxes = %v, want %v", taxes, wantTax)
+	}
+	want := money.Must(money.Sum(wantTotal, wantTax.Amount))
+	if !money.AreEquals(quote.GetTotal(), want) {
+		t.Errorf("quote total = %v, want %v", quote.GetTotal(), want)
+	}
+
+	req := testOrderRequest()
+	req.QuoteId = quote.GetQuoteId()
+	resp, err := svc.PlaceOrder(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if taxes := resp.GetOrder().GetTaxes(); len(taxes) != 1 || !proto.Equal(taxes[0], wantTax) {
+		t.Errorf("order taxes = %v, want %v", taxes, wantTax)
+	}
+	if len(f.payment.charges) != 1 || !money.AreEquals(f.payment.charges[0].GetAmount(), want) {
+		t.Errorf("expected one charge of %v, got %v", want, f.payment.charges)
+	}
+}
+
+func TestApplyTaxesAfterDiscounts(t *testing.T) {
+	svc := &checkout{taxes: testTaxes(t)}
+	prep := orderPrep{
+		orderItems: []*pb.OrderItem{
+			{Item: &pb.CartItem{ProductId: "OLJCESPC7Z", Quantity: 1}, Cost: &pb.Money{CurrencyCode: "EUR", Units: 80}},
+			{Item: &pb.CartItem{ProductId: "66VCHSJNUP", Quantity: 1}, Cost: &pb.Money{CurrencyCode: "EUR", Units: 10}},
+		},
+		categories: map[string][]string{
+			"OLJCESPC7Z": {"telescopes"},
+			"66VCHSJNUP": {"accessories"},
+		},
+		shippingCostLocalized: &pb.Money{CurrencyCode: "EUR", Units: 10},
+		adjustments: []*pb.OrderAdjustment{
+			{PromotionId: "spring-sale", Amount: &pb.Money{CurrencyCode: "EUR", Units: -20}},
+		},
+	}
+	address := testOrderRequest().GetAddress()
+	if err := svc.applyTaxes(context.Background(), &prep, "EUR", address); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two ninths of the items are discounted, so 10% is charged on 62.22
+	// of the 80.00 telescope and on the 10.00 of shipping.
+	want := &pb.TaxLine{
+		TaxId:         "us-ca",
+		Description:   "California sales tax",
+		Rate:          "10",
+		TaxableAmount: &pb.Money{CurrencyCode: "EUR", Units: 72, Nanos: 220000000},
+		Amount:        &pb.Money{CurrencyCode: "EUR", Units: 7, Nanos: 220000000},
+	}
+	if len(prep.taxes) != 1 || !proto.Equal(prep.taxes[0], want) {
+		t.Errorf("taxes = %v, want %v", prep.taxes, want)
+	}
+	total, err := orderTotal("EUR", prep)
+	if want := (&pb.Money{CurrencyCode: "EUR", Units: 87, Nanos: 220000000}); err != nil || !money.AreEquals(total, want) {
+		t.Errorf("orderTotal() = %v, %v, want %v", total, err, want)
+	}
+}
+
+func TestPlaceOrderTaxesFreeShipping(t *testing.T) {
+	f := newFakes()
+	f.cart.items[testUserID] = testCart()
+	svc := startFakes(t, f)
+	loadTestPromotions(t, svc)
+	table, err := tax.Parse([]byte(`
+rates:
+  - id: us-ca
+    description: California sales tax
+    country: United States
+    state: CA
+    percent: 10
+`), tax.YAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.taxes = table
+
+	req := testOrderRequest()
+	req.PromoCodes = []string{"SHIPFREE"}
+	resp, err := svc.PlaceOrder(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The free shipping does not lower the items, which are taxed on the
+	// 442.00 of testCart less the 40.20 telescope discount.
+	want := &pb.TaxLine{
+		TaxId:         "us-ca",
+		Description:   "California sales tax",
+		Rate:          "10",
+		TaxableAmount: &pb.Money{CurrencyCode: "EUR", Units: 401, Nanos: 800000000},
+		Amount:        &pb.Money{CurrencyCode: "EUR", Units: 40, Nanos: 180000000},
+	}
+	if taxes := resp.GetOrder().GetTaxes(); len(taxes) != 1 || !proto.Equal(taxes[0], want) {
+		t.Errorf("order taxes = %v, want %v", taxes, want)
+	}
+}
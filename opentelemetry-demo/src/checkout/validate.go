@@ -0,0 +1,270 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+)
+
+// defaultCurrenciesTTL is how long the list of supported currencies is
+// cached.
+const defaultCurrenciesTTL = 10 * time.Minute
+
+// currenciesFailureBackoff is how long a failure to fetch the supported
+// currencies is returned before they are fetched again, so an outage of the
+// currency service does not cost every order a call.
+const currenciesFailureBackoff = 5 * time.Second
+
+// fieldViolations collects the invalid fields of a request.
+type fieldViolations []*errdetails.BadRequest_FieldViolation
+
+func (v *fieldViolations) add(field, format string, args ...any) {
+	*v = append(*v, &errdetails.BadRequest_FieldViolation{
+		Field:       field,
+		Description: fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *fieldViolations) required(field, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		v.add(field, "must not be empty")
+		return false
+	}
+	return true
+}
+
+// err returns a codes.InvalidArgument error about the named request message
+// with a google.rpc.BadRequest detail listing every violation, or nil if
+// there are none.
+func (v fieldViolations) err(message string) error {
+	if len(v) == 0 {
+		return nil
+	}
+	fields := make([]string, len(v))
+	for i, violation := range v {
+		fields[i] = violation.GetField()
+	}
+	st := status.Newf(codes.InvalidArgument, "invalid %s: %s", message, strings.Join(fields, ", "))
+	if detailed, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: v}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// validatePlaceOrderRequest checks req before any downstream call is made.
+func (cs *checkout) validatePlaceOrderRequest(ctx context.Context, req *pb.PlaceOrderRequest) error {
+	var v fieldViolations
+
+	v.required("user_id", req.GetUserId())
+	if v.required("user_currency", req.GetUserCurrency()) {
+		cs.validateCurrency(ctx, &v, req.GetUserCurrency())
+	}
+	if v.required("email", req.GetEmail()) {
+		if addr, err := mail.ParseAddress(req.GetEmail()); err != nil || addr.Address != req.GetEmail() {
+			v.add("email", "%q is not a valid email address", req.GetEmail())
+		}
+	}
+
+	validateAddress(&v, req.GetAddress())
+
+	if card := req.GetCreditCard(); card == nil {
+		v.add("credit_card", "is required")
+	} else {
+		validateCreditCard(&v, card, time.Now())
+	}
+	cs.validatePromoCodes(&v, req.GetPromoCodes())
+	return v.err("PlaceOrderRequest")
+}
+
+// validatePreviewOrderRequest checks the fields of req that pricing an order
+// depends on.
+func (cs *checkout) validatePreviewOrderRequest(ctx context.Context, req *pb.PreviewOrderRequest) error {
+	var v fieldViolations
+
+	v.required("user_id", req.GetUserId())
+	if v.required("user_currency", req.GetUserCurrency()) {
+		cs.validateCurrency(ctx, &v, req.GetUserCurrency())
+	}
+	validateAddress(&v, req.GetAddress())
+	cs.validatePromoCodes(&v, req.GetPromoCodes())
+	return v.err("PreviewOrderRequest")
+}
+
+func (cs *checkout) validatePromoCodes(v *fieldViolations, codes []string) {
+	rules, now := cs.promotions.Rules(), time.Now()
+	for i, code := range codes {
+		field := fmt.Sprintf("promo_codes[%d]", i)
+		if v.required(field, code) && !rules.Known(code, now) {
+			v.add(field, "%q is not a valid promo code", code)
+		}
+	}
+}
+
+func validateAddress(v *fieldViolations, address *pb.Address) {
+	if address == nil {
+		v.add("address", "is required")
+		return
+	}
+	v.required("address.street_address", address.GetStreetAddress())
+	v.required("address.city", address.GetCity())
+	v.required("address.country", address.GetCountry())
+	v.required("address.zip_code", address.GetZipCode())
+}
+
+func (cs *checkout) validateCurrency(ctx context.Context, v *fieldViolations, code string) {
+	if len(code) != 3 || strings.ToUpper(code) != code {
+		v.add("user_currency", "%q is not an ISO 4217 currency code", code)
+		return
+	}
+	if cs.converter.mode == conversionLocal {
+		if !cs.converter.local.Supports(code) {
+			v.add("user_currency", "currency %q is not supported", code)
+		}
+		return
+	}
+	supported, err := cs.currencies.supported(ctx)
+	if err != nil {
+		// The currency service is also needed to place the order, so an
+		// outage is reported by the conversion rather than as a bad request.
+		log.Warnf("failed to get supported currencies, skipping currency validation: %+v", err)
+		return
+	}
+	if !supported[code] {
+		v.add("user_currency", "currency %q is not supported", code)
+	}
+}
+
+func validateCreditCard(v *fieldViolations, card *pb.CreditCardInfo, now time.Time) {
+	number := strings.NewReplacer(" ", "", "-", "").Replace(card.GetCreditCardNumber())
+	switch {
+	case number == "":
+		v.add("credit_card.credit_card_number", "must not be empty")
+	case len(number) < 12 || len(number) > 19 || strings.Trim(number, "0123456789") != "":
+		v.add("credit_card.credit_card_number", "must be 12 to 19 digits")
+	case !luhnValid(number):
+		v.add("credit_card.credit_card_number", "failed the Luhn check")
+	}
+
+	if cvv := card.GetCreditCardCvv(); cvv < 0 || cvv > 9999 {
+		v.add("credit_card.credit_card_cvv", "must be 3 or 4 digits")
+	}
+
+	month, year := card.GetCreditCardExpirationMonth(), card.GetCreditCardExpirationYear()
+	if month < 1 || month > 12 {
+		v.add("credit_card.credit_card_expiration_month", "must be between 1 and 12, got %d", month)
+		return
+	}
+	// A card is valid until the end of its expiration month.
+	if expires := time.Date(int(year), time.Month(month)+1, 1, 0, 0, 0, 0, time.UTC); !now.Before(expires) {
+		v.add("credit_card.credit_card_expiration_year", "card expired in %d/%d", month, year)
+	}
+}
+
+// luhnValid reports whether the digits in number pass the Luhn checksum.
+func luhnValid(number string) bool {
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// currencyCache caches the currencies the currency service supports.
+type currencyCache struct {
+	client  pb.CurrencyServiceClient
+	ttl     time.Duration
+	backoff time.Duration
+	now     func() time.Time
+	fetches singleflight.Group
+
+	mu      sync.Mutex
+	codes   map[string]bool
+	fetched time.Time
+	err     error
+	failed  time.Time
+}
+
+func newCurrencyCache(client pb.CurrencyServiceClient, ttl time.Duration) *currencyCache {
+	return &currencyCache{client: client, ttl: ttl, backoff: currenciesFailureBackoff, now: time.Now}
+}
+
+// supported returns the supported currency codes, fetching them again once
+// the cached list is older than the TTL. A failed fetch is returned until
+// the backoff has passed. Concurrent callers share a fetch, and each stops
+// waiting for it when its own context is done.
+func (c *currencyCache) supported(ctx context.Context) (map[string]bool, error) {
+	if codes, ok, err := c.cached(); ok {
+		return codes, err
+	}
+
+	// The fetch outlives the caller that started it, as other callers may
+	// be waiting for it; the timeout of the client still bounds it.
+	fetch := c.fetches.DoChan("", func() (any, error) {
+		// A fetch that just finished may have filled the cache.
+		if codes, ok, err := c.cached(); ok {
+			return codes, err
+		}
+		return c.fetch(context.WithoutCancel(ctx))
+	})
+	select {
+	case result := <-fetch:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return result.Val.(map[string]bool), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// cached returns the cached currencies, or the failure of the last fetch
+// during the backoff. It reports false when they must be fetched again.
+func (c *currencyCache) cached() (map[string]bool, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.codes != nil && c.now().Sub(c.fetched) < c.ttl {
+		return c.codes, true, nil
+	}
+	if c.err != nil && c.now().Sub(c.failed) < c.backoff {
+		return nil, true, c.err
+	}
+	return nil, false, nil
+}
+
+func (c *currencyCache) fetch(ctx context.Context) (map[string]bool, error) {
+	resp, err := c.client.GetSupportedCurrencies(ctx, &pb.Empty{})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.err, c.failed = fmt.Errorf("failed to get supported currencies: %w", err), c.now()
+		return nil, c.err
+	}
+	codes := make(map[string]bool, len(resp.GetCurrencyCodes()))
+	for _, code := range resp.GetCurrencyCodes() {
+		codes[code] = true
+	}
+	c.codes, c.fetched, c.err = codes, c.now(), nil
+	return codes, nil
+}
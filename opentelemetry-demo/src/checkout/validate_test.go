@@ -0,0 +1,292 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/open-telemetry/opentelemetry-demo/src/checkout/genproto/oteldemo"
+)
+
+// violatedFields returns the fields listed in the BadRequest detail of err.
+func violatedFields(t *testing.T, err error) []string {
+	t.Helper()
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("error = %v, want InvalidArgument", err)
+	}
+	var fields []string
+	for _, detail := range st.Details() {
+		if br, ok := detail.(*errdetails.BadRequest); ok {
+			for _, v := range br.GetFieldViolations() {
+				fields = append(fields, v.GetField())
+			}
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func TestPlaceOrderValidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		modify     func(req *pb.PlaceOrderRequest)
+		wantFields []string
+	}{
+		{
+			name:       "EmptyEmail",
+			modify:     func(req *pb.PlaceOrderRequest) { req.Email = "" },
+			wantFields: []string{"email"},
+		},
+		{
+			name:       "MalformedEmail",
+			modify:     func(req *pb.PlaceOrderRequest) { req.Email = "someone at example.com" },
+			wantFields: []string{"email"},
+		},
+		{
+			name:       "MissingAddress",
+			modify:     func(req *pb.PlaceOrderRequest) { req.Address = nil },
+			wantFields: []string{"address"},
+		},
+		{
+			name: "IncompleteAddress",
+			modify: func(req *pb.PlaceOrderRequest) {
+				req.Address.City = ""
+				req.Address.ZipCode = " "
+			},
+			wantFields: []string{"address.city", "address.zip_code"},
+		},
+		{
+			name:       "NonLuhnCard",
+			modify:     func(req *pb.PlaceOrderRequest) { req.CreditCard.CreditCardNumber = "4432-8015-6152-0455" },
+			wantFields: []string{"credit_card.credit_card_number"},
+		},
+		{
+			name:       "CardWithLetters",
+			modify:     func(req *pb.PlaceOrderRequest) { req.CreditCard.CreditCardNumber = "4432-8015-6152-04a4" },
+			wantFields: []string{"credit_card.credit_card_number"},
+		},
+		{
+			name: "ExpiredCard",
+			modify: func(req *pb.PlaceOrderRequest) {
+				req.CreditCard.CreditCardExpirationYear = 2020
+				req.CreditCard.CreditCardExpirationMonth = 12
+			},
+			wantFields: []string{"credit_card.credit_card_expiration_year"},
+		},
+		{
+			name:       "InvalidMonth",
+			modify:     func(req *pb.PlaceOrderRequest) { req.CreditCard.CreditCardExpirationMonth = 13 },
+			wantFields: []string{"credit_card.credit_card_expiration_month"},
+		},
+		{
+			name:       "UnknownCurrency",
+			modify:     func(req *pb.PlaceOrderRequest) { req.UserCurrency = "XYZ" },
+			wantFields: []string{"user_currency"},
+		},
+		{
+			name:       "MalformedCurrency",
+			modify:     func(req *pb.PlaceOrderRequest) { req.UserCurrency = "euro" },
+			wantFields: []string{"user_currency"},
+		},
+		{
+			name: "EverythingMissing",
+			modify: func(req *pb.PlaceOrderRequest) {
+				*req = pb.PlaceOrderRequest{}
+			},
+			wantFields: []string{"address", "credit_card", "email", "user_currency", "user_id"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakes()
+			f.cart.items[testUserID] = testCart()
+			svc := startFakes(t, f)
+
+			req := testOrderRequest()
+			tt.modify(req)
+			_, err := svc.PlaceOrder(context.Background(), req)
+
+			if got := violatedFields(t, err); strings.Join(got, ",") != strings.Join(tt.wantFields, ",") {
+				t.Errorf("violated fields = %v, want %v", got, tt.wantFields)
+			}
+			if len(f.catalog.lookups) != 0 || f.currency.calls != 0 || f.payment.calls != 0 {
+				t.Error("an invalid request reached the downstream services")
+			}
+			if len(f.cart.cartOf(testUserID)) == 0 {
+				t.Error("an invalid request emptied the cart")
+			}
+		})
+	}
+}
+
+func TestPlaceOrderCachesSupportedCurrencies(t *testing.T) {
+	f := newFakes()
+	svc := startFakes(t, f)
+	now := time.Unix(0, 0)
+	svc.currencies.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		f.cart.items[testUserID] = testCart()
+		if _, err := svc.PlaceOrder(context.Background(), testOrderRequest()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if f.currency.supportedCalls != 1 {
+		t.Errorf("GetSupportedCurrencies called %d times, want 1", f.currency.supportedCalls)
+	}
+
+	now = now.Add(defaultCurrenciesTTL)
+	f.cart.items[testUserID] = testCart()
+	if _, err := svc.PlaceOrder(context.Background(), testOrderRequest()); err != nil {
+		t.Fatal(err)
+	}
+	if f.currency.supportedCalls != 2 {
+		t.Errorf("GetSupportedCurrencies called %d times after the TTL, want 2", f.currency.supportedCalls)
+	}
+}
+
+func TestPlaceOrderSkipsCurrencyCheckWhenUnavailable(t *testing.T) {
+	f := newFakes()
+	f.cart.items[testUserID] = testCart()
+	f.currency.supportedErr = status.Error(codes.Unavailable, "currency service unavailable")
+	svc := startFakes(t, f)
+
+	if _, err := svc.PlaceOrder(context.Background(), testOrderRequest()); err != nil {
+		t.Errorf("PlaceOrder() error = %v, want the order placed without the currency check", err)
+	}
+}
+
+func TestPlaceOrderBacksOffSupportedCurrencies(t *testing.T) {
+	f := newFakes()
+	// Not retried by the client, so each fetch is a single call.
+	f.currency.supportedErr = status.Error(codes.Internal, "currency service failed")
+	svc := startFakes(t, f)
+	now := time.Unix(0, 0)
+	svc.currencies.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		f.cart.items[testUserID] = testCart()
+		if _, err := svc.PlaceOrder(context.Background(), testOrderRequest()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if f.currency.supportedCalls != 1 {
+		t.Errorf("GetSupportedCurrencies called %d times, want 1", f.currency.supportedCalls)
+	}
+
+	now = now.Add(currenciesFailureBackoff)
+	f.cart.items[testUserID] = testCart()
+	if _, err := svc.PlaceOrder(context.Background(), testOrderRequest()); err != nil {
+		t.Fatal(err)
+	}
+	if f.currency.supportedCalls != 2 {
+		t.Errorf("GetSupportedCurrencies called %d times after the backoff, want 2", f.currency.supportedCalls)
+	}
+}
+
+// blockingCurrencyClient answers GetSupportedCurrencies once release is
+// closed, and counts the calls.
+type blockingCurrencyClient struct {
+	pb.CurrencyServiceClient
+	calls   atomic.Int32
+	started chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingCurrencyClient) GetSupportedCurrencies(context.Context, *pb.Empty, ...grpc.CallOption) (*pb.GetSupportedCurrenciesResponse, error) {
+	if c.calls.Add(1) == 1 {
+		close(c.started)
+	}
+	<-c.release
+	return &pb.GetSupportedCurrenciesResponse{CurrencyCodes: []string{"EUR"}}, nil
+}
+
+func TestCurrencyCacheSharesFetch(t *testing.T) {
+	client := &blockingCurrencyClient{started: make(chan struct{}), release: make(chan struct{})}
+	cache := newCurrencyCache(client, time.Minute)
+
+	var wg sync.WaitGroup
+	results := make(chan map[string]bool, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			supported, err := cache.supported(context.Background())
+			if err != nil {
+				t.Error(err)
+			}
+			results <- supported
+		}()
+	}
+	<-client.started
+
+	// A caller that gives up is not held behind the fetch in flight.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := cache.supported(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("supported() with an expired context error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(client.release)
+	wg.Wait()
+	close(results)
+	for supported := range results {
+		if !supported["EUR"] {
+			t.Errorf("supported() = %v, want EUR", supported)
+		}
+	}
+	if calls := client.calls.Load(); calls != 1 {
+		t.Errorf("GetSupportedCurrencies called %d times, want 1", calls)
+	}
+}
+
+func TestLuhnValid(t *testing.T) {
+	for number, want := range map[string]bool{
+		"4432801561520454": true,
+		"4432801561520455": false,
+		"79927398713":      true,
+		"79927398710":      false,
+		"0000000000000000": true,
+	} {
+		if got := luhnValid(number); got != want {
+			t.Errorf("luhnValid(%q) = %v, want %v", number, got, want)
+		}
+	}
+}
+
+func TestValidateCreditCardExpiry(t *testing.T) {
+	now := time.Date(2025, time.March, 31, 23, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		month, year int32
+		valid       bool
+	}{
+		{3, 2025, true},
+		{2, 2025, false},
+		{12, 2024, false},
+		{1, 2026, true},
+	} {
+		var v fieldViolations
+		validateCreditCard(&v, &pb.CreditCardInfo{
+			CreditCardNumber:          "4432-8015-6152-0454",
+			CreditCardExpirationMonth: tt.month,
+			CreditCardExpirationYear:  tt.year,
+		}, now)
+		if got := len(v) == 0; got != tt.valid {
+			t.Errorf("card expiring %d/%d valid = %v on %v, want %v", tt.month, tt.year, got, now, tt.valid)
+		}
+	}
+}
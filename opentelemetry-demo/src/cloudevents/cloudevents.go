@@ -0,0 +1,193 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package cloudevents wraps the order events exchanged over Kafka in
+// CloudEvents 1.0, using the binary content mode of the Kafka protocol
+// binding: the event attributes travel in ce_* record headers, the content
+// type in the content-type header, and the record value is the encoded
+// protobuf message alone. Encoded as protobuf, the value is therefore the
+// same as the bare messages published before events were wrapped.
+package cloudevents
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// SpecVersion is the CloudEvents version of the events written.
+const SpecVersion = "1.0"
+
+// Record headers of an event in binary content mode.
+const (
+	HeaderSpecVersion = "ce_specversion"
+	HeaderID          = "ce_id"
+	HeaderSource      = "ce_source"
+	HeaderType        = "ce_type"
+	HeaderSubject     = "ce_subject"
+	HeaderTime        = "ce_time"
+	HeaderContentType = "content-type"
+)
+
+// Event types of the order events. The version suffix only changes with a
+// breaking change to the payload, which then needs a new type so consumers
+// can tell the versions apart.
+const (
+	TypeOrderPlaced    = "oteldemo.order.placed.v1"
+	TypeOrderCancelled = "oteldemo.order.cancelled.v1"
+)
+
+// Encoding is how the payload of an event is encoded.
+type Encoding string
+
+const (
+	// Protobuf encodes the payload in the protobuf wire format. It is the
+	// default.
+	Protobuf Encoding = "protobuf"
+	// JSON encodes the payload in the canonical protobuf JSON mapping.
+	JSON Encoding = "json"
+)
+
+// ParseEncoding parses "protobuf" or "json", regardless of case.
+func ParseEncoding(s string) (Encoding, error) {
+	switch e := Encoding(strings.ToLower(s)); e {
+	case Protobuf, JSON:
+		return e, nil
+	}
+	return "", fmt.Errorf("unknown encoding %q, use protobuf or json", s)
+}
+
+// ContentType returns the media type of payloads in encoding e.
+func (e Encoding) ContentType() string {
+	if e == JSON {
+		return "application/json"
+	}
+	return "application/protobuf"
+}
+
+// Headers holds the record headers of an event.
+type Headers map[string]string
+
+// Get returns the value of key, or "" when it is not set.
+func (h Headers) Get(key string) string { return h[key] }
+
+// Getter reads record headers. Headers implements it, and consumers can
+// implement it over the headers of a consumed message.
+type Getter interface {
+	Get(key string) string
+}
+
+// Event holds the attributes of an event.
+type Event struct {
+	ID          string
+	Source      string
+	Type        string
+	Subject     string
+	Time        time.Time
+	SpecVersion string
+	ContentType string
+}
+
+// Encoder wraps messages in events sent by Source.
+type Encoder struct {
+	// Source identifies the producer, as a URI reference.
+	Source   string
+	Encoding Encoding
+}
+
+// Encode returns the payload and the headers of an event of eventType about
+// subject, with msg as its data. Each call creates an event with a new ID.
+func (e Encoder) Encode(eventType, subject string, msg proto.Message) ([]byte, Headers, error) {
+	var data []byte
+	var err error
+	switch e.Encoding {
+	case JSON:
+		data, err = protojson.Marshal(msg)
+	case Protobuf, "":
+		data, err = proto.Marshal(msg)
+	default:
+		err = fmt.Errorf("unknown encoding %q", e.Encoding)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+
+	headers := Headers{
+		HeaderSpecVersion: SpecVersion,
+		HeaderID:          uuid.NewString(),
+		HeaderSource:      e.Source,
+		HeaderType:        eventType,
+		HeaderTime:        time.Now().UTC().Format(time.RFC3339Nano),
+		HeaderContentType: e.Encoding.ContentType(),
+	}
+	if subject != "" {
+		headers[HeaderSubject] = subject
+	}
+	return data, headers, nil
+}
+
+// Decode reads the event in headers and data into msg. A record without a
+// ce_specversion header is decoded as a bare protobuf message, as published
+// before events were wrapped, and returns an Event with no attributes.
+// Fields unknown to msg are ignored in either encoding.
+func Decode(headers Getter, data []byte, msg proto.Message) (Event, error) {
+	event := Event{SpecVersion: headers.Get(HeaderSpecVersion)}
+	if event.SpecVersion == "" {
+		if err := proto.Unmarshal(data, msg); err != nil {
+			return event, fmt.Errorf("failed to decode payload: %w", err)
+		}
+		return event, nil
+	}
+	if event.SpecVersion != SpecVersion {
+		return event, fmt.Errorf("unsupported CloudEvents version %q", event.SpecVersion)
+	}
+
+	event.ID = headers.Get(HeaderID)
+	event.Source = headers.Get(HeaderSource)
+	event.Type = headers.Get(HeaderType)
+	event.Subject = headers.Get(HeaderSubject)
+	event.ContentType = headers.Get(HeaderContentType)
+	var errs []error
+	for _, required := range []struct{ key, value string }{
+		{HeaderID, event.ID},
+		{HeaderSource, event.Source},
+		{HeaderType, event.Type},
+	} {
+		if required.value == "" {
+			errs = append(errs, fmt.Errorf("missing %s header", required.key))
+		}
+	}
+	if value := headers.Get(HeaderTime); value != "" {
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s header: %w", HeaderTime, err))
+		}
+		event.Time = t
+	}
+	if err := errors.Join(errs...); err != nil {
+		return event, err
+	}
+
+	mediaType, _, err := mime.ParseMediaType(event.ContentType)
+	if err != nil {
+		return event, fmt.Errorf("invalid %s header %q: %w", HeaderContentType, event.ContentType, err)
+	}
+	switch mediaType {
+	case "application/protobuf", "application/x-protobuf":
+		err = proto.Unmarshal(data, msg)
+	case "application/json":
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, msg)
+	default:
+		return event, fmt.Errorf("unsupported content type %q", event.ContentType)
+	}
+	if err != nil {
+		return event, fmt.Errorf("failed to decode %s payload: %w", event.Type, err)
+	}
+	return event, nil
+}
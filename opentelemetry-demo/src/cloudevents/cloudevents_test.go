@@ -0,0 +1,134 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package cloudevents
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// testMessage stands in for an order event: any message will do.
+func testMessage() *descriptorpb.DescriptorProto {
+	return &descriptorpb.DescriptorProto{Name: proto.String("OrderResult")}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	for _, encoding := range []Encoding{Protobuf, JSON} {
+		t.Run(string(encoding), func(t *testing.T) {
+			enc := Encoder{Source: "/checkout", Encoding: encoding}
+			data, headers, err := enc.Encode(TypeOrderPlaced, "order-1", testMessage())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if headers.Get(HeaderSpecVersion) != "1.0" || headers.Get(HeaderType) != TypeOrderPlaced ||
+				headers.Get(HeaderSource) != "/checkout" || headers.Get(HeaderSubject) != "order-1" ||
+				headers.Get(HeaderID) == "" || headers.Get(HeaderContentType) != encoding.ContentType() {
+				t.Errorf("unexpected headers: %v", headers)
+			}
+
+			got := new(descriptorpb.DescriptorProto)
+			event, err := Decode(headers, data, got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !proto.Equal(got, testMessage()) {
+				t.Errorf("decoded %v, want %v", got, testMessage())
+			}
+			if event.Type != TypeOrderPlaced || event.Subject != "order-1" || time.Since(event.Time) > time.Minute {
+				t.Errorf("unexpected event: %+v", event)
+			}
+		})
+	}
+}
+
+func TestEncodeNewIDs(t *testing.T) {
+	enc := Encoder{Source: "/checkout"}
+	_, first, _ := enc.Encode(TypeOrderPlaced, "order-1", testMessage())
+	_, second, _ := enc.Encode(TypeOrderPlaced, "order-1", testMessage())
+	if first.Get(HeaderID) == second.Get(HeaderID) {
+		t.Errorf("two events got the same ID %q", first.Get(HeaderID))
+	}
+}
+
+func TestDecodeBareProtobuf(t *testing.T) {
+	data, err := proto.Marshal(testMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := new(descriptorpb.DescriptorProto)
+	event, err := Decode(Headers{}, data, got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(got, testMessage()) || event.Type != "" {
+		t.Errorf("Decode() = %+v, %v, want the message without attributes", event, got)
+	}
+}
+
+func TestDecodeIgnoresUnknownJSONFields(t *testing.T) {
+	headers := Headers{
+		HeaderSpecVersion: "1.0",
+		HeaderID:          "1",
+		HeaderSource:      "/checkout",
+		HeaderType:        TypeOrderPlaced,
+		HeaderContentType: "application/json; charset=utf-8",
+	}
+	got := new(descriptorpb.DescriptorProto)
+	if _, err := Decode(headers, []byte(`{"name":"OrderResult","addedLater":true}`), got); err != nil {
+		t.Fatal(err)
+	}
+	if got.GetName() != "OrderResult" {
+		t.Errorf("decoded %v", got)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	valid := func() Headers {
+		return Headers{
+			HeaderSpecVersion: "1.0",
+			HeaderID:          "1",
+			HeaderSource:      "/checkout",
+			HeaderType:        TypeOrderPlaced,
+			HeaderContentType: "application/protobuf",
+		}
+	}
+	tests := []struct {
+		name    string
+		modify  func(Headers)
+		data    string
+		wantErr string
+	}{
+		{"SpecVersion", func(h Headers) { h[HeaderSpecVersion] = "0.3" }, "", "unsupported CloudEvents version"},
+		{"MissingAttributes", func(h Headers) { delete(h, HeaderID); delete(h, HeaderType) }, "", "missing ce_id header\nmissing ce_type header"},
+		{"Time", func(h Headers) { h[HeaderTime] = "yesterday" }, "", "invalid ce_time header"},
+		{"ContentType", func(h Headers) { h[HeaderContentType] = "text/plain" }, "", "unsupported content type"},
+		{"Payload", nil, "\xff", "failed to decode oteldemo.order.placed.v1 payload"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := valid()
+			if tt.modify != nil {
+				tt.modify(headers)
+			}
+			_, err := Decode(headers, []byte(tt.data), new(descriptorpb.DescriptorProto))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Decode() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseEncoding(t *testing.T) {
+	for input, want := range map[string]Encoding{"protobuf": Protobuf, "JSON": JSON} {
+		if got, err := ParseEncoding(input); err != nil || got != want {
+			t.Errorf("ParseEncoding(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+	if _, err := ParseEncoding("avro"); err == nil {
+		t.Error("ParseEncoding(avro) succeeded, want an error")
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package cloudevents
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Change is a difference between two versions of an event payload.
+type Change struct {
+	// Path is the full name of the changed message, field or enum value.
+	Path        string
+	Description string
+	// Breaking is set when consumers of one version may misread the other,
+	// in the protobuf or in the JSON encoding.
+	Breaking bool
+}
+
+func (c Change) String() string {
+	if c.Breaking {
+		return fmt.Sprintf("BREAKING %s: %s", c.Path, c.Description)
+	}
+	return fmt.Sprintf("%s: %s", c.Path, c.Description)
+}
+
+// Compare reports how cur differs from old, following the message and enum
+// types of their fields. Removing a field is breaking unless its number is
+// reserved, since the number could otherwise be reused with another meaning,
+// and renaming one is breaking because the JSON encoding uses field names.
+func Compare(old, cur protoreflect.MessageDescriptor) []Change {
+	c := &comparer{seen: make(map[protoreflect.FullName]bool)}
+	if old.FullName() != cur.FullName() {
+		c.add(old.FullName(), true, "message renamed to %s", cur.FullName())
+	}
+	c.messages(old, cur)
+	return c.changes
+}
+
+// Breaking returns the breaking changes among changes.
+func Breaking(changes []Change) []Change {
+	var breaking []Change
+	for _, change := range changes {
+		if change.Breaking {
+			breaking = append(breaking, change)
+		}
+	}
+	return breaking
+}
+
+type comparer struct {
+	changes []Change
+	seen    map[protoreflect.FullName]bool
+}
+
+func (c *comparer) add(path protoreflect.FullName, breaking bool, format string, args ...any) {
+	c.changes = append(c.changes, Change{Path: string(path), Description: fmt.Sprintf(format, args...), Breaking: breaking})
+}
+
+func (c *comparer) messages(old, cur protoreflect.MessageDescriptor) {
+	if c.seen[old.FullName()] {
+		return
+	}
+	c.seen[old.FullName()] = true
+
+	oldFields, curFields := old.Fields(), cur.Fields()
+	for i := 0; i < oldFields.Len(); i++ {
+		of := oldFields.Get(i)
+		cf := curFields.ByNumber(of.Number())
+		switch {
+		case cf != nil:
+			c.fields(of, cf)
+		case cur.ReservedRanges().Has(of.Number()):
+			c.add(of.FullName(), false, "field %d removed and reserved", of.Number())
+		default:
+			c.add(of.FullName(), true, "field %d removed without reserving its number", of.Number())
+		}
+	}
+	for i := 0; i < curFields.Len(); i++ {
+		cf := curFields.Get(i)
+		switch {
+		case oldFields.ByNumber(cf.Number()) != nil:
+		case old.ReservedRanges().Has(cf.Number()):
+			c.add(cf.FullName(), true, "field %d reuses a reserved number", cf.Number())
+		case old.ReservedNames().Has(cf.Name()):
+			c.add(cf.FullName(), true, "field %d reuses a reserved name", cf.Number())
+		default:
+			c.add(cf.FullName(), false, "field %d added", cf.Number())
+		}
+	}
+}
+
+func (c *comparer) fields(old, cur protoreflect.FieldDescriptor) {
+	if old.Name() != cur.Name() {
+		c.add(old.FullName(), true, "field %d renamed to %s", old.Number(), cur.Name())
+	} else if old.JSONName() != cur.JSONName() {
+		c.add(old.FullName(), true, "JSON name changed from %s to %s", old.JSONName(), cur.JSONName())
+	}
+	if old.Cardinality() != cur.Cardinality() {
+		c.add(old.FullName(), true, "changed from %s to %s", old.Cardinality(), cur.Cardinality())
+	}
+	if old.Kind() != cur.Kind() {
+		c.add(old.FullName(), true, "type changed from %s to %s", old.Kind(), cur.Kind())
+		return
+	}
+	switch old.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if old.Message().FullName() != cur.Message().FullName() {
+			c.add(old.FullName(), true, "type changed from %s to %s", old.Message().FullName(), cur.Message().FullName())
+			return
+		}
+		c.messages(old.Message(), cur.Message())
+	case protoreflect.EnumKind:
+		if old.Enum().FullName() != cur.Enum().FullName() {
+			c.add(old.FullName(), true, "type changed from %s to %s", old.Enum().FullName(), cur.Enum().FullName())
+			return
+		}
+		c.enums(old.Enum(), cur.Enum())
+	}
+}
+
+func (c *comparer) enums(old, cur protoreflect.EnumDescriptor) {
+	if c.seen[old.FullName()] {
+		return
+	}
+	c.seen[old.FullName()] = true
+
+	oldValues, curValues := old.Values(), cur.Values()
+	for i := 0; i < oldValues.Len(); i++ {
+		ov := oldValues.Get(i)
+		cv := curValues.ByNumber(ov.Number())
+		switch {
+		case cv == nil && cur.ReservedRanges().Has(ov.Number()):
+			c.add(ov.FullName(), false, "value %d removed and reserved", ov.Number())
+		case cv == nil:
+			c.add(ov.FullName(), true, "value %d removed without reserving its number", ov.Number())
+		case cv.Name() != ov.Name():
+			c.add(ov.FullName(), true, "value %d renamed to %s", ov.Number(), cv.Name())
+		}
+	}
+	for i := 0; i < curValues.Len(); i++ {
+		if cv := curValues.Get(i); oldValues.ByNumber(cv.Number()) == nil {
+			c.add(cv.FullName(), false, "value %d added", cv.Number())
+		}
+	}
+}
+
+// MarshalBaseline returns the files that declare messages, with the files
+// they import, as an indented JSON FileDescriptorSet. The output only
+// changes when the files do, so it can be checked in.
+func MarshalBaseline(messages ...protoreflect.MessageDescriptor) ([]byte, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	added := make(map[string]bool)
+	var add func(protoreflect.FileDescriptor)
+	add = func(file protoreflect.FileDescriptor) {
+		if added[file.Path()] {
+			return
+		}
+		added[file.Path()] = true
+		imports := file.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			add(imports.Get(i).FileDescriptor)
+		}
+		set.File = append(set.File, protodesc.ToFileDescriptorProto(file))
+	}
+	for _, msg := range messages {
+		add(msg.ParentFile())
+	}
+
+	data, err := protojson.Marshal(set)
+	if err != nil {
+		return nil, err
+	}
+	// protojson output is deliberately unstable; normalize the whitespace.
+	var compact, out bytes.Buffer
+	if err := json.Compact(&compact, data); err != nil {
+		return nil, err
+	}
+	if err := json.Indent(&out, compact.Bytes(), "", "  "); err != nil {
+		return nil, err
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
+
+// UnmarshalBaseline reads files written by MarshalBaseline.
+func UnmarshalBaseline(data []byte) (*protoregistry.Files, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := protojson.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("failed to read baseline: %w", err)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid baseline: %w", err)
+	}
+	return files, nil
+}
@@ -0,0 +1,219 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package cloudevents
+
+import (
+	"bytes"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const baseFile = `
+name: "demo.proto"
+package: "oteldemo"
+syntax: "proto3"
+message_type {
+  name: "Money"
+  field { name: "currency_code" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "currencyCode" }
+  field { name: "units" number: 2 label: LABEL_OPTIONAL type: TYPE_INT64 json_name: "units" }
+}
+message_type {
+  name: "OrderResult"
+  field { name: "order_id" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "orderId" }
+  field { name: "shipping_cost" number: 2 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".oteldemo.Money" json_name: "shippingCost" }
+  field { name: "items" number: 3 label: LABEL_REPEATED type: TYPE_STRING json_name: "items" }
+  field { name: "status" number: 4 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".oteldemo.Status" json_name: "status" }
+  reserved_range { start: 9 end: 10 }
+}
+enum_type {
+  name: "Status"
+  value { name: "STATUS_UNSPECIFIED" number: 0 }
+  value { name: "STATUS_PLACED" number: 1 }
+}
+`
+
+func baseProto(t *testing.T) *descriptorpb.FileDescriptorProto {
+	t.Helper()
+	file := &descriptorpb.FileDescriptorProto{}
+	if err := prototext.Unmarshal([]byte(baseFile), file); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func orderResult(t *testing.T, file *descriptorpb.FileDescriptorProto) protoreflect.MessageDescriptor {
+	t.Helper()
+	fd, err := protodesc.NewFile(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fd.Messages().ByName("OrderResult")
+}
+
+func field(file *descriptorpb.FileDescriptorProto, message, name string) *descriptorpb.FieldDescriptorProto {
+	for _, m := range file.MessageType {
+		if m.GetName() != message {
+			continue
+		}
+		for _, f := range m.Field {
+			if f.GetName() == name {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+func removeField(file *descriptorpb.FileDescriptorProto, message, name string) {
+	for _, m := range file.MessageType {
+		if m.GetName() != message {
+			continue
+		}
+		for i, f := range m.Field {
+			if f.GetName() == name {
+				m.Field = append(m.Field[:i], m.Field[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	orderMessage := func(file *descriptorpb.FileDescriptorProto) *descriptorpb.DescriptorProto { return file.MessageType[1] }
+
+	tests := []struct {
+		name         string
+		modify       func(*descriptorpb.FileDescriptorProto)
+		wantPath     string
+		wantBreaking bool
+	}{
+		{
+			name: "AddedField",
+			modify: func(f *descriptorpb.FileDescriptorProto) {
+				m := orderMessage(f)
+				m.Field = append(m.Field, &descriptorpb.FieldDescriptorProto{
+					Name: proto.String("tax"), Number: proto.Int32(5), JsonName: proto.String("tax"),
+					Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				})
+			},
+			wantPath: "oteldemo.OrderResult.tax",
+		},
+		{
+			name:         "RemovedField",
+			modify:       func(f *descriptorpb.FileDescriptorProto) { removeField(f, "OrderResult", "items") },
+			wantPath:     "oteldemo.OrderResult.items",
+			wantBreaking: true,
+		},
+		{
+			name: "RemovedAndReservedField",
+			modify: func(f *descriptorpb.FileDescriptorProto) {
+				removeField(f, "OrderResult", "items")
+				m := orderMessage(f)
+				m.ReservedRange = append(m.ReservedRange, &descriptorpb.DescriptorProto_ReservedRange{Start: proto.Int32(3), End: proto.Int32(4)})
+			},
+			wantPath: "oteldemo.OrderResult.items",
+		},
+		{
+			name: "ReusedReservedNumber",
+			modify: func(f *descriptorpb.FileDescriptorProto) {
+				m := orderMessage(f)
+				m.ReservedRange = nil
+				m.Field = append(m.Field, &descriptorpb.FieldDescriptorProto{
+					Name: proto.String("notes"), Number: proto.Int32(9), JsonName: proto.String("notes"),
+					Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				})
+			},
+			wantPath:     "oteldemo.OrderResult.notes",
+			wantBreaking: true,
+		},
+		{
+			name: "RenamedField",
+			modify: func(f *descriptorpb.FileDescriptorProto) {
+				fd := field(f, "OrderResult", "order_id")
+				fd.Name, fd.JsonName = proto.String("id"), proto.String("id")
+			},
+			wantPath:     "oteldemo.OrderResult.order_id",
+			wantBreaking: true,
+		},
+		{
+			name: "RepeatedField",
+			modify: func(f *descriptorpb.FileDescriptorProto) {
+				field(f, "OrderResult", "order_id").Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+			},
+			wantPath:     "oteldemo.OrderResult.order_id",
+			wantBreaking: true,
+		},
+		{
+			name: "NestedTypeChanged",
+			modify: func(f *descriptorpb.FileDescriptorProto) {
+				field(f, "Money", "units").Type = descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()
+			},
+			wantPath:     "oteldemo.Money.units",
+			wantBreaking: true,
+		},
+		{
+			name: "EnumValueRemoved",
+			modify: func(f *descriptorpb.FileDescriptorProto) {
+				f.EnumType[0].Value = f.EnumType[0].Value[:1]
+			},
+			wantPath:     "oteldemo.STATUS_PLACED",
+			wantBreaking: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := orderResult(t, baseProto(t))
+			file := baseProto(t)
+			tt.modify(file)
+
+			changes := Compare(old, orderResult(t, file))
+			if len(changes) != 1 {
+				t.Fatalf("Compare() = %v, want one change", changes)
+			}
+			if changes[0].Path != tt.wantPath || changes[0].Breaking != tt.wantBreaking {
+				t.Errorf("Compare() = %v, want a change to %s with breaking %v", changes[0], tt.wantPath, tt.wantBreaking)
+			}
+			if got := len(Breaking(changes)); got != map[bool]int{true: 1}[tt.wantBreaking] {
+				t.Errorf("Breaking() returned %d changes", got)
+			}
+		})
+	}
+}
+
+func TestCompareUnchanged(t *testing.T) {
+	if changes := Compare(orderResult(t, baseProto(t)), orderResult(t, baseProto(t))); len(changes) != 0 {
+		t.Errorf("Compare() = %v, want no changes", changes)
+	}
+}
+
+func TestBaselineRoundTrip(t *testing.T) {
+	msg := orderResult(t, baseProto(t))
+	data, err := MarshalBaseline(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := MarshalBaseline(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, again) {
+		t.Error("MarshalBaseline() output is not stable")
+	}
+
+	files, err := UnmarshalBaseline(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, err := files.FindDescriptorByName("oteldemo.OrderResult")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes := Compare(desc.(protoreflect.MessageDescriptor), msg); len(changes) != 0 {
+		t.Errorf("baseline differs from the message it was written from: %v", changes)
+	}
+}
@@ -0,0 +1,10 @@
+module github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/cloudevents
+
+go 1.22.0
+
+require (
+	github.com/google/uuid v1.6.0
+	google.golang.org/protobuf v1.36.5
+)
+
+require github.com/google/go-cmp v0.6.0 // indirect
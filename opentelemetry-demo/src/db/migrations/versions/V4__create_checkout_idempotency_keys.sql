@@ -0,0 +1,35 @@
+-- Migration: V4__create_checkout_idempotency_keys.sql
+-- Description: Stores idempotency keys so retried PlaceOrder calls return the original order
+-- Services: Checkout Service
+
+-- ==================== UP MIGRATION ====================
+
+-- Create idempotency keys table
+CREATE TABLE IF NOT EXISTS checkout_idempotency_keys (
+    idempotency_key VARCHAR(255) PRIMARY KEY,
+    request_fingerprint VARCHAR(64) NOT NULL,
+    state VARCHAR(16) NOT NULL DEFAULT 'in_progress',
+    response BYTEA,
+    locked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP
+);
+
+-- Create indices
+CREATE INDEX IF NOT EXISTS idx_checkout_idempotency_keys_created_at ON checkout_idempotency_keys(created_at);
+
+-- Add comments
+COMMENT ON TABLE checkout_idempotency_keys IS 'Idempotency keys of PlaceOrder calls and their stored responses';
+COMMENT ON COLUMN checkout_idempotency_keys.idempotency_key IS 'Client-supplied key, scoped by user id';
+COMMENT ON COLUMN checkout_idempotency_keys.request_fingerprint IS 'SHA-256 of the request the key was first used for; a replay with another request is rejected';
+COMMENT ON COLUMN checkout_idempotency_keys.state IS 'in_progress while the first call runs, completed once it has a response';
+COMMENT ON COLUMN checkout_idempotency_keys.response IS 'Serialized PlaceOrderResponse returned to repeated calls';
+COMMENT ON COLUMN checkout_idempotency_keys.locked_at IS 'When the current attempt claimed the key; identifies its claim';
+COMMENT ON COLUMN checkout_idempotency_keys.created_at IS 'When the key was first seen';
+COMMENT ON COLUMN checkout_idempotency_keys.completed_at IS 'When the original call finished';
+
+-- ==================== DOWN MIGRATION ====================
+
+-- To roll back this migration, uncomment and execute these statements:
+-- DROP INDEX IF EXISTS idx_checkout_idempotency_keys_created_at;
+-- DROP TABLE IF EXISTS checkout_idempotency_keys;
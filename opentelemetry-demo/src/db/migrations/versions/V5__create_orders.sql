@@ -0,0 +1,63 @@
+-- Migration: V5__create_orders.sql
+-- Description: Stores orders placed through the checkout service and their items
+-- Services: Checkout Service
+
+-- ==================== UP MIGRATION ====================
+
+-- Create orders table
+CREATE TABLE IF NOT EXISTS orders (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    email VARCHAR(255),
+    status VARCHAR(32) NOT NULL DEFAULT 'placed',
+    currency_code VARCHAR(3) NOT NULL,
+    total_units BIGINT NOT NULL DEFAULT 0,
+    total_nanos INT NOT NULL DEFAULT 0,
+    shipping_cost_units BIGINT NOT NULL DEFAULT 0,
+    shipping_cost_nanos INT NOT NULL DEFAULT 0,
+    shipping_tracking_id VARCHAR(255),
+    transaction_id VARCHAR(255),
+    street_address VARCHAR(255),
+    city VARCHAR(255),
+    state VARCHAR(255),
+    country VARCHAR(255),
+    zip_code VARCHAR(32),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create order items table
+CREATE TABLE IF NOT EXISTS order_items (
+    id SERIAL PRIMARY KEY,
+    order_id VARCHAR(64) NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    product_id VARCHAR(255) NOT NULL,
+    quantity INT NOT NULL,
+    cost_currency_code VARCHAR(3) NOT NULL,
+    cost_units BIGINT NOT NULL DEFAULT 0,
+    cost_nanos INT NOT NULL DEFAULT 0
+);
+
+-- Create indices
+CREATE INDEX IF NOT EXISTS idx_orders_user_id_created_at ON orders(user_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_order_items_order_id ON order_items(order_id);
+
+-- Add comments
+COMMENT ON TABLE orders IS 'Orders placed through the checkout service';
+COMMENT ON COLUMN orders.id IS 'Order id returned to the client in OrderResult';
+COMMENT ON COLUMN orders.user_id IS 'Id of the user that placed the order';
+COMMENT ON COLUMN orders.status IS 'Lifecycle state of the order, for example placed';
+COMMENT ON COLUMN orders.currency_code IS 'ISO 4217 code of all amounts of the order';
+COMMENT ON COLUMN orders.total_units IS 'Whole units of the charged amount';
+COMMENT ON COLUMN orders.total_nanos IS 'Nano units of the charged amount';
+COMMENT ON COLUMN orders.transaction_id IS 'Payment transaction id of the charge';
+COMMENT ON TABLE order_items IS 'Line items of an order with their localized cost';
+COMMENT ON COLUMN order_items.cost_units IS 'Whole units of the cost of a single item';
+COMMENT ON COLUMN order_items.cost_nanos IS 'Nano units of the cost of a single item';
+
+-- ==================== DOWN MIGRATION ====================
+
+-- To roll back this migration, uncomment and execute these statements:
+-- DROP INDEX IF EXISTS idx_order_items_order_id;
+-- DROP INDEX IF EXISTS idx_orders_user_id_created_at;
+-- DROP TABLE IF EXISTS order_items;
+-- DROP TABLE IF EXISTS orders;
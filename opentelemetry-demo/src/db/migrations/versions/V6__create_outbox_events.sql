@@ -0,0 +1,40 @@
+-- Migration: V6__create_outbox_events.sql
+-- Description: Transactional outbox for events that are published to Kafka after the order is stored
+-- Services: Checkout Service
+
+-- ==================== UP MIGRATION ====================
+
+-- Create outbox table
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id BIGSERIAL PRIMARY KEY,
+    aggregate_id VARCHAR(64) NOT NULL,
+    topic VARCHAR(255) NOT NULL,
+    message_key VARCHAR(255),
+    payload BYTEA NOT NULL,
+    headers JSONB NOT NULL DEFAULT '{}',
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    delivered_at TIMESTAMP
+);
+
+-- Create indices
+CREATE INDEX IF NOT EXISTS idx_outbox_events_pending ON outbox_events(next_attempt_at, id) WHERE delivered_at IS NULL;
+
+-- Add comments
+COMMENT ON TABLE outbox_events IS 'Events written in the same transaction as the data they describe, published by a relay';
+COMMENT ON COLUMN outbox_events.aggregate_id IS 'Id of the entity the event is about, for example the order id';
+COMMENT ON COLUMN outbox_events.topic IS 'Kafka topic the event is published to';
+COMMENT ON COLUMN outbox_events.message_key IS 'Kafka message key';
+COMMENT ON COLUMN outbox_events.payload IS 'Serialized message value';
+COMMENT ON COLUMN outbox_events.headers IS 'Message headers, including the W3C trace context of the request that wrote the event';
+COMMENT ON COLUMN outbox_events.attempts IS 'Number of failed publish attempts';
+COMMENT ON COLUMN outbox_events.next_attempt_at IS 'Earliest time the relay may try to publish the event again';
+COMMENT ON COLUMN outbox_events.delivered_at IS 'When the broker acknowledged the event, NULL while pending';
+
+-- ==================== DOWN MIGRATION ====================
+
+-- To roll back this migration, uncomment and execute these statements:
+-- DROP INDEX IF EXISTS idx_outbox_events_pending;
+-- DROP TABLE IF EXISTS outbox_events;
@@ -0,0 +1,42 @@
+-- Migration: V7__create_email_queue.sql
+-- Description: Queue of order confirmation emails that failed to send and are retried in the background
+-- Services: Checkout Service
+
+-- ==================== UP MIGRATION ====================
+
+-- Create email queue table
+CREATE TABLE IF NOT EXISTS email_queue (
+    id BIGSERIAL PRIMARY KEY,
+    order_id VARCHAR(64) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    payload BYTEA NOT NULL,
+    headers JSONB NOT NULL DEFAULT '{}',
+    status VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'dead')),
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+-- Create indices
+CREATE INDEX IF NOT EXISTS idx_email_queue_pending ON email_queue(next_attempt_at, id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_email_queue_dead ON email_queue(created_at) WHERE status = 'dead';
+
+-- Add comments
+COMMENT ON TABLE email_queue IS 'Order confirmation emails that failed to send, retried by the checkout email worker';
+COMMENT ON COLUMN email_queue.order_id IS 'Id of the order the confirmation is about';
+COMMENT ON COLUMN email_queue.email IS 'Address the confirmation is sent to';
+COMMENT ON COLUMN email_queue.payload IS 'The order, serialized as protobuf JSON';
+COMMENT ON COLUMN email_queue.headers IS 'W3C trace context of the request that placed the order';
+COMMENT ON COLUMN email_queue.status IS 'pending while retried, sent once delivered, dead once the worker gave up';
+COMMENT ON COLUMN email_queue.attempts IS 'Number of failed retries';
+COMMENT ON COLUMN email_queue.next_attempt_at IS 'Earliest time the worker may try to send the email again';
+COMMENT ON COLUMN email_queue.finished_at IS 'When the email was sent or dead-lettered, NULL while pending';
+
+-- ==================== DOWN MIGRATION ====================
+
+-- To roll back this migration, uncomment and execute these statements:
+-- DROP INDEX IF EXISTS idx_email_queue_dead;
+-- DROP INDEX IF EXISTS idx_email_queue_pending;
+-- DROP TABLE IF EXISTS email_queue;
@@ -0,0 +1,29 @@
+-- Migration: V8__add_order_cancellation.sql
+-- Description: Records why and when an order was cancelled
+-- Services: Checkout Service
+
+-- ==================== UP MIGRATION ====================
+
+-- Add cancellation columns
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS cancel_reason TEXT;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMP;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS cancel_claimed_at TIMESTAMP;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS refund_id VARCHAR(255);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS refunded_at TIMESTAMP;
+
+-- Add comments
+COMMENT ON COLUMN orders.status IS 'Lifecycle state of the order: placed, cancelling while a cancellation is in progress, or cancelled';
+COMMENT ON COLUMN orders.cancel_reason IS 'Reason given when the order was cancelled';
+COMMENT ON COLUMN orders.cancelled_at IS 'When the order was cancelled and refunded';
+COMMENT ON COLUMN orders.cancel_claimed_at IS 'When the cancellation in progress claimed the order; an old claim can be taken over';
+COMMENT ON COLUMN orders.refund_id IS 'Payment refund of the cancellation in progress or done';
+COMMENT ON COLUMN orders.refunded_at IS 'When the order was refunded, so a cancellation taken over does not refund it again';
+
+-- ==================== DOWN MIGRATION ====================
+
+-- To roll back this migration, uncomment and execute these statements:
+-- ALTER TABLE orders DROP COLUMN IF EXISTS refunded_at;
+-- ALTER TABLE orders DROP COLUMN IF EXISTS refund_id;
+-- ALTER TABLE orders DROP COLUMN IF EXISTS cancel_claimed_at;
+-- ALTER TABLE orders DROP COLUMN IF EXISTS cancelled_at;
+-- ALTER TABLE orders DROP COLUMN IF EXISTS cancel_reason;
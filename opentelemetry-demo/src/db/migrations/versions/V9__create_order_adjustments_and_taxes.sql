@@ -0,0 +1,58 @@
+-- Migration: V9__create_order_adjustments_and_taxes.sql
+-- Description: Stores the promotion adjustments applied to an order and the taxes charged on it
+-- Services: Checkout Service, Order Consumer
+
+-- ==================== UP MIGRATION ====================
+
+-- Create order adjustments table
+CREATE TABLE IF NOT EXISTS order_adjustments (
+    id SERIAL PRIMARY KEY,
+    order_id VARCHAR(64) NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    promotion_id VARCHAR(255) NOT NULL,
+    description TEXT,
+    promo_code VARCHAR(255),
+    amount_currency_code VARCHAR(3) NOT NULL,
+    amount_units BIGINT NOT NULL DEFAULT 0,
+    amount_nanos INT NOT NULL DEFAULT 0
+);
+
+-- Create order taxes table
+CREATE TABLE IF NOT EXISTS order_taxes (
+    id SERIAL PRIMARY KEY,
+    order_id VARCHAR(64) NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    tax_id VARCHAR(255) NOT NULL,
+    description TEXT,
+    rate VARCHAR(32) NOT NULL,
+    currency_code VARCHAR(3) NOT NULL,
+    taxable_units BIGINT NOT NULL DEFAULT 0,
+    taxable_nanos INT NOT NULL DEFAULT 0,
+    amount_units BIGINT NOT NULL DEFAULT 0,
+    amount_nanos INT NOT NULL DEFAULT 0
+);
+
+-- Create indices
+CREATE INDEX IF NOT EXISTS idx_order_adjustments_order_id ON order_adjustments(order_id);
+CREATE INDEX IF NOT EXISTS idx_order_taxes_order_id ON order_taxes(order_id);
+
+-- Add comments
+COMMENT ON TABLE order_adjustments IS 'Promotion adjustments applied to an order, in the order they were applied';
+COMMENT ON COLUMN order_adjustments.promotion_id IS 'Id of the promotion in the promotions file';
+COMMENT ON COLUMN order_adjustments.promo_code IS 'Promo code that unlocked the promotion, empty for automatic promotions';
+COMMENT ON COLUMN order_adjustments.amount_units IS 'Whole units of the adjustment, negative for a discount';
+COMMENT ON COLUMN order_adjustments.amount_nanos IS 'Nano units of the adjustment, negative for a discount';
+COMMENT ON TABLE order_taxes IS 'Taxes charged on an order, one row per rate of the tax table';
+COMMENT ON COLUMN order_taxes.tax_id IS 'Id of the rate in the tax table';
+COMMENT ON COLUMN order_taxes.rate IS 'Percentage charged, as a decimal string such as 7.25';
+COMMENT ON COLUMN order_taxes.currency_code IS 'ISO 4217 code of the taxable amount and the tax';
+COMMENT ON COLUMN order_taxes.taxable_units IS 'Whole units of the amount the rate applied to, after discounts';
+COMMENT ON COLUMN order_taxes.taxable_nanos IS 'Nano units of the amount the rate applied to, after discounts';
+COMMENT ON COLUMN order_taxes.amount_units IS 'Whole units of the tax';
+COMMENT ON COLUMN order_taxes.amount_nanos IS 'Nano units of the tax';
+
+-- ==================== DOWN MIGRATION ====================
+
+-- To roll back this migration, uncomment and execute these statements:
+-- DROP INDEX IF EXISTS idx_order_taxes_order_id;
+-- DROP INDEX IF EXISTS idx_order_adjustments_order_id;
+-- DROP TABLE IF EXISTS order_taxes;
+-- DROP TABLE IF EXISTS order_adjustments;
@@ -0,0 +1,139 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Email job statuses
+const (
+	EmailPending = "pending"
+	EmailSent    = "sent"
+	EmailDead    = "dead"
+)
+
+// EmailJob represents an order confirmation email that failed to send and
+// is retried in the background
+type EmailJob struct {
+	ID        int64
+	OrderID   string
+	Email     string
+	Payload   []byte
+	Headers   map[string]string
+	Status    string
+	Attempts  int
+	LastError string
+	CreatedAt time.Time
+}
+
+// EmailQueueRepository provides database operations for the queue of
+// order confirmation emails
+type EmailQueueRepository struct {
+	conn *Connection
+}
+
+// NewEmailQueueRepository creates a new EmailQueueRepository
+func NewEmailQueueRepository(conn *Connection) *EmailQueueRepository {
+	return &EmailQueueRepository{conn: conn}
+}
+
+// Enqueue stores a pending job that is due right away and sets its ID
+func (r *EmailQueueRepository) Enqueue(ctx context.Context, job *EmailJob) error {
+	headers := []byte("{}")
+	if job.Headers != nil {
+		var err error
+		if headers, err = json.Marshal(job.Headers); err != nil {
+			return fmt.Errorf("failed to marshal email job headers: %w", err)
+		}
+	}
+	err := r.conn.DB.QueryRowContext(ctx, `
+		INSERT INTO email_queue (order_id, email, payload, headers, status, created_at, next_attempt_at)
+		VALUES ($1, $2, $3, $4, 'pending', NOW(), NOW())
+		RETURNING id, created_at
+	`, job.OrderID, job.Email, job.Payload, string(headers)).Scan(&job.ID, &job.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to queue email for order %s: %w", job.OrderID, err)
+	}
+	job.Status = EmailPending
+	return nil
+}
+
+// ClaimDue claims up to limit pending jobs that are due, oldest first. A
+// claimed job is hidden from other workers for the lease duration, so it is
+// retried again if the worker dies before recording the outcome.
+func (r *EmailQueueRepository) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*EmailJob, error) {
+	rows, err := r.conn.DB.QueryContext(ctx, `
+		UPDATE email_queue
+		SET next_attempt_at = NOW() + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT id FROM email_queue
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, order_id, email, payload, headers, attempts, last_error, created_at
+	`, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*EmailJob
+	for rows.Next() {
+		j := EmailJob{Status: EmailPending}
+		var headers []byte
+		var lastError sql.NullString
+		if err := rows.Scan(&j.ID, &j.OrderID, &j.Email, &j.Payload, &headers, &j.Attempts, &lastError, &j.CreatedAt); err != nil {
+			return nil, err
+		}
+		j.LastError = lastError.String
+		if err := json.Unmarshal(headers, &j.Headers); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal headers of email job %d: %w", j.ID, err)
+		}
+		jobs = append(jobs, &j)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// UPDATE ... RETURNING does not keep the order of the subquery
+	sort.Slice(jobs, func(i, k int) bool {
+		return jobs[i].ID < jobs[k].ID
+	})
+	return jobs, nil
+}
+
+// MarkSent records that the email was delivered
+func (r *EmailQueueRepository) MarkSent(ctx context.Context, id int64) error {
+	_, err := r.conn.DB.ExecContext(ctx,
+		"UPDATE email_queue SET status = 'sent', finished_at = NOW(), last_error = NULL WHERE id = $1",
+		id,
+	)
+	return err
+}
+
+// MarkFailed records a failed attempt and when to try again
+func (r *EmailQueueRepository) MarkFailed(ctx context.Context, id int64, nextAttempt time.Time, reason string) error {
+	_, err := r.conn.DB.ExecContext(ctx, `
+		UPDATE email_queue
+		SET attempts = attempts + 1, last_error = $2, next_attempt_at = $3
+		WHERE id = $1
+	`, id, reason, nextAttempt)
+	return err
+}
+
+// MarkDead records the last failed attempt and moves the job to the dead
+// letters, which are kept for inspection but never retried
+func (r *EmailQueueRepository) MarkDead(ctx context.Context, id int64, reason string) error {
+	_, err := r.conn.DB.ExecContext(ctx, `
+		UPDATE email_queue
+		SET status = 'dead', attempts = attempts + 1, last_error = $2, finished_at = NOW()
+		WHERE id = $1
+	`, id, reason)
+	return err
+}
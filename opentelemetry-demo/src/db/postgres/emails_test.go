@@ -0,0 +1,136 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnqueueEmail(t *testing.T) {
+	t.Run("StoresPendingJob", func(t *testing.T) {
+		// Create mock DB
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Error creating mock DB: %v", err)
+		}
+		defer db.Close()
+
+		// Set up expectations
+		now := time.Now()
+		mock.ExpectQuery("INSERT INTO email_queue").
+			WithArgs("order-1", "someone@example.com", []byte("payload"), `{"traceparent":"tp"}`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(int64(4), now))
+
+		// Create repository
+		repo := NewEmailQueueRepository(&Connection{DB: db})
+
+		// Test queueing an email
+		job := &EmailJob{
+			OrderID: "order-1",
+			Email:   "someone@example.com",
+			Payload: []byte("payload"),
+			Headers: map[string]string{"traceparent": "tp"},
+		}
+		err = repo.Enqueue(context.Background(), job)
+
+		// Assertions
+		assert.NoError(t, err)
+		assert.Equal(t, int64(4), job.ID)
+		assert.Equal(t, EmailPending, job.Status)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("DatabaseError", func(t *testing.T) {
+		// Create mock DB
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Error creating mock DB: %v", err)
+		}
+		defer db.Close()
+
+		// Set up expectations with a database error
+		dbErr := errors.New("database error")
+		mock.ExpectQuery("INSERT INTO email_queue").
+			WillReturnError(dbErr)
+
+		// Create repository
+		repo := NewEmailQueueRepository(&Connection{DB: db})
+
+		// Test queueing with a database error
+		err = repo.Enqueue(context.Background(), &EmailJob{OrderID: "order-1"})
+
+		// Assertions
+		assert.ErrorIs(t, err, dbErr)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestClaimDueEmails(t *testing.T) {
+	// Create mock DB
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	// Set up expectations
+	now := time.Now()
+	rows := sqlmock.NewRows([]string{"id", "order_id", "email", "payload", "headers", "attempts", "last_error", "created_at"}).
+		AddRow(int64(2), "order-2", "b@example.com", []byte("b"), []byte(`{}`), 0, nil, now).
+		AddRow(int64(1), "order-1", "a@example.com", []byte("a"), []byte(`{"traceparent":"tp"}`), 3, "timeout", now)
+	mock.ExpectQuery("UPDATE email_queue").
+		WithArgs(10, float64(30)).
+		WillReturnRows(rows)
+
+	// Create repository
+	repo := NewEmailQueueRepository(&Connection{DB: db})
+
+	// Test claiming due jobs
+	jobs, err := repo.ClaimDue(context.Background(), 10, 30*time.Second)
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 2)
+	assert.Equal(t, int64(1), jobs[0].ID)
+	assert.Equal(t, "a@example.com", jobs[0].Email)
+	assert.Equal(t, map[string]string{"traceparent": "tp"}, jobs[0].Headers)
+	assert.Equal(t, 3, jobs[0].Attempts)
+	assert.Equal(t, "timeout", jobs[0].LastError)
+	assert.Equal(t, int64(2), jobs[1].ID)
+	assert.Equal(t, "", jobs[1].LastError)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMarkEmailOutcomes(t *testing.T) {
+	// Create mock DB
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	// Set up expectations
+	next := time.Now().Add(time.Minute)
+	mock.ExpectExec("UPDATE email_queue SET status = 'sent'").
+		WithArgs(int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE email_queue").
+		WithArgs(int64(2), "email service unavailable", next).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("SET status = 'dead'").
+		WithArgs(int64(3), "email service unavailable").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// Create repository
+	repo := NewEmailQueueRepository(&Connection{DB: db})
+
+	// Test recording the outcome of send attempts
+	assert.NoError(t, repo.MarkSent(context.Background(), 1))
+	assert.NoError(t, repo.MarkFailed(context.Background(), 2, next, "email service unavailable"))
+	assert.NoError(t, repo.MarkDead(context.Background(), 3, "email service unavailable"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,527 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Order statuses
+const (
+	// OrderStatusPlaced is the status of an order that has been paid and shipped
+	OrderStatusPlaced = "placed"
+	// OrderStatusCancelling is the status of an order whose cancellation is
+	// in progress
+	OrderStatusCancelling = "cancelling"
+	// OrderStatusCancelled is the status of an order that has been cancelled
+	// and refunded
+	OrderStatusCancelled = "cancelled"
+)
+
+// Money represents an amount of money in units and nano units of a currency
+type Money struct {
+	CurrencyCode string
+	Units        int64
+	Nanos        int32
+}
+
+// Address represents a shipping address
+type Address struct {
+	StreetAddress string
+	City          string
+	State         string
+	Country       string
+	ZipCode       string
+}
+
+// OrderItem represents a line item of an order
+type OrderItem struct {
+	ProductID string
+	Quantity  int32
+	Cost      Money
+}
+
+// OrderAdjustment represents a promotion applied to an order. Its amount is
+// negative for a discount.
+type OrderAdjustment struct {
+	PromotionID string
+	Description string
+	PromoCode   string
+	Amount      Money
+}
+
+// OrderTax represents a tax charged on an order. Rate is the percentage as
+// written in the tax table, for example "7.25".
+type OrderTax struct {
+	TaxID         string
+	Description   string
+	Rate          string
+	TaxableAmount Money
+	Amount        Money
+}
+
+// Order represents an order placed through the checkout service
+type Order struct {
+	ID                 string
+	UserID             string
+	Email              string
+	Status             string
+	Total              Money
+	ShippingCost       Money
+	ShippingTrackingID string
+	TransactionID      string
+	ShippingAddress    Address
+	Items              []OrderItem
+	Adjustments        []OrderAdjustment
+	Taxes              []OrderTax
+	CancelReason       string
+	CancelledAt        *time.Time
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+}
+
+// OrderCursor identifies a position in the list of a user's orders, which
+// are ordered from newest to oldest
+type OrderCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// OrderRepository provides database operations for orders
+type OrderRepository struct {
+	conn *Connection
+}
+
+// NewOrderRepository creates a new OrderRepository
+func NewOrderRepository(conn *Connection) *OrderRepository {
+	return &OrderRepository{conn: conn}
+}
+
+const orderColumns = `id, user_id, email, status, currency_code,
+	total_units, total_nanos, shipping_cost_units, shipping_cost_nanos,
+	shipping_tracking_id, transaction_id,
+	street_address, city, state, country, zip_code,
+	cancel_reason, cancelled_at, created_at, updated_at`
+
+// CreateOrder stores an order with its items, adjustments and taxes in a
+// single transaction. Events
+// passed along are written to the outbox in the same transaction, so they
+// are published if and only if the order is stored.
+func (r *OrderRepository) CreateOrder(ctx context.Context, order *Order, events ...*OutboxEvent) error {
+	tx, err := r.conn.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := insertOrder(ctx, tx, order, false); err != nil {
+		return err
+	}
+	for _, event := range events {
+		if err := insertOutboxEvent(ctx, tx, event); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit order %s: %w", order.ID, err)
+	}
+	return nil
+}
+
+// RecordOrder stores an order with its items, adjustments and taxes unless an order with the same ID
+// already exists, in which case it is left untouched. It reports whether the
+// order was stored, so consumers of order events can handle redelivered
+// events and orders that the checkout service stored itself.
+func (r *OrderRepository) RecordOrder(ctx context.Context, order *Order) (bool, error) {
+	tx, err := r.conn.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	inserted, err := insertOrder(ctx, tx, order, true)
+	if err != nil || !inserted {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit order %s: %w", order.ID, err)
+	}
+	return true, nil
+}
+
+// insertOrder inserts an order with its items, adjustments and taxes. With ignoreExisting, an order
+// whose ID is already taken is skipped and false is returned.
+func insertOrder(ctx context.Context, tx *sql.Tx, order *Order, ignoreExisting bool) (bool, error) {
+	if order.Status == "" {
+		order.Status = OrderStatusPlaced
+	}
+	onConflict := ""
+	if ignoreExisting {
+		onConflict = "ON CONFLICT (id) DO NOTHING"
+	}
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO orders (id, user_id, email, status, currency_code,
+			total_units, total_nanos, shipping_cost_units, shipping_cost_nanos,
+			shipping_tracking_id, transaction_id,
+			street_address, city, state, country, zip_code,
+			created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, NOW(), NOW())
+		`+onConflict+`
+		RETURNING created_at, updated_at
+	`,
+		order.ID, order.UserID, order.Email, order.Status, order.Total.CurrencyCode,
+		order.Total.Units, order.Total.Nanos, order.ShippingCost.Units, order.ShippingCost.Nanos,
+		order.ShippingTrackingID, order.TransactionID,
+		order.ShippingAddress.StreetAddress, order.ShippingAddress.City, order.ShippingAddress.State,
+		order.ShippingAddress.Country, order.ShippingAddress.ZipCode,
+	).Scan(&order.CreatedAt, &order.UpdatedAt)
+	if ignoreExisting && errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to insert order %s: %w", order.ID, err)
+	}
+
+	for _, item := range order.Items {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO order_items (order_id, product_id, quantity, cost_currency_code, cost_units, cost_nanos)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, order.ID, item.ProductID, item.Quantity, item.Cost.CurrencyCode, item.Cost.Units, item.Cost.Nanos)
+		if err != nil {
+			return false, fmt.Errorf("failed to insert item %s of order %s: %w", item.ProductID, order.ID, err)
+		}
+	}
+	for _, adj := range order.Adjustments {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO order_adjustments (order_id, promotion_id, description, promo_code,
+				amount_currency_code, amount_units, amount_nanos)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`, order.ID, adj.PromotionID, adj.Description, adj.PromoCode,
+			adj.Amount.CurrencyCode, adj.Amount.Units, adj.Amount.Nanos)
+		if err != nil {
+			return false, fmt.Errorf("failed to insert adjustment %s of order %s: %w", adj.PromotionID, order.ID, err)
+		}
+	}
+	for _, line := range order.Taxes {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO order_taxes (order_id, tax_id, description, rate, currency_code,
+				taxable_units, taxable_nanos, amount_units, amount_nanos)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		`, order.ID, line.TaxID, line.Description, line.Rate, line.Amount.CurrencyCode,
+			line.TaxableAmount.Units, line.TaxableAmount.Nanos, line.Amount.Units, line.Amount.Nanos)
+		if err != nil {
+			return false, fmt.Errorf("failed to insert tax %s of order %s: %w", line.TaxID, order.ID, err)
+		}
+	}
+	return true, nil
+}
+
+// GetOrder retrieves an order with its items, adjustments and taxes by ID
+func (r *OrderRepository) GetOrder(ctx context.Context, id string) (*Order, error) {
+	row := r.conn.DB.QueryRowContext(ctx, "SELECT "+orderColumns+" FROM orders WHERE id = $1", id)
+	order, err := scanOrder(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // Order not found
+		}
+		return nil, err
+	}
+
+	if err := r.loadLines(ctx, []*Order{order}); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// CancelClaim is an order claimed for cancellation with BeginCancel. It is
+// passed back to the other cancellation methods, which fail once the claim
+// has been taken over by another call.
+type CancelClaim struct {
+	// ClaimedAt is when the order was claimed; it tells claims apart.
+	ClaimedAt time.Time
+	// Refunded reports whether an earlier claim that expired had already
+	// refunded the order.
+	Refunded bool
+}
+
+// BeginCancel claims a placed order for cancellation by moving it to
+// OrderStatusCancelling. A claim older than lease is assumed to belong to a
+// call that died and is taken over. It returns nil when the order does not
+// exist or cannot be claimed, for example because another call is still
+// cancelling it.
+func (r *OrderRepository) BeginCancel(ctx context.Context, id string, lease time.Duration) (*CancelClaim, error) {
+	claim := new(CancelClaim)
+	err := r.conn.DB.QueryRowContext(ctx, `
+		UPDATE orders SET status = $2, cancel_claimed_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND (status = $3
+			OR (status = $2 AND cancel_claimed_at < NOW() - make_interval(secs => $4)))
+		RETURNING cancel_claimed_at, refunded_at IS NOT NULL
+	`, id, OrderStatusCancelling, OrderStatusPlaced, lease.Seconds()).Scan(&claim.ClaimedAt, &claim.Refunded)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim order %s for cancellation: %w", id, err)
+	}
+	return claim, nil
+}
+
+// RecordRefund records the refund of an order claimed with BeginCancel, so a
+// call that takes the claim over does not refund the order again.
+func (r *OrderRepository) RecordRefund(ctx context.Context, id string, claim *CancelClaim, refundID string) error {
+	result, err := r.conn.DB.ExecContext(ctx, `
+		UPDATE orders SET refund_id = $3, refunded_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = $4 AND cancel_claimed_at = $2
+	`, id, claim.ClaimedAt, refundID, OrderStatusCancelling)
+	if err != nil {
+		return fmt.Errorf("failed to record refund of order %s: %w", id, err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n != 1 {
+		return fmt.Errorf("failed to record refund of order %s: claim was taken over", id)
+	}
+	return nil
+}
+
+// CompleteCancel marks an order claimed with BeginCancel as cancelled. Events
+// passed along are written to the outbox in the same transaction.
+func (r *OrderRepository) CompleteCancel(ctx context.Context, id string, claim *CancelClaim, reason string, events ...*OutboxEvent) error {
+	tx, err := r.conn.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE orders SET status = $3, cancel_reason = $4, cancelled_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = $5 AND cancel_claimed_at = $2
+	`, id, claim.ClaimedAt, OrderStatusCancelled, reason, OrderStatusCancelling)
+	if err != nil {
+		return fmt.Errorf("failed to cancel order %s: %w", id, err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n != 1 {
+		return fmt.Errorf("failed to cancel order %s: order is not claimed by this call", id)
+	}
+	for _, event := range events {
+		if err := insertOutboxEvent(ctx, tx, event); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit cancellation of order %s: %w", id, err)
+	}
+	return nil
+}
+
+// AbandonCancel releases an order claimed with BeginCancel, so it is placed
+// again and can be cancelled by a later call. It does nothing once the claim
+// has been taken over.
+func (r *OrderRepository) AbandonCancel(ctx context.Context, id string, claim *CancelClaim) error {
+	_, err := r.conn.DB.ExecContext(ctx, `
+		UPDATE orders SET status = $3, cancel_claimed_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = $4 AND cancel_claimed_at = $2
+	`, id, claim.ClaimedAt, OrderStatusPlaced, OrderStatusCancelling)
+	if err != nil {
+		return fmt.Errorf("failed to release order %s: %w", id, err)
+	}
+	return nil
+}
+
+// ListOrdersForUser retrieves up to limit orders of a user, newest first,
+// starting after the given cursor. It returns the cursor of the next page,
+// or nil when there are no more orders.
+func (r *OrderRepository) ListOrdersForUser(ctx context.Context, userID string, limit int, after *OrderCursor) ([]*Order, *OrderCursor, error) {
+	query := "SELECT " + orderColumns + " FROM orders WHERE user_id = $1"
+	args := []interface{}{userID}
+	if after != nil {
+		query += " AND (created_at, id) < ($2, $3)"
+		args = append(args, after.CreatedAt, after.ID)
+	}
+	// Fetch one extra row to know whether there is another page.
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT %d", limit+1)
+
+	rows, err := r.conn.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var orders []*Order
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var next *OrderCursor
+	if len(orders) > limit {
+		orders = orders[:limit]
+		last := orders[limit-1]
+		next = &OrderCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+
+	if err := r.loadLines(ctx, orders); err != nil {
+		return nil, nil, err
+	}
+	return orders, next, nil
+}
+
+// loadLines fills in the items, adjustments and taxes of the given orders,
+// with a single query for each
+func (r *OrderRepository) loadLines(ctx context.Context, orders []*Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	byID := make(map[string]*Order, len(orders))
+	ids := make([]string, 0, len(orders))
+	for _, o := range orders {
+		byID[o.ID] = o
+		ids = append(ids, o.ID)
+	}
+
+	if err := r.loadItems(ctx, byID, ids); err != nil {
+		return err
+	}
+	if err := r.loadAdjustments(ctx, byID, ids); err != nil {
+		return err
+	}
+	return r.loadTaxes(ctx, byID, ids)
+}
+
+func (r *OrderRepository) loadItems(ctx context.Context, byID map[string]*Order, ids []string) error {
+	rows, err := r.conn.DB.QueryContext(ctx, `
+		SELECT order_id, product_id, quantity, cost_currency_code, cost_units, cost_nanos
+		FROM order_items
+		WHERE order_id = ANY($1)
+		ORDER BY id
+	`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var orderID string
+		var item OrderItem
+		if err := rows.Scan(&orderID, &item.ProductID, &item.Quantity,
+			&item.Cost.CurrencyCode, &item.Cost.Units, &item.Cost.Nanos); err != nil {
+			return err
+		}
+		if o, ok := byID[orderID]; ok {
+			o.Items = append(o.Items, item)
+		}
+	}
+	return rows.Err()
+}
+
+func (r *OrderRepository) loadAdjustments(ctx context.Context, byID map[string]*Order, ids []string) error {
+	rows, err := r.conn.DB.QueryContext(ctx, `
+		SELECT order_id, promotion_id, description, promo_code,
+			amount_currency_code, amount_units, amount_nanos
+		FROM order_adjustments
+		WHERE order_id = ANY($1)
+		ORDER BY id
+	`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var orderID string
+		var adj OrderAdjustment
+		var description, promoCode sql.NullString
+		if err := rows.Scan(&orderID, &adj.PromotionID, &description, &promoCode,
+			&adj.Amount.CurrencyCode, &adj.Amount.Units, &adj.Amount.Nanos); err != nil {
+			return err
+		}
+		adj.Description = description.String
+		adj.PromoCode = promoCode.String
+		if o, ok := byID[orderID]; ok {
+			o.Adjustments = append(o.Adjustments, adj)
+		}
+	}
+	return rows.Err()
+}
+
+func (r *OrderRepository) loadTaxes(ctx context.Context, byID map[string]*Order, ids []string) error {
+	rows, err := r.conn.DB.QueryContext(ctx, `
+		SELECT order_id, tax_id, description, rate, currency_code,
+			taxable_units, taxable_nanos, amount_units, amount_nanos
+		FROM order_taxes
+		WHERE order_id = ANY($1)
+		ORDER BY id
+	`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var orderID string
+		var line OrderTax
+		var description sql.NullString
+		if err := rows.Scan(&orderID, &line.TaxID, &description, &line.Rate, &line.Amount.CurrencyCode,
+			&line.TaxableAmount.Units, &line.TaxableAmount.Nanos, &line.Amount.Units, &line.Amount.Nanos); err != nil {
+			return err
+		}
+		line.Description = description.String
+		line.TaxableAmount.CurrencyCode = line.Amount.CurrencyCode
+		if o, ok := byID[orderID]; ok {
+			o.Taxes = append(o.Taxes, line)
+		}
+	}
+	return rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanOrder(row rowScanner) (*Order, error) {
+	var o Order
+	var email, trackingID, transactionID sql.NullString
+	var street, city, state, country, zip sql.NullString
+	var cancelReason sql.NullString
+	var cancelledAt sql.NullTime
+	err := row.Scan(
+		&o.ID, &o.UserID, &email, &o.Status, &o.Total.CurrencyCode,
+		&o.Total.Units, &o.Total.Nanos, &o.ShippingCost.Units, &o.ShippingCost.Nanos,
+		&trackingID, &transactionID,
+		&street, &city, &state, &country, &zip,
+		&cancelReason, &cancelledAt, &o.CreatedAt, &o.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	o.Email = email.String
+	o.ShippingTrackingID = trackingID.String
+	o.TransactionID = transactionID.String
+	o.CancelReason = cancelReason.String
+	if cancelledAt.Valid {
+		o.CancelledAt = &cancelledAt.Time
+	}
+	o.ShippingAddress = Address{
+		StreetAddress: street.String,
+		City:          city.String,
+		State:         state.String,
+		Country:       country.String,
+		ZipCode:       zip.String,
+	}
+	o.ShippingCost.CurrencyCode = o.Total.CurrencyCode
+	return &o, nil
+}
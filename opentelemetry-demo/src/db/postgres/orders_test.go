@@ -0,0 +1,556 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+var orderRowColumns = []string{
+	"id", "user_id", "email", "status", "currency_code",
+	"total_units", "total_nanos", "shipping_cost_units", "shipping_cost_nanos",
+	"shipping_tracking_id", "transaction_id",
+	"street_address", "city", "state", "country", "zip_code",
+	"cancel_reason", "cancelled_at", "created_at", "updated_at",
+}
+
+var adjustmentRowColumns = []string{
+	"order_id", "promotion_id", "description", "promo_code",
+	"amount_currency_code", "amount_units", "amount_nanos",
+}
+
+var taxRowColumns = []string{
+	"order_id", "tax_id", "description", "rate", "currency_code",
+	"taxable_units", "taxable_nanos", "amount_units", "amount_nanos",
+}
+
+func addOrderRow(rows *sqlmock.Rows, id, userID string, createdAt time.Time) *sqlmock.Rows {
+	return rows.AddRow(id, userID, "user@example.com", OrderStatusPlaced, "USD",
+		int64(42), int32(500000000), int64(8), int32(990000000),
+		"TRACK-1", "TX-1",
+		"1600 Amphitheatre Parkway", "Mountain View", "CA", "United States", "94043",
+		nil, nil, createdAt, createdAt)
+}
+
+func testOrder() *Order {
+	return &Order{
+		ID:                 "order-1",
+		UserID:             "user-1",
+		Email:              "user@example.com",
+		Total:              Money{CurrencyCode: "USD", Units: 42, Nanos: 500000000},
+		ShippingCost:       Money{CurrencyCode: "USD", Units: 8, Nanos: 990000000},
+		ShippingTrackingID: "TRACK-1",
+		TransactionID:      "TX-1",
+		ShippingAddress: Address{
+			StreetAddress: "1600 Amphitheatre Parkway",
+			City:          "Mountain View",
+			State:         "CA",
+			Country:       "United States",
+			ZipCode:       "94043",
+		},
+		Items: []OrderItem{
+			{ProductID: "OLJCESPC7Z", Quantity: 2, Cost: Money{CurrencyCode: "USD", Units: 16, Nanos: 750000000}},
+		},
+		Adjustments: []OrderAdjustment{
+			{PromotionID: "ship-free", Description: "Free shipping", PromoCode: "SHIPFREE", Amount: Money{CurrencyCode: "USD", Units: -8, Nanos: -990000000}},
+		},
+		Taxes: []OrderTax{
+			{TaxID: "us-ca", Description: "California sales tax", Rate: "7.25", TaxableAmount: Money{CurrencyCode: "USD", Units: 33, Nanos: 500000000}, Amount: Money{CurrencyCode: "USD", Units: 2, Nanos: 430000000}},
+		},
+	}
+}
+
+func TestCreateOrder(t *testing.T) {
+	t.Run("SuccessfulCreation", func(t *testing.T) {
+		// Create mock DB
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Error creating mock DB: %v", err)
+		}
+		defer db.Close()
+
+		// Set up expectations: order, items, adjustments and taxes are written
+		// in one transaction
+		now := time.Now()
+		order := testOrder()
+		mock.ExpectBegin()
+		mock.ExpectQuery("INSERT INTO orders").
+			WithArgs(order.ID, order.UserID, order.Email, OrderStatusPlaced, "USD",
+				int64(42), int32(500000000), int64(8), int32(990000000),
+				"TRACK-1", "TX-1",
+				"1600 Amphitheatre Parkway", "Mountain View", "CA", "United States", "94043").
+			WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(now, now))
+		mock.ExpectExec("INSERT INTO order_items").
+			WithArgs(order.ID, "OLJCESPC7Z", int32(2), "USD", int64(16), int32(750000000)).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO order_adjustments").
+			WithArgs(order.ID, "ship-free", "Free shipping", "SHIPFREE", "USD", int64(-8), int32(-990000000)).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO order_taxes").
+			WithArgs(order.ID, "us-ca", "California sales tax", "7.25", "USD", int64(33), int32(500000000), int64(2), int32(430000000)).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		// Create repository
+		repo := NewOrderRepository(&Connection{DB: db})
+
+		// Test order creation
+		err = repo.CreateOrder(context.Background(), order)
+
+		// Assertions
+		assert.NoError(t, err)
+		assert.Equal(t, OrderStatusPlaced, order.Status)
+		assert.Equal(t, now, order.CreatedAt)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ItemInsertFailsRollsBack", func(t *testing.T) {
+		// Create mock DB
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Error creating mock DB: %v", err)
+		}
+		defer db.Close()
+
+		// Set up expectations: the item insert fails and nothing is committed
+		now := time.Now()
+		dbErr := errors.New("database error")
+		mock.ExpectBegin()
+		mock.ExpectQuery("INSERT INTO orders").
+			WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(now, now))
+		mock.ExpectExec("INSERT INTO order_items").
+			WillReturnError(dbErr)
+		mock.ExpectRollback()
+
+		// Create repository
+		repo := NewOrderRepository(&Connection{DB: db})
+
+		// Test order creation with a failing item insert
+		err = repo.CreateOrder(context.Background(), testOrder())
+
+		// Assertions
+		assert.ErrorIs(t, err, dbErr)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRecordOrder(t *testing.T) {
+	t.Run("NewOrder", func(t *testing.T) {
+		// Create mock DB
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Error creating mock DB: %v", err)
+		}
+		defer db.Close()
+
+		// Set up expectations: the order, its items, its adjustments and its
+		// taxes are inserted
+		now := time.Now()
+		mock.ExpectBegin()
+		mock.ExpectQuery("INSERT INTO orders (.+) ON CONFLICT \\(id\\) DO NOTHING").
+			WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(now, now))
+		mock.ExpectExec("INSERT INTO order_items").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO order_adjustments").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO order_taxes").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		// Create repository
+		repo := NewOrderRepository(&Connection{DB: db})
+
+		// Test recording a new order
+		inserted, err := repo.RecordOrder(context.Background(), testOrder())
+
+		// Assertions
+		assert.NoError(t, err)
+		assert.True(t, inserted)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ExistingOrder", func(t *testing.T) {
+		// Create mock DB
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Error creating mock DB: %v", err)
+		}
+		defer db.Close()
+
+		// Set up expectations: the insert is skipped, and neither items nor a
+		// commit follow
+		mock.ExpectBegin()
+		mock.ExpectQuery("INSERT INTO orders (.+) ON CONFLICT \\(id\\) DO NOTHING").
+			WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}))
+		mock.ExpectRollback()
+
+		// Create repository
+		repo := NewOrderRepository(&Connection{DB: db})
+
+		// Test recording an order that is already stored
+		inserted, err := repo.RecordOrder(context.Background(), testOrder())
+
+		// Assertions
+		assert.NoError(t, err)
+		assert.False(t, inserted)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestGetOrder(t *testing.T) {
+	t.Run("ExistingOrder", func(t *testing.T) {
+		// Create mock DB
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Error creating mock DB: %v", err)
+		}
+		defer db.Close()
+
+		// Set up expectations
+		now := time.Now()
+		mock.ExpectQuery("SELECT (.+) FROM orders WHERE id = \\$1").
+			WithArgs("order-1").
+			WillReturnRows(addOrderRow(sqlmock.NewRows(orderRowColumns), "order-1", "user-1", now))
+		mock.ExpectQuery("SELECT (.+) FROM order_items").
+			WithArgs(pq.Array([]string{"order-1"})).
+			WillReturnRows(sqlmock.NewRows([]string{"order_id", "product_id", "quantity", "cost_currency_code", "cost_units", "cost_nanos"}).
+				AddRow("order-1", "OLJCESPC7Z", int32(2), "USD", int64(16), int32(750000000)))
+		mock.ExpectQuery("SELECT (.+) FROM order_adjustments").
+			WithArgs(pq.Array([]string{"order-1"})).
+			WillReturnRows(sqlmock.NewRows(adjustmentRowColumns).
+				AddRow("order-1", "telescopes-10", "10% off telescopes", nil, "USD", int64(-3), int32(-350000000)))
+		mock.ExpectQuery("SELECT (.+) FROM order_taxes").
+			WithArgs(pq.Array([]string{"order-1"})).
+			WillReturnRows(sqlmock.NewRows(taxRowColumns).
+				AddRow("order-1", "us-ca", "California sales tax", "7.25", "USD", int64(30), int32(150000000), int64(2), int32(190000000)))
+
+		// Create repository
+		repo := NewOrderRepository(&Connection{DB: db})
+
+		// Test retrieving an existing order
+		order, err := repo.GetOrder(context.Background(), "order-1")
+
+		// Assertions
+		assert.NoError(t, err)
+		assert.NotNil(t, order)
+		assert.Equal(t, "user-1", order.UserID)
+		assert.Equal(t, Money{CurrencyCode: "USD", Units: 8, Nanos: 990000000}, order.ShippingCost)
+		assert.Equal(t, "94043", order.ShippingAddress.ZipCode)
+		assert.Nil(t, order.CancelledAt)
+		assert.Equal(t, []OrderItem{{ProductID: "OLJCESPC7Z", Quantity: 2, Cost: Money{CurrencyCode: "USD", Units: 16, Nanos: 750000000}}}, order.Items)
+		assert.Equal(t, []OrderAdjustment{{PromotionID: "telescopes-10", Description: "10% off telescopes", Amount: Money{CurrencyCode: "USD", Units: -3, Nanos: -350000000}}}, order.Adjustments)
+		assert.Equal(t, []OrderTax{{TaxID: "us-ca", Description: "California sales tax", Rate: "7.25", TaxableAmount: Money{CurrencyCode: "USD", Units: 30, Nanos: 150000000}, Amount: Money{CurrencyCode: "USD", Units: 2, Nanos: 190000000}}}, order.Taxes)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("NonExistentOrder", func(t *testing.T) {
+		// Create mock DB
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Error creating mock DB: %v", err)
+		}
+		defer db.Close()
+
+		// Set up expectations with no rows found
+		mock.ExpectQuery("SELECT (.+) FROM orders WHERE id = \\$1").
+			WithArgs("missing").
+			WillReturnError(sql.ErrNoRows)
+
+		// Create repository
+		repo := NewOrderRepository(&Connection{DB: db})
+
+		// Test retrieving a non-existent order
+		order, err := repo.GetOrder(context.Background(), "missing")
+
+		// Assertions
+		assert.NoError(t, err) // No error for non-existent order
+		assert.Nil(t, order)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestCancelOrder(t *testing.T) {
+	t.Run("ClaimRefundAndComplete", func(t *testing.T) {
+		// Create mock DB
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Error creating mock DB: %v", err)
+		}
+		defer db.Close()
+
+		// Set up expectations: the order is claimed, refunded, then cancelled
+		// together with its event
+		now := time.Now()
+		mock.ExpectQuery("UPDATE orders SET status = \\$2, cancel_claimed_at = NOW\\(\\)").
+			WithArgs("order-1", OrderStatusCancelling, OrderStatusPlaced, float64(60)).
+			WillReturnRows(sqlmock.NewRows([]string{"cancel_claimed_at", "refunded"}).AddRow(now, false))
+		mock.ExpectExec("UPDATE orders SET refund_id = \\$3").
+			WithArgs("order-1", now, "REFUND-1", OrderStatusCancelling).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE orders SET status = \\$3, cancel_reason = \\$4").
+			WithArgs("order-1", now, OrderStatusCancelled, "changed my mind", OrderStatusCancelling).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("INSERT INTO outbox_events").
+			WithArgs("order-1", "order_cancelled", "order-1", []byte("payload"), "{}").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(int64(7), now))
+		mock.ExpectCommit()
+
+		// Create repository
+		repo := NewOrderRepository(&Connection{DB: db})
+
+		// Test cancelling an order
+		claim, err := repo.BeginCancel(context.Background(), "order-1", time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, &CancelClaim{ClaimedAt: now}, claim)
+		err = repo.RecordRefund(context.Background(), "order-1", claim, "REFUND-1")
+		assert.NoError(t, err)
+		event := &OutboxEvent{AggregateID: "order-1", Topic: "order_cancelled", Key: "order-1", Payload: []byte("payload")}
+		err = repo.CompleteCancel(context.Background(), "order-1", claim, "changed my mind", event)
+
+		// Assertions
+		assert.NoError(t, err)
+		assert.Equal(t, int64(7), event.ID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("NotClaimable", func(t *testing.T) {
+		// Create mock DB
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Error creating mock DB: %v", err)
+		}
+		defer db.Close()
+
+		// Set up expectations: no placed order or expired claim matches
+		mock.ExpectQuery("UPDATE orders SET status = \\$2, cancel_claimed_at = NOW\\(\\)").
+			WithArgs("order-1", OrderStatusCancelling, OrderStatusPlaced, float64(60)).
+			WillReturnRows(sqlmock.NewRows([]string{"cancel_claimed_at", "refunded"}))
+
+		// Create repository
+		repo := NewOrderRepository(&Connection{DB: db})
+
+		// Test claiming an order that is already being cancelled
+		claim, err := repo.BeginCancel(context.Background(), "order-1", time.Minute)
+
+		// Assertions
+		assert.NoError(t, err)
+		assert.Nil(t, claim)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("TakeOverRefunded", func(t *testing.T) {
+		// Create mock DB
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Error creating mock DB: %v", err)
+		}
+		defer db.Close()
+
+		// Set up expectations: an expired claim that had refunded the order
+		// is taken over
+		now := time.Now()
+		mock.ExpectQuery("UPDATE orders SET status = \\$2, cancel_claimed_at = NOW\\(\\)").
+			WithArgs("order-1", OrderStatusCancelling, OrderStatusPlaced, float64(60)).
+			WillReturnRows(sqlmock.NewRows([]string{"cancel_claimed_at", "refunded"}).AddRow(now, true))
+
+		// Create repository
+		repo := NewOrderRepository(&Connection{DB: db})
+
+		// Test taking over the claim
+		claim, err := repo.BeginCancel(context.Background(), "order-1", time.Minute)
+
+		// Assertions
+		assert.NoError(t, err)
+		assert.Equal(t, &CancelClaim{ClaimedAt: now, Refunded: true}, claim)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("RecordRefundAfterTakeover", func(t *testing.T) {
+		// Create mock DB
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Error creating mock DB: %v", err)
+		}
+		defer db.Close()
+
+		// Set up expectations: the claim was taken over, so nothing matches
+		mock.ExpectExec("UPDATE orders SET refund_id = \\$3").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		// Create repository
+		repo := NewOrderRepository(&Connection{DB: db})
+
+		// Test recording a refund under a lost claim
+		err = repo.RecordRefund(context.Background(), "order-1", &CancelClaim{ClaimedAt: time.Now()}, "REFUND-1")
+
+		// Assertions
+		assert.Error(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("CompleteWithoutClaimRollsBack", func(t *testing.T) {
+		// Create mock DB
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Error creating mock DB: %v", err)
+		}
+		defer db.Close()
+
+		// Set up expectations: the order is not claimed by the caller, so
+		// nothing is committed
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE orders SET status = \\$3, cancel_reason = \\$4").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		// Create repository
+		repo := NewOrderRepository(&Connection{DB: db})
+
+		// Test completing a cancellation that was not claimed
+		err = repo.CompleteCancel(context.Background(), "order-1", &CancelClaim{ClaimedAt: time.Now()}, "", &OutboxEvent{AggregateID: "order-1"})
+
+		// Assertions
+		assert.Error(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Abandon", func(t *testing.T) {
+		// Create mock DB
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Error creating mock DB: %v", err)
+		}
+		defer db.Close()
+
+		// Set up expectations: the claimed order is placed again
+		claimedAt := time.Now()
+		mock.ExpectExec("UPDATE orders SET status = \\$3, cancel_claimed_at = NULL").
+			WithArgs("order-1", claimedAt, OrderStatusPlaced, OrderStatusCancelling).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		// Create repository
+		repo := NewOrderRepository(&Connection{DB: db})
+
+		// Test releasing a claimed order
+		err = repo.AbandonCancel(context.Background(), "order-1", &CancelClaim{ClaimedAt: claimedAt})
+
+		// Assertions
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestListOrdersForUser(t *testing.T) {
+	t.Run("FirstPageWithMore", func(t *testing.T) {
+		// Create mock DB
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Error creating mock DB: %v", err)
+		}
+		defer db.Close()
+
+		// Set up expectations: one row more than the limit is returned
+		t1 := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+		t2 := t1.Add(-time.Hour)
+		t3 := t2.Add(-time.Hour)
+		rows := sqlmock.NewRows(orderRowColumns)
+		addOrderRow(rows, "order-3", "user-1", t1)
+		addOrderRow(rows, "order-2", "user-1", t2)
+		addOrderRow(rows, "order-1", "user-1", t3)
+		mock.ExpectQuery("SELECT (.+) FROM orders WHERE user_id = \\$1 ORDER BY created_at DESC, id DESC LIMIT 3").
+			WithArgs("user-1").
+			WillReturnRows(rows)
+		mock.ExpectQuery("SELECT (.+) FROM order_items").
+			WithArgs(pq.Array([]string{"order-3", "order-2"})).
+			WillReturnRows(sqlmock.NewRows([]string{"order_id", "product_id", "quantity", "cost_currency_code", "cost_units", "cost_nanos"}))
+		mock.ExpectQuery("SELECT (.+) FROM order_adjustments").
+			WithArgs(pq.Array([]string{"order-3", "order-2"})).
+			WillReturnRows(sqlmock.NewRows(adjustmentRowColumns))
+		mock.ExpectQuery("SELECT (.+) FROM order_taxes").
+			WithArgs(pq.Array([]string{"order-3", "order-2"})).
+			WillReturnRows(sqlmock.NewRows(taxRowColumns))
+
+		// Create repository
+		repo := NewOrderRepository(&Connection{DB: db})
+
+		// Test listing the first page
+		orders, next, err := repo.ListOrdersForUser(context.Background(), "user-1", 2, nil)
+
+		// Assertions
+		assert.NoError(t, err)
+		assert.Len(t, orders, 2)
+		assert.Equal(t, "order-3", orders[0].ID)
+		assert.Equal(t, &OrderCursor{CreatedAt: t2, ID: "order-2"}, next)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("LastPage", func(t *testing.T) {
+		// Create mock DB
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Error creating mock DB: %v", err)
+		}
+		defer db.Close()
+
+		// Set up expectations: the query continues after the cursor
+		cursor := &OrderCursor{CreatedAt: time.Date(2025, 3, 1, 11, 0, 0, 0, time.UTC), ID: "order-2"}
+		rows := addOrderRow(sqlmock.NewRows(orderRowColumns), "order-1", "user-1", cursor.CreatedAt.Add(-time.Hour))
+		mock.ExpectQuery("SELECT (.+) FROM orders WHERE user_id = \\$1 AND \\(created_at, id\\) < \\(\\$2, \\$3\\)").
+			WithArgs("user-1", cursor.CreatedAt, cursor.ID).
+			WillReturnRows(rows)
+		mock.ExpectQuery("SELECT (.+) FROM order_items").
+			WithArgs(pq.Array([]string{"order-1"})).
+			WillReturnRows(sqlmock.NewRows([]string{"order_id", "product_id", "quantity", "cost_currency_code", "cost_units", "cost_nanos"}))
+		mock.ExpectQuery("SELECT (.+) FROM order_adjustments").
+			WithArgs(pq.Array([]string{"order-1"})).
+			WillReturnRows(sqlmock.NewRows(adjustmentRowColumns))
+		mock.ExpectQuery("SELECT (.+) FROM order_taxes").
+			WithArgs(pq.Array([]string{"order-1"})).
+			WillReturnRows(sqlmock.NewRows(taxRowColumns))
+
+		// Create repository
+		repo := NewOrderRepository(&Connection{DB: db})
+
+		// Test listing the last page
+		orders, next, err := repo.ListOrdersForUser(context.Background(), "user-1", 2, cursor)
+
+		// Assertions
+		assert.NoError(t, err)
+		assert.Len(t, orders, 1)
+		assert.Nil(t, next)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("DatabaseError", func(t *testing.T) {
+		// Create mock DB
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Error creating mock DB: %v", err)
+		}
+		defer db.Close()
+
+		// Set up expectations with a database error
+		dbErr := errors.New("database connection error")
+		mock.ExpectQuery("SELECT (.+) FROM orders").
+			WillReturnError(dbErr)
+
+		// Create repository
+		repo := NewOrderRepository(&Connection{DB: db})
+
+		// Test listing with a database error
+		orders, next, err := repo.ListOrdersForUser(context.Background(), "user-1", 2, nil)
+
+		// Assertions
+		assert.Equal(t, dbErr, err)
+		assert.Nil(t, orders)
+		assert.Nil(t, next)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
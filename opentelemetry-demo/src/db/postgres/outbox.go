@@ -0,0 +1,118 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// OutboxEvent represents a message that is written together with the data
+// it describes and published to Kafka later by a relay
+type OutboxEvent struct {
+	ID          int64
+	AggregateID string
+	Topic       string
+	Key         string
+	Payload     []byte
+	Headers     map[string]string
+	Attempts    int
+	CreatedAt   time.Time
+}
+
+// OutboxRepository provides database operations for the relay that
+// publishes outbox events
+type OutboxRepository struct {
+	conn *Connection
+}
+
+// NewOutboxRepository creates a new OutboxRepository
+func NewOutboxRepository(conn *Connection) *OutboxRepository {
+	return &OutboxRepository{conn: conn}
+}
+
+func insertOutboxEvent(ctx context.Context, tx *sql.Tx, event *OutboxEvent) error {
+	headers := []byte("{}")
+	if event.Headers != nil {
+		var err error
+		if headers, err = json.Marshal(event.Headers); err != nil {
+			return fmt.Errorf("failed to marshal outbox event headers: %w", err)
+		}
+	}
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO outbox_events (aggregate_id, topic, message_key, payload, headers, created_at, next_attempt_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+		RETURNING id, created_at
+	`, event.AggregateID, event.Topic, event.Key, event.Payload, string(headers)).Scan(&event.ID, &event.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert outbox event for %s: %w", event.AggregateID, err)
+	}
+	return nil
+}
+
+// ClaimPending claims up to limit undelivered events that are due, oldest
+// first. A claimed event is hidden from other relays for the lease duration,
+// so it is published again if the relay dies before marking it delivered.
+func (r *OutboxRepository) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]*OutboxEvent, error) {
+	rows, err := r.conn.DB.QueryContext(ctx, `
+		UPDATE outbox_events
+		SET next_attempt_at = NOW() + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT id FROM outbox_events
+			WHERE delivered_at IS NULL AND next_attempt_at <= NOW()
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, aggregate_id, topic, message_key, payload, headers, attempts, created_at
+	`, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*OutboxEvent
+	for rows.Next() {
+		var e OutboxEvent
+		var key sql.NullString
+		var headers []byte
+		if err := rows.Scan(&e.ID, &e.AggregateID, &e.Topic, &key, &e.Payload, &headers, &e.Attempts, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Key = key.String
+		if err := json.Unmarshal(headers, &e.Headers); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal headers of outbox event %d: %w", e.ID, err)
+		}
+		events = append(events, &e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// UPDATE ... RETURNING does not keep the order of the subquery
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].ID < events[j].ID
+	})
+	return events, nil
+}
+
+// MarkDelivered records that the broker acknowledged an event
+func (r *OutboxRepository) MarkDelivered(ctx context.Context, id int64) error {
+	_, err := r.conn.DB.ExecContext(ctx,
+		"UPDATE outbox_events SET delivered_at = NOW(), last_error = NULL WHERE id = $1",
+		id,
+	)
+	return err
+}
+
+// MarkFailed records a failed publish attempt and when to try again
+func (r *OutboxRepository) MarkFailed(ctx context.Context, id int64, nextAttempt time.Time, reason string) error {
+	_, err := r.conn.DB.ExecContext(ctx, `
+		UPDATE outbox_events
+		SET attempts = attempts + 1, last_error = $2, next_attempt_at = $3
+		WHERE id = $1
+	`, id, reason, nextAttempt)
+	return err
+}
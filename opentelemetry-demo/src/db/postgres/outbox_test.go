@@ -0,0 +1,179 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateOrderWithOutboxEvents(t *testing.T) {
+	t.Run("EventsWrittenInSameTransaction", func(t *testing.T) {
+		// Create mock DB
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Error creating mock DB: %v", err)
+		}
+		defer db.Close()
+
+		// Set up expectations: order, items and the event share one transaction
+		now := time.Now()
+		event := &OutboxEvent{
+			AggregateID: "order-1",
+			Topic:       "orders",
+			Key:         "order-1",
+			Payload:     []byte("payload"),
+			Headers:     map[string]string{"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"},
+		}
+		mock.ExpectBegin()
+		mock.ExpectQuery("INSERT INTO orders").
+			WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(now, now))
+		mock.ExpectExec("INSERT INTO order_items").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO order_adjustments").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO order_taxes").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery("INSERT INTO outbox_events").
+			WithArgs("order-1", "orders", "order-1", []byte("payload"),
+				`{"traceparent":"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(int64(7), now))
+		mock.ExpectCommit()
+
+		// Create repository
+		repo := NewOrderRepository(&Connection{DB: db})
+
+		// Test order creation with an outbox event
+		err = repo.CreateOrder(context.Background(), testOrder(), event)
+
+		// Assertions
+		assert.NoError(t, err)
+		assert.Equal(t, int64(7), event.ID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("EventInsertFailsRollsBackOrder", func(t *testing.T) {
+		// Create mock DB
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Error creating mock DB: %v", err)
+		}
+		defer db.Close()
+
+		// Set up expectations: the event insert fails and the order is not committed
+		now := time.Now()
+		dbErr := errors.New("database error")
+		mock.ExpectBegin()
+		mock.ExpectQuery("INSERT INTO orders").
+			WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(now, now))
+		mock.ExpectExec("INSERT INTO order_items").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO order_adjustments").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO order_taxes").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery("INSERT INTO outbox_events").
+			WillReturnError(dbErr)
+		mock.ExpectRollback()
+
+		// Create repository
+		repo := NewOrderRepository(&Connection{DB: db})
+
+		// Test order creation with a failing event insert
+		err = repo.CreateOrder(context.Background(), testOrder(), &OutboxEvent{AggregateID: "order-1", Topic: "orders"})
+
+		// Assertions
+		assert.ErrorIs(t, err, dbErr)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestClaimPending(t *testing.T) {
+	t.Run("ReturnsEventsOldestFirst", func(t *testing.T) {
+		// Create mock DB
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Error creating mock DB: %v", err)
+		}
+		defer db.Close()
+
+		// Set up expectations
+		now := time.Now()
+		rows := sqlmock.NewRows([]string{"id", "aggregate_id", "topic", "message_key", "payload", "headers", "attempts", "created_at"}).
+			AddRow(int64(2), "order-2", "orders", "order-2", []byte("b"), []byte(`{}`), 0, now).
+			AddRow(int64(1), "order-1", "orders", nil, []byte("a"), []byte(`{"traceparent":"tp"}`), 3, now)
+		mock.ExpectQuery("UPDATE outbox_events").
+			WithArgs(10, float64(30)).
+			WillReturnRows(rows)
+
+		// Create repository
+		repo := NewOutboxRepository(&Connection{DB: db})
+
+		// Test claiming pending events
+		events, err := repo.ClaimPending(context.Background(), 10, 30*time.Second)
+
+		// Assertions
+		assert.NoError(t, err)
+		assert.Len(t, events, 2)
+		assert.Equal(t, int64(1), events[0].ID)
+		assert.Equal(t, "", events[0].Key)
+		assert.Equal(t, map[string]string{"traceparent": "tp"}, events[0].Headers)
+		assert.Equal(t, 3, events[0].Attempts)
+		assert.Equal(t, int64(2), events[1].ID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("DatabaseError", func(t *testing.T) {
+		// Create mock DB
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Error creating mock DB: %v", err)
+		}
+		defer db.Close()
+
+		// Set up expectations with a database error
+		dbErr := errors.New("database connection error")
+		mock.ExpectQuery("UPDATE outbox_events").
+			WillReturnError(dbErr)
+
+		// Create repository
+		repo := NewOutboxRepository(&Connection{DB: db})
+
+		// Test claiming with a database error
+		events, err := repo.ClaimPending(context.Background(), 10, 30*time.Second)
+
+		// Assertions
+		assert.Equal(t, dbErr, err)
+		assert.Nil(t, events)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestMarkDeliveredAndFailed(t *testing.T) {
+	// Create mock DB
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	// Set up expectations
+	next := time.Now().Add(time.Minute)
+	mock.ExpectExec("UPDATE outbox_events SET delivered_at = NOW\\(\\)").
+		WithArgs(int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE outbox_events").
+		WithArgs(int64(2), "broker unavailable", next).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// Create repository
+	repo := NewOutboxRepository(&Connection{DB: db})
+
+	// Test recording the outcome of publish attempts
+	assert.NoError(t, repo.MarkDelivered(context.Background(), 1))
+	assert.NoError(t, repo.MarkFailed(context.Background(), 2, next, "broker unavailable"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
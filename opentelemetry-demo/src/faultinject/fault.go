@@ -0,0 +1,211 @@
+// Package faultinject injects latency, errors and aborted calls into gRPC
+// clients and servers, driven by OpenFeature flags. Chaos scenarios are
+// described entirely by the flag values, so a new one only needs a new
+// flag variant.
+package faultinject
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Side restricts a fault to the client or the server end of a call.
+type Side string
+
+const (
+	// Client faults are injected by the client interceptors, before a call
+	// leaves the process.
+	Client Side = "client"
+	// Server faults are injected by the server interceptors, before a call
+	// reaches its handler.
+	Server Side = "server"
+)
+
+// Fault describes one fault and the calls it applies to. A flag value holds
+// a list of them:
+//
+//	{"faults": [{"name": "payment-unreachable",
+//	             "methods": ["/oteldemo.PaymentService/Charge"],
+//	             "code": "UNAVAILABLE"}]}
+type Fault struct {
+	// Name identifies the fault in spans and logs.
+	Name string `json:"name"`
+	// Methods are the full gRPC method names the fault applies to, such as
+	// "/oteldemo.ProductCatalogService/GetProduct". "/oteldemo.CartService/*"
+	// matches every method of a service and "*" every method. Empty matches
+	// every method.
+	Methods []string `json:"methods"`
+	// Side restricts the fault to client or server interceptors; empty
+	// applies it to both.
+	Side Side `json:"side"`
+	// Match restricts the fault to requests whose fields have the given
+	// values. Keys are proto field names, with dots for nested messages, such
+	// as "id" or "address.country"; values are compared to the field's text
+	// form, enums by name.
+	Match map[string]string `json:"match"`
+	// Rate is the share of matching calls that get the fault, between 0 and
+	// 1. Unset means every call.
+	Rate *float64 `json:"rate"`
+	// Delay holds the call for that long, such as "1.5s", before it goes on
+	// or fails.
+	Delay Duration `json:"delay"`
+	// Code fails the call with that status code, such as "UNAVAILABLE".
+	// Unset, or OK, only delays the call.
+	Code codes.Code `json:"code"`
+	// Message is the status message of the failed call.
+	Message string `json:"message"`
+	// Abort drops the call as if the connection broke: it fails with
+	// codes.Unavailable. A stream is dropped after AbortAfter messages.
+	Abort      bool `json:"abort"`
+	AbortAfter int  `json:"abort_after"`
+}
+
+// Duration is a time.Duration written as a string in JSON, such as "250ms".
+type Duration time.Duration
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"1s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// config is the value of a fault flag.
+type config struct {
+	Faults []Fault `json:"faults"`
+}
+
+// parse decodes the value of a fault flag, as returned by the OpenFeature
+// client, and validates its faults.
+func parse(value any) ([]Fault, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var cfg config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	var errs []error
+	for i, f := range cfg.Faults {
+		if err := f.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("faults[%d] %q: %w", i, f.Name, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return cfg.Faults, nil
+}
+
+func (f *Fault) validate() error {
+	var errs []error
+	if f.Side != "" && f.Side != Client && f.Side != Server {
+		errs = append(errs, fmt.Errorf("unknown side %q", f.Side))
+	}
+	if f.Rate != nil && (*f.Rate < 0 || *f.Rate > 1) {
+		errs = append(errs, fmt.Errorf("rate must be between 0 and 1, got %v", *f.Rate))
+	}
+	if f.Delay < 0 {
+		errs = append(errs, errors.New("delay must not be negative"))
+	}
+	if f.AbortAfter < 0 {
+		errs = append(errs, errors.New("abort_after must not be negative"))
+	}
+	if f.Delay == 0 && f.Code == codes.OK && !f.Abort {
+		errs = append(errs, errors.New("needs a delay, a code or abort"))
+	}
+	return errors.Join(errs...)
+}
+
+// appliesTo reports whether f applies to method on side.
+func (f *Fault) appliesTo(side Side, method string) bool {
+	if f.Side != "" && f.Side != side {
+		return false
+	}
+	if len(f.Methods) == 0 {
+		return true
+	}
+	method = strings.TrimPrefix(method, "/")
+	for _, m := range f.Methods {
+		m = strings.TrimPrefix(m, "/")
+		if m == "*" || m == method {
+			return true
+		}
+		if service, ok := strings.CutSuffix(m, "/*"); ok && strings.HasPrefix(method, service+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether msg has the field values f asks for. Messages
+// that are not protos match only faults without Match.
+func (f *Fault) matches(msg any) bool {
+	if len(f.Match) == 0 {
+		return true
+	}
+	m, ok := msg.(proto.Message)
+	if !ok {
+		return false
+	}
+	for path, want := range f.Match {
+		got, ok := fieldText(m.ProtoReflect(), path)
+		if !ok || got != want {
+			return false
+		}
+	}
+	return true
+}
+
+// fieldText returns the text form of the singular field at path in m.
+func fieldText(m protoreflect.Message, path string) (string, bool) {
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		fd := m.Descriptor().Fields().ByName(protoreflect.Name(name))
+		if fd == nil || fd.IsList() || fd.IsMap() {
+			return "", false
+		}
+		v := m.Get(fd)
+		if i < len(names)-1 {
+			if fd.Message() == nil {
+				return "", false
+			}
+			m = v.Message()
+			continue
+		}
+		switch fd.Kind() {
+		case protoreflect.EnumKind:
+			if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+				return string(ev.Name()), true
+			}
+			return strconv.Itoa(int(v.Enum())), true
+		case protoreflect.MessageKind, protoreflect.GroupKind:
+			return "", false
+		case protoreflect.BytesKind:
+			return string(v.Bytes()), true
+		}
+		return v.String(), true
+	}
+	return "", false
+}
@@ -0,0 +1,120 @@
+package faultinject
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// flagValue decodes JSON the way flag providers return object values.
+func flagValue(t *testing.T, data string) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal([]byte(data), &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestParse(t *testing.T) {
+	faults, err := parse(flagValue(t, `{"faults": [
+		{"name": "slow", "methods": ["/oteldemo.CartService/*"], "delay": "1.5s", "rate": 0.25},
+		{"name": "down", "side": "client", "code": "UNAVAILABLE", "message": "no route"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(faults) != 2 {
+		t.Fatalf("parse() returned %d faults, want 2", len(faults))
+	}
+	if got := time.Duration(faults[0].Delay); got != 1500*time.Millisecond {
+		t.Errorf("delay = %v, want 1.5s", got)
+	}
+	if got := *faults[0].Rate; got != 0.25 {
+		t.Errorf("rate = %v, want 0.25", got)
+	}
+	if faults[1].Code != codes.Unavailable || faults[1].Side != Client {
+		t.Errorf("faults[1] = %+v, want a client UNAVAILABLE fault", faults[1])
+	}
+
+	faults, err = parse(flagValue(t, `{"faults": []}`))
+	if err != nil || len(faults) != 0 {
+		t.Errorf("parse(no faults) = %v, %v, want none", faults, err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := parse(flagValue(t, `{"faults": [
+		{"name": "noop"},
+		{"name": "bad", "side": "both", "rate": 2, "delay": "-1s"}
+	]}`))
+	if err == nil {
+		t.Fatal("parse() = nil, want an error")
+	}
+	for _, want := range []string{
+		`faults[0] "noop": needs a delay, a code or abort`,
+		`unknown side "both"`,
+		"rate must be between 0 and 1",
+		"delay must not be negative",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+
+	if _, err := parse(flagValue(t, `{"faults": [{"name": "x", "delay": 5}]}`)); err == nil {
+		t.Error("parse() accepted a delay without a unit")
+	}
+}
+
+func TestAppliesTo(t *testing.T) {
+	const method = "/oteldemo.ProductCatalogService/GetProduct"
+	tests := []struct {
+		fault Fault
+		side  Side
+		want  bool
+	}{
+		{Fault{}, Server, true},
+		{Fault{Methods: []string{"*"}}, Client, true},
+		{Fault{Methods: []string{method}}, Server, true},
+		{Fault{Methods: []string{"oteldemo.ProductCatalogService/GetProduct"}}, Server, true},
+		{Fault{Methods: []string{"/oteldemo.ProductCatalogService/*"}}, Server, true},
+		{Fault{Methods: []string{"/oteldemo.ProductCatalog/*"}}, Server, false},
+		{Fault{Methods: []string{"/oteldemo.ProductCatalogService/ListProducts"}}, Server, false},
+		{Fault{Side: Client}, Server, false},
+		{Fault{Side: Server}, Server, true},
+	}
+	for _, tt := range tests {
+		if got := tt.fault.appliesTo(tt.side, method); got != tt.want {
+			t.Errorf("%+v.appliesTo(%s, %s) = %v, want %v", tt.fault, tt.side, method, got, tt.want)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	req := &healthpb.HealthCheckRequest{Service: "cart"}
+	resp := &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}
+	tests := []struct {
+		match map[string]string
+		msg   any
+		want  bool
+	}{
+		{nil, "not a proto", true},
+		{map[string]string{"service": "cart"}, req, true},
+		{map[string]string{"service": "payment"}, req, false},
+		{map[string]string{"missing": "cart"}, req, false},
+		{map[string]string{"service.name": "cart"}, req, false},
+		{map[string]string{"status": "SERVING"}, resp, true},
+		{map[string]string{"service": "cart"}, "not a proto", false},
+	}
+	for _, tt := range tests {
+		f := Fault{Match: tt.match}
+		if got := f.matches(tt.msg); got != tt.want {
+			t.Errorf("matches(%v, %v) = %v, want %v", tt.match, tt.msg, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package faultinject
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/grpc"
+)
+
+// UnaryServerInterceptor injects the server faults that apply to a call
+// before its handler runs.
+func (i *Injector) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if f := i.pick(i.faults(ctx, Server, info.FullMethod), req); f != nil {
+			if err := inject(ctx, f, info.FullMethod, false); err != nil {
+				return nil, err
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// UnaryClientInterceptor injects the client faults that apply to a call
+// before it is sent.
+func (i *Injector) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if f := i.pick(i.faults(ctx, Client, method), req); f != nil {
+			if err := inject(ctx, f, method, false); err != nil {
+				return err
+			}
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamServerInterceptor injects the server faults that apply to a
+// stream. Faults without Match are injected when the stream starts; those
+// with Match when a message that matches is received, failing its RecvMsg.
+// A fault with AbortAfter fails the stream once that many messages were
+// sent.
+func (i *Injector) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		fs, err := i.startStream(ss.Context(), Server, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		if fs == nil {
+			return handler(srv, ss)
+		}
+		err = handler(srv, &serverStream{ServerStream: ss, faults: fs})
+		// Handlers may report a failed send as an error of their own.
+		if fs.aborted() {
+			return abortError(fs.abort)
+		}
+		return err
+	}
+}
+
+// StreamClientInterceptor injects the client faults that apply to a
+// stream. Faults without Match are injected before the stream is opened;
+// those with Match when a message that matches is sent, failing its
+// SendMsg. A fault with AbortAfter cancels the stream once that many
+// messages were received.
+func (i *Injector) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		fs, err := i.startStream(ctx, Client, method)
+		if err != nil {
+			return nil, err
+		}
+		if fs == nil {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+		ctx, cancel := context.WithCancel(ctx)
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		return &clientStream{ClientStream: cs, faults: fs, cancel: cancel}, nil
+	}
+}
+
+// streamFaults holds the faults that still apply to a stream after it
+// started.
+type streamFaults struct {
+	injector *Injector
+	method   string
+	// matched are the faults with Match, checked against every message.
+	matched []Fault
+	// abort, when set, drops the stream after abort.AbortAfter messages.
+	abort *Fault
+
+	mu       sync.Mutex
+	messages int
+}
+
+// startStream injects the faults without Match that apply to a new stream
+// and returns the ones left for its messages, or nil when there are none.
+func (i *Injector) startStream(ctx context.Context, side Side, method string) (*streamFaults, error) {
+	faults := i.faults(ctx, side, method)
+	if len(faults) == 0 {
+		return nil, nil
+	}
+	fs := &streamFaults{injector: i, method: method}
+	var unmatched []Fault
+	for _, f := range faults {
+		if len(f.Match) > 0 {
+			fs.matched = append(fs.matched, f)
+		} else {
+			unmatched = append(unmatched, f)
+		}
+	}
+	if f := i.pick(unmatched, nil); f != nil {
+		if err := inject(ctx, f, method, true); err != nil {
+			return nil, err
+		}
+		if f.Abort && f.AbortAfter > 0 {
+			fs.abort = f
+		}
+	}
+	if fs.matched == nil && fs.abort == nil {
+		return nil, nil
+	}
+	return fs, nil
+}
+
+// message injects the matched faults that apply to msg.
+func (fs *streamFaults) message(ctx context.Context, msg any) error {
+	if f := fs.injector.pick(fs.matched, msg); f != nil {
+		return inject(ctx, f, fs.method, false)
+	}
+	return nil
+}
+
+// count records a message that went through and reports whether the
+// stream is to be dropped now.
+func (fs *streamFaults) count() bool {
+	if fs.abort == nil {
+		return false
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.messages++
+	return fs.messages >= fs.abort.AbortAfter
+}
+
+// aborted reports whether the stream was dropped.
+func (fs *streamFaults) aborted() bool {
+	if fs.abort == nil {
+		return false
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.messages >= fs.abort.AbortAfter
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	faults *streamFaults
+}
+
+func (s *serverStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.faults.message(s.Context(), m)
+}
+
+func (s *serverStream) SendMsg(m any) error {
+	if s.faults.aborted() {
+		return abortError(s.faults.abort)
+	}
+	if err := s.ServerStream.SendMsg(m); err != nil {
+		return err
+	}
+	if s.faults.count() {
+		return abortError(s.faults.abort)
+	}
+	return nil
+}
+
+type clientStream struct {
+	grpc.ClientStream
+	faults *streamFaults
+	cancel context.CancelFunc
+}
+
+func (s *clientStream) SendMsg(m any) error {
+	if err := s.faults.message(s.Context(), m); err != nil {
+		s.cancel()
+		return err
+	}
+	return s.ClientStream.SendMsg(m)
+}
+
+func (s *clientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		s.cancel()
+		return err
+	}
+	if s.faults.count() {
+		s.cancel()
+		return abortError(s.faults.abort)
+	}
+	return nil
+}
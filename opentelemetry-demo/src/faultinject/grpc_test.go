@@ -0,0 +1,241 @@
+package faultinject
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/open-feature/go-sdk/openfeature/memprovider"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeFlags is an Evaluator over fixed flag values.
+type fakeFlags struct {
+	mu     sync.Mutex
+	values map[string]any
+}
+
+func (f *fakeFlags) set(flag string, value any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.values[flag] = value
+}
+
+func (f *fakeFlags) ObjectValue(_ context.Context, flag string, defaultValue any, _ openfeature.EvaluationContext, _ ...openfeature.Option) (any, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	v, ok := f.values[flag]
+	if !ok {
+		return defaultValue, fmt.Errorf("flag %q not found", flag)
+	}
+	return v, nil
+}
+
+// testServer serves the gRPC health service with the faults of server and
+// connects to it with the faults of client. It returns the count of unary
+// calls that reached the health service.
+func testServer(t *testing.T, server, client *Injector) (*health.Server, healthpb.HealthClient, *atomic.Int32) {
+	t.Helper()
+	calls := &atomic.Int32{}
+	count := func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		calls.Add(1)
+		return handler(ctx, req)
+	}
+	hs := health.NewServer()
+	hs.SetServingStatus("cart", healthpb.HealthCheckResponse_SERVING)
+	hs.SetServingStatus("payment", healthpb.HealthCheckResponse_SERVING)
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(server.UnaryServerInterceptor(), count),
+		grpc.ChainStreamInterceptor(server.StreamServerInterceptor()),
+	)
+	healthpb.RegisterHealthServer(srv, hs)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(client.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(client.StreamClientInterceptor()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return hs, healthpb.NewHealthClient(conn), calls
+}
+
+func newFakes(t *testing.T, flag, value string) (*fakeFlags, *Injector) {
+	flags := &fakeFlags{values: map[string]any{}}
+	if value != "" {
+		flags.set(flag, flagValue(t, value))
+	}
+	return flags, New(flags, flag)
+}
+
+func check(ctx context.Context, c healthpb.HealthClient, service string) error {
+	_, err := c.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+	return err
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	_, server := newFakes(t, "serverFaults", `{"faults": [{
+		"name": "cart-down", "methods": ["/grpc.health.v1.Health/Check"],
+		"match": {"service": "cart"}, "code": "INTERNAL", "message": "cart is down"}]}`)
+	_, client := newFakes(t, "clientFaults", "")
+	_, c, calls := testServer(t, server, client)
+	ctx := context.Background()
+
+	err := check(ctx, c, "cart")
+	if status.Code(err) != codes.Internal || status.Convert(err).Message() != "cart is down" {
+		t.Errorf("Check(cart) = %v, want INTERNAL: cart is down", err)
+	}
+	if err := check(ctx, c, "payment"); err != nil {
+		t.Errorf("Check(payment) = %v, want no fault", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("%d calls reached the handler, want 1", got)
+	}
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	clientFlags, client := newFakes(t, "clientFaults", `{"faults": [{"name": "unreachable", "abort": true}]}`)
+	_, server := newFakes(t, "serverFaults", "")
+	_, c, calls := testServer(t, server, client)
+	ctx := context.Background()
+
+	if err := check(ctx, c, "cart"); status.Code(err) != codes.Unavailable {
+		t.Errorf("Check() = %v, want UNAVAILABLE", err)
+	}
+	if got := calls.Load(); got != 0 {
+		t.Errorf("%d calls reached the server, want none", got)
+	}
+
+	clientFlags.set("clientFaults", flagValue(t, `{"faults": [{"name": "slow", "side": "client", "delay": "1s"}]}`))
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := check(ctx, c, "cart"); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("Check() = %v, want DEADLINE_EXCEEDED", err)
+	}
+
+	clientFlags.set("clientFaults", flagValue(t, `{"faults": [{"name": "server-only", "side": "server", "code": "INTERNAL"}]}`))
+	if err := check(context.Background(), c, "cart"); err != nil {
+		t.Errorf("Check() = %v, want no client fault", err)
+	}
+}
+
+func TestRate(t *testing.T) {
+	_, server := newFakes(t, "serverFaults", `{"faults": [{"name": "flaky", "rate": 0.5, "code": "UNAVAILABLE"}]}`)
+	_, client := newFakes(t, "clientFaults", "")
+	var draw atomic.Value
+	server.Rand = func() float64 { return draw.Load().(float64) }
+	_, c, _ := testServer(t, server, client)
+
+	draw.Store(0.7)
+	if err := check(context.Background(), c, "cart"); err != nil {
+		t.Errorf("Check() with a draw above the rate = %v, want no fault", err)
+	}
+	draw.Store(0.3)
+	if err := check(context.Background(), c, "cart"); status.Code(err) != codes.Unavailable {
+		t.Errorf("Check() with a draw below the rate = %v, want UNAVAILABLE", err)
+	}
+}
+
+func TestStreamServerInterceptorAbort(t *testing.T) {
+	_, server := newFakes(t, "serverFaults", `{"faults": [{
+		"name": "drop-watch", "methods": ["/grpc.health.v1.Health/Watch"], "abort": true, "abort_after": 1}]}`)
+	_, client := newFakes(t, "clientFaults", "")
+	hs, c, _ := testServer(t, server, client)
+
+	stream, err := c.Watch(context.Background(), &healthpb.HealthCheckRequest{Service: "cart"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := stream.Recv(); err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("first Recv() = %v, %v, want SERVING", resp, err)
+	}
+	hs.SetServingStatus("cart", healthpb.HealthCheckResponse_NOT_SERVING)
+	if _, err := stream.Recv(); status.Code(err) != codes.Unavailable {
+		t.Errorf("second Recv() = %v, want UNAVAILABLE", err)
+	}
+}
+
+func TestStreamClientInterceptorMatch(t *testing.T) {
+	_, client := newFakes(t, "clientFaults", `{"faults": [{
+		"name": "watch-cart", "match": {"service": "cart"}, "code": "FAILED_PRECONDITION"}]}`)
+	_, server := newFakes(t, "serverFaults", "")
+	_, c, _ := testServer(t, server, client)
+	ctx := context.Background()
+
+	_, err := c.Watch(ctx, &healthpb.HealthCheckRequest{Service: "cart"})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Watch(cart) = %v, want FAILED_PRECONDITION", err)
+	}
+
+	stream, err := c.Watch(ctx, &healthpb.HealthCheckRequest{Service: "payment"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Errorf("Watch(payment).Recv() = %v, want no fault", err)
+	}
+}
+
+func TestInvalidFlagIsLoggedOnce(t *testing.T) {
+	_, server := newFakes(t, "serverFaults", `{"faults": [{"name": "noop"}]}`)
+	var logs []string
+	server.Logf = func(format string, args ...any) { logs = append(logs, fmt.Sprintf(format, args...)) }
+	_, client := newFakes(t, "clientFaults", "")
+	_, c, _ := testServer(t, server, client)
+
+	for range 3 {
+		if err := check(context.Background(), c, "cart"); err != nil {
+			t.Errorf("Check() = %v, want an invalid flag to inject nothing", err)
+		}
+	}
+	if len(logs) != 1 || !strings.Contains(logs[0], `"serverFaults" is ignored`) {
+		t.Errorf("logs = %q, want one about the invalid flag", logs)
+	}
+}
+
+func TestNewOpenFeature(t *testing.T) {
+	const domain = "faultinject-test"
+	err := openfeature.SetNamedProviderAndWait(domain, memprovider.NewInMemoryProvider(map[string]memprovider.InMemoryFlag{
+		"productCatalogFailure": {
+			Key:            "productCatalogFailure",
+			State:          memprovider.Enabled,
+			DefaultVariant: "on",
+			Variants: map[string]any{
+				"on":  flagValue(t, `{"faults": [{"name": "failure", "match": {"service": "cart"}, "code": "INTERNAL"}]}`),
+				"off": flagValue(t, `{"faults": []}`),
+			},
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewOpenFeature(domain, "productCatalogFailure", "missingFlag")
+	_, client := newFakes(t, "clientFaults", "")
+	_, c, _ := testServer(t, server, client)
+
+	if err := check(context.Background(), c, "cart"); status.Code(err) != codes.Internal {
+		t.Errorf("Check(cart) = %v, want INTERNAL", err)
+	}
+	if err := check(context.Background(), c, "payment"); err != nil {
+		t.Errorf("Check(payment) = %v, want no fault", err)
+	}
+}
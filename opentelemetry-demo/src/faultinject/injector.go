@@ -0,0 +1,175 @@
+package faultinject
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/open-feature/go-sdk/openfeature"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Evaluator evaluates object flags. *openfeature.Client implements it.
+type Evaluator interface {
+	ObjectValue(ctx context.Context, flag string, defaultValue any, evalCtx openfeature.EvaluationContext, options ...openfeature.Option) (any, error)
+}
+
+// Injector reads faults from flags on every call and injects the first one
+// that applies. Flags that are missing, off, or not fault lists inject
+// nothing.
+type Injector struct {
+	evaluator Evaluator
+	flags     []string
+
+	// Logf, when set, is called when a flag holds an invalid fault list.
+	Logf func(format string, args ...any)
+	// Rand returns a number in [0, 1) to decide whether a call gets a fault
+	// with a rate. It defaults to math/rand/v2.Float64.
+	Rand func() float64
+
+	mu sync.Mutex
+	// parsed caches the faults of each flag by the JSON of its value, so a
+	// value is parsed, and an invalid one logged, only when it changes.
+	parsed map[string]parsedFlag
+}
+
+type parsedFlag struct {
+	value  string
+	faults []Fault
+}
+
+// New returns an Injector that reads faults from flags, evaluated with e.
+func New(e Evaluator, flags ...string) *Injector {
+	return &Injector{evaluator: e, flags: flags, parsed: make(map[string]parsedFlag)}
+}
+
+// NewOpenFeature returns an Injector that evaluates flags with an OpenFeature
+// client of domain, which uses the provider set for that domain or the
+// default one.
+func NewOpenFeature(domain string, flags ...string) *Injector {
+	return New(openfeature.NewClient(domain), flags...)
+}
+
+// faults returns the faults that apply to method on side, in flag order.
+// The evaluation context carries the method, so flag targeting can use it
+// too.
+func (i *Injector) faults(ctx context.Context, side Side, method string) []Fault {
+	service, name, _ := strings.Cut(strings.TrimPrefix(method, "/"), "/")
+	evalCtx := openfeature.NewEvaluationContext("", map[string]any{
+		"rpc.service": service,
+		"rpc.method":  name,
+		"rpc.side":    string(side),
+	})
+	var faults []Fault
+	for _, flag := range i.flags {
+		value, err := i.evaluator.ObjectValue(ctx, flag, nil, evalCtx)
+		if err != nil || value == nil {
+			continue
+		}
+		for _, f := range i.parse(flag, value) {
+			if f.appliesTo(side, method) {
+				faults = append(faults, f)
+			}
+		}
+	}
+	return faults
+}
+
+func (i *Injector) parse(flag string, value any) []Fault {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if p, ok := i.parsed[flag]; ok && p.value == string(data) {
+		return p.faults
+	}
+	faults, err := parse(value)
+	if err != nil && i.Logf != nil {
+		i.Logf("fault injection flag %q is ignored: %v", flag, err)
+	}
+	i.parsed[flag] = parsedFlag{value: string(data), faults: faults}
+	return faults
+}
+
+// pick returns the first of faults that matches msg and is drawn by its
+// rate.
+func (i *Injector) pick(faults []Fault, msg any) *Fault {
+	for k := range faults {
+		f := &faults[k]
+		if !f.matches(msg) {
+			continue
+		}
+		if f.Rate != nil && i.random() >= *f.Rate {
+			continue
+		}
+		return f
+	}
+	return nil
+}
+
+func (i *Injector) random() float64 {
+	if i.Rand != nil {
+		return i.Rand()
+	}
+	return rand.Float64()
+}
+
+// inject applies the delay of f and returns the error the call fails with,
+// if any. Streams that abort later fail only when aborted, so abort is
+// ignored for them here.
+func inject(ctx context.Context, f *Fault, method string, stream bool) error {
+	attrs := []attribute.KeyValue{
+		attribute.String("app.fault.name", f.Name),
+		attribute.String("rpc.method", method),
+	}
+	if f.Delay > 0 {
+		attrs = append(attrs, attribute.Int64("app.fault.delay_ms", time.Duration(f.Delay).Milliseconds()))
+	}
+	err := faultError(f, stream)
+	if err != nil {
+		attrs = append(attrs, attribute.String("rpc.grpc.status_code", status.Code(err).String()))
+	}
+	trace.SpanFromContext(ctx).AddEvent("fault injected", trace.WithAttributes(attrs...))
+
+	if f.Delay > 0 {
+		t := time.NewTimer(time.Duration(f.Delay))
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	return err
+}
+
+// faultError returns the error a call that gets f fails with.
+func faultError(f *Fault, stream bool) error {
+	if f.Abort && !(stream && f.AbortAfter > 0) {
+		return abortError(f)
+	}
+	if f.Code == codes.OK {
+		return nil
+	}
+	msg := f.Message
+	if msg == "" {
+		msg = "fault injected: " + f.Name
+	}
+	return status.Error(f.Code, msg)
+}
+
+func abortError(f *Fault) error {
+	msg := f.Message
+	if msg == "" {
+		msg = "fault injected: connection aborted"
+	}
+	return status.Error(codes.Unavailable, msg)
+}
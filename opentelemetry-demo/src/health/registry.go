@@ -0,0 +1,233 @@
+// Package health keeps track of whether a service and the dependencies it
+// needs are healthy, and serves the result over the gRPC health protocol.
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Status names every registry reports, next to the service names it is
+// created with and the name of every registered check.
+const (
+	// Liveness reports whether the process is up. It stays SERVING until the
+	// process exits, also while the service drains or a dependency is down,
+	// so orchestrators do not restart a process that would not recover by it.
+	Liveness = "liveness"
+
+	// Readiness reports whether the service should be sent calls. It is
+	// SERVING once every check passes and the service is not draining. The
+	// overall status, requested with an empty name, and the service names
+	// the registry is created with report the same.
+	Readiness = "readiness"
+)
+
+const (
+	defaultInterval = 10 * time.Second
+	defaultTimeout  = 2 * time.Second
+)
+
+// Probe checks a single dependency and returns an error while it is
+// unhealthy.
+type Probe func(ctx context.Context) error
+
+type check struct {
+	name  string
+	probe Probe
+	err   error
+	done  bool
+}
+
+// Registry runs the probes of a service's dependencies and implements the
+// gRPC health service on top of their results. Watch streams are sent every
+// change of the status they watch.
+type Registry struct {
+	healthpb.UnimplementedHealthServer
+
+	// Interval is the time between two rounds of probes in Run, and Timeout
+	// bounds every probe. They must be set before Run is called.
+	Interval time.Duration
+	Timeout  time.Duration
+
+	// Logf, when set, is called whenever a check starts or stops failing.
+	Logf func(format string, args ...any)
+
+	server   *health.Server
+	services []string
+
+	mu       sync.Mutex
+	checks   []*check
+	draining bool
+}
+
+// NewRegistry creates a registry whose readiness is also reported under the
+// given service names, for example "oteldemo.CheckoutService". The service
+// is not ready until the first round of probes has passed.
+func NewRegistry(services ...string) *Registry {
+	r := &Registry{
+		Interval: defaultInterval,
+		Timeout:  defaultTimeout,
+		server:   health.NewServer(),
+		services: services,
+	}
+	r.server.SetServingStatus(Liveness, healthpb.HealthCheckResponse_SERVING)
+	r.setReadiness(healthpb.HealthCheckResponse_NOT_SERVING)
+	return r
+}
+
+// Register adds a check that must pass for the service to be ready. Its
+// result is also reported under name. Checks should be registered before
+// the first call to Update or Run.
+func (r *Registry) Register(name string, probe Probe) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, &check{name: name, probe: probe})
+	r.server.SetServingStatus(name, healthpb.HealthCheckResponse_NOT_SERVING)
+}
+
+// Run updates the statuses right away and then every Interval until ctx is
+// done.
+func (r *Registry) Run(ctx context.Context) {
+	r.Update(ctx)
+
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.Update(ctx)
+		}
+	}
+}
+
+// Update runs every probe once, concurrently, and updates the statuses with
+// their results.
+func (r *Registry) Update(ctx context.Context) {
+	r.mu.Lock()
+	checks := append([]*check(nil), r.checks...)
+	r.mu.Unlock()
+
+	errs := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = r.probe(ctx, c.probe)
+		}()
+	}
+	wg.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, c := range checks {
+		r.record(c, errs[i])
+	}
+	r.updateReadiness()
+}
+
+func (r *Registry) probe(ctx context.Context, probe Probe) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, r.Timeout)
+	defer cancel()
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("probe panicked: %v", p)
+		}
+	}()
+	return probe(ctx)
+}
+
+// record stores the result of c's probe. r.mu must be held.
+func (r *Registry) record(c *check, err error) {
+	if r.Logf != nil {
+		switch {
+		case err != nil && (c.err == nil || !c.done):
+			r.Logf("health check %s failed: %v", c.name, err)
+		case err == nil && c.err != nil:
+			r.Logf("health check %s passed again", c.name)
+		}
+	}
+	c.err, c.done = err, true
+
+	if err != nil {
+		r.server.SetServingStatus(c.name, healthpb.HealthCheckResponse_NOT_SERVING)
+	} else {
+		r.server.SetServingStatus(c.name, healthpb.HealthCheckResponse_SERVING)
+	}
+}
+
+// updateReadiness derives readiness from the last result of every check.
+// r.mu must be held.
+func (r *Registry) updateReadiness() {
+	ready := !r.draining
+	for _, c := range r.checks {
+		if !c.done || c.err != nil {
+			ready = false
+		}
+	}
+	if ready {
+		r.setReadiness(healthpb.HealthCheckResponse_SERVING)
+	} else {
+		r.setReadiness(healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+}
+
+func (r *Registry) setReadiness(status healthpb.HealthCheckResponse_ServingStatus) {
+	r.server.SetServingStatus("", status)
+	r.server.SetServingStatus(Readiness, status)
+	for _, service := range r.services {
+		r.server.SetServingStatus(service, status)
+	}
+}
+
+// Drain marks the service as not ready for good, so clients and load
+// balancers stop sending it calls while it shuts down. Liveness and the
+// statuses of the checks are still reported.
+func (r *Registry) Drain() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.draining = true
+	r.updateReadiness()
+}
+
+// Check returns the status of the requested name, or NOT_FOUND for names
+// the registry does not report.
+func (r *Registry) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	return r.server.Check(ctx, req)
+}
+
+// Watch sends the status of the requested name, and then every change of
+// it until the stream is done.
+func (r *Registry) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	return r.server.Watch(req, stream)
+}
+
+// ConnProbe checks that conn can connect to its target. An idle connection
+// is asked to connect, and the probe waits for the attempt to succeed or
+// fail.
+func ConnProbe(conn *grpc.ClientConn) Probe {
+	return func(ctx context.Context) error {
+		conn.Connect()
+		for {
+			state := conn.GetState()
+			switch state {
+			case connectivity.Ready:
+				return nil
+			case connectivity.TransientFailure, connectivity.Shutdown:
+				return fmt.Errorf("connection to %s is %v", conn.Target(), state)
+			}
+			if !conn.WaitForStateChange(ctx, state) {
+				return fmt.Errorf("connection to %s is %v: %w", conn.Target(), state, ctx.Err())
+			}
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	serving    = healthpb.HealthCheckResponse_SERVING
+	notServing = healthpb.HealthCheckResponse_NOT_SERVING
+)
+
+// switchProbe fails while its error is set.
+type switchProbe struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (p *switchProbe) set(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+func (p *switchProbe) probe(context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+func statusOf(t *testing.T, r *Registry, name string) healthpb.HealthCheckResponse_ServingStatus {
+	t.Helper()
+	resp, err := r.Check(context.Background(), &healthpb.HealthCheckRequest{Service: name})
+	if err != nil {
+		t.Fatalf("Check(%q) error = %v", name, err)
+	}
+	return resp.GetStatus()
+}
+
+func TestRegistryReadiness(t *testing.T) {
+	const service = "oteldemo.TestService"
+	db := &switchProbe{}
+	r := NewRegistry(service)
+	r.Register("db", db.probe)
+
+	for _, name := range []string{"", Readiness, service, "db"} {
+		if got := statusOf(t, r, name); got != notServing {
+			t.Errorf("before the first update, %q = %v, want %v", name, got, notServing)
+		}
+	}
+	if got := statusOf(t, r, Liveness); got != serving {
+		t.Errorf("%q = %v, want %v", Liveness, got, serving)
+	}
+
+	r.Update(context.Background())
+	for _, name := range []string{"", Readiness, service, "db", Liveness} {
+		if got := statusOf(t, r, name); got != serving {
+			t.Errorf("with the check passing, %q = %v, want %v", name, got, serving)
+		}
+	}
+
+	db.set(errors.New("connection refused"))
+	r.Update(context.Background())
+	for _, name := range []string{"", Readiness, service, "db"} {
+		if got := statusOf(t, r, name); got != notServing {
+			t.Errorf("with the check failing, %q = %v, want %v", name, got, notServing)
+		}
+	}
+	if got := statusOf(t, r, Liveness); got != serving {
+		t.Errorf("with the check failing, %q = %v, want %v", Liveness, got, serving)
+	}
+
+	if _, err := r.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "unknown"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Check(unknown) error = %v, want NotFound", err)
+	}
+}
+
+func TestRegistryDrain(t *testing.T) {
+	r := NewRegistry()
+	r.Register("db", (&switchProbe{}).probe)
+	r.Update(context.Background())
+
+	r.Drain()
+	r.Update(context.Background())
+	if got := statusOf(t, r, ""); got != notServing {
+		t.Errorf("while draining, readiness = %v, want %v", got, notServing)
+	}
+	if got := statusOf(t, r, "db"); got != serving {
+		t.Errorf("while draining, db = %v, want %v", got, serving)
+	}
+	if got := statusOf(t, r, Liveness); got != serving {
+		t.Errorf("while draining, liveness = %v, want %v", got, serving)
+	}
+}
+
+func TestRegistryProbeTimeout(t *testing.T) {
+	r := NewRegistry()
+	r.Timeout = 10 * time.Millisecond
+	r.Register("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	r.Register("panics", func(context.Context) error { panic("boom") })
+
+	r.Update(context.Background())
+	for _, name := range []string{"", "slow", "panics"} {
+		if got := statusOf(t, r, name); got != notServing {
+			t.Errorf("%q = %v, want %v", name, got, notServing)
+		}
+	}
+}
+
+func TestRegistryWatch(t *testing.T) {
+	db := &switchProbe{}
+	r := NewRegistry()
+	r.Register("db", db.probe)
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, r)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///health",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := healthpb.NewHealthClient(conn).Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := func(want healthpb.HealthCheckResponse_ServingStatus) {
+		t.Helper()
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv() error = %v", err)
+		}
+		if resp.GetStatus() != want {
+			t.Errorf("Watch sent %v, want %v", resp.GetStatus(), want)
+		}
+	}
+
+	next(notServing)
+	r.Update(ctx)
+	next(serving)
+	db.set(errors.New("connection refused"))
+	r.Update(ctx)
+	next(notServing)
+	db.set(nil)
+	r.Update(ctx)
+	next(serving)
+	r.Drain()
+	next(notServing)
+}
+
+func TestConnProbe(t *testing.T) {
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	go srv.Serve(lis)
+
+	dial := grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	})
+	conn, err := grpc.NewClient("passthrough:///up", grpc.WithTransportCredentials(insecure.NewCredentials()), dial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := ConnProbe(conn)(ctx); err != nil {
+		t.Errorf("probe of a reachable server = %v, want nil", err)
+	}
+
+	srv.Stop()
+	lis.Close()
+	down, err := grpc.NewClient("passthrough:///down", grpc.WithTransportCredentials(insecure.NewCredentials()), dial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer down.Close()
+	if err := ConnProbe(down)(ctx); err == nil {
+		t.Error("probe of an unreachable server = nil, want an error")
+	}
+}
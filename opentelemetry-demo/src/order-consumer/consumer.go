@@ -0,0 +1,251 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/cloudevents"
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/db/postgres"
+	pb "github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/order-consumer/genproto/oteldemo"
+)
+
+// Headers added to dead-lettered messages, next to the original ones.
+const (
+	headerDeadLetterReason = "x-dead-letter-reason"
+	headerOriginalTopic    = "x-original-topic"
+	headerOriginalPart     = "x-original-partition"
+	headerOriginalOffset   = "x-original-offset"
+)
+
+// orderStore stores consumed orders. It is implemented by
+// postgres.OrderRepository.
+type orderStore interface {
+	RecordOrder(ctx context.Context, order *postgres.Order) (bool, error)
+}
+
+// handler consumes order events. Each order is written to the store, and an
+// event that cannot be decoded or written is moved to the dead-letter topic.
+// The offset of a message is committed only once it is in either place.
+type handler struct {
+	store    orderStore
+	dlq      sarama.SyncProducer
+	dlqTopic string
+	group    string
+	tracer   trace.Tracer
+	log      *logrus.Logger
+
+	// writeAttempts is how often a write is tried before the message is
+	// dead-lettered.
+	writeAttempts int
+	// minBackoff and maxBackoff bound the delay between attempts.
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+func (h *handler) Setup(sarama.ConsumerGroupSession) error   { return nil }
+func (h *handler) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+// ConsumeClaim handles the messages of a partition one at a time, in order.
+func (h *handler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			if err := h.process(session.Context(), msg); err != nil {
+				// The session is ending; the message is consumed again by
+				// whoever owns the partition next.
+				return nil
+			}
+			session.MarkMessage(msg, "")
+			session.Commit()
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// process stores or dead-letters msg. When neither works, for example while
+// the database and the brokers are both unreachable, it keeps trying until
+// ctx is done, so that no message is skipped.
+func (h *handler) process(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	for attempt := 0; ; attempt++ {
+		err := h.handle(ctx, msg)
+		if err == nil {
+			return nil
+		}
+		h.log.Errorf("failed to store or dead-letter message at offset %d of %s/%d: %+v", msg.Offset, msg.Topic, msg.Partition, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(h.backoff(attempt)):
+		}
+	}
+}
+
+// handle processes a single message within a consumer span that continues
+// the trace of the checkout call that produced it. It returns an error only
+// when the message could not be dead-lettered.
+func (h *handler) handle(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	producerCtx := otel.GetTextMapPropagator().Extract(ctx, headerCarrier(msg.Headers))
+	ctx, span := h.tracer.Start(producerCtx, fmt.Sprintf("%s process", msg.Topic),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(trace.LinkFromContext(producerCtx)),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingOperationDeliver,
+			semconv.MessagingDestinationName(msg.Topic),
+			semconv.MessagingKafkaConsumerGroup(h.group),
+			semconv.MessagingKafkaDestinationPartition(int(msg.Partition)),
+			semconv.MessagingKafkaMessageOffset(int(msg.Offset)),
+		),
+	)
+	defer span.End()
+
+	order := new(pb.OrderResult)
+	event, err := cloudevents.Decode(headerCarrier(msg.Headers), msg.Value, order)
+	if event.Type != "" {
+		span.SetAttributes(
+			semconv.CloudeventsEventID(event.ID),
+			semconv.CloudeventsEventSource(event.Source),
+			semconv.CloudeventsEventType(event.Type),
+			semconv.CloudeventsEventSpecVersion(event.SpecVersion),
+		)
+	}
+	if err != nil {
+		return h.deadLetter(ctx, msg, fmt.Errorf("failed to decode order: %w", err))
+	}
+	// Records without a type predate CloudEvents and hold the same payload.
+	if event.Type != "" && event.Type != cloudevents.TypeOrderPlaced {
+		return h.deadLetter(ctx, msg, fmt.Errorf("unsupported event type %q", event.Type))
+	}
+	span.SetAttributes(attribute.String("app.order.id", order.GetOrderId()))
+
+	row, err := orderRow(order)
+	if err == nil {
+		err = h.write(ctx, row)
+	}
+	if err != nil {
+		return h.deadLetter(ctx, msg, err)
+	}
+	return nil
+}
+
+// write stores the order, retrying up to writeAttempts times.
+func (h *handler) write(ctx context.Context, order *postgres.Order) error {
+	span := trace.SpanFromContext(ctx)
+	var err error
+	for attempt := 0; attempt < h.writeAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(h.backoff(attempt - 1)):
+			}
+		}
+		var inserted bool
+		if inserted, err = h.store.RecordOrder(ctx, order); err == nil {
+			span.AddEvent("stored", trace.WithAttributes(attribute.Bool("app.order.duplicate", !inserted)))
+			if inserted {
+				h.log.Infof("stored order %s", order.ID)
+			} else {
+				h.log.Infof("order %s is already stored", order.ID)
+			}
+			return nil
+		}
+		span.AddEvent("write failed", trace.WithAttributes(
+			attribute.Int("app.order.write.attempt", attempt+1),
+			attribute.String("exception.message", err.Error()),
+		))
+	}
+	return fmt.Errorf("failed to store order %s: %w", order.ID, err)
+}
+
+// deadLetter publishes msg to the dead-letter topic with the reason it could
+// not be handled.
+func (h *handler) deadLetter(ctx context.Context, msg *sarama.ConsumerMessage, reason error) error {
+	span := trace.SpanFromContext(ctx)
+	span.SetStatus(otelcodes.Error, reason.Error())
+	h.log.Warnf("dead-lettering message at offset %d of %s/%d: %v", msg.Offset, msg.Topic, msg.Partition, reason)
+
+	headers := make([]sarama.RecordHeader, 0, len(msg.Headers)+4)
+	for _, header := range msg.Headers {
+		headers = append(headers, *header)
+	}
+	headers = append(headers,
+		sarama.RecordHeader{Key: []byte(headerDeadLetterReason), Value: []byte(reason.Error())},
+		sarama.RecordHeader{Key: []byte(headerOriginalTopic), Value: []byte(msg.Topic)},
+		sarama.RecordHeader{Key: []byte(headerOriginalPart), Value: []byte(strconv.Itoa(int(msg.Partition)))},
+		sarama.RecordHeader{Key: []byte(headerOriginalOffset), Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+	)
+	dead := &sarama.ProducerMessage{
+		Topic:   h.dlqTopic,
+		Value:   sarama.ByteEncoder(msg.Value),
+		Headers: headers,
+	}
+	if msg.Key != nil {
+		dead.Key = sarama.ByteEncoder(msg.Key)
+	}
+	partition, offset, err := h.dlq.SendMessage(dead)
+	if err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", h.dlqTopic, err)
+	}
+	span.AddEvent("dead-lettered", trace.WithAttributes(
+		semconv.MessagingDestinationName(h.dlqTopic),
+		semconv.MessagingKafkaDestinationPartition(int(partition)),
+		semconv.MessagingKafkaMessageOffset(int(offset)),
+	))
+	return nil
+}
+
+// backoff returns the delay before the next attempt after attempt failed
+// ones.
+func (h *handler) backoff(attempt int) time.Duration {
+	d := h.minBackoff
+	for i := 0; i < attempt && d < h.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > h.maxBackoff {
+		d = h.maxBackoff
+	}
+	return d
+}
+
+// headerCarrier adapts the headers of a consumed message to a
+// propagation.TextMapCarrier.
+type headerCarrier []*sarama.RecordHeader
+
+func (c headerCarrier) Get(key string) string {
+	for _, h := range c {
+		if h != nil && string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// Set is not used: the carrier is only read from.
+func (c headerCarrier) Set(string, string) {}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for _, h := range c {
+		if h != nil {
+			keys = append(keys, string(h.Key))
+		}
+	}
+	return keys
+}
@@ -0,0 +1,373 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/cloudevents"
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/db/postgres"
+	pb "github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/order-consumer/genproto/oteldemo"
+)
+
+func init() {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+}
+
+// fakeStore records orders in memory. The first failures calls fail.
+type fakeStore struct {
+	mu       sync.Mutex
+	orders   map[string]*postgres.Order
+	failures int
+	calls    int
+}
+
+func (s *fakeStore) RecordOrder(_ context.Context, order *postgres.Order) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.failures > 0 {
+		s.failures--
+		return false, errors.New("connection refused")
+	}
+	if s.orders == nil {
+		s.orders = make(map[string]*postgres.Order)
+	}
+	if _, ok := s.orders[order.ID]; ok {
+		return false, nil
+	}
+	s.orders[order.ID] = order
+	return true, nil
+}
+
+// fakeSession records the offsets marked and committed by the handler.
+type fakeSession struct {
+	ctx       context.Context
+	marked    []int64
+	committed int
+}
+
+func (s *fakeSession) Claims() map[string][]int32               { return nil }
+func (s *fakeSession) MemberID() string                         { return "member-1" }
+func (s *fakeSession) GenerationID() int32                      { return 1 }
+func (s *fakeSession) MarkOffset(string, int32, int64, string)  {}
+func (s *fakeSession) ResetOffset(string, int32, int64, string) {}
+func (s *fakeSession) Commit()                                  { s.committed++ }
+func (s *fakeSession) Context() context.Context                 { return s.ctx }
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, _ string) {
+	s.marked = append(s.marked, msg.Offset)
+}
+
+// fakeClaim delivers the given messages and then ends the claim.
+type fakeClaim struct {
+	messages chan *sarama.ConsumerMessage
+}
+
+func newFakeClaim(msgs ...*sarama.ConsumerMessage) *fakeClaim {
+	c := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, len(msgs))}
+	for _, msg := range msgs {
+		c.messages <- msg
+	}
+	close(c.messages)
+	return c
+}
+
+func (c *fakeClaim) Topic() string                            { return "orders" }
+func (c *fakeClaim) Partition() int32                         { return 0 }
+func (c *fakeClaim) InitialOffset() int64                     { return 0 }
+func (c *fakeClaim) HighWaterMarkOffset() int64               { return 0 }
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+// unavailableProducer fails every message it is asked to send.
+type unavailableProducer struct {
+	sarama.SyncProducer
+}
+
+func (unavailableProducer) SendMessage(*sarama.ProducerMessage) (int32, int64, error) {
+	return 0, 0, sarama.ErrLeaderNotAvailable
+}
+
+func newTestHandler(t *testing.T, store orderStore, dlq sarama.SyncProducer) (*handler, *tracetest.SpanRecorder) {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	t.Cleanup(func() { tp.Shutdown(context.Background()) })
+	quiet := logrus.New()
+	quiet.Out = io.Discard
+	return &handler{
+		store:         store,
+		dlq:           dlq,
+		dlqTopic:      "orders-dlq",
+		group:         "order-consumer",
+		tracer:        tp.Tracer("test"),
+		log:           quiet,
+		writeAttempts: 3,
+		minBackoff:    time.Millisecond,
+		maxBackoff:    4 * time.Millisecond,
+	}, recorder
+}
+
+func testOrder(id string) *pb.OrderResult {
+	return &pb.OrderResult{
+		OrderId:            id,
+		ShippingTrackingId: "TRACK-1",
+		ShippingCost:       &pb.Money{CurrencyCode: "USD", Units: 8, Nanos: 990_000_000},
+		ShippingAddress:    &pb.Address{StreetAddress: "1600 Amphitheatre Parkway", City: "Mountain View", Country: "US"},
+		Items: []*pb.OrderItem{
+			{Item: &pb.CartItem{ProductId: "OLJCESPC7Z", Quantity: 2}, Cost: &pb.Money{CurrencyCode: "USD", Units: 19, Nanos: 990_000_000}},
+		},
+	}
+}
+
+// testMessage returns the message checkout publishes for order, with the
+// trace context of a producer span.
+func testMessage(t *testing.T, offset int64, order *pb.OrderResult) (*sarama.ConsumerMessage, trace.SpanContext) {
+	t.Helper()
+	value, err := proto.Marshal(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, producer := sdktrace.NewTracerProvider().Tracer("checkout").Start(context.Background(), "orders publish")
+	producer.End()
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	msg := &sarama.ConsumerMessage{Topic: "orders", Partition: 0, Offset: offset, Value: value}
+	for key, value := range carrier {
+		msg.Headers = append(msg.Headers, &sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+	}
+	return msg, producer.SpanContext()
+}
+
+// eventMessage returns the message checkout publishes for order, wrapped in
+// a CloudEvent of eventType.
+func eventMessage(t *testing.T, offset int64, order *pb.OrderResult, encoding cloudevents.Encoding, eventType string) *sarama.ConsumerMessage {
+	t.Helper()
+	msg, _ := testMessage(t, offset, order)
+	data, headers, err := cloudevents.Encoder{Source: "/oteldemo/checkout", Encoding: encoding}.Encode(eventType, order.GetOrderId(), order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.Value = data
+	for key, value := range headers {
+		msg.Headers = append(msg.Headers, &sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+	}
+	return msg
+}
+
+func header(msg *sarama.ProducerMessage, key string) string {
+	for _, h := range msg.Headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func TestConsumeClaim(t *testing.T) {
+	store := &fakeStore{}
+	dlq := mocks.NewSyncProducer(t, nil)
+	defer dlq.Close()
+	h, recorder := newTestHandler(t, store, dlq)
+
+	first, producer := testMessage(t, 10, testOrder("order-1"))
+	duplicate, _ := testMessage(t, 11, testOrder("order-1"))
+	session := &fakeSession{ctx: context.Background()}
+	if err := h.ConsumeClaim(session, newFakeClaim(first, duplicate)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(store.orders) != 1 || store.orders["order-1"] == nil {
+		t.Fatalf("stored orders = %v, want order-1", store.orders)
+	}
+	if len(session.marked) != 2 || session.marked[0] != 10 || session.marked[1] != 11 || session.committed != 2 {
+		t.Errorf("marked %v and committed %d times, want offsets 10 and 11 committed twice", session.marked, session.committed)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "orders process" || span.SpanKind() != trace.SpanKindConsumer {
+		t.Errorf("span %q of kind %v, want a consumer span named orders process", span.Name(), span.SpanKind())
+	}
+	if span.Parent().SpanID() != producer.SpanID() || span.SpanContext().TraceID() != producer.TraceID() {
+		t.Errorf("span parent = %v, want the producer span %v", span.Parent(), producer)
+	}
+	if links := span.Links(); len(links) != 1 || links[0].SpanContext.SpanID() != producer.SpanID() {
+		t.Errorf("span links = %v, want a link to the producer span", links)
+	}
+}
+
+func TestConsumeClaimCloudEvents(t *testing.T) {
+	for _, encoding := range []cloudevents.Encoding{cloudevents.Protobuf, cloudevents.JSON} {
+		t.Run(string(encoding), func(t *testing.T) {
+			store := &fakeStore{}
+			dlq := mocks.NewSyncProducer(t, nil)
+			defer dlq.Close()
+			h, recorder := newTestHandler(t, store, dlq)
+
+			msg := eventMessage(t, 0, testOrder("order-1"), encoding, cloudevents.TypeOrderPlaced)
+			session := &fakeSession{ctx: context.Background()}
+			if err := h.ConsumeClaim(session, newFakeClaim(msg)); err != nil {
+				t.Fatal(err)
+			}
+			if got := store.orders["order-1"]; got == nil || got.Total.Units != 48 {
+				t.Errorf("stored order = %+v, want order-1 with a total of 48.97", got)
+			}
+			var eventType string
+			for _, attr := range recorder.Ended()[0].Attributes() {
+				if attr.Key == "cloudevents.event_type" {
+					eventType = attr.Value.AsString()
+				}
+			}
+			if eventType != cloudevents.TypeOrderPlaced {
+				t.Errorf("span event type = %q, want %q", eventType, cloudevents.TypeOrderPlaced)
+			}
+		})
+	}
+}
+
+func TestConsumeClaimRetriesWrites(t *testing.T) {
+	store := &fakeStore{failures: 2}
+	dlq := mocks.NewSyncProducer(t, nil)
+	defer dlq.Close()
+	h, _ := newTestHandler(t, store, dlq)
+
+	msg, _ := testMessage(t, 0, testOrder("order-1"))
+	session := &fakeSession{ctx: context.Background()}
+	if err := h.ConsumeClaim(session, newFakeClaim(msg)); err != nil {
+		t.Fatal(err)
+	}
+	if store.calls != 3 || store.orders["order-1"] == nil {
+		t.Errorf("RecordOrder() called %d times, want the third call to store the order", store.calls)
+	}
+	if len(session.marked) != 1 {
+		t.Errorf("marked offsets %v, want the message marked", session.marked)
+	}
+}
+
+func TestConsumeClaimDeadLetters(t *testing.T) {
+	tests := []struct {
+		name       string
+		store      *fakeStore
+		value      func(t *testing.T) *sarama.ConsumerMessage
+		wantReason string
+	}{
+		{
+			name:  "Undecodable",
+			store: &fakeStore{},
+			value: func(t *testing.T) *sarama.ConsumerMessage {
+				msg, _ := testMessage(t, 7, testOrder("order-1"))
+				msg.Value = []byte("not a protobuf message")
+				return msg
+			},
+			wantReason: "failed to decode order",
+		},
+		{
+			name:  "Invalid",
+			store: &fakeStore{},
+			value: func(t *testing.T) *sarama.ConsumerMessage {
+				msg, _ := testMessage(t, 7, testOrder(""))
+				return msg
+			},
+			wantReason: "order has no ID",
+		},
+		{
+			name:  "UnsupportedEventType",
+			store: &fakeStore{},
+			value: func(t *testing.T) *sarama.ConsumerMessage {
+				return eventMessage(t, 7, testOrder("order-1"), cloudevents.Protobuf, "oteldemo.order.placed.v2")
+			},
+			wantReason: `unsupported event type "oteldemo.order.placed.v2"`,
+		},
+		{
+			name:  "WriteFails",
+			store: &fakeStore{failures: 3},
+			value: func(t *testing.T) *sarama.ConsumerMessage {
+				msg, _ := testMessage(t, 7, testOrder("order-1"))
+				return msg
+			},
+			wantReason: "failed to store order order-1: connection refused",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dlq := mocks.NewSyncProducer(t, nil)
+			defer dlq.Close()
+			var dead *sarama.ProducerMessage
+			dlq.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+				dead = msg
+				return nil
+			})
+			h, _ := newTestHandler(t, tt.store, dlq)
+
+			msg := tt.value(t)
+			session := &fakeSession{ctx: context.Background()}
+			if err := h.ConsumeClaim(session, newFakeClaim(msg)); err != nil {
+				t.Fatal(err)
+			}
+
+			if dead == nil {
+				t.Fatal("no message was dead-lettered")
+			}
+			if dead.Topic != "orders-dlq" {
+				t.Errorf("dead-lettered to %q, want orders-dlq", dead.Topic)
+			}
+			if got := header(dead, headerDeadLetterReason); !strings.HasPrefix(got, tt.wantReason) {
+				t.Errorf("reason = %q, want %q", got, tt.wantReason)
+			}
+			if header(dead, headerOriginalTopic) != "orders" || header(dead, headerOriginalPart) != "0" || header(dead, headerOriginalOffset) != "7" {
+				t.Errorf("unexpected origin headers: %v", dead.Headers)
+			}
+			if header(dead, "traceparent") == "" {
+				t.Error("dead letter lost the trace context of the original message")
+			}
+			if len(session.marked) != 1 || session.marked[0] != 7 {
+				t.Errorf("marked offsets %v, want the dead-lettered message marked", session.marked)
+			}
+		})
+	}
+}
+
+func TestConsumeClaimStopsWithoutCommitting(t *testing.T) {
+	// Neither the store nor the dead-letter topic is available.
+	h, _ := newTestHandler(t, &fakeStore{failures: 1 << 30}, unavailableProducer{})
+	h.writeAttempts = 1
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	msg, _ := testMessage(t, 3, testOrder("order-1"))
+	session := &fakeSession{ctx: ctx}
+	if err := h.ConsumeClaim(session, newFakeClaim(msg)); err != nil {
+		t.Fatal(err)
+	}
+	if len(session.marked) != 0 || session.committed != 0 {
+		t.Errorf("marked %v and committed %d times, want nothing committed", session.marked, session.committed)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	h := &handler{minBackoff: 100 * time.Millisecond, maxBackoff: time.Second}
+	for attempt, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		if got := h.backoff(attempt); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+}
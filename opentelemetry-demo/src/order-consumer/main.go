@@ -0,0 +1,261 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+// Command order-consumer reads the order events that checkout publishes to
+// Kafka and records each order in PostgreSQL, continuing the trace of the
+// checkout call that placed it.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/runtime"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/db/postgres"
+)
+
+//go:generate go install google.golang.org/protobuf/cmd/protoc-gen-go
+//go:generate go install google.golang.org/grpc/cmd/protoc-gen-go-grpc
+//go:generate protoc --go_out=./ --go-grpc_out=./ --proto_path=../../pb ../../pb/demo.proto
+
+var log *logrus.Logger
+var resource *sdkresource.Resource
+var initResourcesOnce sync.Once
+
+func init() {
+	log = logrus.New()
+	log.Level = logrus.DebugLevel
+	log.Formatter = &logrus.JSONFormatter{
+		FieldMap: logrus.FieldMap{
+			logrus.FieldKeyTime:  "timestamp",
+			logrus.FieldKeyLevel: "severity",
+			logrus.FieldKeyMsg:   "message",
+		},
+		TimestampFormat: time.RFC3339Nano,
+	}
+	log.Out = os.Stdout
+}
+
+func initResource() *sdkresource.Resource {
+	initResourcesOnce.Do(func() {
+		extraResources, _ := sdkresource.New(
+			context.Background(),
+			sdkresource.WithOS(),
+			sdkresource.WithProcess(),
+			sdkresource.WithContainer(),
+			sdkresource.WithHost(),
+		)
+		resource, _ = sdkresource.Merge(
+			sdkresource.Default(),
+			extraResources,
+		)
+	})
+	return resource
+}
+
+func initTracerProvider() *sdktrace.TracerProvider {
+	ctx := context.Background()
+
+	exporter, err := otlptracegrpc.New(ctx)
+	if err != nil {
+		log.Fatalf("new otlp trace grpc exporter failed: %v", err)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(initResource()),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return tp
+}
+
+func initMeterProvider() *sdkmetric.MeterProvider {
+	ctx := context.Background()
+
+	exporter, err := otlpmetricgrpc.New(ctx)
+	if err != nil {
+		log.Fatalf("new otlp metric grpc exporter failed: %v", err)
+	}
+
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)),
+		sdkmetric.WithResource(initResource()),
+	)
+	otel.SetMeterProvider(mp)
+	return mp
+}
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run consumes order events until the process is told to stop. Deferred
+// calls release resources in reverse order of creation, so the consumer
+// group leaves first and the telemetry providers are flushed last.
+func run() error {
+	var brokers, dbConn string
+	mustMapEnv(&brokers, "KAFKA_ADDR")
+	mustMapEnv(&dbConn, "DB_CONN")
+	topic := envOr("KAFKA_TOPIC", "orders")
+	group := envOr("KAFKA_GROUP_ID", "order-consumer")
+	dlqTopic := envOr("KAFKA_DLQ_TOPIC", "orders-dlq")
+	version, err := sarama.ParseKafkaVersion(envOr("KAFKA_VERSION", sarama.V3_0_0_0.String()))
+	if err != nil {
+		return fmt.Errorf("KAFKA_VERSION: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	tp := initTracerProvider()
+	defer func() {
+		if err := tp.Shutdown(context.Background()); err != nil {
+			log.Printf("Error shutting down tracer provider: %v", err)
+		}
+	}()
+
+	mp := initMeterProvider()
+	defer func() {
+		if err := mp.Shutdown(context.Background()); err != nil {
+			log.Printf("Error shutting down meter provider: %v", err)
+		}
+	}()
+
+	if err := runtime.Start(runtime.WithMinimumReadMemStatsInterval(time.Second)); err != nil {
+		return err
+	}
+
+	conn, err := postgres.NewConnection(dbConn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	sarama.Logger = log
+	addrs := strings.Split(brokers, ",")
+
+	// Dead letters must not be lost, so they wait for all in-sync replicas.
+	producerConfig := sarama.NewConfig()
+	producerConfig.Version = version
+	producerConfig.ClientID = group
+	producerConfig.Producer.RequiredAcks = sarama.WaitForAll
+	producerConfig.Producer.Return.Successes = true
+	producerConfig.Producer.Retry.Max = 5
+	dlq, err := sarama.NewSyncProducer(addrs, producerConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create dead-letter producer: %w", err)
+	}
+	defer dlq.Close()
+
+	// Offsets are committed by the handler, after each message is stored or
+	// dead-lettered, never in the background.
+	consumerConfig := sarama.NewConfig()
+	consumerConfig.Version = version
+	consumerConfig.ClientID = group
+	consumerConfig.Consumer.Offsets.Initial = sarama.OffsetOldest
+	consumerConfig.Consumer.Offsets.AutoCommit.Enable = false
+	consumerConfig.Consumer.Return.Errors = true
+	consumerGroup, err := sarama.NewConsumerGroup(addrs, group, consumerConfig)
+	if err != nil {
+		return fmt.Errorf("failed to join consumer group %s: %w", group, err)
+	}
+	defer func() {
+		log.Infof("leaving consumer group %s", group)
+		if err := consumerGroup.Close(); err != nil {
+			log.Errorf("failed to close consumer group: %+v", err)
+		}
+	}()
+	go func() {
+		for err := range consumerGroup.Errors() {
+			log.Errorf("consumer group error: %+v", err)
+		}
+	}()
+
+	h := &handler{
+		store:         postgres.NewOrderRepository(conn),
+		dlq:           dlq,
+		dlqTopic:      dlqTopic,
+		group:         group,
+		tracer:        tp.Tracer("order-consumer"),
+		log:           log,
+		writeAttempts: mustParseIntEnv("WRITE_ATTEMPTS", 3),
+		minBackoff:    mustParseDurationEnv("RETRY_MIN_BACKOFF", 500*time.Millisecond),
+		maxBackoff:    mustParseDurationEnv("RETRY_MAX_BACKOFF", 30*time.Second),
+	}
+
+	log.Infof("consuming %s as %s, dead letters go to %s", topic, group, dlqTopic)
+	// Consume returns at every rebalance, and is called again to join the
+	// next generation of the group.
+	for ctx.Err() == nil {
+		if err := consumerGroup.Consume(ctx, []string{topic}, h); err != nil {
+			if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+				return nil
+			}
+			log.Errorf("failed to consume %s: %+v", topic, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(h.minBackoff):
+			}
+		}
+	}
+	return nil
+}
+
+func mustMapEnv(target *string, envKey string) {
+	v := os.Getenv(envKey)
+	if v == "" {
+		panic(fmt.Sprintf("environment variable %q not set", envKey))
+	}
+	*target = v
+}
+
+func envOr(envKey, fallback string) string {
+	if v := os.Getenv(envKey); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func mustParseIntEnv(envKey string, fallback int) int {
+	v := os.Getenv(envKey)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		panic(fmt.Sprintf("environment variable %q is not a positive integer: %q", envKey, v))
+	}
+	return n
+}
+
+func mustParseDurationEnv(envKey string, fallback time.Duration) time.Duration {
+	v := os.Getenv(envKey)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		panic(fmt.Sprintf("environment variable %q is not a valid duration: %v", envKey, err))
+	}
+	return d
+}
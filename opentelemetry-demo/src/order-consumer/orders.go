@@ -0,0 +1,97 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/db/postgres"
+	pb "github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/order-consumer/genproto/oteldemo"
+)
+
+const nanosPerUnit = 1_000_000_000
+
+// orderRow converts an order event into the row stored for it. The event
+// does not carry the user, email or payment of the order, so those are left
+// empty, and the total is recomputed from the items, the shipping cost, the
+// adjustments and the taxes.
+func orderRow(order *pb.OrderResult) (*postgres.Order, error) {
+	if order.GetOrderId() == "" {
+		return nil, errors.New("order has no ID")
+	}
+	currency := order.GetShippingCost().GetCurrencyCode()
+	if currency == "" {
+		return nil, fmt.Errorf("order %s has no currency", order.GetOrderId())
+	}
+
+	total := toNanos(order.GetShippingCost())
+	row := &postgres.Order{
+		ID:                 order.GetOrderId(),
+		Status:             postgres.OrderStatusPlaced,
+		ShippingCost:       toMoneyRow(order.GetShippingCost()),
+		ShippingTrackingID: order.GetShippingTrackingId(),
+		ShippingAddress: postgres.Address{
+			StreetAddress: order.GetShippingAddress().GetStreetAddress(),
+			City:          order.GetShippingAddress().GetCity(),
+			State:         order.GetShippingAddress().GetState(),
+			Country:       order.GetShippingAddress().GetCountry(),
+			ZipCode:       order.GetShippingAddress().GetZipCode(),
+		},
+		Items:       make([]postgres.OrderItem, len(order.GetItems())),
+		Adjustments: make([]postgres.OrderAdjustment, len(order.GetAdjustments())),
+		Taxes:       make([]postgres.OrderTax, len(order.GetTaxes())),
+	}
+	for i, it := range order.GetItems() {
+		if code := it.GetCost().GetCurrencyCode(); code != currency {
+			return nil, fmt.Errorf("item %s of order %s costs %s, want %s", it.GetItem().GetProductId(), order.GetOrderId(), code, currency)
+		}
+		row.Items[i] = postgres.OrderItem{
+			ProductID: it.GetItem().GetProductId(),
+			Quantity:  it.GetItem().GetQuantity(),
+			Cost:      toMoneyRow(it.GetCost()),
+		}
+		total += toNanos(it.GetCost()) * int64(it.GetItem().GetQuantity())
+	}
+	for i, adj := range order.GetAdjustments() {
+		if code := adj.GetAmount().GetCurrencyCode(); code != currency {
+			return nil, fmt.Errorf("adjustment %s of order %s is in %s, want %s", adj.GetPromotionId(), order.GetOrderId(), code, currency)
+		}
+		row.Adjustments[i] = postgres.OrderAdjustment{
+			PromotionID: adj.GetPromotionId(),
+			Description: adj.GetDescription(),
+			PromoCode:   adj.GetPromoCode(),
+			Amount:      toMoneyRow(adj.GetAmount()),
+		}
+		total += toNanos(adj.GetAmount())
+	}
+	for i, line := range order.GetTaxes() {
+		if code := line.GetAmount().GetCurrencyCode(); code != currency {
+			return nil, fmt.Errorf("tax %s of order %s is in %s, want %s", line.GetTaxId(), order.GetOrderId(), code, currency)
+		}
+		row.Taxes[i] = postgres.OrderTax{
+			TaxID:         line.GetTaxId(),
+			Description:   line.GetDescription(),
+			Rate:          line.GetRate(),
+			TaxableAmount: toMoneyRow(line.GetTaxableAmount()),
+			Amount:        toMoneyRow(line.GetAmount()),
+		}
+		total += toNanos(line.GetAmount())
+	}
+	row.Total = postgres.Money{
+		CurrencyCode: currency,
+		Units:        total / nanosPerUnit,
+		Nanos:        int32(total % nanosPerUnit),
+	}
+	return row, nil
+}
+
+// toNanos returns m in nano units. Order amounts are far below the roughly
+// 9.2 billion units that fit.
+func toNanos(m *pb.Money) int64 {
+	return m.GetUnits()*nanosPerUnit + int64(m.GetNanos())
+}
+
+func toMoneyRow(m *pb.Money) postgres.Money {
+	return postgres.Money{CurrencyCode: m.GetCurrencyCode(), Units: m.GetUnits(), Nanos: m.GetNanos()}
+}
@@ -0,0 +1,69 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package main
+
+import (
+	"testing"
+
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/db/postgres"
+	pb "github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/order-consumer/genproto/oteldemo"
+)
+
+func TestOrderRow(t *testing.T) {
+	order := testOrder("order-1")
+	order.Adjustments = []*pb.OrderAdjustment{
+		{PromotionId: "WELCOME10", Amount: &pb.Money{CurrencyCode: "USD", Units: -4, Nanos: -990_000_000}},
+	}
+	order.Taxes = []*pb.TaxLine{
+		{TaxId: "us-ca", Amount: &pb.Money{CurrencyCode: "USD", Units: 3, Nanos: 180_000_000}},
+	}
+
+	row, err := orderRow(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 8.99 shipping + 2 × 19.99 - 4.99 discount + 3.18 tax.
+	want := postgres.Money{CurrencyCode: "USD", Units: 47, Nanos: 160_000_000}
+	if row.Total != want {
+		t.Errorf("total = %+v, want %+v", row.Total, want)
+	}
+	if row.ID != "order-1" || row.Status != postgres.OrderStatusPlaced || row.ShippingTrackingID != "TRACK-1" {
+		t.Errorf("unexpected row: %+v", row)
+	}
+	if row.ShippingAddress.City != "Mountain View" || len(row.Items) != 1 || row.Items[0].ProductID != "OLJCESPC7Z" || row.Items[0].Quantity != 2 {
+		t.Errorf("unexpected address or items: %+v", row)
+	}
+	wantAdj := postgres.OrderAdjustment{PromotionID: "WELCOME10", Amount: postgres.Money{CurrencyCode: "USD", Units: -4, Nanos: -990_000_000}}
+	if len(row.Adjustments) != 1 || row.Adjustments[0] != wantAdj {
+		t.Errorf("adjustments = %+v, want [%+v]", row.Adjustments, wantAdj)
+	}
+	if len(row.Taxes) != 1 || row.Taxes[0].TaxID != "us-ca" || row.Taxes[0].Amount != (postgres.Money{CurrencyCode: "USD", Units: 3, Nanos: 180_000_000}) {
+		t.Errorf("taxes = %+v, want the us-ca line", row.Taxes)
+	}
+}
+
+func TestOrderRowErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*pb.OrderResult)
+	}{
+		{"NoID", func(o *pb.OrderResult) { o.OrderId = "" }},
+		{"NoCurrency", func(o *pb.OrderResult) { o.ShippingCost = nil }},
+		{"MixedItemCurrency", func(o *pb.OrderResult) { o.Items[0].Cost.CurrencyCode = "EUR" }},
+		{"MixedAdjustmentCurrency", func(o *pb.OrderResult) {
+			o.Adjustments = []*pb.OrderAdjustment{{PromotionId: "WELCOME10", Amount: &pb.Money{CurrencyCode: "EUR", Units: -1}}}
+		}},
+		{"MixedTaxCurrency", func(o *pb.OrderResult) {
+			o.Taxes = []*pb.TaxLine{{TaxId: "us-ca", Amount: &pb.Money{CurrencyCode: "EUR", Units: 1}}}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := testOrder("order-1")
+			tt.modify(order)
+			if _, err := orderRow(order); err == nil {
+				t.Error("orderRow() succeeded, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build tools
+// +build tools
+
+package tools
+
+// This file follows the recommendation at
+// https://go.dev/wiki/Modules#how-can-i-track-tool-dependencies-for-a-module
+// on how to pin tooling dependencies to a go.mod file.
+// This ensures that all systems use the same version of tools in addition to regular dependencies.
+
+import (
+	_ "google.golang.org/grpc/cmd/protoc-gen-go-grpc"
+	_ "google.golang.org/protobuf/cmd/protoc-gen-go"
+)
@@ -86,3 +86,21 @@ module.exports.charge = async request => {
 
   return { transactionId };
 };
+
+module.exports.refund = async request => {
+  const span = tracer.startSpan('refund');
+
+  const { transactionId } = request;
+  if (!transactionId) {
+    span.end();
+    throw new Error('A transaction id is required to refund a charge.');
+  }
+
+  const refundId = uuidv4();
+  const { units, nanos, currencyCode } = request.amount;
+  span.setAttributes({ 'app.payment.refunded': true });
+  logger.info({ transactionId, refundId, amount: { units, nanos, currencyCode } }, 'Refund complete.');
+  span.end();
+
+  return { refundId };
+};
@@ -31,6 +31,30 @@ async function chargeServiceHandler(call, callback) {
   }
 }
 
+async function refundServiceHandler(call, callback) {
+  const span = opentelemetry.trace.getActiveSpan();
+
+  try {
+    const { transactionId, amount } = call.request
+    span.setAttributes({
+      'app.payment.transaction.id': transactionId,
+      'app.payment.amount': parseFloat(`${amount.units}.${amount.nanos}`).toFixed(2)
+    })
+    logger.info({ transactionId }, "Refund request received.")
+
+    const response = await charge.refund(call.request)
+    callback(null, response)
+
+  } catch (err) {
+    logger.warn({ err })
+
+    span.recordException(err)
+    span.setStatus({ code: opentelemetry.SpanStatusCode.ERROR })
+
+    callback(err)
+  }
+}
+
 async function closeGracefully(signal) {
   server.forceShutdown()
   process.kill(process.pid, signal)
@@ -43,7 +67,7 @@ server.addService(health.service, new health.Implementation({
   '': health.servingStatus.SERVING
 }))
 
-server.addService(otelDemoPackage.oteldemo.PaymentService.service, { charge: chargeServiceHandler })
+server.addService(otelDemoPackage.oteldemo.PaymentService.service, { charge: chargeServiceHandler, refund: refundServiceHandler })
 
 server.bindAsync(`0.0.0.0:${process.env['PAYMENT_PORT']}`, grpc.ServerCredentials.createInsecure(), (err, port) => {
   if (err) {
@@ -5,6 +5,9 @@ go 1.22.7
 toolchain go1.22.9
 
 require (
+	github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/faultinject v0.0.0-00010101000000-000000000000
+	github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/health v0.0.0-00010101000000-000000000000
+	github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/redact v0.0.0-00010101000000-000000000000
 	github.com/open-feature/go-sdk v1.14.1
 	github.com/open-feature/go-sdk-contrib/hooks/open-telemetry v0.3.4
 	github.com/open-feature/go-sdk-contrib/providers/flagd v0.2.6
@@ -76,3 +79,9 @@ require (
 	sigs.k8s.io/json v0.0.0-20221116044647-bc3834ca7abd // indirect
 	sigs.k8s.io/structured-merge-diff/v4 v4.4.1 // indirect
 )
+
+replace github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/faultinject => ../faultinject
+
+replace github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/health => ../health
+
+replace github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/redact => ../redact
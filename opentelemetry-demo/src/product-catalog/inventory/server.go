@@ -0,0 +1,105 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package inventory
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/opentelemetry/opentelemetry-demo/src/product-catalog/genproto/oteldemo"
+)
+
+// DefaultTTL is how long stock is held when a reservation does not say.
+const DefaultTTL = 5 * time.Minute
+
+// MaxTTL bounds how long a reservation can hold stock.
+const MaxTTL = time.Hour
+
+// Server serves the InventoryService from a Store.
+type Server struct {
+	pb.UnimplementedInventoryServiceServer
+	store *Store
+}
+
+// NewServer creates a Server for store.
+func NewServer(store *Store) *Server {
+	return &Server{store: store}
+}
+
+// ReserveStock implements pb.InventoryServiceServer. A shortage is reported
+// with FAILED_PRECONDITION and the short products on the span.
+func (s *Server) ReserveStock(ctx context.Context, req *pb.ReserveStockRequest) (*pb.ReserveStockResponse, error) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.String("app.inventory.reservation.id", req.ReservationId),
+		attribute.Int("app.inventory.reservation.items.count", len(req.Items)),
+	)
+
+	ttl := DefaultTTL
+	if req.Ttl != nil {
+		if err := req.Ttl.CheckValid(); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid ttl: %v", err)
+		}
+		ttl = min(req.Ttl.AsDuration(), MaxTTL)
+	}
+	lines := make([]Line, len(req.Items))
+	for i, it := range req.Items {
+		lines[i] = Line{ProductID: it.ProductId, Quantity: int64(it.Quantity)}
+	}
+
+	expires, err := s.store.Reserve(req.ReservationId, lines, ttl)
+	if err != nil {
+		var shortage *ShortageError
+		if errors.As(err, &shortage) {
+			ids := make([]string, len(shortage.Shortages))
+			for i, short := range shortage.Shortages {
+				ids[i] = short.ProductID
+			}
+			span.SetAttributes(attribute.StringSlice("app.inventory.shortage", ids))
+		}
+		return nil, toStatus(err)
+	}
+	span.AddEvent("reserved")
+	return &pb.ReserveStockResponse{ExpiresAt: timestamppb.New(expires)}, nil
+}
+
+// CommitReservation implements pb.InventoryServiceServer. An expired
+// reservation is reported with NOT_FOUND.
+func (s *Server) CommitReservation(ctx context.Context, req *pb.CommitReservationRequest) (*pb.Empty, error) {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("app.inventory.reservation.id", req.ReservationId))
+	if err := s.store.Commit(req.ReservationId); err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.Empty{}, nil
+}
+
+// ReleaseReservation implements pb.InventoryServiceServer.
+func (s *Server) ReleaseReservation(ctx context.Context, req *pb.ReleaseReservationRequest) (*pb.Empty, error) {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("app.inventory.reservation.id", req.ReservationId))
+	if err := s.store.Release(req.ReservationId); err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.Empty{}, nil
+}
+
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, ErrInsufficientStock):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrConflict):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, ErrInvalid):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package inventory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	pb "github.com/opentelemetry/opentelemetry-demo/src/product-catalog/genproto/oteldemo"
+)
+
+func TestServer(t *testing.T) {
+	store, _ := newTestStore()
+	srv := NewServer(store)
+	ctx := context.Background()
+	items := []*pb.CartItem{{ProductId: "OLJCESPC7Z", Quantity: 4}}
+
+	resp, err := srv.ReserveStock(ctx, &pb.ReserveStockRequest{ReservationId: "order-1", Items: items})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := store.now().Add(DefaultTTL); !resp.GetExpiresAt().AsTime().Equal(want) {
+		t.Errorf("expires_at = %v, want the default ttl", resp.GetExpiresAt().AsTime())
+	}
+	resp, err = srv.ReserveStock(ctx, &pb.ReserveStockRequest{ReservationId: "order-2", Items: items, Ttl: durationpb.New(24 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := store.now().Add(MaxTTL); !resp.GetExpiresAt().AsTime().Equal(want) {
+		t.Errorf("expires_at = %v, want the ttl capped", resp.GetExpiresAt().AsTime())
+	}
+
+	for name, tt := range map[string]struct {
+		call func() error
+		want codes.Code
+	}{
+		"Shortage": {func() error {
+			_, err := srv.ReserveStock(ctx, &pb.ReserveStockRequest{ReservationId: "order-3", Items: items})
+			return err
+		}, codes.FailedPrecondition},
+		"Conflict": {func() error {
+			other := []*pb.CartItem{{ProductId: "OLJCESPC7Z", Quantity: 1}}
+			_, err := srv.ReserveStock(ctx, &pb.ReserveStockRequest{ReservationId: "order-1", Items: other})
+			return err
+		}, codes.AlreadyExists},
+		"NoItems": {func() error {
+			_, err := srv.ReserveStock(ctx, &pb.ReserveStockRequest{ReservationId: "order-3"})
+			return err
+		}, codes.InvalidArgument},
+		"NegativeTTL": {func() error {
+			_, err := srv.ReserveStock(ctx, &pb.ReserveStockRequest{ReservationId: "order-3", Items: items, Ttl: durationpb.New(-time.Second)})
+			return err
+		}, codes.InvalidArgument},
+		"CommitUnknown": {func() error {
+			_, err := srv.CommitReservation(ctx, &pb.CommitReservationRequest{ReservationId: "unknown"})
+			return err
+		}, codes.NotFound},
+		"Commit": {func() error {
+			_, err := srv.CommitReservation(ctx, &pb.CommitReservationRequest{ReservationId: "order-1"})
+			return err
+		}, codes.OK},
+		"Release": {func() error {
+			_, err := srv.ReleaseReservation(ctx, &pb.ReleaseReservationRequest{ReservationId: "unknown"})
+			return err
+		}, codes.OK},
+	} {
+		if got := status.Code(tt.call()); got != tt.want {
+			t.Errorf("%s: code = %v, want %v", name, got, tt.want)
+		}
+	}
+}
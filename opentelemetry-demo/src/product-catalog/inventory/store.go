@@ -0,0 +1,300 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package inventory keeps the stock of the catalog and holds it for orders
+// while they are placed.
+package inventory
+
+import (
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInsufficientStock is wrapped by a *ShortageError when a
+	// reservation asks for more than is available.
+	ErrInsufficientStock = errors.New("insufficient stock")
+	// ErrNotFound is returned when committing a reservation that does not
+	// exist, because it expired or was released.
+	ErrNotFound = errors.New("reservation not found")
+	// ErrConflict is returned when a reservation id is reused for other
+	// items, or reserved again once committed.
+	ErrConflict = errors.New("reservation already exists")
+	// ErrInvalid is returned for reservations without an id or items, or
+	// with a quantity that is not positive.
+	ErrInvalid = errors.New("invalid reservation")
+)
+
+// committedRetention is how long a committed reservation is kept so that it
+// can still be released, returning its stock, when the order that made it
+// is rolled back.
+const committedRetention = time.Hour
+
+// Shortage is a product of a reservation with less stock available than
+// requested.
+type Shortage struct {
+	ProductID string
+	Requested int64
+	Available int64
+}
+
+// ShortageError lists every product of a reservation that is short.
+type ShortageError struct {
+	Shortages []Shortage
+}
+
+func (e *ShortageError) Error() string {
+	parts := make([]string, len(e.Shortages))
+	for i, s := range e.Shortages {
+		parts[i] = fmt.Sprintf("%s: %d requested, %d available", s.ProductID, s.Requested, s.Available)
+	}
+	return fmt.Sprintf("%v: %s", ErrInsufficientStock, strings.Join(parts, ", "))
+}
+
+func (e *ShortageError) Unwrap() error { return ErrInsufficientStock }
+
+// Line is a product and the quantity reserved of it.
+type Line struct {
+	ProductID string
+	Quantity  int64
+}
+
+type reservation struct {
+	id        string
+	lines     map[string]int64
+	expires   time.Time
+	committed bool
+	// index is the position of the reservation in the expiry heap.
+	index int
+}
+
+// Store is an in-memory inventory. Only the products it was given stock for
+// are tracked; reservations of other products always succeed. Stock that is
+// held by a reservation is not available to others until the reservation is
+// released or expires. Committing a reservation takes its stock off hand for
+// good.
+type Store struct {
+	now func() time.Time
+
+	mu           sync.Mutex
+	onHand       map[string]int64
+	held         map[string]int64
+	reservations map[string]*reservation
+	expiry       expiryHeap
+}
+
+// NewStore creates a Store with the given quantities on hand, by product id.
+func NewStore(stock map[string]int64) *Store {
+	onHand := make(map[string]int64, len(stock))
+	for id, quantity := range stock {
+		onHand[id] = quantity
+	}
+	return &Store{
+		now:          time.Now,
+		onHand:       onHand,
+		held:         make(map[string]int64),
+		reservations: make(map[string]*reservation),
+	}
+}
+
+// Reserve holds the stock of lines for ttl under id and returns when the hold
+// expires. Either every line is reserved or none is: when some products are
+// short, the error is a *ShortageError listing all of them. Reserving again
+// with the same id and lines returns the existing reservation, so callers
+// can retry.
+func (s *Store) Reserve(id string, lines []Line, ttl time.Duration) (time.Time, error) {
+	if id == "" || len(lines) == 0 || ttl <= 0 {
+		return time.Time{}, fmt.Errorf("%w: id, items and a positive ttl are required", ErrInvalid)
+	}
+	wanted := make(map[string]int64, len(lines))
+	for _, l := range lines {
+		if l.Quantity <= 0 {
+			return time.Time{}, fmt.Errorf("%w: quantity of %q must be positive", ErrInvalid, l.ProductID)
+		}
+		wanted[l.ProductID] += l.Quantity
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.expire(now)
+
+	if r, ok := s.reservations[id]; ok {
+		if r.committed || !sameLines(r.lines, wanted) {
+			return time.Time{}, fmt.Errorf("%w: %q", ErrConflict, id)
+		}
+		return r.expires, nil
+	}
+
+	var shortages []Shortage
+	for productID, quantity := range wanted {
+		onHand, tracked := s.onHand[productID]
+		if !tracked {
+			continue
+		}
+		if available := onHand - s.held[productID]; available < quantity {
+			shortages = append(shortages, Shortage{ProductID: productID, Requested: quantity, Available: max(available, 0)})
+		}
+	}
+	if len(shortages) > 0 {
+		sort.Slice(shortages, func(i, j int) bool { return shortages[i].ProductID < shortages[j].ProductID })
+		return time.Time{}, &ShortageError{Shortages: shortages}
+	}
+
+	for productID, quantity := range wanted {
+		if _, tracked := s.onHand[productID]; tracked {
+			s.held[productID] += quantity
+		}
+	}
+	r := &reservation{id: id, lines: wanted, expires: now.Add(ttl)}
+	s.reservations[id] = r
+	heap.Push(&s.expiry, r)
+	return r.expires, nil
+}
+
+// Commit takes the stock held by the reservation id off hand. It fails with
+// ErrNotFound once the reservation has expired. Committing twice is a no-op.
+func (s *Store) Commit(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.expire(now)
+
+	r, ok := s.reservations[id]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrNotFound, id)
+	}
+	if r.committed {
+		return nil
+	}
+	for productID, quantity := range r.lines {
+		if _, tracked := s.onHand[productID]; tracked {
+			s.held[productID] -= quantity
+			s.onHand[productID] -= quantity
+		}
+	}
+	r.committed = true
+	r.expires = now.Add(committedRetention)
+	heap.Fix(&s.expiry, r.index)
+	return nil
+}
+
+// Release gives back the stock of the reservation id, whether it is held or
+// was committed. Releasing an unknown or expired reservation is a no-op.
+func (s *Store) Release(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(s.now())
+
+	r, ok := s.reservations[id]
+	if !ok {
+		return nil
+	}
+	for productID, quantity := range r.lines {
+		if _, tracked := s.onHand[productID]; !tracked {
+			continue
+		}
+		if r.committed {
+			s.onHand[productID] += quantity
+		} else {
+			s.held[productID] -= quantity
+		}
+	}
+	heap.Remove(&s.expiry, r.index)
+	delete(s.reservations, id)
+	return nil
+}
+
+// Available returns the stock of productID that can still be reserved, and
+// whether the product is tracked at all.
+func (s *Store) Available(productID string) (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(s.now())
+
+	onHand, tracked := s.onHand[productID]
+	return onHand - s.held[productID], tracked
+}
+
+// expire drops the reservations whose time is up. Held stock becomes
+// available again; committed stock stays off hand.
+func (s *Store) expire(now time.Time) {
+	for s.expiry.Len() > 0 && !s.expiry[0].expires.After(now) {
+		r := heap.Pop(&s.expiry).(*reservation)
+		if !r.committed {
+			for productID, quantity := range r.lines {
+				if _, tracked := s.onHand[productID]; tracked {
+					s.held[productID] -= quantity
+				}
+			}
+		}
+		delete(s.reservations, r.id)
+	}
+}
+
+func sameLines(a, b map[string]int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for productID, quantity := range a {
+		if b[productID] != quantity {
+			return false
+		}
+	}
+	return true
+}
+
+// LoadStock reads the quantities on hand from a JSON file that maps product
+// ids to quantities, such as {"OLJCESPC7Z": 10}.
+func LoadStock(path string) (map[string]int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var stock map[string]int64
+	if err := json.Unmarshal(data, &stock); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var errs []error
+	for productID, quantity := range stock {
+		if quantity < 0 {
+			errs = append(errs, fmt.Errorf("%s: stock of %q must not be negative", path, productID))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return stock, nil
+}
+
+// expiryHeap orders reservations by expiry, soonest first.
+type expiryHeap []*reservation
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expires.Before(h[j].expires) }
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x any) {
+	r := x.(*reservation)
+	r.index = len(*h)
+	*h = append(*h, r)
+}
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	r := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return r
+}
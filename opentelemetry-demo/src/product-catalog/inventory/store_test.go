@@ -0,0 +1,253 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestStore returns a Store with 10 telescopes and 3 lenses on hand, and
+// a function that moves its clock forward.
+func newTestStore() (*Store, func(time.Duration)) {
+	s := NewStore(map[string]int64{"OLJCESPC7Z": 10, "66VCHSJNUP": 3})
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var mu sync.Mutex
+	s.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	return s, func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+}
+
+func wantAvailable(t *testing.T, s *Store, productID string, want int64) {
+	t.Helper()
+	if got, _ := s.Available(productID); got != want {
+		t.Errorf("Available(%q) = %d, want %d", productID, got, want)
+	}
+}
+
+func TestReserveHoldsStock(t *testing.T) {
+	s, _ := newTestStore()
+	lines := []Line{{"OLJCESPC7Z", 2}, {"66VCHSJNUP", 1}, {"OLJCESPC7Z", 1}}
+	expires, err := s.Reserve("order-1", lines, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := s.now().Add(time.Minute); !expires.Equal(want) {
+		t.Errorf("expires = %v, want %v", expires, want)
+	}
+	wantAvailable(t, s, "OLJCESPC7Z", 7)
+	wantAvailable(t, s, "66VCHSJNUP", 2)
+
+	// Retrying the same reservation holds nothing more.
+	if again, err := s.Reserve("order-1", lines, time.Minute); err != nil || !again.Equal(expires) {
+		t.Errorf("Reserve() again = %v, %v, want %v", again, err, expires)
+	}
+	wantAvailable(t, s, "OLJCESPC7Z", 7)
+
+	if _, err := s.Reserve("order-1", lines[:1], time.Minute); !errors.Is(err, ErrConflict) {
+		t.Errorf("Reserve() with other items error = %v, want ErrConflict", err)
+	}
+}
+
+func TestReserveIsAllOrNothing(t *testing.T) {
+	s, _ := newTestStore()
+	_, err := s.Reserve("order-1", []Line{{"OLJCESPC7Z", 11}, {"66VCHSJNUP", 1}, {"L9ECAV7KIM", 4}}, time.Minute)
+	var shortage *ShortageError
+	if !errors.As(err, &shortage) || !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("Reserve() error = %v, want a shortage", err)
+	}
+	if want := []Shortage{{"OLJCESPC7Z", 11, 10}}; fmt.Sprint(shortage.Shortages) != fmt.Sprint(want) {
+		t.Errorf("shortages = %v, want %v", shortage.Shortages, want)
+	}
+	wantAvailable(t, s, "66VCHSJNUP", 3)
+
+	// Products without stock are not tracked and never run out.
+	if _, err := s.Reserve("order-2", []Line{{"L9ECAV7KIM", 1000}}, time.Minute); err != nil {
+		t.Errorf("Reserve(untracked) error = %v", err)
+	}
+	if _, tracked := s.Available("L9ECAV7KIM"); tracked {
+		t.Error("L9ECAV7KIM is tracked")
+	}
+}
+
+func TestReserveRejectsInvalid(t *testing.T) {
+	s, _ := newTestStore()
+	for name, reserve := range map[string]func() error{
+		"NoID":         func() error { _, err := s.Reserve("", []Line{{"OLJCESPC7Z", 1}}, time.Minute); return err },
+		"NoItems":      func() error { _, err := s.Reserve("order-1", nil, time.Minute); return err },
+		"ZeroQuantity": func() error { _, err := s.Reserve("order-1", []Line{{"OLJCESPC7Z", 0}}, time.Minute); return err },
+		"NoTTL":        func() error { _, err := s.Reserve("order-1", []Line{{"OLJCESPC7Z", 1}}, 0); return err },
+	} {
+		if err := reserve(); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: error = %v, want ErrInvalid", name, err)
+		}
+	}
+}
+
+func TestReservationExpires(t *testing.T) {
+	s, advance := newTestStore()
+	if _, err := s.Reserve("order-1", []Line{{"OLJCESPC7Z", 10}}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Reserve("order-2", []Line{{"OLJCESPC7Z", 1}}, time.Minute); !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("Reserve() error = %v, want ErrInsufficientStock", err)
+	}
+
+	advance(time.Minute)
+	wantAvailable(t, s, "OLJCESPC7Z", 10)
+	if err := s.Commit("order-1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Commit(expired) error = %v, want ErrNotFound", err)
+	}
+	if _, err := s.Reserve("order-2", []Line{{"OLJCESPC7Z", 1}}, time.Minute); err != nil {
+		t.Errorf("Reserve() after expiry error = %v", err)
+	}
+}
+
+func TestCommitTakesStockOffHand(t *testing.T) {
+	s, advance := newTestStore()
+	if _, err := s.Reserve("order-1", []Line{{"OLJCESPC7Z", 4}}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Commit("order-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Commit("order-1"); err != nil {
+		t.Errorf("Commit() again error = %v", err)
+	}
+	wantAvailable(t, s, "OLJCESPC7Z", 6)
+
+	// A committed reservation outlives its ttl and stays off hand.
+	advance(2 * time.Minute)
+	wantAvailable(t, s, "OLJCESPC7Z", 6)
+	if _, err := s.Reserve("order-1", []Line{{"OLJCESPC7Z", 4}}, time.Minute); !errors.Is(err, ErrConflict) {
+		t.Errorf("Reserve(committed) error = %v, want ErrConflict", err)
+	}
+
+	advance(committedRetention)
+	wantAvailable(t, s, "OLJCESPC7Z", 6)
+}
+
+func TestRelease(t *testing.T) {
+	s, _ := newTestStore()
+	if _, err := s.Reserve("held", []Line{{"OLJCESPC7Z", 2}}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Reserve("committed", []Line{{"OLJCESPC7Z", 3}}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Commit("committed"); err != nil {
+		t.Fatal(err)
+	}
+	wantAvailable(t, s, "OLJCESPC7Z", 5)
+
+	for _, id := range []string{"held", "committed", "committed", "unknown"} {
+		if err := s.Release(id); err != nil {
+			t.Errorf("Release(%q) error = %v", id, err)
+		}
+	}
+	wantAvailable(t, s, "OLJCESPC7Z", 10)
+	if err := s.Commit("held"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Commit(released) error = %v, want ErrNotFound", err)
+	}
+}
+
+// TestReserveConcurrentNeverOversells is meant to be run with -race.
+func TestReserveConcurrentNeverOversells(t *testing.T) {
+	s, advance := newTestStore()
+
+	const buyers = 200
+	var (
+		wg       sync.WaitGroup
+		reserved atomic.Int64
+		sold     atomic.Int64
+	)
+	for i := 0; i < buyers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id := fmt.Sprintf("order-%d", i)
+			_, err := s.Reserve(id, []Line{{"OLJCESPC7Z", 1}, {"66VCHSJNUP", int64(i%2 + 1)}}, time.Minute)
+			switch {
+			case errors.Is(err, ErrInsufficientStock):
+				return
+			case err != nil:
+				t.Error(err)
+				return
+			}
+			reserved.Add(1)
+			// Some buyers give up, some let the reservation expire,
+			// the rest pay for it.
+			switch i % 3 {
+			case 0:
+				if err := s.Release(id); err != nil {
+					t.Error(err)
+				}
+			case 1:
+				advance(time.Second)
+			default:
+				if err := s.Commit(id); err == nil {
+					sold.Add(1)
+				} else if !errors.Is(err, ErrNotFound) {
+					t.Error(err)
+				}
+			}
+			if available, _ := s.Available("66VCHSJNUP"); available < 0 {
+				t.Errorf("available lenses = %d", available)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if reserved.Load() == 0 {
+		t.Fatal("no reservation succeeded")
+	}
+	telescopes, _ := s.Available("OLJCESPC7Z")
+	lenses, _ := s.Available("66VCHSJNUP")
+	if telescopes < 0 || lenses < 0 {
+		t.Fatalf("oversold: %d telescopes and %d lenses available", telescopes, lenses)
+	}
+
+	// Once every hold has expired, only the sold stock is gone.
+	advance(2 * time.Minute)
+	telescopes, _ = s.Available("OLJCESPC7Z")
+	if want := 10 - sold.Load(); telescopes != want {
+		t.Errorf("available telescopes = %d, want %d after %d sales", telescopes, want, sold.Load())
+	}
+}
+
+func TestLoadStock(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "inventory.json")
+	if err := os.WriteFile(path, []byte(`{"OLJCESPC7Z": 10, "66VCHSJNUP": 0}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stock, err := LoadStock(path)
+	if err != nil || len(stock) != 2 || stock["OLJCESPC7Z"] != 10 {
+		t.Errorf("LoadStock() = %v, %v", stock, err)
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(bad, []byte(`{"OLJCESPC7Z": -1, "66VCHSJNUP": -2}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadStock(bad)
+	for _, want := range []string{`"OLJCESPC7Z" must not be negative`, `"66VCHSJNUP" must not be negative`} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("LoadStock(bad.json) error = %v, want %q", err, want)
+		}
+	}
+}
@@ -34,10 +34,14 @@ import (
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.opentelemetry.io/otel/trace"
 
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/faultinject"
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/health"
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/redact"
 	otelhooks "github.com/open-feature/go-sdk-contrib/hooks/open-telemetry/pkg"
 	flagd "github.com/open-feature/go-sdk-contrib/providers/flagd/pkg"
 	"github.com/open-feature/go-sdk/openfeature"
 	pb "github.com/opentelemetry/opentelemetry-demo/src/product-catalog/genproto/oteldemo"
+	"github.com/opentelemetry/opentelemetry-demo/src/product-catalog/inventory"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
@@ -49,9 +53,15 @@ import (
 
 var (
 	log               *logrus.Logger
+	redactor          *redact.Redactor
 	catalog           []*pb.Product
 	resource          *sdkresource.Resource
 	initResourcesOnce sync.Once
+
+	// catalogLoadErr is the result of the last attempt to load the catalog,
+	// guarded by catalogLoadMu.
+	catalogLoadMu  sync.Mutex
+	catalogLoadErr error
 )
 
 const DEFAULT_RELOAD_INTERVAL = 10
@@ -59,6 +69,12 @@ const DEFAULT_RELOAD_INTERVAL = 10
 func init() {
 	log = logrus.New()
 
+	var err error
+	if redactor, err = redact.FromEnv(); err != nil {
+		log.Fatalf("Redaction Rules: %v", err)
+	}
+	redact.InstallLogrus(log, redactor)
+
 	loadProductCatalog()
 }
 
@@ -87,7 +103,7 @@ func initTracerProvider() *sdktrace.TracerProvider {
 		log.Fatalf("OTLP Trace gRPC Creation: %v", err)
 	}
 	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSpanProcessor(redact.NewSpanProcessor(redactor, sdktrace.NewBatchSpanProcessor(exporter))),
 		sdktrace.WithResource(initResource()),
 	)
 	otel.SetTracerProvider(tp)
@@ -139,6 +155,12 @@ func main() {
 	}
 
 	svc := &productCatalog{}
+	inventorySvc := inventory.NewServer(inventory.NewStore(loadStock()))
+
+	registry := health.NewRegistry(pb.ProductCatalogService_ServiceDesc.ServiceName)
+	registry.Logf = log.Warnf
+	registry.Register("catalog", checkCatalogLoaded)
+
 	var port string
 	mustMapEnv(&port, "PRODUCT_CATALOG_PORT")
 
@@ -149,18 +171,28 @@ func main() {
 		log.Fatalf("TCP Listen: %v", err)
 	}
 
+	// Chaos scenarios, such as productCatalogFailure, are fault lists in
+	// these flags, injected into the calls the catalog serves.
+	faults := faultinject.NewOpenFeature("productCatalog", "productCatalogFailure", "productCatalogFaults")
+	faults.Logf = log.Warnf
+
 	srv := grpc.NewServer(
 		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(faults.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(faults.StreamServerInterceptor()),
 	)
 
 	reflection.Register(srv)
 
 	pb.RegisterProductCatalogServiceServer(srv, svc)
-	healthpb.RegisterHealthServer(srv, svc)
+	pb.RegisterInventoryServiceServer(srv, inventorySvc)
+	healthpb.RegisterHealthServer(srv, registry)
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGKILL)
 	defer cancel()
 
+	go registry.Run(ctx)
+
 	go func() {
 		if err := srv.Serve(ln); err != nil {
 			log.Fatalf("Failed to serve gRPC server, err: %v", err)
@@ -169,6 +201,7 @@ func main() {
 
 	<-ctx.Done()
 
+	registry.Drain()
 	srv.GracefulStop()
 	log.Println("Product Catalog gRPC server stopped")
 }
@@ -205,6 +238,7 @@ func loadProductCatalog() {
 			case <-ticker.C:
 				log.Info("Reloading Product Catalog...")
 				catalog, err = readProductFiles()
+				setCatalogLoadErr(err)
 				if err != nil {
 					log.Errorf("Error reading product files: %v", err)
 					continue
@@ -214,6 +248,39 @@ func loadProductCatalog() {
 	}()
 }
 
+func setCatalogLoadErr(err error) {
+	catalogLoadMu.Lock()
+	defer catalogLoadMu.Unlock()
+	catalogLoadErr = err
+}
+
+// checkCatalogLoaded is the health probe of the catalog. It fails while the
+// last reload of the product files failed.
+func checkCatalogLoaded(context.Context) error {
+	catalogLoadMu.Lock()
+	defer catalogLoadMu.Unlock()
+	if catalogLoadErr != nil {
+		return fmt.Errorf("failed to load the product catalog: %w", catalogLoadErr)
+	}
+	return nil
+}
+
+// loadStock reads the stock of the inventory from INVENTORY_FILE. Without
+// it no product is tracked, so reservations always succeed.
+func loadStock() map[string]int64 {
+	path := os.Getenv("INVENTORY_FILE")
+	if path == "" {
+		log.Info("INVENTORY_FILE not set, stock is not tracked")
+		return nil
+	}
+	stock, err := inventory.LoadStock(path)
+	if err != nil {
+		log.Fatalf("Inventory: %v", err)
+	}
+	log.Infof("Loaded stock of %d products", len(stock))
+	return stock
+}
+
 func readProductFiles() ([]*pb.Product, error) {
 
 	// find all .json files in the products directory
@@ -263,14 +330,6 @@ func mustMapEnv(target *string, key string) {
 	*target = value
 }
 
-func (p *productCatalog) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
-	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
-}
-
-func (p *productCatalog) Watch(req *healthpb.HealthCheckRequest, ws healthpb.Health_WatchServer) error {
-	return status.Errorf(codes.Unimplemented, "health check via Watch not implemented")
-}
-
 func (p *productCatalog) ListProducts(ctx context.Context, req *pb.Empty) (*pb.ListProductsResponse, error) {
 	span := trace.SpanFromContext(ctx)
 
@@ -286,14 +345,6 @@ func (p *productCatalog) GetProduct(ctx context.Context, req *pb.GetProductReque
 		attribute.String("app.product.id", req.Id),
 	)
 
-	// GetProduct will fail on a specific product when feature flag is enabled
-	if p.checkProductFailure(ctx, req.Id) {
-		msg := fmt.Sprintf("Error: Product Catalog Fail Feature Flag Enabled")
-		span.SetStatus(otelcodes.Error, msg)
-		span.AddEvent(msg)
-		return nil, status.Errorf(codes.Internal, msg)
-	}
-
 	var found *pb.Product
 	for _, product := range catalog {
 		if req.Id == product.Id {
@@ -333,18 +384,6 @@ func (p *productCatalog) SearchProducts(ctx context.Context, req *pb.SearchProdu
 	return &pb.SearchProductsResponse{Results: result}, nil
 }
 
-func (p *productCatalog) checkProductFailure(ctx context.Context, id string) bool {
-	if id != "OLJCESPC7Z" {
-		return false
-	}
-
-	client := openfeature.NewClient("productCatalog")
-	failureEnabled, _ := client.BooleanValue(
-		ctx, "productCatalogFailure", false, openfeature.EvaluationContext{},
-	)
-	return failureEnabled
-}
-
 func createClient(ctx context.Context, svcAddr string) (*grpc.ClientConn, error) {
 	return grpc.DialContext(ctx, svcAddr,
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
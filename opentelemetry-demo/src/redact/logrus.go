@@ -0,0 +1,80 @@
+package redact
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+)
+
+// Hook is a logrus hook that masks the message and fields of every entry
+// before it is formatted. Fields named by a rule key are masked entirely,
+// proto messages are masked with Proto, and strings, errors and
+// fmt.Stringers are searched for pattern matches.
+type Hook struct {
+	Redactor *Redactor
+}
+
+// Levels implements logrus.Hook.
+func (h Hook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook. logrus hands hooks a copy of the entry, so
+// the fields of the entry the caller holds are left as they are.
+func (h Hook) Fire(entry *logrus.Entry) error {
+	entry.Message = h.Redactor.String(entry.Message)
+	for key, value := range entry.Data {
+		entry.Data[key] = h.Redactor.Value(key, value)
+	}
+	return nil
+}
+
+// Value masks a log field or other value of any type stored under key.
+// Values of types it does not know are returned as they are.
+func (r *Redactor) Value(key string, value any) any {
+	if r == nil || value == nil {
+		return value
+	}
+	if c := r.ruleForKey(key); c != nil {
+		if s, ok := value.(string); ok {
+			return mask(c.Mask, s)
+		}
+		return Redacted
+	}
+	switch v := value.(type) {
+	case string:
+		return r.String(v)
+	case proto.Message:
+		return r.Proto(v)
+	case error:
+		return r.String(v.Error())
+	case fmt.Stringer:
+		return r.String(v.String())
+	}
+	return value
+}
+
+// Formatter formats entries with Next and masks every pattern match in the
+// result. It catches what the hook cannot see, such as values formatted
+// into the output by Next.
+type Formatter struct {
+	Next     logrus.Formatter
+	Redactor *Redactor
+}
+
+// Format implements logrus.Formatter.
+func (f *Formatter) Format(entry *logrus.Entry) ([]byte, error) {
+	b, err := f.Next.Format(entry)
+	if err != nil {
+		return nil, err
+	}
+	return f.Redactor.Bytes(b), nil
+}
+
+// InstallLogrus adds the Hook to logger and wraps its formatter in a
+// Formatter.
+func InstallLogrus(logger *logrus.Logger, r *Redactor) {
+	logger.AddHook(Hook{Redactor: r})
+	logger.SetFormatter(&Formatter{Next: logger.Formatter, Redactor: r})
+}
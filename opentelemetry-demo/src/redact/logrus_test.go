@@ -0,0 +1,42 @@
+package redact
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestInstallLogrus(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = &logrus.JSONFormatter{}
+	InstallLogrus(logger, Must(DefaultRules()))
+
+	fields := logrus.Fields{
+		"email":         "someone@example.com",
+		"cvv":           672,
+		"card":          "4432 8015 6152 0454",
+		logrus.ErrorKey: errors.New("declined card 4432801561520454"),
+	}
+	entry := logger.WithFields(fields)
+	entry.Infof("order confirmation sent to %s", "other@example.org")
+
+	got := out.String()
+	for _, secret := range []string{"someone@", "other@", "672", "8015", "4432"} {
+		if strings.Contains(got, secret) {
+			t.Errorf("log output %s contains %q", got, secret)
+		}
+	}
+	for _, want := range []string{"s***@example.com", "o***@example.org", "****0454", `"cvv":"[REDACTED]"`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("log output %s does not contain %q", got, want)
+		}
+	}
+	if entry.Data["email"] != "someone@example.com" {
+		t.Error("the hook changed the fields of the caller's entry")
+	}
+}
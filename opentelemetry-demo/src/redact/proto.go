@@ -0,0 +1,65 @@
+package redact
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Proto returns a copy of m with sensitive fields masked, leaving m itself
+// untouched. String fields named by a rule key are masked with the rule's
+// mask, other fields named by one are cleared, and every other string is
+// searched for pattern matches. Nested messages, lists and maps are masked
+// too, so a PlaceOrderRequest comes out with the card number reduced to its
+// last four digits, no CVV, a masked email and no street address.
+func (r *Redactor) Proto(m proto.Message) proto.Message {
+	if r == nil || m == nil {
+		return m
+	}
+	out := proto.Clone(m)
+	r.message(out.ProtoReflect())
+	return out
+}
+
+func (r *Redactor) message(m protoreflect.Message) {
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if c := r.ruleForKey(string(fd.Name())); c != nil {
+			if fd.Kind() == protoreflect.StringKind && !fd.IsList() && !fd.IsMap() {
+				m.Set(fd, protoreflect.ValueOfString(mask(c.Mask, v.String())))
+			} else {
+				m.Clear(fd)
+			}
+			return true
+		}
+
+		switch {
+		case fd.IsList():
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				if fd.Kind() == protoreflect.StringKind {
+					list.Set(i, protoreflect.ValueOfString(r.String(list.Get(i).String())))
+				} else if isMessage(fd) {
+					r.message(list.Get(i).Message())
+				}
+			}
+		case fd.IsMap():
+			mv := v.Map()
+			mv.Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+				if fd.MapValue().Kind() == protoreflect.StringKind {
+					mv.Set(k, protoreflect.ValueOfString(r.KeyValue(k.String(), v.String())))
+				} else if isMessage(fd.MapValue()) {
+					r.message(v.Message())
+				}
+				return true
+			})
+		case fd.Kind() == protoreflect.StringKind:
+			m.Set(fd, protoreflect.ValueOfString(r.String(v.String())))
+		case isMessage(fd):
+			r.message(v.Message())
+		}
+		return true
+	})
+}
+
+func isMessage(fd protoreflect.FieldDescriptor) bool {
+	return fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind
+}
@@ -0,0 +1,122 @@
+package redact
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// orderRequestDescriptor describes a message shaped like the demo's
+// PlaceOrderRequest.
+func orderRequestDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string, repeated bool) *descriptorpb.FieldDescriptorProto {
+		label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+		if repeated {
+			label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+		}
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(number),
+			Type:   typ.Enum(),
+			Label:  label.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	const (
+		str = descriptorpb.FieldDescriptorProto_TYPE_STRING
+		i32 = descriptorpb.FieldDescriptorProto_TYPE_INT32
+		msg = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+	)
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("test.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("CreditCardInfo"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("credit_card_number", 1, str, "", false),
+					field("credit_card_cvv", 2, i32, "", false),
+					field("credit_card_expiration_year", 3, i32, "", false),
+				},
+			},
+			{
+				Name: proto.String("Address"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("street_address", 1, str, "", false),
+					field("city", 2, str, "", false),
+				},
+			},
+			{
+				Name: proto.String("PlaceOrderRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("user_id", 1, str, "", false),
+					field("address", 3, msg, ".test.Address", false),
+					field("email", 5, str, "", false),
+					field("credit_card", 6, msg, ".test.CreditCardInfo", false),
+					field("notes", 7, str, "", true),
+				},
+			},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file.Messages().ByName("PlaceOrderRequest")
+}
+
+func TestProto(t *testing.T) {
+	desc := orderRequestDescriptor(t)
+	req := dynamicpb.NewMessage(desc)
+	fields := desc.Fields()
+	card := dynamicpb.NewMessage(fields.ByName("credit_card").Message())
+	card.Set(card.Descriptor().Fields().ByName("credit_card_number"), protoreflect.ValueOfString("4432-8015-6152-0454"))
+	card.Set(card.Descriptor().Fields().ByName("credit_card_cvv"), protoreflect.ValueOfInt32(672))
+	card.Set(card.Descriptor().Fields().ByName("credit_card_expiration_year"), protoreflect.ValueOfInt32(2039))
+	address := dynamicpb.NewMessage(fields.ByName("address").Message())
+	address.Set(address.Descriptor().Fields().ByName("street_address"), protoreflect.ValueOfString("1600 Amphitheatre Parkway"))
+	address.Set(address.Descriptor().Fields().ByName("city"), protoreflect.ValueOfString("Mountain View"))
+	req.Set(fields.ByName("user_id"), protoreflect.ValueOfString("user-1"))
+	req.Set(fields.ByName("email"), protoreflect.ValueOfString("someone@example.com"))
+	req.Set(fields.ByName("credit_card"), protoreflect.ValueOfMessage(card))
+	req.Set(fields.ByName("address"), protoreflect.ValueOfMessage(address))
+	notes := req.Mutable(fields.ByName("notes")).List()
+	notes.Append(protoreflect.ValueOfString("call me at someone@example.com"))
+
+	masked := Must(DefaultRules()).Proto(req).ProtoReflect()
+
+	get := func(m protoreflect.Message, name protoreflect.Name) protoreflect.Value {
+		return m.Get(m.Descriptor().Fields().ByName(name))
+	}
+	maskedCard := get(masked, "credit_card").Message()
+	maskedAddress := get(masked, "address").Message()
+	for _, c := range []struct {
+		name      string
+		got, want any
+	}{
+		{"user_id", get(masked, "user_id").String(), "user-1"},
+		{"email", get(masked, "email").String(), "s***@example.com"},
+		{"credit_card_number", get(maskedCard, "credit_card_number").String(), "****0454"},
+		{"credit_card_cvv", get(maskedCard, "credit_card_cvv").Int(), int64(0)},
+		{"credit_card_expiration_year", get(maskedCard, "credit_card_expiration_year").Int(), int64(2039)},
+		{"street_address", get(maskedAddress, "street_address").String(), Redacted},
+		{"city", get(maskedAddress, "city").String(), "Mountain View"},
+		{"notes", get(masked, "notes").List().Get(0).String(), "call me at s***@example.com"},
+	} {
+		if c.got != c.want {
+			t.Errorf("%s = %v, want %v", c.name, c.got, c.want)
+		}
+	}
+
+	if got := get(card, "credit_card_number").String(); got != "4432-8015-6152-0454" {
+		t.Errorf("Proto() changed the original message: credit_card_number = %q", got)
+	}
+}
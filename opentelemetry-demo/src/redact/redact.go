@@ -0,0 +1,296 @@
+// Package redact masks sensitive data such as card numbers, emails, addresses
+// and credentials before it leaves a service in logs or traces. A Redactor
+// is built from a list of rules; each rule masks the values of matching keys,
+// such as a log field, span attribute or proto field, and every match of its
+// pattern in any string.
+package redact
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Mask is how a rule replaces the data it matches.
+type Mask string
+
+const (
+	// MaskFull replaces the value with "[REDACTED]". It is the default.
+	MaskFull Mask = "full"
+	// MaskLast4 keeps the last four digits or letters, as in "****0454".
+	MaskLast4 Mask = "last4"
+	// MaskEmail keeps the first letter and the domain, as in
+	// "s***@example.com".
+	MaskEmail Mask = "email"
+)
+
+// Redacted replaces values masked with MaskFull.
+const Redacted = "[REDACTED]"
+
+// Rule describes one kind of sensitive data.
+type Rule struct {
+	Name string `json:"name"`
+	// Keys are names whose whole value is masked. They match a key, or the
+	// last dot-separated segment of one, regardless of case, "_" and "-":
+	// "credit_card_number" matches "creditCardNumber" and
+	// "app.credit_card_number".
+	Keys []string `json:"keys"`
+	// Pattern is a regular expression whose matches are masked in every
+	// string.
+	Pattern string `json:"pattern"`
+	// Luhn limits pattern matches to digit sequences that pass the Luhn
+	// check, as card numbers do.
+	Luhn bool `json:"luhn"`
+	Mask Mask `json:"mask"`
+}
+
+// DefaultRules returns the rules used when no rules file is configured.
+func DefaultRules() []Rule {
+	return []Rule{
+		{
+			Name:    "card_number",
+			Keys:    []string{"credit_card_number", "card_number", "pan"},
+			Pattern: `\b(?:\d[ -]?){11,18}\d\b`,
+			Luhn:    true,
+			Mask:    MaskLast4,
+		},
+		{
+			Name: "card_security_code",
+			Keys: []string{"credit_card_cvv", "cvv", "cvc"},
+		},
+		{
+			Name:    "email",
+			Keys:    []string{"email"},
+			Pattern: `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+			Mask:    MaskEmail,
+		},
+		{
+			Name: "address",
+			Keys: []string{"street_address", "zip_code", "postal_code"},
+		},
+		{
+			Name: "credentials",
+			Keys: []string{"password", "password_hash", "secret", "jwt_secret", "token", "api_key", "authorization"},
+		},
+		{
+			Name:    "bearer_token",
+			Pattern: `(?i)bearer\s+[A-Za-z0-9._~+/=-]+`,
+		},
+		{
+			Name:    "jwt",
+			Pattern: `\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`,
+		},
+		{
+			Name:    "url_credentials",
+			Pattern: `[A-Za-z][A-Za-z0-9+.-]*://[^/\s:@]+:[^/\s@]+@`,
+		},
+	}
+}
+
+// Redactor applies a list of rules. It is safe for concurrent use; a nil
+// Redactor masks nothing.
+type Redactor struct {
+	keys     map[string]*rule
+	patterns []*rule
+}
+
+type rule struct {
+	Rule
+	re *regexp.Regexp
+}
+
+// New compiles rules, reporting every invalid one.
+func New(rules []Rule) (*Redactor, error) {
+	r := &Redactor{keys: make(map[string]*rule)}
+	var errs []error
+	for i, cfg := range rules {
+		c := &rule{Rule: cfg}
+		if c.Mask == "" {
+			c.Mask = MaskFull
+		}
+		switch c.Mask {
+		case MaskFull, MaskLast4, MaskEmail:
+		default:
+			errs = append(errs, fmt.Errorf("rules[%d] %q: unknown mask %q", i, cfg.Name, cfg.Mask))
+		}
+		if len(cfg.Keys) == 0 && cfg.Pattern == "" {
+			errs = append(errs, fmt.Errorf("rules[%d] %q: needs keys or a pattern", i, cfg.Name))
+		}
+		if cfg.Pattern != "" {
+			re, err := regexp.Compile(cfg.Pattern)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("rules[%d] %q: %w", i, cfg.Name, err))
+				continue
+			}
+			c.re = re
+			r.patterns = append(r.patterns, c)
+		}
+		for _, key := range cfg.Keys {
+			r.keys[normalizeKey(key)] = c
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("redact: invalid rules: %w", err)
+	}
+	return r, nil
+}
+
+// Must is New for rules known to be valid, such as DefaultRules. It panics
+// on an error.
+func Must(rules []Rule) *Redactor {
+	r, err := New(rules)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// RulesFileEnv names the environment variable FromEnv reads the rules file
+// from.
+const RulesFileEnv = "REDACTION_RULES_FILE"
+
+// FromEnv returns a Redactor for the JSON rules file named by
+// REDACTION_RULES_FILE, or for DefaultRules when it is not set. The file has
+// the form
+//
+//	{"extend_defaults": true, "rules": [{"name": "...", "keys": ["..."]}]}
+//
+// and replaces the default rules unless extend_defaults is set.
+func FromEnv() (*Redactor, error) {
+	path := os.Getenv(RulesFileEnv)
+	if path == "" {
+		return New(DefaultRules())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("redact: %w", err)
+	}
+	var file struct {
+		ExtendDefaults bool   `json:"extend_defaults"`
+		Rules          []Rule `json:"rules"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("redact: %s: %w", path, err)
+	}
+	rules := file.Rules
+	if file.ExtendDefaults {
+		rules = append(DefaultRules(), rules...)
+	}
+	return New(rules)
+}
+
+// normalizeKey lower-cases key and drops "_" and "-".
+func normalizeKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == '-' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(key))
+}
+
+// ruleForKey returns the rule that masks the values of key, or nil.
+func (r *Redactor) ruleForKey(key string) *rule {
+	if r == nil || len(r.keys) == 0 {
+		return nil
+	}
+	key = normalizeKey(key)
+	if c, ok := r.keys[key]; ok {
+		return c
+	}
+	if i := strings.LastIndexByte(key, '.'); i >= 0 {
+		return r.keys[key[i+1:]]
+	}
+	return nil
+}
+
+// SensitiveKey reports whether the values of key are masked.
+func (r *Redactor) SensitiveKey(key string) bool {
+	return r.ruleForKey(key) != nil
+}
+
+// String masks every match of a rule pattern in s.
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, c := range r.patterns {
+		if !c.re.MatchString(s) {
+			continue
+		}
+		s = c.re.ReplaceAllStringFunc(s, func(match string) string {
+			if c.Luhn && !luhnValid(match) {
+				return match
+			}
+			return mask(c.Mask, match)
+		})
+	}
+	return s
+}
+
+// Bytes is String for byte slices.
+func (r *Redactor) Bytes(b []byte) []byte {
+	if r == nil {
+		return b
+	}
+	return []byte(r.String(string(b)))
+}
+
+// KeyValue masks value as the value of key: entirely when a rule names
+// key, and otherwise every pattern match in it.
+func (r *Redactor) KeyValue(key, value string) string {
+	if c := r.ruleForKey(key); c != nil {
+		return mask(c.Mask, value)
+	}
+	return r.String(value)
+}
+
+func mask(m Mask, value string) string {
+	if value == "" {
+		return value
+	}
+	switch m {
+	case MaskLast4:
+		var last []rune
+		for i := len(value) - 1; i >= 0 && len(last) < 4; i-- {
+			if c := rune(value[i]); ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') {
+				last = append([]rune{c}, last...)
+			}
+		}
+		if len(last) < 4 {
+			return Redacted
+		}
+		return "****" + string(last)
+	case MaskEmail:
+		local, domain, ok := strings.Cut(value, "@")
+		if !ok || local == "" {
+			return Redacted
+		}
+		return local[:1] + "***@" + domain
+	}
+	return Redacted
+}
+
+// luhnValid reports whether the digits in s pass the Luhn checksum.
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n > 0 && sum%10 == 0
+}
@@ -0,0 +1,109 @@
+package redact
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// SpanProcessor hands ended spans to the next processor with their
+// attributes, event attributes and status description masked. Spans cannot
+// be changed once they end, so it wraps the processor that exports them:
+//
+//	sdktrace.WithSpanProcessor(redact.NewSpanProcessor(r, sdktrace.NewBatchSpanProcessor(exporter)))
+type SpanProcessor struct {
+	redactor *Redactor
+	next     sdktrace.SpanProcessor
+}
+
+var _ sdktrace.SpanProcessor = (*SpanProcessor)(nil)
+
+// NewSpanProcessor returns a SpanProcessor that masks spans for next.
+func NewSpanProcessor(r *Redactor, next sdktrace.SpanProcessor) *SpanProcessor {
+	return &SpanProcessor{redactor: r, next: next}
+}
+
+// OnStart implements sdktrace.SpanProcessor.
+func (p *SpanProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	p.next.OnStart(parent, s)
+}
+
+// OnEnd implements sdktrace.SpanProcessor.
+func (p *SpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	p.next.OnEnd(p.redactor.span(s))
+}
+
+// Shutdown implements sdktrace.SpanProcessor.
+func (p *SpanProcessor) Shutdown(ctx context.Context) error {
+	return p.next.Shutdown(ctx)
+}
+
+// ForceFlush implements sdktrace.SpanProcessor.
+func (p *SpanProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
+
+// redactedSpan is a ReadOnlySpan with masked attributes.
+type redactedSpan struct {
+	sdktrace.ReadOnlySpan
+	attrs  []attribute.KeyValue
+	events []sdktrace.Event
+	status sdktrace.Status
+}
+
+func (s redactedSpan) Attributes() []attribute.KeyValue { return s.attrs }
+func (s redactedSpan) Events() []sdktrace.Event         { return s.events }
+func (s redactedSpan) Status() sdktrace.Status          { return s.status }
+
+func (r *Redactor) span(s sdktrace.ReadOnlySpan) sdktrace.ReadOnlySpan {
+	if r == nil {
+		return s
+	}
+	out := redactedSpan{
+		ReadOnlySpan: s,
+		attrs:        r.Attributes(s.Attributes()),
+		status:       s.Status(),
+	}
+	out.status.Description = r.String(out.status.Description)
+	if events := s.Events(); len(events) > 0 {
+		out.events = make([]sdktrace.Event, len(events))
+		for i, e := range events {
+			e.Attributes = r.Attributes(e.Attributes)
+			out.events[i] = e
+		}
+	}
+	return out
+}
+
+// Attributes returns a copy of attrs with sensitive values masked. Values of
+// keys named by a rule are replaced, whatever their type.
+func (r *Redactor) Attributes(attrs []attribute.KeyValue) []attribute.KeyValue {
+	if r == nil || len(attrs) == 0 {
+		return attrs
+	}
+	out := make([]attribute.KeyValue, len(attrs))
+	for i, kv := range attrs {
+		out[i] = r.attribute(kv)
+	}
+	return out
+}
+
+func (r *Redactor) attribute(kv attribute.KeyValue) attribute.KeyValue {
+	key := string(kv.Key)
+	c := r.ruleForKey(key)
+	switch kv.Value.Type() {
+	case attribute.STRING:
+		return kv.Key.String(r.KeyValue(key, kv.Value.AsString()))
+	case attribute.STRINGSLICE:
+		values := kv.Value.AsStringSlice()
+		for i, v := range values {
+			values[i] = r.KeyValue(key, v)
+		}
+		return kv.Key.StringSlice(values)
+	}
+	if c != nil {
+		return kv.Key.String(Redacted)
+	}
+	return kv
+}
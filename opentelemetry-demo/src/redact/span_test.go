@@ -0,0 +1,48 @@
+package redact
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSpanProcessor(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(NewSpanProcessor(Must(DefaultRules()), recorder)))
+
+	_, span := tp.Tracer("test").Start(context.Background(), "PlaceOrder", trace.WithAttributes(
+		attribute.String("app.user.email", "someone@example.com"),
+		attribute.Int("app.payment.cvv", 672),
+		attribute.String("app.user.id", "user-1"),
+		attribute.StringSlice("app.notes", []string{"card 4432-8015-6152-0454"}),
+	))
+	span.AddEvent("error", trace.WithAttributes(attribute.String("exception.message", "failed to email someone@example.com")))
+	span.SetStatus(codes.Error, "card 4432801561520454 declined")
+	span.End()
+
+	ended := recorder.Ended()[0]
+	attrs := attribute.NewSet(ended.Attributes()...)
+	for key, want := range map[attribute.Key]string{
+		"app.user.email":  "s***@example.com",
+		"app.payment.cvv": Redacted,
+		"app.user.id":     "user-1",
+	} {
+		if v, _ := attrs.Value(key); v.Emit() != want {
+			t.Errorf("%s = %q, want %q", key, v.Emit(), want)
+		}
+	}
+	if v, _ := attrs.Value("app.notes"); v.AsStringSlice()[0] != "card ****0454" {
+		t.Errorf("app.notes = %q", v.AsStringSlice())
+	}
+	if got := ended.Events()[0].Attributes[0].Value.AsString(); got != "failed to email s***@example.com" {
+		t.Errorf("event attribute = %q", got)
+	}
+	if got := ended.Status().Description; got != "card ****0454 declined" {
+		t.Errorf("status description = %q", got)
+	}
+}
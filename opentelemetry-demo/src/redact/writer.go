@@ -0,0 +1,27 @@
+package redact
+
+import "io"
+
+// Writer masks every pattern match in what is written to it before passing
+// it on. It suits writers that get whole lines, such as the output of the
+// standard library logger:
+//
+//	log.SetOutput(redact.NewWriter(r, os.Stderr))
+type Writer struct {
+	redactor *Redactor
+	w        io.Writer
+}
+
+// NewWriter returns a Writer that writes to w.
+func NewWriter(r *Redactor, w io.Writer) *Writer {
+	return &Writer{redactor: r, w: w}
+}
+
+// Write implements io.Writer. It reports len(p) bytes written when the
+// masked data is written in full, since masking changes its length.
+func (w *Writer) Write(p []byte) (int, error) {
+	if _, err := w.w.Write(w.redactor.Bytes(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
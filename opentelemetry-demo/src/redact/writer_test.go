@@ -0,0 +1,16 @@
+package redact
+
+import (
+	"bytes"
+	"log"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	var out bytes.Buffer
+	logger := log.New(NewWriter(Must(DefaultRules()), &out), "", 0)
+	logger.Printf("login for someone@example.com")
+	if got := out.String(); got != "login for s***@example.com\n" {
+		t.Errorf("output = %q", got)
+	}
+}
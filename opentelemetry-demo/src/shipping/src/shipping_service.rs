@@ -5,7 +5,10 @@ use opentelemetry::trace::{FutureExt, SpanKind, TraceContextExt, Tracer};
 use opentelemetry::{global, propagation::Extractor, trace::Span, Context, KeyValue};
 use opentelemetry_semantic_conventions as semconv;
 use shop::shipping_service_server::ShippingService;
-use shop::{GetQuoteRequest, GetQuoteResponse, Money, ShipOrderRequest, ShipOrderResponse};
+use shop::{
+    CancelShipmentRequest, Empty, GetQuoteRequest, GetQuoteResponse, Money, ShipOrderRequest,
+    ShipOrderResponse,
+};
 use tonic::{Request, Response, Status};
 
 use log::*;
@@ -14,13 +17,14 @@ mod quote;
 use quote::create_quote_from_count;
 
 mod tracking;
-use tracking::create_tracking_id;
+use tracking::{create_tracking_id, is_tracking_id};
 
 const NANOS_MULTIPLE: i32 = 10000000i32;
 
 const RPC_SYSTEM_GRPC: &'static str = "grpc";
 const RPC_SERVICE_SHIPPING: &'static str = "oteldemo.ShippingService";
 const RPC_GRPC_STATUS_CODE_OK: i64 = 0;
+const RPC_GRPC_STATUS_CODE_INVALID_ARGUMENT: i64 = 3;
 const RPC_GRPC_STATUS_CODE_UNKNOWN: i64 = 2;
 
 pub mod shop {
@@ -151,12 +155,54 @@ impl ShippingService for ShippingServer {
         ));
         Ok(Response::new(ShipOrderResponse { tracking_id: tid }))
     }
+    async fn cancel_shipment(
+        &self,
+        request: Request<CancelShipmentRequest>,
+    ) -> Result<Response<Empty>, Status> {
+        debug!("CancelShipmentRequest: {:?}", request);
+
+        let parent_cx =
+            global::get_text_map_propagator(|prop| prop.extract(&MetadataMap(request.metadata())));
+        let tracer = global::tracer("shipping");
+        let mut span = tracer
+            .span_builder("oteldemo.ShippingService/CancelShipment")
+            .with_kind(SpanKind::Server)
+            .start_with_context(&tracer, &parent_cx);
+        span.set_attribute(KeyValue::new(semconv::trace::RPC_SYSTEM, RPC_SYSTEM_GRPC));
+        span.set_attribute(KeyValue::new(semconv::trace::RPC_SERVICE, RPC_SERVICE_SHIPPING));
+        span.set_attribute(KeyValue::new(semconv::trace::RPC_METHOD, "CancelShipment"));
+
+        let tid = request.into_inner().tracking_id;
+        span.set_attribute(KeyValue::new("app.shipping.tracking.id", tid.clone()));
+        if !is_tracking_id(&tid) {
+            span.set_attribute(KeyValue::new(
+                semconv::trace::RPC_GRPC_STATUS_CODE,
+                RPC_GRPC_STATUS_CODE_INVALID_ARGUMENT,
+            ));
+            return Err(Status::invalid_argument(format!(
+                "invalid tracking id {:?}",
+                tid
+            )));
+        }
+
+        // Shipments are not tracked past their creation, so there is nothing
+        // to stop; cancelling the same shipment twice succeeds both times.
+        info!("Shipment Cancelled: {}", tid);
+        span.add_event("Shipment cancelled".to_string(), vec![]);
+
+        span.set_attribute(KeyValue::new(
+            semconv::trace::RPC_GRPC_STATUS_CODE,
+            RPC_GRPC_STATUS_CODE_OK,
+        ));
+        Ok(Response::new(Empty {}))
+    }
 }
 
 #[cfg(test)]
 mod tests {
     use super::{
-        shop::shipping_service_server::ShippingService, shop::ShipOrderRequest, ShippingServer,
+        shop::shipping_service_server::ShippingService, shop::CancelShipmentRequest,
+        shop::ShipOrderRequest, ShippingServer,
     };
     use tonic::Request;
     use uuid::Uuid;
@@ -179,4 +225,34 @@ mod tests {
             Err(e) => panic!("error when making request for tracking ID: {}", e),
         }
     }
+
+    #[tokio::test]
+    async fn can_cancel_shipment() {
+        let server = ShippingServer::default();
+
+        let tracking_id = server
+            .ship_order(Request::new(ShipOrderRequest::default()))
+            .await
+            .expect("error when making request for tracking ID")
+            .into_inner()
+            .tracking_id;
+        for _ in 0..2 {
+            if let Err(e) = server
+                .cancel_shipment(Request::new(CancelShipmentRequest {
+                    tracking_id: tracking_id.clone(),
+                }))
+                .await
+            {
+                panic!("error when cancelling shipment: {}", e);
+            }
+        }
+
+        match server
+            .cancel_shipment(Request::new(CancelShipmentRequest::default()))
+            .await
+        {
+            Ok(_) => panic!("cancelled a shipment without a tracking ID"),
+            Err(e) => assert_eq!(e.code(), tonic::Code::InvalidArgument),
+        }
+    }
 }
@@ -7,3 +7,8 @@ use uuid::Uuid;
 pub fn create_tracking_id() -> String {
     Uuid::new_v4().to_string()
 }
+
+/// reports whether id is a tracking ID returned by create_tracking_id
+pub fn is_tracking_id(id: &str) -> bool {
+    Uuid::parse_str(id).is_ok()
+}
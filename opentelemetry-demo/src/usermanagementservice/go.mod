@@ -7,6 +7,8 @@ toolchain go1.22.1
 require (
 	github.com/DATA-DOG/go-sqlmock v1.5.2
 	github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/db/postgres v0.0.0-00010101000000-000000000000
+	github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/health v0.0.0-00010101000000-000000000000
+	github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/redact v0.0.0-00010101000000-000000000000
 	github.com/golang-jwt/jwt v3.2.2+incompatible
 	github.com/lib/pq v1.10.9
 	github.com/stretchr/testify v1.10.0
@@ -29,6 +31,7 @@ require (
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/grpc-ecosystem/grpc-gateway/v2 v2.19.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/sirupsen/logrus v1.9.3 // indirect
 	go.opentelemetry.io/auto/sdk v1.1.0 // indirect
 	go.opentelemetry.io/otel/exporters/otlp/otlptrace v1.24.0 // indirect
 	go.opentelemetry.io/otel/metric v1.35.0 // indirect
@@ -42,3 +45,7 @@ require (
 )
 
 replace github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/db/postgres => ../db/postgres
+
+replace github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/health => ../health
+
+replace github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/redact => ../redact
@@ -27,10 +27,10 @@ import (
 	"google.golang.org/grpc/reflection"
 
 	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/db/postgres"
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/health"
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/redact"
 	pb "github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/usermanagementservice/genproto/oteldemo"
-	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/health/grpc_health_v1"
-	"google.golang.org/grpc/status"
 )
 
 // Variables for dependency injection in tests
@@ -63,17 +63,13 @@ const (
 	defaultPort = "8082"
 )
 
-// HealthChecker implements the gRPC health check service
-type HealthChecker struct {
-	grpc_health_v1.UnimplementedHealthServer
-}
-
-func (s *HealthChecker) Check(ctx context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
-	return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
-}
-
-func (s *HealthChecker) Watch(req *grpc_health_v1.HealthCheckRequest, ws grpc_health_v1.Health_WatchServer) error {
-	return status.Errorf(codes.Unimplemented, "health check via Watch not implemented")
+// newHealthRegistry creates the health registry of the service, which is
+// ready while the database answers pings
+func newHealthRegistry(db *sql.DB) *health.Registry {
+	registry := health.NewRegistry(pb.UserManagementService_ServiceDesc.ServiceName)
+	registry.Logf = log.Printf
+	registry.Register("database", db.PingContext)
+	return registry
 }
 
 // UserManagementServiceServer combines the AuthHandler with the Health method
@@ -100,7 +96,7 @@ func (s *UserManagementServiceServer) Health(ctx context.Context, req *pb.Health
 	}, nil
 }
 
-func initTracer() *sdktrace.TracerProvider {
+func initTracer(redactor *redact.Redactor) *sdktrace.TracerProvider {
 	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
 	if endpoint == "" {
 		endpoint = "otel-collector:4317"
@@ -124,7 +120,7 @@ func initTracer() *sdktrace.TracerProvider {
 	}
 
 	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSpanProcessor(redact.NewSpanProcessor(redactor, sdktrace.NewBatchSpanProcessor(exporter))),
 		sdktrace.WithResource(res),
 	)
 	otel.SetTracerProvider(tp)
@@ -145,8 +141,15 @@ func main() {
 		port = port[1:]
 	}
 
+	// Mask sensitive data, such as emails and passwords, in logs and spans
+	redactor, err := redact.FromEnv()
+	if err != nil {
+		logFatalf("failed to load redaction rules: %v", err)
+	}
+	log.SetOutput(redact.NewWriter(redactor, os.Stderr))
+
 	// Initialize tracer
-	tp := initTracer()
+	tp := initTracer(redactor)
 	defer func() {
 		if err := tp.Shutdown(context.Background()); err != nil {
 			log.Printf("Error shutting down tracer provider: %v", err)
@@ -168,7 +171,7 @@ func main() {
 
 	// Create handlers
 	authHandler := handlers.NewAuthHandler(db, tracer, []byte(jwtSecret))
-	healthChecker := &HealthChecker{}
+	healthRegistry := newHealthRegistry(db)
 
 	// Create the combined service server
 	userManagementServer := &UserManagementServiceServer{
@@ -189,9 +192,14 @@ func main() {
 
 	// Register services
 	pb.RegisterUserManagementServiceServer(grpcServer, userManagementServer)
-	grpc_health_v1.RegisterHealthServer(grpcServer, healthChecker)
+	grpc_health_v1.RegisterHealthServer(grpcServer, healthRegistry)
 	reflection.Register(grpcServer)
 
+	// Probe the database until the service shuts down
+	healthCtx, stopHealth := context.WithCancel(context.Background())
+	defer stopHealth()
+	go healthRegistry.Run(healthCtx)
+
 	// Start server
 	log.Printf("user management service listening on port %s", port)
 	go func() {
@@ -206,5 +214,6 @@ func main() {
 	<-sigCh
 
 	log.Println("Shutting down user management service...")
+	healthRegistry.Drain()
 	grpcServer.GracefulStop()
 }
@@ -7,28 +7,63 @@ import (
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/health"
 	pb "github.com/MichaelRobotics/Kubernetes/opentelemetry-demo/src/usermanagementservice/genproto/oteldemo"
 	"github.com/stretchr/testify/assert"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
-func TestHealthChecker_Check(t *testing.T) {
-	healthChecker := &HealthChecker{}
+func TestHealthRegistry_DatabaseUp(t *testing.T) {
+	mockDB, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	assert.NoError(t, err)
+	defer mockDB.Close()
+	mock.ExpectPing()
 
-	resp, err := healthChecker.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	registry := newHealthRegistry(mockDB)
+	registry.Update(context.Background())
+
+	for _, name := range []string{"", pb.UserManagementService_ServiceDesc.ServiceName, "database", health.Liveness} {
+		resp, err := registry.Check(context.Background(), &healthpb.HealthCheckRequest{Service: name})
+		assert.NoError(t, err)
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status, name)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
 
+func TestHealthRegistry_DatabaseDown(t *testing.T) {
+	mockDB, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	assert.NoError(t, err)
+	defer mockDB.Close()
+	mock.ExpectPing().WillReturnError(fmt.Errorf("connection refused"))
+
+	registry := newHealthRegistry(mockDB)
+	registry.Update(context.Background())
+
+	for _, name := range []string{"", pb.UserManagementService_ServiceDesc.ServiceName, "database"} {
+		resp, err := registry.Check(context.Background(), &healthpb.HealthCheckRequest{Service: name})
+		assert.NoError(t, err)
+		assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, resp.Status, name)
+	}
+
+	// A failing database must not get the process restarted
+	resp, err := registry.Check(context.Background(), &healthpb.HealthCheckRequest{Service: health.Liveness})
 	assert.NoError(t, err)
-	assert.NotNil(t, resp)
 	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
 }
 
-func TestHealthChecker_Watch(t *testing.T) {
-	healthChecker := &HealthChecker{}
+func TestHealthRegistry_Drain(t *testing.T) {
+	mockDB, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	assert.NoError(t, err)
+	defer mockDB.Close()
+	mock.ExpectPing()
 
-	err := healthChecker.Watch(&healthpb.HealthCheckRequest{}, nil)
+	registry := newHealthRegistry(mockDB)
+	registry.Update(context.Background())
+	registry.Drain()
 
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "not implemented")
+	resp, err := registry.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, resp.Status)
 }
 
 func TestUserManagementServiceServer_Health(t *testing.T) {